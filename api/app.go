@@ -172,15 +172,31 @@ func appList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if status, ok := r.URL.Query()["status"]; ok {
 		filter.Statuses = status
 	}
-	contexts := permission.ContextsForPermission(t, permission.PermAppRead)
+	perms, err := t.Permissions()
+	if err != nil {
+		return err
+	}
+	contexts := permission.CandidateContextsFromListForPermission(perms, permission.PermAppRead)
 	if len(contexts) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return nil
 	}
-	apps, err := app.List(appFilterByContext(contexts, filter))
+	dbApps, err := app.List(appFilterByContext(contexts, filter))
 	if err != nil {
 		return err
 	}
+	var apps []app.App
+	for _, a := range dbApps {
+		allowed := permission.CheckFromPermList(perms, permission.PermAppRead,
+			append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)...,
+		)
+		if allowed {
+			apps = append(apps, a)
+		}
+	}
 	if len(apps) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return nil
@@ -400,6 +416,7 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		Kind:       permission.PermAppUpdate,
 		Owner:      t,
 		CustomData: formToEvents(r.Form),
+		Cancelable: true,
 	})
 	if err != nil {
 		return err
@@ -409,7 +426,8 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	defer keepAliveWriter.Stop()
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	err = a.Update(updateData, writer)
+	evt.SetLogWriter(writer)
+	err = a.Update(updateData, evt)
 	if err == app.ErrPlanNotFound {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
@@ -800,15 +818,19 @@ func getEnv(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 
 func writeEnvVars(w http.ResponseWriter, a *app.App, variables ...string) error {
 	var result []bind.EnvVar
+	envs, err := a.Envs()
+	if err != nil {
+		return err
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if len(variables) > 0 {
 		for _, variable := range variables {
-			if v, ok := a.Env[variable]; ok {
+			if v, ok := envs[variable]; ok {
 				result = append(result, v)
 			}
 		}
 	} else {
-		for _, v := range a.Env {
+		for _, v := range envs {
 			result = append(result, v)
 		}
 	}
@@ -854,11 +876,15 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if err != nil {
 		return err
 	}
+	envNames := make([]string, len(e.Envs))
+	for i, env := range e.Envs {
+		envNames[i] = env.Name
+	}
 	allowed := permission.Check(t, permission.PermAppUpdateEnvSet,
-		append(permission.Contexts(permission.CtxTeam, a.Teams),
+		append(append(permission.Contexts(permission.CtxTeam, a.Teams),
 			permission.Context(permission.CtxApp, a.Name),
 			permission.Context(permission.CtxPool, a.Pool),
-		)...,
+		), permission.Attributes("env", envNames)...)...,
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
@@ -918,10 +944,10 @@ func unsetEnv(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		return err
 	}
 	allowed := permission.Check(t, permission.PermAppUpdateEnvUnset,
-		append(permission.Contexts(permission.CtxTeam, a.Teams),
+		append(append(permission.Contexts(permission.CtxTeam, a.Teams),
 			permission.Context(permission.CtxApp, a.Name),
 			permission.Context(permission.CtxPool, a.Pool),
-		)...,
+		), permission.Attributes("env", variables)...)...,
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
@@ -1307,6 +1333,7 @@ func restart(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 		Kind:       permission.PermAppUpdateRestart,
 		Owner:      t,
 		CustomData: formToEvents(r.Form),
+		Cancelable: true,
 	})
 	if err != nil {
 		return err
@@ -1316,7 +1343,8 @@ func restart(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
 	defer keepAliveWriter.Stop()
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	return a.Restart(process, writer)
+	evt.SetLogWriter(writer)
+	return a.Restart(process, evt)
 }
 
 // title: app sleep
@@ -72,6 +72,42 @@ func (s *S) TestAppListFilteringByPlatform(c *check.C) {
 	}
 }
 
+func (s *S) TestAppListWithDeniedTeam(c *check.C) {
+	team := auth.Team{Name: "angra"}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&app1, s.user)
+	c.Assert(err, check.IsNil)
+	app2 := app.App{Name: "app2", Platform: "zend", TeamOwner: team.Name}
+	err = app.CreateApp(&app2, s.user)
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("deny-read", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.read")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, team.Name)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	apps := []app.App{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &apps)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, app1.Name)
+}
+
 func (s *S) TestAppListFilteringByTeamOwner(c *check.C) {
 	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&app1, s.user)
@@ -2790,6 +2826,47 @@ func (s *S) TestSetEnvHandlerReturnsForbiddenIfTheGivenUserDoesNotHaveAccessToTh
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
 
+func (s *S) TestSetEnvHandlerReturnsForbiddenIfAVariableIsDenied(c *check.C) {
+	a := app.App{Name: "rock-and-roll", Platform: "zend", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	role, err := permission.NewRole("deny-db-envs", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.update.env.set")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{SchemeName: "app.update.env.set", Deny: true, Attribute: "env", Values: []string{"DB_*"}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateEnvSet,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, "")
+	c.Assert(err, check.IsNil)
+	d := Envs{
+		Envs: []struct{ Name, Value string }{
+			{"PORT", "8888"},
+			{"DB_PASSWORD", "secret"},
+		},
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env, check.HasLen, 0)
+}
+
 func (s *S) TestUnsetEnv(c *check.C) {
 	a := app.App{
 		Name:     "swift",
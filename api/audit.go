@@ -0,0 +1,80 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/audit"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func auditFilterFromRequest(r *http.Request) (*audit.Filter, error) {
+	r.ParseForm()
+	filter := &audit.Filter{}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	err := dec.DecodeValues(&filter, r.Form)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse audit filters: %s", err)}
+	}
+	return filter, nil
+}
+
+// title: audit log list
+// path: /audit
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid filter
+//   401: Unauthorized
+func auditList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermAuditRead) {
+		return permission.ErrUnauthorized
+	}
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		return err
+	}
+	filter.PruneUserValues()
+	entries, err := audit.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// title: audit log export
+// path: /audit/export
+// method: GET
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   400: Invalid filter
+//   401: Unauthorized
+func auditExport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermAuditRead) {
+		return permission.ErrUnauthorized
+	}
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	return audit.Export(w, filter)
+}
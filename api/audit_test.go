@@ -0,0 +1,86 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/audit"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAuditListRecordsMutations(c *check.C) {
+	request, err := http.NewRequest("POST", "/teams", strings.NewReader("name=audited"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	request, err = http.NewRequest("GET", "/audit?method=POST", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var entries []audit.Entry
+	err = json.NewDecoder(recorder.Body).Decode(&entries)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].Path, check.Equals, "/teams")
+	c.Assert(entries[0].Owner, check.Equals, s.token.GetUserName())
+	c.Assert(entries[0].StatusCode, check.Equals, http.StatusCreated)
+}
+
+func (s *S) TestAuditListNoContent(c *check.C) {
+	request, err := http.NewRequest("GET", "/audit", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAuditListForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/audit", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAuditExport(c *check.C) {
+	for _, owner := range []string{"a@a.com", "b@b.com"} {
+		err := audit.Record(&audit.Entry{OwnerType: audit.OwnerTypeUser, Owner: owner, Method: "POST", Path: "/apps"})
+		c.Assert(err, check.IsNil)
+	}
+	request, err := http.NewRequest("GET", "/audit/export?owner=b@b.com", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	c.Assert(lines, check.HasLen, 1)
+	var entry audit.Entry
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.Owner, check.Equals, "b@b.com")
+}
@@ -311,6 +311,85 @@ func removeTeam(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	return nil
 }
 
+// title: set team parent
+// path: /teams/{name}/parent
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Team parent updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+//   409: Team cycle
+func setTeamParent(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	parent := r.FormValue("parent")
+	if parent == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "parent team is required"}
+	}
+	allowed := permission.Check(t, permission.PermTeamUpdateParent,
+		permission.Context(permission.CtxTeam, name),
+	) && permission.Check(t, permission.PermTeamUpdateParent,
+		permission.Context(permission.CtxTeam, parent),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateParent,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return teamParentError(name, auth.SetTeamParent(name, parent))
+}
+
+// title: unset team parent
+// path: /teams/{name}/parent
+// method: DELETE
+// responses:
+//   200: Team parent removed
+//   401: Unauthorized
+//   404: Team not found
+func unsetTeamParent(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateParent,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateParent,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return teamParentError(name, auth.SetTeamParent(name, ""))
+}
+
+func teamParentError(name string, err error) error {
+	switch err {
+	case auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
+	case auth.ErrParentTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case auth.ErrTeamParentCycle:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
 // title: team list
 // path: /teams
 // method: GET
@@ -326,11 +405,13 @@ func teamList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	teamsMap := map[string][]string{}
+	parents := map[string]string{}
 	perms, err := t.Permissions()
 	if err != nil {
 		return err
 	}
 	for _, team := range teams {
+		parents[team.Name] = team.Parent
 		teamCtx := permission.Context(permission.CtxTeam, team.Name)
 		var parent *permission.PermissionScheme
 		for _, p := range permsForTeam {
@@ -349,10 +430,14 @@ func teamList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	var result []map[string]interface{}
 	for name, permissions := range teamsMap {
-		result = append(result, map[string]interface{}{
+		teamData := map[string]interface{}{
 			"name":        name,
 			"permissions": permissions,
-		})
+		}
+		if parents[name] != "" {
+			teamData["parent"] = parents[name]
+		}
+		result = append(result, teamData)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(result)
@@ -542,9 +627,13 @@ func authScheme(w http.ResponseWriter, r *http.Request) error {
 // responses:
 //   200: OK
 //   401: Unauthorized
+//   403: Forbidden
 //   404: User not found
 func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	r.ParseForm()
+	if err = checkNotPersonalToken(t); err != nil {
+		return err
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
@@ -584,8 +673,12 @@ func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (e
 // responses:
 //   200: OK
 //   401: Unauthorized
+//   403: Forbidden
 //   404: User not found
 func showAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if err := checkNotPersonalToken(t); err != nil {
+		return err
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
@@ -628,6 +721,9 @@ func createAPIUser(perms []permission.Permission, user *auth.User, roleMap map[s
 	}
 	allGlobal := true
 	for _, userRole := range user.Roles {
+		if userRole.IsExpired() {
+			continue
+		}
 		role := roleMap[userRole.Name]
 		if role == nil {
 			r, err := permission.FindRole(userRole.Name)
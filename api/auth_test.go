@@ -660,6 +660,150 @@ func (s *AuthSuite) TestListTeamsReturns204IfTheUserHasNoTeam(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
 }
 
+func (s *AuthSuite) TestListTeamsIncludesChildTeams(c *check.C) {
+	err := auth.SetTeamParent(s.team2.Name, s.team.Name)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/teams", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var m []map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &m)
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.HasLen, 2)
+	teams := map[string]map[string]interface{}{}
+	for _, t := range m {
+		teams[t["name"].(string)] = t
+	}
+	c.Assert(teams[s.team.Name]["parent"], check.IsNil)
+	c.Assert(teams[s.team2.Name]["parent"], check.Equals, s.team.Name)
+	c.Assert(teams[s.team2.Name]["permissions"], check.DeepEquals, []interface{}{"app.create"})
+}
+
+func (s *AuthSuite) TestSetTeamParent(c *check.C) {
+	body := strings.NewReader("parent=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/teams/"+s.team2.Name+"/parent", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team2.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Parent, check.Equals, s.team.Name)
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team2.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update.parent",
+		StartCustomData: []map[string]interface{}{
+			{"name": "parent", "value": s.team.Name},
+			{"name": ":name", "value": s.team2.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestSetTeamParentRequiresPermissionInParent(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamUpdateParent,
+		Context: permission.Context(permission.CtxTeam, s.team2.Name),
+	})
+	body := strings.NewReader("parent=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/teams/"+s.team2.Name+"/parent", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	team, err := auth.GetTeam(s.team2.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Parent, check.Equals, "")
+}
+
+func (s *AuthSuite) TestSetTeamParentWithoutParent(c *check.C) {
+	request, err := http.NewRequest("POST", "/teams/"+s.team2.Name+"/parent", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "parent team is required\n")
+}
+
+func (s *AuthSuite) TestSetTeamParentNotFound(c *check.C) {
+	body := strings.NewReader("parent=unknown")
+	request, err := http.NewRequest("POST", "/teams/"+s.team2.Name+"/parent", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrParentTeamNotFound.Error()+"\n")
+}
+
+func (s *AuthSuite) TestSetTeamParentCycle(c *check.C) {
+	err := auth.SetTeamParent(s.team2.Name, s.team.Name)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("parent=" + s.team2.Name)
+	request, err := http.NewRequest("POST", "/teams/"+s.team.Name+"/parent", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrTeamParentCycle.Error()+"\n")
+}
+
+func (s *AuthSuite) TestUnsetTeamParent(c *check.C) {
+	err := auth.SetTeamParent(s.team2.Name, s.team.Name)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/teams/"+s.team2.Name+"/parent", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team2.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Parent, check.Equals, "")
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team2.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "team.update.parent",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team2.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestUnsetTeamParentNotFound(c *check.C) {
+	request, err := http.NewRequest("DELETE", "/teams/unknown/parent", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	mux := RunServer(true)
+	mux.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, "Team \"unknown\" not found.\n")
+}
+
 func (s *AuthSuite) TestAddKeyToUser(c *check.C) {
 	conn, err := db.Conn()
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,82 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// title: app auto rollback
+// path: /apps/{app}/auto-rollback
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Auto rollback changed
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppAutoRollback(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var autoRollback provision.AutoRollback
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"window", &autoRollback.Window},
+		{"max-restarts", &autoRollback.MaxRestarts},
+		{"max-errors", &autoRollback.MaxErrors},
+	}
+	for _, f := range fields {
+		value := r.FormValue(f.name)
+		if value == "" {
+			continue
+		}
+		*f.value, err = strconv.Atoi(value)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid %s: the number must be an integer.", f.name)
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	err = autoRollback.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoRollback,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateAutoRollback,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetAutoRollback(autoRollback)
+}
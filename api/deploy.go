@@ -97,6 +97,17 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			}
 		}
 	}
+	var dockerfile bool
+	dockerfileString := r.FormValue("dockerfile")
+	if dockerfileString != "" {
+		dockerfile, err = strconv.ParseBool(dockerfileString)
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+	}
 	message := r.FormValue("message")
 	if commit != "" && message == "" {
 		var messages []string
@@ -118,6 +129,7 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 		Image:      image,
 		Origin:     origin,
 		Build:      build,
+		Dockerfile: dockerfile,
 		Message:    message,
 	}
 	opts.GetKind()
@@ -284,6 +284,50 @@ func (s *DeploySuite) TestDeployArchiveURL(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *DeploySuite) TestDeployArchiveURLWithDockerfile(c *check.C) {
+	user, _ := s.token.User()
+	a := app.App{
+		Name:      "otherapp",
+		Plan:      app.Plan{Router: "fake"},
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("archive-url=http://something.tar.gz&dockerfile=true"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Archive deploy called\nOK\n")
+	c.Assert(s.provisioner.LastDockerfile(&a), check.Equals, true)
+}
+
+func (s *DeploySuite) TestDeployInvalidDockerfile(c *check.C) {
+	user, _ := s.token.User()
+	a := app.App{
+		Name:      "otherapp",
+		Plan:      app.Plan{Router: "fake"},
+		Platform:  "python",
+		TeamOwner: s.team.Name,
+	}
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("archive-url=http://something.tar.gz&dockerfile=maybe"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
 func (s *DeploySuite) TestDeployUploadFile(c *check.C) {
 	user, _ := s.token.User()
 	a := app.App{
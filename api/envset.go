@@ -0,0 +1,442 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func envSetTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeEnvSet, Value: name}
+}
+
+func envSetContext(set *app.EnvSet) permission.PermissionContext {
+	if set.Pool != "" {
+		return permission.Context(permission.CtxPool, set.Pool)
+	}
+	return permission.Context(permission.CtxTeam, set.Team)
+}
+
+func getEnvSet(name string) (*app.EnvSet, error) {
+	set, err := app.GetEnvSet(name)
+	if err == app.ErrEnvSetNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return set, err
+}
+
+type envSetInfo struct {
+	app.EnvSet
+	Apps []string `json:"apps"`
+}
+
+// title: env set list
+// path: /envsets
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func envSetList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	perms, err := t.Permissions()
+	if err != nil {
+		return err
+	}
+	contexts := permission.CandidateContextsFromListForPermission(perms, permission.PermEnvsetRead)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var teams, pools []string
+	global := false
+	for _, c := range contexts {
+		switch c.CtxType {
+		case permission.CtxGlobal:
+			global = true
+		case permission.CtxTeam:
+			teams = append(teams, c.Value)
+		case permission.CtxPool:
+			pools = append(pools, c.Value)
+		}
+	}
+	var query bson.M
+	if !global {
+		query = bson.M{"$or": []bson.M{
+			{"team": bson.M{"$in": teams}},
+			{"pool": bson.M{"$in": pools}},
+		}}
+	}
+	dbSets, err := app.ListEnvSets(query)
+	if err != nil {
+		return err
+	}
+	var sets []app.EnvSet
+	for i := range dbSets {
+		if permission.CheckFromPermList(perms, permission.PermEnvsetRead, envSetContext(&dbSets[i])) {
+			sets = append(sets, dbSets[i])
+		}
+	}
+	if len(sets) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(sets)
+}
+
+// title: env set create
+// path: /envsets
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Env set created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Env set already exists
+func envSetCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	set := app.EnvSet{
+		Name: r.FormValue("name"),
+		Team: r.FormValue("team"),
+		Pool: r.FormValue("pool"),
+	}
+	if (set.Team == "") == (set.Pool == "") {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: app.ErrEnvSetInvalidOwner.Error()}
+	}
+	allowed := permission.Check(t, permission.PermEnvsetCreate, envSetContext(&set))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     envSetTarget(set.Name),
+		Kind:       permission.PermEnvsetCreate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = set.Create()
+	if _, ok := err.(app.EnvSetValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err == app.ErrEnvSetAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: env set info
+// path: /envsets/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Env set not found
+func envSetInfoHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	set, err := getEnvSet(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermEnvsetRead, envSetContext(set))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	apps, err := set.Apps()
+	if err != nil {
+		return err
+	}
+	info := envSetInfo{EnvSet: *set, Apps: []string{}}
+	for _, a := range apps {
+		info.Apps = append(info.Apps, a.Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(info)
+}
+
+// title: env set remove
+// path: /envsets/{name}
+// method: DELETE
+// responses:
+//   200: Env set removed
+//   401: Unauthorized
+//   404: Env set not found
+//   412: Env set attached to apps
+func envSetRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	set, err := getEnvSet(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermEnvsetDelete, envSetContext(set))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     envSetTarget(set.Name),
+		Kind:       permission.PermEnvsetDelete,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.RemoveEnvSet(set.Name)
+	if err == app.ErrEnvSetInUse {
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	if err == app.ErrEnvSetNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: env set set envs
+// path: /envsets/{name}/env
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Envs updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Env set not found
+func envSetSetEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var e Envs
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&e, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if len(e.Envs) == 0 {
+		msg := "You must provide the list of environment variables"
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	set, err := getEnvSet(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	envNames := make([]string, len(e.Envs))
+	for i, env := range e.Envs {
+		envNames[i] = env.Name
+	}
+	allowed := permission.Check(t, permission.PermEnvsetUpdate,
+		append([]permission.PermissionContext{envSetContext(set)}, permission.Attributes("env", envNames)...)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     envSetTarget(set.Name),
+		Kind:       permission.PermEnvsetUpdate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	variables := []bind.EnvVar{}
+	for _, v := range e.Envs {
+		variables = append(variables, bind.EnvVar{Name: v.Name, Value: v.Value, Public: !e.Private})
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	return set.SetEnvs(variables, !e.NoRestart, writer)
+}
+
+// title: env set unset envs
+// path: /envsets/{name}/env
+// method: DELETE
+// produce: application/x-json-stream
+// responses:
+//   200: Envs removed
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Env set not found
+func envSetUnsetEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	variables := r.Form["env"]
+	if len(variables) == 0 {
+		msg := "You must provide the list of environment variables."
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	set, err := getEnvSet(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermEnvsetUpdate,
+		append([]permission.PermissionContext{envSetContext(set)}, permission.Attributes("env", variables)...)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     envSetTarget(set.Name),
+		Kind:       permission.PermEnvsetUpdate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	return set.UnsetEnvs(variables, !noRestart, writer)
+}
+
+// title: attach env set to app
+// path: /apps/{app}/envsets
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Env set attached
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or env set not found
+//   409: Env set already attached
+func appAttachEnvSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	setName := r.FormValue("envset")
+	if setName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the env set name."}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	set, err := getEnvSet(setName)
+	if err != nil {
+		return err
+	}
+	envNames := make([]string, 0, len(set.Envs))
+	for name := range set.Envs {
+		envNames = append(envNames, name)
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateEnvsetAttach,
+		append(append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		), permission.Attributes("env", envNames)...)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	allowed = permission.Check(t, permission.PermEnvsetRead, envSetContext(set))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateEnvsetAttach,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = a.AttachEnvSet(setName, !noRestart, writer)
+	switch err {
+	case app.ErrEnvSetAlreadyAttached:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case app.ErrEnvSetNotAllowed:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case app.ErrEnvSetNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: detach env set from app
+// path: /apps/{app}/envsets/{name}
+// method: DELETE
+// produce: application/x-json-stream
+// responses:
+//   200: Env set detached
+//   401: Unauthorized
+//   404: App not found or env set not attached
+func appDetachEnvSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateEnvsetDetach,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateEnvsetDetach,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = a.DetachEnvSet(r.URL.Query().Get(":name"), !noRestart, writer)
+	if err == app.ErrEnvSetNotAttached {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
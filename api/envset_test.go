@@ -0,0 +1,317 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestEnvSetCreate(c *check.C) {
+	body := strings.NewReader("name=tracing&team=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/envsets", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	set, err := app.GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(set.Team, check.Equals, s.team.Name)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeEnvSet, Value: "tracing"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "envset.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "tracing"},
+			{"name": "team", "value": s.team.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestEnvSetCreateInvalidOwner(c *check.C) {
+	body := strings.NewReader("name=tracing&team=t1&pool=p1")
+	request, err := http.NewRequest("POST", "/envsets", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrEnvSetInvalidOwner.Error()+"\n")
+}
+
+func (s *S) TestEnvSetCreateForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermEnvsetCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader("name=tracing&team=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/envsets", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestEnvSetList(c *check.C) {
+	for _, set := range []app.EnvSet{{Name: "s1", Team: s.team.Name}, {Name: "s2", Team: "otherteam"}} {
+		err := set.Create()
+		c.Assert(err, check.IsNil)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermEnvsetRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/envsets", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var sets []app.EnvSet
+	err = json.NewDecoder(recorder.Body).Decode(&sets)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Assert(sets[0].Name, check.Equals, "s1")
+}
+
+func (s *S) TestEnvSetInfo(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Teams: []string{s.team.Name}, EnvSets: []string{"tracing"}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/envsets/tracing", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var info envSetInfo
+	err = json.NewDecoder(recorder.Body).Decode(&info)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Name, check.Equals, "tracing")
+	c.Assert(info.Apps, check.DeepEquals, []string{"myapp"})
+}
+
+func (s *S) TestEnvSetRemoveInUse(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Teams: []string{s.team.Name}, EnvSets: []string{"tracing"}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/envsets/tracing", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestEnvSetSetEnvs(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	d := Envs{
+		Envs: []struct{ Name, Value string }{
+			{"TRACING_URL", "http://tracing"},
+		},
+		NoRestart: true,
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/envsets/tracing/env", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	dbSet, err := app.GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSet.Envs, check.DeepEquals, map[string]bind.EnvVar{
+		"TRACING_URL": {Name: "TRACING_URL", Value: "http://tracing", Public: true},
+	})
+}
+
+func (s *S) TestEnvSetSetEnvsDeniedVariable(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("deny-db-envs", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("envset.update")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{SchemeName: "envset.update", Deny: true, Attribute: "env", Values: []string{"DB_*"}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermEnvsetUpdate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, "")
+	c.Assert(err, check.IsNil)
+	d := Envs{
+		Envs: []struct{ Name, Value string }{
+			{"TRACING_URL", "http://tracing"},
+			{"DB_PASSWORD", "secret"},
+		},
+		NoRestart: true,
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/envsets/tracing/env", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	dbSet, err := app.GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSet.Envs, check.HasLen, 0)
+}
+
+func (s *S) TestAppAttachEnvSet(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name, Envs: map[string]bind.EnvVar{
+		"TRACING_URL": {Name: "TRACING_URL", Value: "http://tracing", Public: true},
+	}}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("envset=tracing&noRestart=true")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/envsets", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.DeepEquals, []string{"tracing"})
+	envs, err := dbApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["TRACING_URL"].Value, check.Equals, "http://tracing")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.envset.attach",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "envset", "value": "tracing"},
+			{"name": "noRestart", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAttachEnvSetNotAllowed(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: "otherteam"}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("envset=tracing")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/envsets", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAppAttachEnvSetDeniedVariable(c *check.C) {
+	set := app.EnvSet{Name: "database", Team: s.team.Name, Envs: map[string]bind.EnvVar{
+		"DB_PASSWORD": {Name: "DB_PASSWORD", Value: "secret"},
+	}}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("deny-db-envs", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.update.envset.attach")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{SchemeName: "app.update.envset.attach", Deny: true, Attribute: "env", Values: []string{"DB_*"}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateEnvsetAttach,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermEnvsetRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, "")
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("envset=database&noRestart=true")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/envsets", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.HasLen, 0)
+}
+
+func (s *S) TestAppDetachEnvSet(c *check.C) {
+	set := app.EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AttachEnvSet("tracing", false, nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("/apps/%s/envsets/tracing?noRestart=true", a.Name), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.HasLen, 0)
+}
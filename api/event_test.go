@@ -458,6 +458,33 @@ func (s *EventSuite) TestEventList(c *check.C) {
 	c.Assert(result, check.HasLen, 10)
 }
 
+func (s *EventSuite) TestEventListWithConditionalGrant(c *check.C) {
+	_, err := s.insertEvents("app", c)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "conditionaluser")
+	role, err := permission.NewRole("conditional-events", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.read.events")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{
+		SchemeName: "app.read.events",
+		Attribute:  "app",
+		Values:     []string{"app-1"},
+	})
+	c.Assert(err, check.IsNil)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, s.team.Name)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
 func (s *EventSuite) TestEventListFilterByTarget(c *check.C) {
 	_, err := s.insertEvents("app", c)
 	c.Assert(err, check.IsNil)
@@ -90,6 +90,78 @@ func machineDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	return m.Destroy()
 }
 
+// title: machine reconcile list
+// path: /iaas/reconcile
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   403: Forbidden
+func iaasReconcileList(w http.ResponseWriter, r *http.Request, token auth.Token) error {
+	contexts := permission.ContextsForPermission(token, permission.PermMachineRead)
+	var global bool
+	var iaasNames []string
+	for _, c := range contexts {
+		if c.CtxType == permission.CtxGlobal {
+			global = true
+			iaasNames = nil
+			break
+		}
+		if c.CtxType == permission.CtxIaaS {
+			iaasNames = append(iaasNames, c.Value)
+		}
+	}
+	if !global && len(iaasNames) == 0 {
+		return permission.ErrUnauthorized
+	}
+	drifts, err := reconcileIaaS(false, iaasNames...)
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(drifts)
+}
+
+// title: machine reconcile cleanup
+// path: /iaas/reconcile
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func iaasReconcileCleanup(w http.ResponseWriter, r *http.Request, token auth.Token) (err error) {
+	r.ParseForm()
+	iaasName := r.FormValue("iaas")
+	if iaasName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "iaas is required"}
+	}
+	allowed := permission.Check(token, permission.PermMachineDelete,
+		permission.Context(permission.CtxIaaS, iaasName),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
+		Kind:       permission.PermMachineDelete,
+		Owner:      token,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	drifts, err := reconcileIaaS(true, iaasName)
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(drifts)
+}
+
 // title: machine template list
 // path: /iaas/templates
 // method: GET
@@ -143,14 +215,18 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
+	resolved, err := paramTemplate.Resolve()
+	if err != nil {
+		return templateError(err)
+	}
 	allowed := permission.Check(token, permission.PermMachineTemplateCreate,
-		permission.Context(permission.CtxIaaS, paramTemplate.IaaSName),
+		permission.Context(permission.CtxIaaS, resolved.IaaSName),
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: paramTemplate.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: resolved.IaaSName},
 		Kind:       permission.PermMachineTemplateCreate,
 		Owner:      token,
 		CustomData: formToEvents(r.Form),
@@ -161,17 +237,25 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	defer func() { evt.Done(err) }()
 	err = paramTemplate.Save()
 	if err != nil {
-		return err
+		return templateError(err)
 	}
 	w.WriteHeader(http.StatusCreated)
 	return nil
 }
 
+func templateError(err error) error {
+	if _, ok := err.(*iaas.TemplateError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
 // title: template destroy
 // path: /iaas/templates/{template_name}
 // method: DELETE
 // responses:
 //   200: OK
+//   400: Template extended by other templates
 //   401: Unauthorized
 //   404: Not found
 func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (err error) {
@@ -200,7 +284,7 @@ func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (
 		return err
 	}
 	defer func() { evt.Done(err) }()
-	return iaas.DestroyTemplate(templateName)
+	return templateError(iaas.DestroyTemplate(templateName))
 }
 
 // title: template update
@@ -248,5 +332,5 @@ func templateUpdate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 		return err
 	}
 	defer func() { evt.Done(err) }()
-	return dbTpl.Update(&paramTemplate)
+	return templateError(dbTpl.Update(&paramTemplate))
 }
@@ -0,0 +1,176 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const (
+	iaasDriftEventKind   = "iaas.drift"
+	iaasCleanupEventKind = "iaas.cleanup"
+)
+
+// iaasReconciler periodically compares the machines stored by tsuru with the
+// machines running in the IaaSs and with the provisioner nodes, registering
+// an internal event for each IaaS with drift. When autoCleanup is set,
+// cleanable drift is fixed as soon as it's found.
+type iaasReconciler struct {
+	interval    time.Duration
+	autoCleanup bool
+	done        chan bool
+}
+
+// newIaaSReconciler returns nil when the reconciler is disabled, which is the
+// default.
+func newIaaSReconciler() *iaasReconciler {
+	interval, _ := config.GetInt("iaas:reconcile:interval")
+	if interval <= 0 {
+		return nil
+	}
+	autoCleanup, _ := config.GetBool("iaas:reconcile:auto-cleanup")
+	return &iaasReconciler{
+		interval:    time.Duration(interval) * time.Second,
+		autoCleanup: autoCleanup,
+		done:        make(chan bool),
+	}
+}
+
+func (r *iaasReconciler) run() {
+	for {
+		err := r.runOnce()
+		if err != nil {
+			log.Errorf("[iaas reconciler] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *iaasReconciler) runOnce() (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = fmt.Errorf("recovered panic: %v", rec)
+		}
+	}()
+	drifts, err := reconcileIaaS(false)
+	if err != nil {
+		return err
+	}
+	var names []string
+	byIaaS := map[string][]iaas.Drift{}
+	for _, d := range drifts {
+		if _, ok := byIaaS[d.IaaS]; !ok {
+			names = append(names, d.IaaS)
+		}
+		byIaaS[d.IaaS] = append(byIaaS[d.IaaS], d)
+	}
+	for _, name := range names {
+		if r.autoCleanup && hasCleanableDrift(byIaaS[name]) {
+			cleaned, cleanErr := cleanupIaaS(name)
+			if cleanErr != nil {
+				log.Errorf("[iaas reconciler] unable to clean up IaaS %q: %s", name, cleanErr)
+			} else if cleaned != nil {
+				byIaaS[name] = cleaned
+			}
+		}
+		err = registerIaaSDrift(name, byIaaS[name])
+		if err != nil {
+			log.Errorf("[iaas reconciler] unable to register drift in IaaS %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func registerIaaSDrift(iaasName string, drifts []iaas.Drift) error {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeIaas, Value: iaasName},
+		InternalKind: iaasDriftEventKind,
+		DisableLock:  true,
+		CustomData:   map[string]interface{}{"drifts": drifts},
+	})
+	if err != nil {
+		return err
+	}
+	return evt.Done(nil)
+}
+
+func hasCleanableDrift(drifts []iaas.Drift) bool {
+	for _, d := range drifts {
+		if d.Cleanable() {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupIaaS reconciles the IaaS again and cleans up its drift holding the
+// lock of the IaaS, the same lock held by users cleaning it up, so the drift
+// isn't cleaned up twice by other API instances. It returns nil drift when
+// the IaaS is already locked.
+func cleanupIaaS(iaasName string) ([]iaas.Drift, error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeIaas, Value: iaasName},
+		InternalKind: iaasCleanupEventKind,
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	drifts, err := reconcileIaaS(true, iaasName)
+	evt.DoneCustomData(err, map[string]interface{}{"drifts": drifts})
+	return drifts, err
+}
+
+// reconcileIaaS returns the drift found in the given IaaSs, or in every IaaS
+// when none is given, cleaning up cleanable drift when cleanup is set.
+func reconcileIaaS(cleanup bool, iaasNames ...string) ([]iaas.Drift, error) {
+	var nodes []iaas.Node
+	if nodeProvisioner, ok := app.Provisioner.(provision.NodeProvisioner); ok {
+		provNodes, err := nodeProvisioner.ListNodes(nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range provNodes {
+			nodes = append(nodes, iaas.Node{Address: n.Address(), Metadata: n.Metadata()})
+		}
+	}
+	drifts, err := iaas.Reconcile(nodes, iaasNames...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]iaas.Drift, 0, len(drifts))
+	for _, d := range drifts {
+		if cleanup && d.Cleanable() {
+			err = d.Cleanup()
+			if err != nil {
+				log.Errorf("[iaas reconciler] unable to clean up %s: %s", d.String(), err)
+			}
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+func (r *iaasReconciler) Shutdown() {
+	r.done <- true
+}
+
+func (r *iaasReconciler) String() string {
+	return "iaas reconciler"
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestNewIaaSReconcilerDisabledByDefault(c *check.C) {
+	c.Assert(newIaaSReconciler(), check.IsNil)
+	config.Set("iaas:reconcile:interval", 0)
+	defer config.Unset("iaas:reconcile:interval")
+	c.Assert(newIaaSReconciler(), check.IsNil)
+}
+
+func (s *S) TestNewIaaSReconciler(c *check.C) {
+	config.Set("iaas:reconcile:interval", 120)
+	defer config.Unset("iaas:reconcile:interval")
+	config.Set("iaas:reconcile:auto-cleanup", true)
+	defer config.Unset("iaas:reconcile:auto-cleanup")
+	reconciler := newIaaSReconciler()
+	c.Assert(reconciler, check.NotNil)
+	c.Assert(reconciler.interval, check.Equals, 2*time.Minute)
+	c.Assert(reconciler.autoCleanup, check.Equals, true)
+}
+
+func (s *S) TestIaaSReconcilerRegistersDrift(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	_, err := iaas.CreateMachineForIaaS("lister-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	reconciler := &iaasReconciler{interval: time.Minute, done: make(chan bool)}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "lister-iaas"},
+		Kind:   "iaas.drift",
+	}, eventtest.HasEvent)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+}
+
+func (s *S) TestIaaSReconcilerAutoCleanup(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	_, err := iaas.CreateMachineForIaaS("lister-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	reconciler := &iaasReconciler{interval: time.Minute, autoCleanup: true, done: make(chan bool)}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+}
+
+func (s *S) TestIaaSReconcilerAutoCleanupSkipsLockedIaaS(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	_, err := iaas.CreateMachineForIaaS("lister-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "lister-iaas"},
+		Kind:   permission.PermMachineDelete,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	reconciler := &iaasReconciler{interval: time.Minute, autoCleanup: true, done: make(chan bool)}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "lister-iaas"},
+		Kind:   "iaas.drift",
+	}, eventtest.HasEvent)
+}
@@ -12,9 +12,11 @@ import (
 	"strings"
 
 	"github.com/ajg/form"
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/check.v1"
 )
 
@@ -38,6 +40,20 @@ func newTestIaaS(string) iaas.IaaS {
 	return TestIaaS{}
 }
 
+var listerIaaSMachines []iaas.Machine
+
+type TestListerIaaS struct {
+	TestIaaS
+}
+
+func (TestListerIaaS) ListMachines(known []iaas.Machine) ([]iaas.Machine, error) {
+	return listerIaaSMachines, nil
+}
+
+func newTestListerIaaS(string) iaas.IaaS {
+	return TestListerIaaS{}
+}
+
 func (s *S) TestMachinesList(c *check.C) {
 	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
 	_, err := iaas.CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1"})
@@ -212,6 +228,133 @@ func (s *S) TestTemplateCreateBadRequest(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 }
 
+func (s *S) TestTemplateCreateWithParent(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{
+		Name:     "base",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "size", Value: "small"}},
+		Params:   iaas.TemplateParamList{{Name: "size", Values: []string{"small", "large"}}},
+	}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	data := iaas.Template{
+		Name:   "my-tpl",
+		Parent: "base",
+		Data:   iaas.TemplateDataList{{Name: "size", Value: "large"}},
+		Params: iaas.TemplateParamList{{Name: "disk", Type: iaas.ParamTypeInt, Required: true}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineTemplateCreate,
+		Context: permission.Context(permission.CtxIaaS, "my-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer iaas.DestroyTemplate("my-tpl")
+	tpl, err := iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.IsNil)
+	c.Assert(tpl.IaaSName, check.Equals, "my-iaas")
+	c.Assert(tpl.Parent, check.Equals, "base")
+	c.Assert(tpl.Params, check.DeepEquals, iaas.TemplateParamList{{Name: "disk", Type: iaas.ParamTypeInt, Required: true}})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "my-iaas"},
+		Owner:  token.GetUserName(),
+		Kind:   "machine.template.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Name", "value": "my-tpl"},
+			{"name": "Parent", "value": "base"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestTemplateCreateWithParentInOtherIaaSUnauthorized(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{Name: "base", IaaSName: "my-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineTemplateCreate,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader("Name=my-tpl&Parent=base"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestTemplateCreateParentNotFound(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader("Name=my-tpl&Parent=base"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "template \"my-tpl\": parent template \"base\" not found\n")
+}
+
+func (s *S) TestTemplateCreateInvalidParams(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	data := iaas.Template{
+		Name:     "my-tpl",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "disk", Value: "big"}},
+		Params:   iaas.TemplateParamList{{Name: "disk", Type: iaas.ParamTypeInt}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "template \"my-tpl\": param \"disk\" must be a valid int, got \"big\"\n")
+	templates, err := iaas.ListTemplates()
+	c.Assert(err, check.IsNil)
+	c.Assert(templates, check.HasLen, 0)
+}
+
+func (s *S) TestTemplateDestroyWithChildren(c *check.C) {
+	iaas.RegisterIaasProvider("ec2", newTestIaaS)
+	parent := iaas.Template{Name: "base", IaaSName: "ec2"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	child := iaas.Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("child")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/iaas/templates/base", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "template \"base\": extended by templates: child\n")
+	templates, err := iaas.ListTemplates()
+	c.Assert(err, check.IsNil)
+	c.Assert(templates, check.HasLen, 2)
+}
+
 func (s *S) TestTemplateDestroy(c *check.C) {
 	iaas.RegisterIaasProvider("ec2", newTestIaaS)
 	tpl1 := iaas.Template{
@@ -333,3 +476,142 @@ func (s *S) TestTemplateUpdateBadRequest(c *check.C) {
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 }
+
+func (s *S) TestIaaSReconcileList(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	_, err := iaas.CreateMachineForIaaS("lister-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	listerIaaSMachines = []iaas.Machine{{Id: "orphan1", Address: "orphan1.somewhere.com"}}
+	defer func() { listerIaaSMachines = nil }()
+	s.provisioner.AddNodeWithMetadata("http://node1.somewhere.com:2375", "test1", map[string]string{"iaas": "lister-iaas"})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/reconcile", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var drifts []iaas.Drift
+	err = json.NewDecoder(recorder.Body).Decode(&drifts)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 3)
+	c.Assert(drifts[0].Kind, check.Equals, iaas.DriftMissingMachine)
+	c.Assert(drifts[0].Machine.Id, check.Equals, "myid1")
+	c.Assert(drifts[1].Kind, check.Equals, iaas.DriftOrphanMachine)
+	c.Assert(drifts[1].Machine.Id, check.Equals, "orphan1")
+	c.Assert(drifts[2].Kind, check.Equals, iaas.DriftNodeWithoutMachine)
+	c.Assert(drifts[2].Node, check.Equals, "http://node1.somewhere.com:2375")
+	for _, d := range drifts {
+		c.Assert(d.IaaS, check.Equals, "lister-iaas")
+		c.Assert(d.Cleaned, check.Equals, false)
+	}
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+}
+
+func (s *S) TestIaaSReconcileListFilteredByPermission(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	s.provisioner.AddNodeWithMetadata("http://node1.somewhere.com:2375", "test1", map[string]string{"iaas": "lister-iaas"})
+	s.provisioner.AddNodeWithMetadata("http://node2.somewhere.com:2375", "test1", map[string]string{"iaas": "other-iaas"})
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineRead,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/reconcile", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var drifts []iaas.Drift
+	err = json.NewDecoder(recorder.Body).Decode(&drifts)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.DeepEquals, []iaas.Drift{
+		{Kind: iaas.DriftNodeWithoutMachine, IaaS: "other-iaas", Node: "http://node2.somewhere.com:2375"},
+	})
+}
+
+func (s *S) TestIaaSReconcileListForbidden(c *check.C) {
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	token := userWithPermission(c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/iaas/reconcile", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestIaaSReconcileCleanup(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	iaas.RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	_, err := iaas.CreateMachineForIaaS("lister-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	listerIaaSMachines = []iaas.Machine{{Id: "orphan1", Address: "orphan1.somewhere.com"}}
+	defer func() { listerIaaSMachines = nil }()
+	s.provisioner.AddNodeWithMetadata("http://node1.somewhere.com:2375", "test1", map[string]string{"iaas": "lister-iaas"})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/reconcile", strings.NewReader("iaas=lister-iaas"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var drifts []iaas.Drift
+	err = json.NewDecoder(recorder.Body).Decode(&drifts)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 3)
+	c.Assert(drifts[0].Cleaned, check.Equals, true)
+	c.Assert(drifts[1].Cleaned, check.Equals, true)
+	c.Assert(drifts[1].Machine.Status, check.Equals, "destroyed")
+	c.Assert(drifts[2].Cleaned, check.Equals, false)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "lister-iaas"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "machine.delete",
+		StartCustomData: []map[string]interface{}{
+			{"name": "iaas", "value": "lister-iaas"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestIaaSReconcileCleanupWithoutIaaS(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/reconcile", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "iaas is required\n")
+}
+
+func (s *S) TestIaaSReconcileCleanupUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineDelete,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/reconcile", strings.NewReader("iaas=lister-iaas"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
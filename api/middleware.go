@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	stdLog "log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -18,6 +20,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/audit"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
@@ -35,7 +38,13 @@ func validate(token string, r *http.Request) (auth.Token, error) {
 	if err != nil {
 		t, err = auth.APIAuth(token)
 		if err != nil {
-			return nil, err
+			t, err = auth.PersonalTokenAuth(token)
+			if err == auth.ErrInvalidToken {
+				t, err = auth.ServiceAccountAuth(token)
+			}
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	if t.IsAppToken() {
@@ -253,3 +262,65 @@ func (l *loggerMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, ne
 	}
 	l.logger.Printf("%s %s %s %d in %0.6fms%s", nowFormatted, r.Method, r.URL.Path, statusCode, float64(duration)/float64(time.Millisecond), requestID)
 }
+
+// auditMiddleware records every request that may change state in tsuru (i.e.
+// every non-GET request) in the audit log, after the request is handled.
+func auditMiddleware(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method == "GET" {
+		next(rw, r)
+		return
+	}
+	start := time.Now()
+	next(rw, r)
+	entry := audit.Entry{
+		Date:      start.UTC(),
+		OwnerType: audit.OwnerTypeAnonymous,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Duration:  time.Since(start),
+		ClientIP:  requestClientIP(r),
+	}
+	if nrw, ok := rw.(negroni.ResponseWriter); ok {
+		entry.StatusCode = nrw.Status()
+	}
+	if entry.StatusCode == 0 {
+		entry.StatusCode = http.StatusOK
+	}
+	if t := context.GetAuthToken(r); t != nil {
+		if t.IsAppToken() {
+			entry.OwnerType = audit.OwnerTypeApp
+			entry.Owner = t.GetAppName()
+		} else {
+			entry.OwnerType = audit.OwnerTypeUser
+			entry.Owner = t.GetUserName()
+		}
+	} else if email := r.URL.Query().Get(":email"); email != "" {
+		entry.Owner = email
+	}
+	entry.App = r.URL.Query().Get(":app")
+	if entry.App == "" {
+		entry.App = r.URL.Query().Get(":appname")
+	}
+	entry.Team = r.URL.Query().Get(":team")
+	if entry.Team == "" && r.Form != nil {
+		entry.Team = r.Form.Get("team")
+	}
+	if requestIDHeader, _ := config.GetString("request-id-header"); requestIDHeader != "" {
+		entry.RequestID = context.GetRequestID(r, requestIDHeader)
+	}
+	err := audit.Record(&entry)
+	if err != nil {
+		log.Errorf("unable to record audit entry for %s %s: %s", r.Method, r.URL.Path, err)
+	}
+}
+
+func requestClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/audit"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
@@ -530,3 +531,59 @@ func (s *S) TestLoggerMiddlewareWithRequestID(c *check.C) {
 	timePart := time.Now().Format(time.RFC3339Nano)[:19]
 	c.Assert(out.String(), check.Matches, fmt.Sprintf(`%s\..+? PUT /my/path 200 in 1\d{2}\.\d+ms \[Request-ID: my-rid\]`+"\n", timePart))
 }
+
+func (s *S) TestAuditMiddleware(c *check.C) {
+	config.Set("request-id-header", "Request-ID")
+	defer config.Unset("request-id-header")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/myapp/env?:app=myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.RemoteAddr = "10.1.1.1:4321"
+	context.SetAuthToken(request, s.token)
+	context.SetRequestID(request, "Request-ID", "my-rid")
+	h, handlerLog := doHandler()
+	handlerLog.response = http.StatusBadRequest
+	auditMiddleware(negroni.NewResponseWriter(recorder), request, h)
+	c.Assert(handlerLog.called, check.Equals, true)
+	entries, err := audit.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	entry := entries[0]
+	c.Assert(entry.OwnerType, check.Equals, audit.OwnerTypeUser)
+	c.Assert(entry.Owner, check.Equals, s.token.GetUserName())
+	c.Assert(entry.Method, check.Equals, "POST")
+	c.Assert(entry.Path, check.Equals, "/apps/myapp/env")
+	c.Assert(entry.App, check.Equals, "myapp")
+	c.Assert(entry.StatusCode, check.Equals, http.StatusBadRequest)
+	c.Assert(entry.RequestID, check.Equals, "my-rid")
+	c.Assert(entry.ClientIP, check.Equals, "10.1.1.1")
+}
+
+func (s *S) TestAuditMiddlewareAnonymousWithForwardedFor(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/users/me@me.com/tokens?:email=me@me.com", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.1")
+	h, handlerLog := doHandler()
+	auditMiddleware(negroni.NewResponseWriter(recorder), request, h)
+	c.Assert(handlerLog.called, check.Equals, true)
+	entries, err := audit.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].OwnerType, check.Equals, audit.OwnerTypeAnonymous)
+	c.Assert(entries[0].Owner, check.Equals, "me@me.com")
+	c.Assert(entries[0].StatusCode, check.Equals, http.StatusOK)
+	c.Assert(entries[0].ClientIP, check.Equals, "192.168.0.1")
+}
+
+func (s *S) TestAuditMiddlewareIgnoresGet(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, check.IsNil)
+	h, handlerLog := doHandler()
+	auditMiddleware(negroni.NewResponseWriter(recorder), request, h)
+	c.Assert(handlerLog.called, check.Equals, true)
+	entries, err := audit.List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 0)
+}
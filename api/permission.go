@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -95,6 +98,10 @@ func removeRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	if err != nil {
 		return err
 	}
+	err = auth.RemoveRoleFromAllServiceAccounts(roleName)
+	if err != nil {
+		return err
+	}
 	err = permission.DestroyRole(roleName)
 	if err == permission.ErrRoleNotFound {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
@@ -180,7 +187,11 @@ func deployableApps(u *auth.User, rolesCache map[string]*permission.Role) ([]str
 		}
 		perms = append(perms, role.PermissionsFor(roleData.ContextValue)...)
 	}
-	contexts := permission.ContextsFromListForPermission(perms, permission.PermAppDeploy)
+	perms, err := auth.InheritTeamPermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+	contexts := permission.CandidateContextsFromListForPermission(perms, permission.PermAppDeploy)
 	if len(contexts) == 0 {
 		return nil, nil
 	}
@@ -189,9 +200,17 @@ func deployableApps(u *auth.User, rolesCache map[string]*permission.Role) ([]str
 	if err != nil {
 		return nil, err
 	}
-	appNames := make([]string, len(apps))
-	for i := range apps {
-		appNames[i] = apps[i].GetName()
+	var appNames []string
+	for _, a := range apps {
+		allowed := permission.CheckFromPermList(perms, permission.PermAppDeploy,
+			append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)...,
+		)
+		if allowed {
+			appNames = append(appNames, a.Name)
+		}
 	}
 	return appNames, nil
 }
@@ -359,6 +378,190 @@ func removePermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	return err
 }
 
+// title: add deny permissions
+// path: /roles/{name}/deny
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Role not found
+//   409: Permission not allowed
+func addDenyPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateDenyAdd) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateDenyAdd,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	users, err := auth.ListUsersWithRole(roleName)
+	if err != nil {
+		return err
+	}
+	err = runWithPermSync(users, func() error {
+		return role.AddDenyPermissions(r.Form["permission"]...)
+	})
+	return rolePermissionError(err)
+}
+
+// title: remove deny permission
+// path: /roles/{name}/deny/{permission}
+// method: DELETE
+// responses:
+//   200: Permission removed
+//   401: Unauthorized
+//   404: Not found
+func removeDenyPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateDenyRemove) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateDenyRemove,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	users, err := auth.ListUsersWithRole(roleName)
+	if err != nil {
+		return err
+	}
+	return runWithPermSync(users, func() error {
+		return role.RemoveDenyPermissions(r.URL.Query().Get(":permission"))
+	})
+}
+
+// title: add role condition
+// path: /roles/{name}/conditions
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Role not found
+//   409: Permission not allowed
+func addRoleCondition(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateConditionAdd) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateConditionAdd,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	deny, _ := strconv.ParseBool(r.FormValue("deny"))
+	err = role.AddCondition(permission.Condition{
+		SchemeName: r.FormValue("permission"),
+		Deny:       deny,
+		Attribute:  r.FormValue("attribute"),
+		Values:     r.Form["value"],
+	})
+	if err == permission.ErrInvalidCondition {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return rolePermissionError(err)
+}
+
+// title: remove role condition
+// path: /roles/{name}/conditions/{permission}
+// method: DELETE
+// responses:
+//   200: Condition removed
+//   401: Unauthorized
+//   404: Role not found
+func removeRoleCondition(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateConditionRemove) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateConditionRemove,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	deny, _ := strconv.ParseBool(r.FormValue("deny"))
+	return role.RemoveCondition(r.URL.Query().Get(":permission"), deny, r.FormValue("attribute"))
+}
+
+func rolePermissionError(err error) error {
+	if err == permission.ErrInvalidPermissionName {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	if perr, ok := err.(*permission.ErrPermissionNotFound); ok {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: perr.Error(),
+		}
+	}
+	if perr, ok := err.(*permission.ErrPermissionNotAllowed); ok {
+		return &errors.HTTP{
+			Code:    http.StatusConflict,
+			Message: perr.Error(),
+		}
+	}
+	return err
+}
+
 func canUseRole(t auth.Token, roleName, contextValue string) error {
 	role, err := permission.FindRole(roleName)
 	if err != nil {
@@ -417,12 +620,29 @@ func assignRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	if err != nil {
 		return err
 	}
+	var expiresAt time.Time
+	if expires := r.FormValue("expires"); expires != "" {
+		duration, parseErr := time.ParseDuration(expires)
+		if parseErr != nil || duration <= 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid expires: %q", expires)}
+		}
+		expiresAt = time.Now().Add(duration)
+	}
 	err = canUseRole(t, roleName, contextValue)
 	if err != nil {
 		return err
 	}
 	err = runWithPermSync([]auth.User{*user}, func() error {
-		return user.AddRole(roleName, contextValue)
+		if expiresAt.IsZero() {
+			return user.AddRole(roleName, contextValue)
+		}
+		return user.AddTemporaryRole(auth.RoleInstance{
+			Name:         roleName,
+			ContextValue: contextValue,
+			ExpiresAt:    expiresAt,
+			Reason:       r.FormValue("reason"),
+			Approver:     t.GetUserName(),
+		})
 	})
 	return err
 }
@@ -501,6 +721,133 @@ func listPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return json.NewEncoder(w).Encode(permList)
 }
 
+// title: explain permission check
+// path: /permissions/explain
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+func explainPermission(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	r.ParseForm()
+	scheme, contexts, err := parseCheckedPermission(r)
+	if err != nil {
+		return err
+	}
+	exp, err := auth.ExplainPermission(t, scheme, contexts...)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(exp)
+}
+
+type permissionCheckResult struct {
+	Subject string `json:"subject"`
+	permission.Explanation
+}
+
+// title: check permission
+// path: /permissions/check
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: User not found
+func checkPermission(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	scheme, contexts, err := parseCheckedPermission(r)
+	if err != nil {
+		return err
+	}
+	email := r.FormValue("user")
+	tokenValue := r.FormValue("token")
+	if email != "" && tokenValue != "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "either a user or a token must be provided, not both"}
+	}
+	var result permissionCheckResult
+	switch {
+	case email != "":
+		if !permission.Check(t, permission.PermUserUpdate) {
+			return permission.ErrUnauthorized
+		}
+		u, err := auth.GetUserByEmail(email)
+		if err == auth.ErrUserNotFound {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		result.Subject = u.Email
+		result.Explanation, err = auth.ExplainRolesPermission(u.Roles, scheme, contexts...)
+		if err != nil {
+			return err
+		}
+	case tokenValue != "":
+		checked, err := validate(tokenValue, r)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid token: %s", err)}
+		}
+		result.Subject = tokenSubject(checked)
+		result.Explanation, err = auth.ExplainPermission(checked, scheme, contexts...)
+		if err != nil {
+			return err
+		}
+	default:
+		result.Subject = tokenSubject(t)
+		result.Explanation, err = auth.ExplainPermission(t, scheme, contexts...)
+		if err != nil {
+			return err
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
+func tokenSubject(t auth.Token) string {
+	if t.IsAppToken() {
+		return "app:" + t.GetAppName()
+	}
+	return t.GetUserName()
+}
+
+// parseCheckedPermission parses the permission name, contexts in the form
+// <type>:<value> and attributes in the form <name>=<value> of a permission
+// check described in the request form.
+func parseCheckedPermission(r *http.Request) (*permission.PermissionScheme, []permission.PermissionContext, error) {
+	perm, err := permission.ParsePermission(r.FormValue("permission"), "", "")
+	if err != nil {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var contexts []permission.PermissionContext
+	for _, ctx := range r.Form["context"] {
+		parts := strings.SplitN(ctx, ":", 2)
+		if len(parts) != 2 {
+			return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid context %q, must be in the form <type>:<value>", ctx)}
+		}
+		parsed, err := permission.ParseContext(parts[0], parts[1])
+		if err != nil {
+			return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		contexts = append(contexts, parsed)
+	}
+	for _, attr := range r.Form["attribute"] {
+		parts := strings.SplitN(attr, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid attribute %q, must be in the form <name>=<value>", attr)}
+		}
+		contexts = append(contexts, permission.Attribute(parts[0], parts[1]))
+	}
+	return perm.Scheme, contexts, nil
+}
+
 // title: add default role
 // path: /role/default
 // method: POST
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"time"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -441,6 +442,58 @@ func (s *S) TestAssignRole(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAssignRoleTemporary(c *check.C) {
+	role, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.create")
+	c.Assert(err, check.IsNil)
+	emptyToken := customUserWithPermission(c, "user2")
+	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam&expires=2h&reason=incident", emptyToken.GetUserName()))
+	req, err := http.NewRequest("POST", "/roles/test/user", roleBody)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "user1", permission.Permission{
+		Scheme:  permission.PermRoleUpdateAssign,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	}, permission.Permission{
+		Scheme:  permission.PermAppCreate,
+		Context: permission.Context(permission.CtxTeam, "myteam"),
+	})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	emptyUser, err := emptyToken.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(emptyUser.Roles, check.HasLen, 1)
+	c.Assert(emptyUser.Roles[0].Name, check.Equals, "test")
+	c.Assert(emptyUser.Roles[0].ContextValue, check.Equals, "myteam")
+	c.Assert(emptyUser.Roles[0].Reason, check.Equals, "incident")
+	c.Assert(emptyUser.Roles[0].Approver, check.Equals, token.GetUserName())
+	remaining := emptyUser.Roles[0].ExpiresAt.Sub(time.Now())
+	c.Assert(remaining > time.Hour && remaining <= 2*time.Hour, check.Equals, true)
+}
+
+func (s *S) TestAssignRoleInvalidExpires(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	emptyToken := customUserWithPermission(c, "user2")
+	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam&expires=-1h", emptyToken.GetUserName()))
+	req, err := http.NewRequest("POST", "/roles/test/user", roleBody)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid expires: \"-1h\"\n")
+	emptyUser, err := emptyToken.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(emptyUser.Roles, check.HasLen, 0)
+}
+
 func (s *S) TestAssignRoleNotFound(c *check.C) {
 	emptyToken := customUserWithPermission(c, "user2")
 	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam", emptyToken.GetUserName()))
@@ -860,3 +913,357 @@ func (s *S) BenchmarkAddPermissionToRoleWithoutDeploy(c *check.C) {
 	sort.Strings(users)
 	c.Assert(users, check.DeepEquals, []string{s.user.Email})
 }
+
+func (s *S) TestAddDenyPermissionsToARole(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.update.env.set&permission=app.deploy`)
+	req, err := http.NewRequest("POST", "/roles/test/deny", b)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdateDeny,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.DenySchemeNames, check.DeepEquals, []string{"app.deploy", "app.update.env.set"})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "test"},
+		Owner:  token.GetUserName(),
+		Kind:   "role.update.deny.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "permission", "value": []string{"app.update.env.set", "app.deploy"}},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddDenyPermissionsToARolePermissionNotFound(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=does.not.exists`)
+	req, err := http.NewRequest("POST", "/roles/test/deny", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Matches, "permission named \"does.not.exists\" not found\n")
+}
+
+func (s *S) TestRemoveDenyPermissionsFromRole(c *check.C) {
+	r, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.deploy", "app.update.env.set")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("DELETE", "/roles/test/deny/app.deploy", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdateDenyRemove,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err = permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.DenySchemeNames, check.DeepEquals, []string{"app.update.env.set"})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "test"},
+		Owner:  token.GetUserName(),
+		Kind:   "role.update.deny.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "test"},
+			{"name": ":permission", "value": "app.deploy"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddRoleCondition(c *check.C) {
+	_, err := permission.NewRole("test", "global", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.deploy&attribute=pool&value=dev&value=staging-*`)
+	req, err := http.NewRequest("POST", "/roles/test/conditions", b)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdateCondition,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []permission.Condition{
+		{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev", "staging-*"}},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "test"},
+		Owner:  token.GetUserName(),
+		Kind:   "role.update.condition.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "permission", "value": "app.deploy"},
+			{"name": "attribute", "value": "pool"},
+			{"name": "value", "value": []string{"dev", "staging-*"}},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddRoleConditionToDeniedPermission(c *check.C) {
+	_, err := permission.NewRole("test", "global", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.deploy&deny=true&attribute=pool&value=prod`)
+	req, err := http.NewRequest("POST", "/roles/test/conditions", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []permission.Condition{
+		{SchemeName: "app.deploy", Deny: true, Attribute: "pool", Values: []string{"prod"}},
+	})
+}
+
+func (s *S) TestAddRoleConditionInvalid(c *check.C) {
+	_, err := permission.NewRole("test", "global", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.deploy&attribute=pool`)
+	req, err := http.NewRequest("POST", "/roles/test/conditions", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Equals, permission.ErrInvalidCondition.Error()+"\n")
+}
+
+func (s *S) TestAddRoleConditionRoleNotFound(c *check.C) {
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.deploy&attribute=pool&value=dev`)
+	req, err := http.NewRequest("POST", "/roles/test/conditions", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRemoveRoleCondition(c *check.C) {
+	r, err := permission.NewRole("test", "global", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddCondition(permission.Condition{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev"}})
+	c.Assert(err, check.IsNil)
+	err = r.AddCondition(permission.Condition{SchemeName: "app.deploy", Attribute: "team", Values: []string{"myteam"}})
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("DELETE", "/roles/test/conditions/app.deploy?attribute=pool", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdateConditionRemove,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err = permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []permission.Condition{
+		{SchemeName: "app.deploy", Attribute: "team", Values: []string{"myteam"}},
+	})
+}
+
+func (s *S) TestExplainPermission(c *check.C) {
+	role, err := permission.NewRole("deny-prod", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{SchemeName: "app.deploy", Deny: true, Attribute: "pool", Values: []string{"prod"}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, "myteam"),
+	})
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("deny-prod", "")
+	c.Assert(err, check.IsNil)
+	server := RunServer(true)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/explain?permission=app.deploy&context=team:myteam&context=pool:dev", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var exp permission.Explanation
+	err = json.Unmarshal(rec.Body.Bytes(), &exp)
+	c.Assert(err, check.IsNil)
+	c.Assert(exp.Allowed, check.Equals, true)
+	c.Assert(exp.Reason, check.Equals, `granted by app.deploy(team myteam) in role "majortomapp.deploymyteam"`)
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/permissions/explain?permission=app.deploy&context=team:myteam&context=pool:prod", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	err = json.Unmarshal(rec.Body.Bytes(), &exp)
+	c.Assert(err, check.IsNil)
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Reason, check.Equals, `denied by app.deploy(global) in role "deny-prod"`)
+}
+
+func (s *S) TestExplainPermissionInvalidData(c *check.C) {
+	server := RunServer(true)
+	for _, query := range []string{
+		"permission=does.not.exist",
+		"permission=app.deploy&context=team",
+		"permission=app.deploy&context=invalid:x",
+		"permission=app.deploy&attribute=env",
+	} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/permissions/explain?"+query, nil)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		server.ServeHTTP(rec, req)
+		c.Assert(rec.Code, check.Equals, http.StatusBadRequest, check.Commentf("query: %s", query))
+	}
+}
+
+func (s *S) TestCheckPermissionUser(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	user := &auth.User{Email: "checked@groundcontrol.com", Password: "123456"}
+	_, err = nativeScheme.Create(user)
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("deployer", "myteam")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermUserUpdate,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := bytes.NewBufferString("user=checked@groundcontrol.com&permission=app.deploy&context=team:myteam")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, permissionCheckResult{
+		Subject: "checked@groundcontrol.com",
+		Explanation: permission.Explanation{
+			Permission: "app.deploy",
+			Allowed:    true,
+			Reason:     `granted by app.deploy(team myteam) in role "deployer"`,
+			Matches: []permission.PermissionMatch{
+				{Permission: "app.deploy(team myteam)", Role: "deployer", Result: permission.MatchGranted},
+			},
+		},
+	})
+}
+
+func (s *S) TestCheckPermissionUserWithoutPermission(c *check.C) {
+	token := userWithPermission(c)
+	body := bytes.NewBufferString("user=" + s.user.Email + "&permission=app.deploy")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestCheckPermissionUserNotFound(c *check.C) {
+	body := bytes.NewBufferString("user=unknown@groundcontrol.com&permission=app.deploy")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestCheckPermissionToken(c *check.C) {
+	checked := customUserWithPermission(c, "checked", permission.Permission{
+		Scheme:  permission.PermApp,
+		Context: permission.Context(permission.CtxPool, "mypool"),
+	})
+	token := userWithPermission(c)
+	body := bytes.NewBufferString("token=" + checked.GetValue() + "&permission=app.update.env.set&context=pool:otherpool")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Subject, check.Equals, "checked@groundcontrol.com")
+	c.Assert(result.Allowed, check.Equals, false)
+	c.Assert(result.Matches, check.DeepEquals, []permission.PermissionMatch{
+		{Permission: "app(pool mypool)", Role: "checkedappmypool", Result: permission.MatchContextMismatch},
+	})
+}
+
+func (s *S) TestCheckPermissionInvalidToken(c *check.C) {
+	body := bytes.NewBufferString("token=invalid&permission=app.deploy")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestCheckPermissionCurrentToken(c *check.C) {
+	body := bytes.NewBufferString("permission=app.deploy")
+	req, err := http.NewRequest("POST", "/permissions/check", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Subject, check.Equals, s.token.GetUserName())
+	c.Assert(result.Allowed, check.Equals, true)
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const defaultPersonalTokenExpiration = 30 * 24 * time.Hour
+
+type personalTokenCreated struct {
+	auth.PersonalToken
+	Token string `json:"token"`
+}
+
+var errPersonalTokenNotAllowed = &errors.HTTP{
+	Code:    http.StatusForbidden,
+	Message: "personal tokens are not allowed to manage tokens or api keys",
+}
+
+// checkNotPersonalToken prevents personal tokens from managing tokens and
+// api keys, which would allow them to escape their scopes.
+func checkNotPersonalToken(t auth.Token) error {
+	if _, ok := t.(*auth.PersonalToken); ok {
+		return errPersonalTokenNotAllowed
+	}
+	return nil
+}
+
+// personalTokenUser returns the user whose personal tokens are being managed.
+// Managing tokens of other users requires the user.update.token permission.
+func personalTokenUser(r *http.Request, t auth.Token) (*auth.User, error) {
+	if err := checkNotPersonalToken(t); err != nil {
+		return nil, err
+	}
+	email := r.URL.Query().Get("user")
+	if email == "" {
+		return t.User()
+	}
+	if !permission.Check(t, permission.PermUserUpdateToken) {
+		return nil, permission.ErrUnauthorized
+	}
+	u, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return u, nil
+}
+
+func parseTokenScope(value string) auth.TokenScope {
+	parts := strings.SplitN(value, ":", 3)
+	scope := auth.TokenScope{Scheme: parts[0]}
+	if len(parts) > 1 {
+		scope.ContextType = parts[1]
+	}
+	if len(parts) > 2 {
+		scope.ContextValue = parts[2]
+	}
+	return scope
+}
+
+func personalTokenExpiration(r *http.Request) (time.Time, error) {
+	if expiresAt := r.FormValue("expiresAt"); expiresAt != "" {
+		date, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expiresAt: %s", err)
+		}
+		return date, nil
+	}
+	expiration := defaultPersonalTokenExpiration
+	if expires := r.FormValue("expires"); expires != "" {
+		var err error
+		expiration, err = time.ParseDuration(expires)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expires: %s", err)
+		}
+	}
+	return time.Now().Add(expiration), nil
+}
+
+// title: personal token list
+// path: /users/personal-tokens
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   403: Forbidden
+//   404: User not found
+func personalTokenList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := personalTokenUser(r, t)
+	if err != nil {
+		return err
+	}
+	tokens, err := auth.ListPersonalTokens(u.Email)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// title: personal token create
+// path: /users/personal-tokens
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Token created
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: User not found
+//   409: Token already exists
+func personalTokenCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := personalTokenUser(r, t)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := personalTokenExpiration(r)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var scopes []auth.TokenScope
+	for _, value := range r.Form["scope"] {
+		scope := parseTokenScope(value)
+		_, err = permission.ParsePermission(scope.Scheme, scope.ContextType, scope.ContextValue)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid scope %q: %s", value, err)}
+		}
+		scopes = append(scopes, scope)
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(u.Email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	token, err := auth.CreatePersonalToken(u, r.FormValue("name"), expiresAt, scopes)
+	switch err {
+	case nil:
+	case auth.ErrPersonalTokenAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case auth.ErrPersonalTokenInvalidName, auth.ErrPersonalTokenInvalidExpire:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(personalTokenCreated{PersonalToken: *token, Token: token.GetValue()})
+}
+
+// title: personal token revoke
+// path: /users/personal-tokens/{name}
+// method: DELETE
+// responses:
+//   200: Token revoked
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Not found
+func personalTokenRevoke(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := personalTokenUser(r, t)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(u.Email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RevokePersonalToken(u.Email, r.URL.Query().Get(":name"))
+	if err == auth.ErrPersonalTokenNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPersonalTokenCreate(c *check.C) {
+	body := strings.NewReader("name=ci&expires=1h&scope=app.deploy:team:" + s.team.Name)
+	request, err := http.NewRequest("POST", "/users/personal-tokens", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var created personalTokenCreated
+	err = json.NewDecoder(recorder.Body).Decode(&created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Token, check.Not(check.Equals), "")
+	c.Assert(created.Name, check.Equals, "ci")
+	c.Assert(created.Scopes, check.DeepEquals, []auth.TokenScope{
+		{Scheme: "app.deploy", ContextType: "team", ContextValue: s.team.Name},
+	})
+	c.Assert(created.ExpiresAt.Before(time.Now().Add(time.Hour+time.Minute)), check.Equals, true)
+	tokens, err := auth.ListPersonalTokens(s.token.GetUserName())
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(s.token.GetUserName()),
+		Owner:  s.token.GetUserName(),
+		Kind:   "user.update.token",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "ci"},
+			{"name": "expires", "value": "1h"},
+			{"name": "scope", "value": "app.deploy:team:" + s.team.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestPersonalTokenCreateInvalidScope(c *check.C) {
+	body := strings.NewReader("name=ci&scope=app.deploy:invalid:x")
+	request, err := http.NewRequest("POST", "/users/personal-tokens", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestPersonalTokenCreateDuplicated(c *check.C) {
+	_, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=ci")
+	request, err := http.NewRequest("POST", "/users/personal-tokens", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestPersonalTokenCreateOtherUserForbidden(c *check.C) {
+	token := userWithPermission(c)
+	body := strings.NewReader("name=ci")
+	request, err := http.NewRequest("POST", "/users/personal-tokens?user="+s.user.Email, body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestPersonalTokenList(c *check.C) {
+	_, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/users/personal-tokens", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(strings.Contains(recorder.Body.String(), `"token"`), check.Equals, false)
+	var tokens []auth.PersonalToken
+	err = json.NewDecoder(recorder.Body).Decode(&tokens)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+}
+
+func (s *S) TestPersonalTokenRevoke(c *check.C) {
+	_, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/users/personal-tokens/ci", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	tokens, err := auth.ListPersonalTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestPersonalTokenAuthenticatesRequests(c *check.C) {
+	t, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/users/info", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *S) TestPersonalTokenCannotCreateTokens(c *check.C) {
+	t, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []auth.TokenScope{
+		{Scheme: "app.read"},
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/users/personal-tokens", strings.NewReader("name=escape"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	tokens, err := auth.ListPersonalTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+}
+
+func (s *S) TestPersonalTokenCannotManageAPIKey(c *check.C) {
+	t, err := auth.CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []auth.TokenScope{
+		{Scheme: "app.read"},
+	})
+	c.Assert(err, check.IsNil)
+	m := RunServer(true)
+	for _, method := range []string{"GET", "POST"} {
+		request, err := http.NewRequest(method, "/users/api-key", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+t.GetValue())
+		recorder := httptest.NewRecorder()
+		m.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusForbidden, check.Commentf("%s /users/api-key", method))
+	}
+}
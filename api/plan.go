@@ -6,6 +6,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -28,6 +29,16 @@ import (
 //   409: Plan already exists
 func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	cpuShare, _ := strconv.Atoi(r.FormValue("cpushare"))
+	var cpuLimit float64
+	if value := r.FormValue("cpulimit"); value != "" {
+		cpuLimit, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid cpu limit: %q", value),
+			}
+		}
+	}
 	isDefault, _ := strconv.ParseBool(r.FormValue("default"))
 	memory := getSize(r.FormValue("memory"))
 	swap := getSize(r.FormValue("swap"))
@@ -36,6 +47,7 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 		Memory:   memory,
 		Swap:     swap,
 		CpuShare: cpuShare,
+		CpuLimit: cpuLimit,
 		Default:  isDefault,
 		Router:   r.FormValue("router"),
 	}
@@ -66,7 +78,7 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			Message: err.Error(),
 		}
 	}
-	if err == app.ErrLimitOfMemory || err == app.ErrLimitOfCpuShare {
+	if err == app.ErrLimitOfMemory || err == app.ErrLimitOfCpuShare || err == app.ErrLimitOfCpuLimit {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
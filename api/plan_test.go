@@ -107,6 +107,39 @@ func (s *S) TestPlanAddWithGigabyteAsMemoryUnit(c *check.C) {
 	})
 }
 
+func (s *S) TestPlanAddWithCpuLimit(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&cpushare=100&cpulimit=0.5&router=fake")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer s.conn.Plans().RemoveAll(nil)
+	var plans []app.Plan
+	err = s.conn.Plans().Find(nil).All(&plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []app.Plan{
+		{Name: "xyz", Memory: 536870912, CpuShare: 100, CpuLimit: 0.5, Router: "fake"},
+	})
+}
+
+func (s *S) TestPlanAddWithInvalidCpuLimit(c *check.C) {
+	for _, limit := range []string{"abc", "0.001"} {
+		recorder := httptest.NewRecorder()
+		body := strings.NewReader("name=xyz&cpushare=100&cpulimit=" + limit)
+		request, err := http.NewRequest("POST", "/plans", body)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		m := RunServer(true)
+		m.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
 func (s *S) TestPlanAddWithNoPermission(c *check.C) {
 	token := userWithPermission(c)
 	recorder := httptest.NewRecorder()
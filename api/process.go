@@ -0,0 +1,105 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// title: app process update
+// path: /apps/{app}/processes/{process}
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Process updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func updateAppProcess(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	process := r.URL.Query().Get(":process")
+	if strings.ContainsAny(process, ".$") {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid process name: %q", process)}
+	}
+	_, setPlan := r.Form["plan"]
+	_, setMaxUnits := r.Form["max-units"]
+	if !setPlan && !setMaxUnits {
+		msg := "Neither the plan or max units were set. You must define at least one."
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	var maxUnits int
+	if setMaxUnits {
+		maxUnits, err = strconv.Atoi(r.FormValue("max-units"))
+		if err != nil || maxUnits < 0 {
+			msg := "Invalid max units: the number must be an integer greater than or equal to 0."
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	contexts := append(permission.Contexts(permission.CtxTeam, a.Teams),
+		permission.Context(permission.CtxApp, a.Name),
+		permission.Context(permission.CtxPool, a.Pool),
+	)
+	allowed := permission.Check(t, permission.PermAppUpdateProcess, contexts...)
+	if allowed && setPlan {
+		allowed = permission.Check(t, permission.PermAppUpdatePlan, contexts...)
+	}
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateProcess,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+		Cancelable: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	if setMaxUnits {
+		err = a.SetProcessMaxUnits(process, maxUnits)
+		if _, ok := err.(*app.ProcessUnitLimitError); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !setPlan {
+		return nil
+	}
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	evt.SetLogWriter(writer)
+	err = a.SetProcessPlan(process, r.FormValue("plan"), evt)
+	if err == app.ErrPlanNotFound {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUpdateAppProcess(c *check.C) {
+	plan := app.Plan{Name: "small", Memory: 4194304, CpuShare: 10}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Plans().RemoveId(plan.Name)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("plan=small&max-units=2")
+	request, err := http.NewRequest("POST", "/apps/black-dog/processes/cron", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.DeepEquals, map[string]app.ProcessSettings{
+		"cron": {Plan: &plan, MaxUnits: 2},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.process",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": ":process", "value": "cron"},
+			{"name": "plan", "value": "small"},
+			{"name": "max-units", "value": "2"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUpdateAppProcessPlanRequiresUpdatePlanPermission(c *check.C) {
+	plan := app.Plan{Name: "small", Memory: 4194304, CpuShare: 10}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Plans().RemoveId(plan.Name)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateProcess,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	m := RunServer(true)
+	request, err := http.NewRequest("POST", "/apps/black-dog/processes/cron", strings.NewReader("plan=small"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	request, err = http.NewRequest("POST", "/apps/black-dog/processes/cron", strings.NewReader("max-units=2"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.DeepEquals, map[string]app.ProcessSettings{"cron": {MaxUnits: 2}})
+}
+
+func (s *S) TestUpdateAppProcessInvalid(c *check.C) {
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"", "Neither the plan or max units were set. You must define at least one.\n"},
+		{"max-units=-1", "Invalid max units: the number must be an integer greater than or equal to 0.\n"},
+		{"plan=unknown", "plan not found\n"},
+	}
+	m := RunServer(true)
+	for _, tt := range tests {
+		request, err := http.NewRequest("POST", "/apps/black-dog/processes/cron", strings.NewReader(tt.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		m.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, tt.message)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+)
+
+const roleExpireEventKind = "role.expire"
+
+// roleReaper periodically removes expired temporary role assignments,
+// registering an internal event for each removed assignment.
+type roleReaper struct {
+	interval time.Duration
+	done     chan bool
+}
+
+func newRoleReaper() *roleReaper {
+	interval, _ := config.GetInt("auth:temporary-roles:reaper-interval")
+	if interval <= 0 {
+		interval = 60
+	}
+	return &roleReaper{
+		interval: time.Duration(interval) * time.Second,
+		done:     make(chan bool),
+	}
+}
+
+func (r *roleReaper) run() {
+	for {
+		err := r.runOnce()
+		if err != nil {
+			log.Errorf("[role reaper] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *roleReaper) runOnce() (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = fmt.Errorf("recovered panic: %v", rec)
+		}
+	}()
+	users, err := auth.ListUsersWithExpiredRoles()
+	if err != nil {
+		return fmt.Errorf("unable to list users: %s", err)
+	}
+	for i := range users {
+		u := &users[i]
+		for _, role := range u.Roles {
+			if !role.IsExpired() {
+				continue
+			}
+			err = reapRole(u, role)
+			if err != nil {
+				log.Errorf("[role reaper] unable to remove role %q from user %q: %s", role.Name, u.Email, err)
+			}
+		}
+	}
+	return nil
+}
+
+func reapRole(u *auth.User, role auth.RoleInstance) error {
+	var removed bool
+	err := runWithPermSync([]auth.User{*u}, func() error {
+		var err error
+		removed, err = u.RemoveExpiredRole(role.Name, role.ContextValue)
+		return err
+	})
+	if err != nil || !removed {
+		return err
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeRole, Value: role.Name},
+		InternalKind: roleExpireEventKind,
+		DisableLock:  true,
+		CustomData: map[string]interface{}{
+			"user":      u.Email,
+			"context":   role.ContextValue,
+			"expiresat": role.ExpiresAt,
+			"reason":    role.Reason,
+			"approver":  role.Approver,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return evt.Done(nil)
+}
+
+func (r *roleReaper) Shutdown() {
+	r.done <- true
+}
+
+func (r *roleReaper) String() string {
+	return "temporary roles reaper"
+}
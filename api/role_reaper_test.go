@@ -0,0 +1,54 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestRoleReaperRemovesExpiredRoles(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	u := auth.User{
+		Email:    "temporary@groundcontrol.com",
+		Password: "123456",
+		Roles: []auth.RoleInstance{
+			{Name: "deployer", ContextValue: "expired", ExpiresAt: time.Now().Add(-time.Minute), Reason: "incident", Approver: "admin@tsuru.io"},
+			{Name: "deployer", ContextValue: "valid", ExpiresAt: time.Now().Add(time.Hour)},
+			{Name: "deployer", ContextValue: "permanent"},
+		},
+	}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	reaper := newRoleReaper()
+	err = reaper.runOnce()
+	c.Assert(err, check.IsNil)
+	dbUser, err := auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Roles, check.HasLen, 2)
+	c.Assert(dbUser.Roles[0].ContextValue, check.Equals, "valid")
+	c.Assert(dbUser.Roles[1].ContextValue, check.Equals, "permanent")
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "deployer"},
+		Kind:   "role.expire",
+		StartCustomData: map[string]interface{}{
+			"user":     u.Email,
+			"context":  "expired",
+			"reason":   "incident",
+			"approver": "admin@tsuru.io",
+		},
+	}, eventtest.HasEvent)
+	err = reaper.runOnce()
+	c.Assert(err, check.IsNil)
+	dbUser, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Roles, check.HasLen, 2)
+}
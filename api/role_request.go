@@ -0,0 +1,171 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const (
+	defaultRoleRequestDuration    = time.Hour
+	defaultRoleRequestMaxDuration = 8 * time.Hour
+)
+
+func roleRequestMaxDuration() time.Duration {
+	maxDuration, _ := config.GetInt("auth:temporary-roles:max-duration")
+	if maxDuration <= 0 {
+		return defaultRoleRequestMaxDuration
+	}
+	return time.Duration(maxDuration) * time.Second
+}
+
+// title: role request create
+// path: /role/requests
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Role request created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Role not found
+func roleRequestCreate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	duration := defaultRoleRequestDuration
+	if value := r.FormValue("duration"); value != "" {
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid duration: %q", value)}
+		}
+	}
+	req, err := auth.CreateRoleRequest(u, r.FormValue("role"), r.FormValue("context"), duration, roleRequestMaxDuration(), r.FormValue("reason"))
+	switch err {
+	case nil:
+	case permission.ErrRoleNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case auth.ErrRoleRequestInvalidDuration:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(req)
+}
+
+// title: role request list
+// path: /role/requests
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func roleRequestList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	var email string
+	if !permission.Check(t, permission.PermRoleUpdateAssign) {
+		u, err := t.User()
+		if err != nil {
+			return err
+		}
+		email = u.Email
+	}
+	status := auth.RoleRequestStatus(r.URL.Query().Get("status"))
+	requests, err := auth.ListRoleRequests(email, status)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(requests)
+}
+
+// title: role request approve
+// path: /role/requests/{id}/approve
+// method: POST
+// responses:
+//   200: Role request approved
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Role request not found
+//   409: Role request already reviewed
+func roleRequestApprove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	return reviewRoleRequest(r, t, true)
+}
+
+// title: role request reject
+// path: /role/requests/{id}/reject
+// method: POST
+// responses:
+//   200: Role request rejected
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Role request not found
+//   409: Role request already reviewed
+func roleRequestReject(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	return reviewRoleRequest(r, t, false)
+}
+
+func reviewRoleRequest(r *http.Request, t auth.Token, approve bool) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateAssign) {
+		return permission.ErrUnauthorized
+	}
+	req, err := auth.GetRoleRequest(r.URL.Query().Get(":id"))
+	if err == auth.ErrRoleRequestNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	err = canUseRole(t, req.RoleName, req.ContextValue)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: req.RoleName},
+		Kind:       permission.PermRoleUpdateAssign,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	if approve {
+		var user *auth.User
+		user, err = auth.GetUserByEmail(req.UserEmail)
+		if err != nil {
+			return err
+		}
+		err = runWithPermSync([]auth.User{*user}, func() error {
+			return req.Approve(t.GetUserName())
+		})
+	} else {
+		err = req.Reject(t.GetUserName())
+	}
+	switch err {
+	case auth.ErrRoleRequestSelfReview:
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	case auth.ErrRoleRequestNotPending:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
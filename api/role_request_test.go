@@ -0,0 +1,245 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestRoleRequestCreate(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	body := strings.NewReader("role=deployer&context=myapp&duration=2h&reason=incident")
+	request, err := http.NewRequest("POST", "/role/requests", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var created auth.RoleRequest
+	err = json.NewDecoder(recorder.Body).Decode(&created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.UserEmail, check.Equals, token.GetUserName())
+	c.Assert(created.RoleName, check.Equals, "deployer")
+	c.Assert(created.ContextValue, check.Equals, "myapp")
+	c.Assert(created.Duration, check.Equals, 2*time.Hour)
+	c.Assert(created.Reason, check.Equals, "incident")
+	c.Assert(created.Status, check.Equals, auth.RoleRequestPending)
+	requests, err := auth.ListRoleRequests(token.GetUserName(), "")
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+}
+
+func (s *S) TestRoleRequestCreateDefaultDuration(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/role/requests", strings.NewReader("role=deployer&context=myapp"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var created auth.RoleRequest
+	err = json.NewDecoder(recorder.Body).Decode(&created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Duration, check.Equals, time.Hour)
+}
+
+func (s *S) TestRoleRequestCreateExceedsMaxDuration(c *check.C) {
+	config.Set("auth:temporary-roles:max-duration", 3600)
+	defer config.Unset("auth:temporary-roles:max-duration")
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/role/requests", strings.NewReader("role=deployer&context=myapp&duration=2h"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrRoleRequestInvalidDuration.Error()+"\n")
+}
+
+func (s *S) TestRoleRequestCreateRoleNotFound(c *check.C) {
+	request, err := http.NewRequest("POST", "/role/requests", strings.NewReader("role=unknown&context=myapp"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRoleRequestList(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	_, err = auth.CreateRoleRequest(u, "deployer", "app1", time.Hour, time.Hour, "")
+	c.Assert(err, check.IsNil)
+	_, err = auth.CreateRoleRequest(s.user, "deployer", "app2", time.Hour, time.Hour, "")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/role/requests", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var requests []auth.RoleRequest
+	err = json.NewDecoder(recorder.Body).Decode(&requests)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].ContextValue, check.Equals, "app1")
+	request, err = http.NewRequest("GET", "/role/requests?status=pending", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = json.NewDecoder(recorder.Body).Decode(&requests)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 2)
+}
+
+func (s *S) TestRoleRequestListEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/role/requests", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestRoleRequestApprove(c *check.C) {
+	role, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	req, err := auth.CreateRoleRequest(u, "deployer", "myapp", time.Hour, time.Hour, "incident")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/role/requests/"+req.ID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	req, err = auth.GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, auth.RoleRequestApproved)
+	c.Assert(req.Reviewer, check.Equals, s.token.GetUserName())
+	u, err = token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].Name, check.Equals, "deployer")
+	c.Assert(u.Roles[0].Approver, check.Equals, s.token.GetUserName())
+	c.Assert(u.Roles[0].ExpiresAt.IsZero(), check.Equals, false)
+	c.Assert(permission.Check(token, permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp")), check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "deployer"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "role.update.assign",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":id", "value": req.ID.Hex()},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRoleRequestApproveOwnRequest(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := auth.CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, time.Hour, "")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/role/requests/"+req.ID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrRoleRequestSelfReview.Error()+"\n")
+}
+
+func (s *S) TestRoleRequestApproveUnauthorized(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := auth.CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, time.Hour, "")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	request, err := http.NewRequest("POST", "/role/requests/"+req.ID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	req, err = auth.GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, auth.RoleRequestPending)
+}
+
+func (s *S) TestRoleRequestApproveNotFound(c *check.C) {
+	request, err := http.NewRequest("POST", "/role/requests/5807a2a5e74fbb0fa0cc1df1/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestRoleRequestReject(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	req, err := auth.CreateRoleRequest(u, "deployer", "myapp", time.Hour, time.Hour, "")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/role/requests/"+req.ID.Hex()+"/reject", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	req, err = auth.GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, auth.RoleRequestRejected)
+	u, err = token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 0)
+	request, err = http.NewRequest("POST", "/role/requests/"+req.ID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// title: app rolling update
+// path: /apps/{app}/rolling-update
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Rolling update changed
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppRollingUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var rolling provision.RollingUpdate
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"batch-size", &rolling.BatchSize},
+		{"max-surge", &rolling.MaxSurge},
+		{"max-unavailable", &rolling.MaxUnavailable},
+		{"pause", &rolling.Pause},
+	}
+	for _, f := range fields {
+		value := r.FormValue(f.name)
+		if value == "" {
+			continue
+		}
+		*f.value, err = strconv.Atoi(value)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid %s: the number must be an integer.", f.name)
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	err = rolling.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateRollingUpdate,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateRollingUpdate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetRollingUpdate(rolling)
+}
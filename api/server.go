@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
+	_ "github.com/tsuru/tsuru/auth/ldap"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
 	_ "github.com/tsuru/tsuru/auth/saml"
@@ -141,6 +142,16 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/env", AuthorizationRequiredHandler(getEnv))
 	m.Add("1.0", "Post", "/apps/{app}/env", AuthorizationRequiredHandler(setEnv))
 	m.Add("1.0", "Delete", "/apps/{app}/env", AuthorizationRequiredHandler(unsetEnv))
+	m.Add("1.0", "Post", "/apps/{app}/envsets", AuthorizationRequiredHandler(appAttachEnvSet))
+	m.Add("1.0", "Delete", "/apps/{app}/envsets/{name}", AuthorizationRequiredHandler(appDetachEnvSet))
+	m.Add("1.0", "Post", "/apps/{app}/volumes", AuthorizationRequiredHandler(appBindVolume))
+	m.Add("1.0", "Delete", "/apps/{app}/volumes/{volume}", AuthorizationRequiredHandler(appUnbindVolume))
+	m.Add("1.0", "Get", "/apps/{app}/constraints", AuthorizationRequiredHandler(listAppConstraints))
+	m.Add("1.0", "Post", "/apps/{app}/constraints", AuthorizationRequiredHandler(addAppConstraint))
+	m.Add("1.0", "Delete", "/apps/{app}/constraints", AuthorizationRequiredHandler(removeAppConstraint))
+	m.Add("1.0", "Post", "/apps/{app}/rolling-update", AuthorizationRequiredHandler(setAppRollingUpdate))
+	m.Add("1.0", "Post", "/apps/{app}/auto-rollback", AuthorizationRequiredHandler(setAppAutoRollback))
+	m.Add("1.0", "Post", "/apps/{app}/processes/{process}", AuthorizationRequiredHandler(updateAppProcess))
 	m.Add("1.0", "Get", "/apps", AuthorizationRequiredHandler(appList))
 	m.Add("1.0", "Post", "/apps", AuthorizationRequiredHandler(createApp))
 	forceDeleteLockHandler := AuthorizationRequiredHandler(forceDeleteLock)
@@ -208,12 +219,25 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/users/keys/{key}", AuthorizationRequiredHandler(removeKeyFromUser))
 	m.Add("1.0", "Get", "/users/api-key", AuthorizationRequiredHandler(showAPIToken))
 	m.Add("1.0", "Post", "/users/api-key", AuthorizationRequiredHandler(regenerateAPIToken))
+	m.Add("1.0", "Get", "/users/personal-tokens", AuthorizationRequiredHandler(personalTokenList))
+	m.Add("1.0", "Post", "/users/personal-tokens", AuthorizationRequiredHandler(personalTokenCreate))
+	m.Add("1.0", "Delete", "/users/personal-tokens/{name}", AuthorizationRequiredHandler(personalTokenRevoke))
+
+	m.Add("1.0", "Get", "/service-accounts", AuthorizationRequiredHandler(serviceAccountList))
+	m.Add("1.0", "Post", "/service-accounts", AuthorizationRequiredHandler(serviceAccountCreate))
+	m.Add("1.0", "Get", "/service-accounts/{name}", AuthorizationRequiredHandler(serviceAccountInfo))
+	m.Add("1.0", "Delete", "/service-accounts/{name}", AuthorizationRequiredHandler(serviceAccountRemove))
+	m.Add("1.0", "Post", "/service-accounts/{name}/token", AuthorizationRequiredHandler(serviceAccountRotateToken))
+	m.Add("1.0", "Post", "/service-accounts/{name}/roles", AuthorizationRequiredHandler(serviceAccountAddRole))
+	m.Add("1.0", "Delete", "/service-accounts/{name}/roles/{role}", AuthorizationRequiredHandler(serviceAccountRemoveRole))
 
 	m.Add("1.0", "Get", "/logs", websocket.Handler(addLogs))
 
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
+	m.Add("1.0", "Post", "/teams/{name}/parent", AuthorizationRequiredHandler(setTeamParent))
+	m.Add("1.0", "Delete", "/teams/{name}/parent", AuthorizationRequiredHandler(unsetTeamParent))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -222,6 +246,8 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.0", "Get", "/iaas/machines", AuthorizationRequiredHandler(machinesList))
 	m.Add("1.0", "Delete", "/iaas/machines/{machine_id}", AuthorizationRequiredHandler(machineDestroy))
+	m.Add("1.0", "Get", "/iaas/reconcile", AuthorizationRequiredHandler(iaasReconcileList))
+	m.Add("1.0", "Post", "/iaas/reconcile", AuthorizationRequiredHandler(iaasReconcileCleanup))
 	m.Add("1.0", "Get", "/iaas/templates", AuthorizationRequiredHandler(templatesList))
 	m.Add("1.0", "Post", "/iaas/templates", AuthorizationRequiredHandler(templateCreate))
 	m.Add("1.0", "Put", "/iaas/templates/{template_name}", AuthorizationRequiredHandler(templateUpdate))
@@ -232,6 +258,21 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/plans/{planname}", AuthorizationRequiredHandler(removePlan))
 	m.Add("1.0", "Get", "/plans/routers", AuthorizationRequiredHandler(listRouters))
 
+	m.Add("1.0", "Get", "/envsets", AuthorizationRequiredHandler(envSetList))
+	m.Add("1.0", "Post", "/envsets", AuthorizationRequiredHandler(envSetCreate))
+	m.Add("1.0", "Get", "/envsets/{name}", AuthorizationRequiredHandler(envSetInfoHandler))
+	m.Add("1.0", "Delete", "/envsets/{name}", AuthorizationRequiredHandler(envSetRemove))
+	m.Add("1.0", "Post", "/envsets/{name}/env", AuthorizationRequiredHandler(envSetSetEnvs))
+	m.Add("1.0", "Delete", "/envsets/{name}/env", AuthorizationRequiredHandler(envSetUnsetEnvs))
+
+	m.Add("1.0", "Get", "/volumeplans", AuthorizationRequiredHandler(volumePlanList))
+	m.Add("1.0", "Post", "/volumeplans", AuthorizationRequiredHandler(volumePlanCreate))
+	m.Add("1.0", "Delete", "/volumeplans/{pool}/{name}", AuthorizationRequiredHandler(volumePlanRemove))
+	m.Add("1.0", "Get", "/volumes", AuthorizationRequiredHandler(volumeList))
+	m.Add("1.0", "Post", "/volumes", AuthorizationRequiredHandler(volumeCreate))
+	m.Add("1.0", "Get", "/volumes/{name}", AuthorizationRequiredHandler(volumeInfoHandler))
+	m.Add("1.0", "Delete", "/volumes/{name}", AuthorizationRequiredHandler(volumeRemove))
+
 	m.Add("1.0", "Get", "/pools", AuthorizationRequiredHandler(poolList))
 	m.Add("1.0", "Post", "/pools", AuthorizationRequiredHandler(addPoolHandler))
 	m.Add("1.0", "Delete", "/pools/{name}", AuthorizationRequiredHandler(removePoolHandler))
@@ -245,12 +286,25 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/roles/{name}", AuthorizationRequiredHandler(removeRole))
 	m.Add("1.0", "Post", "/roles/{name}/permissions", AuthorizationRequiredHandler(addPermissions))
 	m.Add("1.0", "Delete", "/roles/{name}/permissions/{permission}", AuthorizationRequiredHandler(removePermissions))
+	m.Add("1.0", "Post", "/roles/{name}/deny", AuthorizationRequiredHandler(addDenyPermissions))
+	m.Add("1.0", "Delete", "/roles/{name}/deny/{permission}", AuthorizationRequiredHandler(removeDenyPermissions))
+	m.Add("1.0", "Post", "/roles/{name}/conditions", AuthorizationRequiredHandler(addRoleCondition))
+	m.Add("1.0", "Delete", "/roles/{name}/conditions/{permission}", AuthorizationRequiredHandler(removeRoleCondition))
 	m.Add("1.0", "Post", "/roles/{name}/user", AuthorizationRequiredHandler(assignRole))
 	m.Add("1.0", "Delete", "/roles/{name}/user/{email}", AuthorizationRequiredHandler(dissociateRole))
+	m.Add("1.0", "Get", "/role/requests", AuthorizationRequiredHandler(roleRequestList))
+	m.Add("1.0", "Post", "/role/requests", AuthorizationRequiredHandler(roleRequestCreate))
+	m.Add("1.0", "Post", "/role/requests/{id}/approve", AuthorizationRequiredHandler(roleRequestApprove))
+	m.Add("1.0", "Post", "/role/requests/{id}/reject", AuthorizationRequiredHandler(roleRequestReject))
 	m.Add("1.0", "Get", "/role/default", AuthorizationRequiredHandler(listDefaultRoles))
 	m.Add("1.0", "Post", "/role/default", AuthorizationRequiredHandler(addDefaultRole))
 	m.Add("1.0", "Delete", "/role/default", AuthorizationRequiredHandler(removeDefaultRole))
 	m.Add("1.0", "Get", "/permissions", AuthorizationRequiredHandler(listPermissions))
+	m.Add("1.0", "Get", "/permissions/explain", AuthorizationRequiredHandler(explainPermission))
+	m.Add("1.0", "Post", "/permissions/check", AuthorizationRequiredHandler(checkPermission))
+
+	m.Add("1.0", "Get", "/audit", AuthorizationRequiredHandler(auditList))
+	m.Add("1.0", "Get", "/audit/export", AuthorizationRequiredHandler(auditExport))
 
 	m.Add("1.0", "Get", "/debug/goroutines", AuthorizationRequiredHandler(dumpGoroutines))
 	m.Add("1.0", "Get", "/debug/pprof/", AuthorizationRequiredHandler(indexHandler))
@@ -268,6 +322,7 @@ func RunServer(dry bool) http.Handler {
 	if !dry {
 		n.Use(newLoggerMiddleware())
 	}
+	n.Use(negroni.HandlerFunc(auditMiddleware))
 	n.UseHandler(m)
 	n.Use(negroni.HandlerFunc(flushingWriterMiddleware))
 	n.Use(negroni.HandlerFunc(setRequestIDHeaderMiddleware))
@@ -293,6 +348,13 @@ func RunServer(dry bool) http.Handler {
 		idleTracker := newIdleTracker()
 		shutdown.Register(idleTracker)
 		shutdown.Register(&logTracker)
+		reaper := newRoleReaper()
+		shutdown.Register(reaper)
+		go reaper.run()
+		if reconciler := newIaaSReconciler(); reconciler != nil {
+			shutdown.Register(reconciler)
+			go reconciler.run()
+		}
 		readTimeout, _ := config.GetInt("server:read-timeout")
 		writeTimeout, _ := config.GetInt("server:write-timeout")
 		listen, err := config.GetString("listen")
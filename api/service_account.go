@@ -0,0 +1,282 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func serviceAccountTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeServiceAccount, Value: name}
+}
+
+func serviceAccountContext(sa *auth.ServiceAccount) permission.PermissionContext {
+	return permission.Context(permission.CtxTeam, sa.Team)
+}
+
+func getServiceAccount(name string) (*auth.ServiceAccount, error) {
+	sa, err := auth.GetServiceAccount(name)
+	if err == auth.ErrServiceAccountNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return sa, err
+}
+
+// title: service account list
+// path: /service-accounts
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func serviceAccountList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermServiceAccountRead)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var teams []string
+	global := false
+	for _, c := range contexts {
+		switch c.CtxType {
+		case permission.CtxGlobal:
+			global = true
+		case permission.CtxTeam:
+			teams = append(teams, c.Value)
+		}
+	}
+	var query bson.M
+	if !global {
+		query = bson.M{"team": bson.M{"$in": teams}}
+	}
+	accounts, err := auth.ListServiceAccounts(query)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(accounts)
+}
+
+// title: service account create
+// path: /service-accounts
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Service account created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+//   409: Service account already exists
+func serviceAccountCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	sa := auth.ServiceAccount{
+		Name:        r.FormValue("name"),
+		Team:        r.FormValue("team"),
+		Description: r.FormValue("description"),
+		CreatedBy:   t.GetUserName(),
+	}
+	if sa.Team == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "team is required"}
+	}
+	if !permission.Check(t, permission.PermServiceAccountCreate, serviceAccountContext(&sa)) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceAccountTarget(sa.Name),
+		Kind:       permission.PermServiceAccountCreate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = sa.Create()
+	switch err {
+	case nil:
+	case auth.ErrServiceAccountInvalidName:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case auth.ErrServiceAccountAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: service account info
+// path: /service-accounts/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func serviceAccountInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	sa, err := getServiceAccount(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceAccountRead, serviceAccountContext(sa)) {
+		return permission.ErrUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(sa)
+}
+
+// title: service account remove
+// path: /service-accounts/{name}
+// method: DELETE
+// responses:
+//   200: Service account removed
+//   401: Unauthorized
+//   404: Not found
+func serviceAccountRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sa, err := getServiceAccount(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceAccountDelete, serviceAccountContext(sa)) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceAccountTarget(sa.Name),
+		Kind:       permission.PermServiceAccountDelete,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RemoveServiceAccount(sa.Name)
+	if err == auth.ErrServiceAccountNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: service account token rotate
+// path: /service-accounts/{name}/token
+// method: POST
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func serviceAccountRotateToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sa, err := getServiceAccount(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceAccountUpdateToken, serviceAccountContext(sa)) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceAccountTarget(sa.Name),
+		Kind:       permission.PermServiceAccountUpdateToken,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	token, err := sa.RotateToken()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// title: service account role add
+// path: /service-accounts/{name}/roles
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Role added
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func serviceAccountAddRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sa, err := getServiceAccount(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceAccountUpdateRole, serviceAccountContext(sa)) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.FormValue("role")
+	contextValue := r.FormValue("context")
+	if roleName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "role is required"}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceAccountTarget(sa.Name),
+		Kind:       permission.PermServiceAccountUpdateRole,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = canUseRole(t, roleName, contextValue)
+	if err != nil {
+		return err
+	}
+	return sa.AddRole(roleName, contextValue)
+}
+
+// title: service account role remove
+// path: /service-accounts/{name}/roles/{role}
+// method: DELETE
+// responses:
+//   200: Role removed
+//   401: Unauthorized
+//   404: Not found
+func serviceAccountRemoveRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sa, err := getServiceAccount(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermServiceAccountUpdateRole, serviceAccountContext(sa)) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceAccountTarget(sa.Name),
+		Kind:       permission.PermServiceAccountUpdateRole,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return sa.RemoveRole(r.URL.Query().Get(":role"), r.URL.Query().Get("context"))
+}
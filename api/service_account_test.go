@@ -0,0 +1,188 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestServiceAccountCreate(c *check.C) {
+	body := strings.NewReader("name=ci-bot&team=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/service-accounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	sa, err := auth.GetServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	c.Assert(sa.Team, check.Equals, s.team.Name)
+	c.Assert(sa.CreatedBy, check.Equals, s.token.GetUserName())
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeServiceAccount, Value: "ci-bot"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-account.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "ci-bot"},
+			{"name": "team", "value": s.team.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestServiceAccountCreateForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermServiceAccountCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader("name=ci-bot&team=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/service-accounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestServiceAccountList(c *check.C) {
+	err := s.conn.Teams().Insert(auth.Team{Name: "otherteam"})
+	c.Assert(err, check.IsNil)
+	for _, sa := range []auth.ServiceAccount{{Name: "a", Team: s.team.Name}, {Name: "b", Team: "otherteam"}} {
+		err = sa.Create()
+		c.Assert(err, check.IsNil)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermServiceAccountRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/service-accounts", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var accounts []auth.ServiceAccount
+	err = json.NewDecoder(recorder.Body).Decode(&accounts)
+	c.Assert(err, check.IsNil)
+	c.Assert(accounts, check.HasLen, 1)
+	c.Assert(accounts[0].Name, check.Equals, "a")
+}
+
+func (s *S) TestServiceAccountRemove(c *check.C) {
+	sa := auth.ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err := sa.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/service-accounts/ci-bot", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = auth.GetServiceAccount("ci-bot")
+	c.Assert(err, check.Equals, auth.ErrServiceAccountNotFound)
+}
+
+func (s *S) TestServiceAccountRotateTokenAndAuthenticate(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("service-account.read")
+	c.Assert(err, check.IsNil)
+	sa := auth.ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	err = sa.AddRole("deployer", s.team.Name)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/service-accounts/ci-bot/token", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["token"], check.Not(check.Equals), "")
+	request, err = http.NewRequest("GET", "/service-accounts/ci-bot", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+result["token"])
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	request, err = http.NewRequest("GET", "/users/keys", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+result["token"])
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestServiceAccountAddRole(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	sa := auth.ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("role=deployer&context=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/service-accounts/ci-bot/roles", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbSA, err := auth.GetServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSA.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "deployer", ContextValue: s.team.Name}})
+	request, err = http.NewRequest("DELETE", "/service-accounts/ci-bot/roles/deployer?context="+s.team.Name, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbSA, err = auth.GetServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSA.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestServiceAccountAddRoleNotAllowed(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	sa := auth.ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermServiceAccountUpdateRole,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("role=deployer&context=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/service-accounts/ci-bot/roles", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
@@ -1132,6 +1132,48 @@ func (s *ConsumptionSuite) TestServicesInstancesHandlerFilterInstancesPerService
 	c.Assert(instances, check.DeepEquals, expected)
 }
 
+func (s *ConsumptionSuite) TestServicesInstancesHandlerWithConditionalGrant(c *check.C) {
+	srv := service.Service{Name: "redis", Teams: []string{s.team.Name}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "redis"})
+	defer s.conn.ServiceInstances().RemoveAll(bson.M{"service_name": "redis"})
+	for _, name := range []string{"redis1", "redis2"} {
+		instance := service.ServiceInstance{Name: name, ServiceName: "redis", Teams: []string{s.team.Name}}
+		err = instance.Create()
+		c.Assert(err, check.IsNil)
+	}
+	token := customUserWithPermission(c, "conditionaluser", permission.Permission{
+		Scheme:  permission.PermServiceRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	role, err := permission.NewRole("conditional-instances", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("service-instance.read")
+	c.Assert(err, check.IsNil)
+	err = role.AddCondition(permission.Condition{
+		SchemeName: "service-instance.read",
+		Attribute:  "service-instance",
+		Values:     []string{"redis1"},
+	})
+	c.Assert(err, check.IsNil)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole(role.Name, s.team.Name)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/instances", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstances(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	var instances []service.ServiceModel
+	err = json.Unmarshal(recorder.Body.Bytes(), &instances)
+	c.Assert(err, check.IsNil)
+	for _, model := range instances {
+		c.Assert(model.Instances, check.HasLen, 0)
+	}
+}
+
 func makeRequestToStatusHandler(service string, instance string, c *check.C) (*httptest.ResponseRecorder, *http.Request) {
 	url := fmt.Sprintf("/services/%s/instances/%s/status/?:instance=%s&:service=%s", service, instance, instance, service)
 	request, err := http.NewRequest("GET", url, nil)
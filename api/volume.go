@@ -0,0 +1,485 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func volumeTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeVolume, Value: name}
+}
+
+func volumeContexts(v *app.Volume) []permission.PermissionContext {
+	return []permission.PermissionContext{
+		permission.Context(permission.CtxTeam, v.TeamOwner),
+		permission.Context(permission.CtxPool, v.Pool),
+	}
+}
+
+func getVolume(name string) (*app.Volume, error) {
+	v, err := app.GetVolume(name)
+	if err == app.ErrVolumeNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return v, err
+}
+
+type volumeInfo struct {
+	app.Volume
+	Binds []app.VolumeBind `json:"binds"`
+}
+
+// title: volume plan list
+// path: /volumeplans
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func volumePlanList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermVolumeRead)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var pools []string
+	global := false
+	for _, c := range contexts {
+		switch c.CtxType {
+		case permission.CtxGlobal:
+			global = true
+		case permission.CtxPool:
+			pools = append(pools, c.Value)
+		case permission.CtxTeam:
+			teamPools, err := provision.ListPools(bson.M{"$or": []bson.M{
+				{"teams": c.Value},
+				{"public": true},
+				{"default": true},
+			}})
+			if err != nil {
+				return err
+			}
+			for _, p := range teamPools {
+				pools = append(pools, p.Name)
+			}
+		}
+	}
+	if !global && len(pools) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if global {
+		pools = nil
+	}
+	plans, err := app.ListVolumePlans(pools...)
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(plans)
+}
+
+// title: volume plan create
+// path: /volumeplans
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Volume plan created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Volume plan already exists
+func volumePlanCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var plan app.VolumePlan
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&plan, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	allowed := permission.Check(t, permission.PermVolumePlanCreate,
+		permission.Context(permission.CtxPool, plan.Pool),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypePool, Value: plan.Pool},
+		Kind:       permission.PermVolumePlanCreate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.AddVolumePlan(plan)
+	if _, ok := err.(app.VolumeValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	switch err {
+	case app.ErrVolumePlanAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case provision.ErrPoolNotFound:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case nil:
+		w.WriteHeader(http.StatusCreated)
+	}
+	return err
+}
+
+// title: volume plan remove
+// path: /volumeplans/{pool}/{name}
+// method: DELETE
+// responses:
+//   200: Volume plan removed
+//   401: Unauthorized
+//   404: Volume plan not found
+//   412: Volume plan used by volumes
+func volumePlanRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	pool := r.URL.Query().Get(":pool")
+	allowed := permission.Check(t, permission.PermVolumePlanDelete,
+		permission.Context(permission.CtxPool, pool),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypePool, Value: pool},
+		Kind:       permission.PermVolumePlanDelete,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.RemoveVolumePlan(pool, r.URL.Query().Get(":name"))
+	switch err {
+	case app.ErrVolumePlanNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case app.ErrVolumePlanInUse:
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
+}
+
+// title: volume list
+// path: /volumes
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func volumeList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	perms, err := t.Permissions()
+	if err != nil {
+		return err
+	}
+	contexts := permission.CandidateContextsFromListForPermission(perms, permission.PermVolumeRead)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var teams, pools []string
+	global := false
+	for _, c := range contexts {
+		switch c.CtxType {
+		case permission.CtxGlobal:
+			global = true
+		case permission.CtxTeam:
+			teams = append(teams, c.Value)
+		case permission.CtxPool:
+			pools = append(pools, c.Value)
+		}
+	}
+	var query bson.M
+	if !global {
+		query = bson.M{"$or": []bson.M{
+			{"teamowner": bson.M{"$in": teams}},
+			{"pool": bson.M{"$in": pools}},
+		}}
+	}
+	dbVolumes, err := app.ListVolumes(query)
+	if err != nil {
+		return err
+	}
+	var volumes []app.Volume
+	for i := range dbVolumes {
+		if permission.CheckFromPermList(perms, permission.PermVolumeRead, volumeContexts(&dbVolumes[i])...) {
+			volumes = append(volumes, dbVolumes[i])
+		}
+	}
+	if len(volumes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(volumes)
+}
+
+// title: volume create
+// path: /volumes
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Volume created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Volume already exists
+func volumeCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	v := app.Volume{
+		Name:      r.FormValue("name"),
+		Pool:      r.FormValue("pool"),
+		Plan:      r.FormValue("plan"),
+		TeamOwner: r.FormValue("teamOwner"),
+	}
+	if v.TeamOwner == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the team owner of the volume."}
+	}
+	allowed := permission.Check(t, permission.PermVolumeCreate, volumeContexts(&v)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     volumeTarget(v.Name),
+		Kind:       permission.PermVolumeCreate,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = v.Create()
+	if _, ok := err.(app.VolumeValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	switch err {
+	case app.ErrVolumeAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case app.ErrVolumePlanNotFound, auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case nil:
+		w.WriteHeader(http.StatusCreated)
+	}
+	return err
+}
+
+// title: volume info
+// path: /volumes/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Volume not found
+func volumeInfoHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	v, err := getVolume(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermVolumeRead, volumeContexts(v)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	binds, err := v.Binds()
+	if err != nil {
+		return err
+	}
+	info := volumeInfo{Volume: *v, Binds: binds}
+	if info.Binds == nil {
+		info.Binds = []app.VolumeBind{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(info)
+}
+
+// title: volume remove
+// path: /volumes/{name}
+// method: DELETE
+// responses:
+//   200: Volume removed
+//   401: Unauthorized
+//   404: Volume not found
+//   412: Volume bound to apps
+func volumeRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	v, err := getVolume(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermVolumeDelete, volumeContexts(v)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     volumeTarget(v.Name),
+		Kind:       permission.PermVolumeDelete,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.RemoveVolume(v.Name)
+	switch err {
+	case app.ErrVolumeInUse:
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	case app.ErrVolumeNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: bind volume to app
+// path: /apps/{app}/volumes
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Volume bound
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or volume not found
+//   409: Volume already bound
+func appBindVolume(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	volumeName := r.FormValue("volume")
+	if volumeName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the volume name."}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateVolumeBind,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	v, err := getVolume(volumeName)
+	if err != nil {
+		return err
+	}
+	allowed = permission.Check(t, permission.PermVolumeUpdateBind, volumeContexts(v)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateVolumeBind,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	readOnly, _ := strconv.ParseBool(r.FormValue("readOnly"))
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = v.Bind(&a, r.FormValue("mountPoint"), readOnly, !noRestart, writer)
+	if _, ok := err.(app.VolumeValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	switch err {
+	case app.ErrVolumeAlreadyBound, app.ErrVolumeMountPointInUse:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	case app.ErrVolumePoolMismatch:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: unbind volume from app
+// path: /apps/{app}/volumes/{volume}
+// method: DELETE
+// produce: application/x-json-stream
+// responses:
+//   200: Volume unbound
+//   401: Unauthorized
+//   404: App or volume not found or volume not bound
+func appUnbindVolume(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateVolumeUnbind,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	v, err := getVolume(r.URL.Query().Get(":volume"))
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateVolumeUnbind,
+		Owner:      t,
+		CustomData: formToEvents(r.Form),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = v.Unbind(&a, r.FormValue("mountPoint"), !noRestart, writer)
+	if err == app.ErrVolumeNotBound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
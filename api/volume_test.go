@@ -0,0 +1,258 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createVolume(c *check.C, name string) *app.Volume {
+	plan := app.VolumePlan{Name: "p1", Pool: s.Pool, Type: app.VolumeTypeDriver, Driver: "rexray"}
+	err := app.AddVolumePlan(plan)
+	if err != app.ErrVolumePlanAlreadyExists {
+		c.Assert(err, check.IsNil)
+	}
+	v := app.Volume{Name: name, Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	err = v.Create()
+	c.Assert(err, check.IsNil)
+	return &v
+}
+
+func (s *S) TestVolumePlanCreate(c *check.C) {
+	body := strings.NewReader("Name=nfs1&Pool=" + s.Pool + "&Type=nfs&Opts.server=10.0.0.1&Opts.path=/exports")
+	request, err := http.NewRequest("POST", "/volumeplans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	plan, err := app.GetVolumePlan(s.Pool, "nfs1")
+	c.Assert(err, check.IsNil)
+	c.Assert(plan, check.DeepEquals, &app.VolumePlan{
+		Name: "nfs1",
+		Pool: s.Pool,
+		Type: app.VolumeTypeNFS,
+		Opts: map[string]string{"server": "10.0.0.1", "path": "/exports"},
+	})
+}
+
+func (s *S) TestVolumePlanCreateInvalid(c *check.C) {
+	body := strings.NewReader("Name=nfs1&Pool=" + s.Pool + "&Type=nfs")
+	request, err := http.NewRequest("POST", "/volumeplans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid value for server\n")
+}
+
+func (s *S) TestVolumePlanRemoveInUse(c *check.C) {
+	s.createVolume(c, "data")
+	request, err := http.NewRequest("DELETE", "/volumeplans/"+s.Pool+"/p1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestVolumeCreate(c *check.C) {
+	err := app.AddVolumePlan(app.VolumePlan{Name: "p1", Pool: s.Pool, Type: app.VolumeTypeDriver, Driver: "rexray"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=data&pool=" + s.Pool + "&plan=p1&teamOwner=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/volumes", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	v, err := app.GetVolume("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(v.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeVolume, Value: "data"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "volume.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "data"},
+			{"name": "pool", "value": s.Pool},
+			{"name": "plan", "value": "p1"},
+			{"name": "teamOwner", "value": s.team.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestVolumeCreateForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermVolumeCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader("name=data&pool=" + s.Pool + "&plan=p1&teamOwner=" + s.team.Name)
+	request, err := http.NewRequest("POST", "/volumes", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestVolumeList(c *check.C) {
+	s.createVolume(c, "data1")
+	s.createVolume(c, "data2")
+	request, err := http.NewRequest("GET", "/volumes", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var volumes []app.Volume
+	err = json.NewDecoder(recorder.Body).Decode(&volumes)
+	c.Assert(err, check.IsNil)
+	c.Assert(volumes, check.HasLen, 2)
+	c.Assert(volumes[0].Name, check.Equals, "data1")
+	c.Assert(volumes[1].Name, check.Equals, "data2")
+}
+
+func (s *S) TestVolumeRemoveInUse(c *check.C) {
+	v := s.createVolume(c, "data")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = v.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/volumes/data", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestAppBindVolume(c *check.C) {
+	s.createVolume(c, "data")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("volume=data&mountPoint=/var/data&readOnly=true&noRestart=true")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	binds, err := a.VolumeBinds()
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []app.VolumeBind{
+		{ID: app.VolumeBindID{Volume: "data", App: a.Name, MountPoint: "/var/data"}, ReadOnly: true},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.volume.bind",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "volume", "value": "data"},
+			{"name": "mountPoint", "value": "/var/data"},
+			{"name": "readOnly", "value": "true"},
+			{"name": "noRestart", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppBindVolumeOtherTeamForbidden(c *check.C) {
+	s.createVolume(c, "data")
+	team := auth.Team{Name: "angra"}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateVolumeBind,
+		Context: permission.Context(permission.CtxTeam, team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermVolumeRead,
+		Context: permission.Context(permission.CtxPool, s.Pool),
+	})
+	body := strings.NewReader("volume=data&mountPoint=/var/data&noRestart=true")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	binds, err := a.VolumeBinds()
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+}
+
+func (s *S) TestAppBindVolumeMountPointInUse(c *check.C) {
+	v := s.createVolume(c, "data1")
+	s.createVolume(c, "data2")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = v.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("volume=data2&mountPoint=/data&noRestart=true")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/apps/%s/volumes", a.Name), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAppUnbindVolume(c *check.C) {
+	v := s.createVolume(c, "data")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = v.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/volumes/data?mountPoint=/data&noRestart=true", a.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	binds, err := a.VolumeBinds()
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
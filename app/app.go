@@ -122,6 +122,11 @@ type App struct {
 	Pool           string
 	Description    string
 	RouterOpts     map[string]string
+	EnvSets        []string                   `bson:"envsets"`
+	Constraints    []PlacementConstraint      `bson:",omitempty"`
+	Processes      map[string]ProcessSettings `bson:",omitempty"`
+	RollingUpdate  provision.RollingUpdate    `bson:",omitempty"`
+	AutoRollback   provision.AutoRollback     `bson:",omitempty"`
 
 	quota.Quota
 }
@@ -157,6 +162,28 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["teamowner"] = app.TeamOwner
 	result["plan"] = app.Plan
 	result["lock"] = app.Lock
+	if len(app.EnvSets) > 0 {
+		result["envsets"] = app.EnvSets
+	}
+	if len(app.Constraints) > 0 {
+		constraints := make([]string, len(app.Constraints))
+		for i, c := range app.Constraints {
+			constraints[i] = c.String()
+			if c.Process != "" {
+				constraints[i] += " (process " + c.Process + ")"
+			}
+		}
+		result["constraints"] = constraints
+	}
+	if len(app.Processes) > 0 {
+		result["processes"] = app.Processes
+	}
+	if app.RollingUpdate.Enabled() {
+		result["rollingUpdate"] = app.RollingUpdate
+	}
+	if app.AutoRollback.Enabled() {
+		result["autoRollback"] = app.AutoRollback
+	}
 	return json.Marshal(&result)
 }
 
@@ -431,6 +458,10 @@ func Delete(app *App, w io.Writer) error {
 	conn, err := db.Conn()
 	if err == nil {
 		defer conn.Close()
+		_, err = conn.VolumeBinds().RemoveAll(bson.M{"_id.app": appName})
+		if err != nil {
+			logErr("Unable to remove volume binds", err)
+		}
 		err = conn.Apps().Remove(bson.M{"name": appName})
 	}
 	if err != nil {
@@ -504,7 +535,11 @@ func (app *App) AddUnits(n uint, process string, writer io.Writer) error {
 	if n == 0 {
 		return stderr.New("Cannot add zero units.")
 	}
-	err := action.NewPipeline(
+	err := app.checkProcessUnitLimit(process, int(n))
+	if err != nil {
+		return err
+	}
+	err = action.NewPipeline(
 		&reserveUnitsToAdd,
 		&provisionAddUnits,
 	).Execute(app, n, writer, process)
@@ -967,6 +1002,11 @@ func (app *App) GetCpuShare() int {
 	return app.Plan.CpuShare
 }
 
+// GetCpuLimit returns the hard limit of CPUs for each unit of the app.
+func (app *App) GetCpuLimit() float64 {
+	return app.Plan.CpuLimit
+}
+
 // GetIp returns the ip of the app.
 func (app *App) GetIp() string {
 	return app.Ip
@@ -1018,9 +1058,28 @@ func (app *App) GetDeploys() uint {
 	return app.Deploys
 }
 
-// Envs returns a map representing the apps environment variables.
-func (app *App) Envs() map[string]bind.EnvVar {
-	return app.Env
+// Envs returns a map representing the apps environment variables. Variables
+// from attached env sets are included, with variables set in the app or by
+// bound services taking precedence over them. When more than one env set
+// defines the same variable, the set attached last wins.
+func (app *App) Envs() (map[string]bind.EnvVar, error) {
+	if len(app.EnvSets) == 0 {
+		return app.Env, nil
+	}
+	sets, err := app.envSets()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load env sets of app %q: %s", app.Name, err)
+	}
+	envs := make(map[string]bind.EnvVar)
+	for _, set := range sets {
+		for name, env := range set.Envs {
+			envs[name] = env
+		}
+	}
+	for name, env := range app.Env {
+		envs[name] = env
+	}
+	return envs, nil
 }
 
 // SetEnvs saves a list of environment variables in the app. The publicOnly
@@ -1631,5 +1690,70 @@ func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
 		}
 		result.Removed = append(result.Removed, toRemoveUrl.String())
 	}
+	if tcpRouter, ok := r.(router.TCPRouter); ok {
+		if portProv, ok := Provisioner.(provision.PortRoutableProvisioner); ok {
+			err = app.rebuildPortRoutes(tcpRouter, portProv, &result)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	return &result, nil
 }
+
+// rebuildPortRoutes reconciles the routes of the ports exposed by the units of
+// the app, besides the HTTP one, in the TCP router.
+func (app *App) rebuildPortRoutes(r router.TCPRouter, p provision.PortRoutableProvisioner, result *RebuildRoutesResult) error {
+	oldRoutes, err := r.PortRoutes(app.Name)
+	if err != nil {
+		return err
+	}
+	expectedRoutes, err := p.RoutablePorts(app)
+	if err != nil {
+		return err
+	}
+	ports := make(map[router.PortRoute]struct{})
+	for port := range oldRoutes {
+		ports[port] = struct{}{}
+	}
+	for port := range expectedRoutes {
+		ports[port] = struct{}{}
+	}
+	for port := range ports {
+		expectedMap := make(map[string]*url.URL)
+		for _, addr := range expectedRoutes[port] {
+			expectedMap[addr.Host] = addr
+		}
+		var toRemove []*url.URL
+		for _, addr := range oldRoutes[port] {
+			if _, isPresent := expectedMap[addr.Host]; isPresent {
+				delete(expectedMap, addr.Host)
+			} else {
+				toRemove = append(toRemove, addr)
+			}
+		}
+		if len(expectedMap) > 0 {
+			toAdd := make([]*url.URL, 0, len(expectedMap))
+			for _, addr := range expectedMap {
+				toAdd = append(toAdd, addr)
+			}
+			err = r.AddPortRoutes(app.Name, port, toAdd)
+			if err != nil {
+				return err
+			}
+			for _, addr := range toAdd {
+				result.Added = append(result.Added, addr.String())
+			}
+		}
+		if len(toRemove) > 0 {
+			err = r.RemovePortRoutes(app.Name, port, toRemove)
+			if err != nil {
+				return err
+			}
+			for _, addr := range toRemove {
+				result.Removed = append(result.Removed, addr.String())
+			}
+		}
+	}
+	return nil
+}
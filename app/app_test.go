@@ -30,6 +30,7 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/repository/repositorytest"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/routertest"
 	"github.com/tsuru/tsuru/safe"
 	"github.com/tsuru/tsuru/service"
@@ -2753,7 +2754,8 @@ func (s *S) TestEnvs(c *check.C) {
 			},
 		},
 	}
-	env := app.Envs()
+	env, err := app.Envs()
+	c.Assert(err, check.IsNil)
 	c.Assert(env, check.DeepEquals, app.Env)
 }
 
@@ -3935,6 +3937,38 @@ func (s *S) TestRebuildRoutesTCPRoutes(c *check.C) {
 	c.Assert(app.Ip, check.Equals, addr)
 }
 
+func (s *S) TestRebuildRoutesPortRoutes(c *check.C) {
+	a := App{Name: "my-test-app", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	mqtt := router.PortRoute{Port: 1883, Protocol: "tcp"}
+	dns := router.PortRoute{Port: 53, Protocol: "udp"}
+	addr1 := &url.URL{Scheme: "tcp", Host: "10.10.10.10:30001"}
+	addr2 := &url.URL{Scheme: "tcp", Host: "10.10.10.11:30002"}
+	addr3 := &url.URL{Scheme: "udp", Host: "10.10.10.10:30003"}
+	stale := &url.URL{Scheme: "tcp", Host: "10.10.10.12:30004"}
+	err = routertest.FakeRouter.AddPortRoutes(a.Name, mqtt, []*url.URL{addr1, stale})
+	c.Assert(err, check.IsNil)
+	s.provisioner.SetPortRoutes(&a, map[router.PortRoute][]*url.URL{
+		mqtt: {addr1, addr2},
+		dns:  {addr3},
+	})
+	changes, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	sort.Strings(changes.Added)
+	c.Assert(changes.Added, check.DeepEquals, []string{addr2.String(), addr3.String()})
+	c.Assert(changes.Removed, check.DeepEquals, []string{stale.String()})
+	routes, err := routertest.FakeRouter.PortRoutes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	sort.Sort(URLList(routes[mqtt]))
+	c.Assert(routes[mqtt], check.DeepEquals, []*url.URL{addr1, addr2})
+	c.Assert(routes[dns], check.DeepEquals, []*url.URL{addr3})
+}
+
 type URLList []*url.URL
 
 func (l URLList) Len() int           { return len(l) }
@@ -0,0 +1,40 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GetAutoRollback returns how the units of the app are watched after deploys.
+func (app *App) GetAutoRollback() provision.AutoRollback {
+	return app.AutoRollback
+}
+
+// SetAutoRollback changes how the units of the app are watched after deploys.
+// The zero value disables automatic rollbacks.
+func (app *App) SetAutoRollback(r provision.AutoRollback) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"autorollback": r}}
+	if !r.Enabled() {
+		update = bson.M{"$unset": bson.M{"autorollback": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.AutoRollback = r
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestAppSetAutoRollback(c *check.C) {
+	a := App{Name: "myapp", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	autoRollback := provision.AutoRollback{Window: 600, MaxRestarts: 3, MaxErrors: 10}
+	err = a.SetAutoRollback(autoRollback)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.GetAutoRollback(), check.DeepEquals, autoRollback)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoRollback, check.DeepEquals, autoRollback)
+	err = a.SetAutoRollback(provision.AutoRollback{})
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoRollback.Enabled(), check.Equals, false)
+}
+
+func (s *S) TestAppSetAutoRollbackInvalid(c *check.C) {
+	a := App{Name: "myapp", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetAutoRollback(provision.AutoRollback{Window: 600})
+	c.Assert(err, check.Equals, provision.ErrInvalidAutoRollback)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoRollback.Enabled(), check.Equals, false)
+}
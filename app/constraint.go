@@ -0,0 +1,162 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of placement constraints.
+const (
+	// ConstraintRequire places units only in nodes matching the constraint.
+	ConstraintRequire = "require"
+	// ConstraintPrefer places units in nodes matching the constraint when
+	// there are any available.
+	ConstraintPrefer = "prefer"
+	// ConstraintSpread distributes units evenly among the groups of nodes
+	// with the same value for the metadata key.
+	ConstraintSpread = "spread"
+)
+
+var (
+	ErrConstraintAlreadySet = errors.New("placement constraint already set in this app")
+	ErrConstraintNotFound   = errors.New("placement constraint not found in this app")
+)
+
+type ConstraintValidationError struct{ msg string }
+
+func (e ConstraintValidationError) Error() string {
+	return fmt.Sprintf("invalid placement constraint: %s", e.msg)
+}
+
+// PlacementConstraint restricts the nodes where the units of an app, or of
+// one of its processes, are placed based on the metadata of the nodes. With
+// Exclude set, require and prefer constraints match the nodes whose metadata
+// is different from Value (anti-affinity).
+type PlacementConstraint struct {
+	Kind    string
+	Process string `bson:",omitempty" json:",omitempty"`
+	Key     string
+	Value   string `bson:",omitempty" json:",omitempty"`
+	Exclude bool   `bson:",omitempty" json:",omitempty"`
+}
+
+// ParsePlacementConstraint parses constraints in the forms "require key=value",
+// "require key!=value", "prefer key=value", "prefer key!=value" and
+// "spread key", applying them to the given process or, if it's empty, to
+// all processes of the app.
+func ParsePlacementConstraint(value, process string) (PlacementConstraint, error) {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return PlacementConstraint{}, ConstraintValidationError{fmt.Sprintf("%q, expected <kind> <expression>", value)}
+	}
+	c := PlacementConstraint{Kind: parts[0], Process: process}
+	expr := parts[1]
+	switch c.Kind {
+	case ConstraintRequire, ConstraintPrefer:
+		sep := "="
+		if strings.Contains(expr, "!=") {
+			sep = "!="
+			c.Exclude = true
+		}
+		kv := strings.SplitN(expr, sep, 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return PlacementConstraint{}, ConstraintValidationError{fmt.Sprintf("%q, expected key=value or key!=value", expr)}
+		}
+		c.Key, c.Value = kv[0], kv[1]
+	case ConstraintSpread:
+		if strings.ContainsAny(expr, "=!") {
+			return PlacementConstraint{}, ConstraintValidationError{fmt.Sprintf("%q, spread expects a metadata key", expr)}
+		}
+		c.Key = expr
+	default:
+		return PlacementConstraint{}, ConstraintValidationError{fmt.Sprintf("unknown kind %q, expected require, prefer or spread", c.Kind)}
+	}
+	return c, nil
+}
+
+func (c PlacementConstraint) String() string {
+	if c.Kind == ConstraintSpread {
+		return c.Kind + " " + c.Key
+	}
+	sep := "="
+	if c.Exclude {
+		sep = "!="
+	}
+	return c.Kind + " " + c.Key + sep + c.Value
+}
+
+// Matches returns whether a node with the given metadata satisfies the
+// constraint. Spread constraints are satisfied by any node.
+func (c PlacementConstraint) Matches(metadata map[string]string) bool {
+	if c.Kind == ConstraintSpread {
+		return true
+	}
+	return (metadata[c.Key] == c.Value) != c.Exclude
+}
+
+// ConstraintsForProcess returns the constraints of the app applying to the
+// given process, including the ones set for all processes.
+func (app *App) ConstraintsForProcess(process string) []PlacementConstraint {
+	var result []PlacementConstraint
+	for _, c := range app.Constraints {
+		if c.Process == "" || c.Process == process {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// AddConstraint adds a placement constraint to the app. Constraints are used
+// when units are added or moved, existing units are kept in their nodes
+// until they're rebalanced.
+func (app *App) AddConstraint(c PlacementConstraint) error {
+	for _, current := range app.Constraints {
+		if current == c {
+			return ErrConstraintAlreadySet
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$push": bson.M{"constraints": c}})
+	if err != nil {
+		return err
+	}
+	app.Constraints = append(app.Constraints, c)
+	return nil
+}
+
+// RemoveConstraint removes a placement constraint from the app.
+func (app *App) RemoveConstraint(c PlacementConstraint) error {
+	index := -1
+	for i, current := range app.Constraints {
+		if current == c {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrConstraintNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"constraints": c}})
+	if err != nil {
+		return err
+	}
+	app.Constraints = append(app.Constraints[:index], app.Constraints[index+1:]...)
+	return nil
+}
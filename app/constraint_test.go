@@ -0,0 +1,93 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestParsePlacementConstraint(c *check.C) {
+	tests := []struct {
+		value    string
+		process  string
+		expected PlacementConstraint
+	}{
+		{"require zone=a", "", PlacementConstraint{Kind: ConstraintRequire, Key: "zone", Value: "a"}},
+		{"require zone!=a", "web", PlacementConstraint{Kind: ConstraintRequire, Process: "web", Key: "zone", Value: "a", Exclude: true}},
+		{"prefer ssd=true", "", PlacementConstraint{Kind: ConstraintPrefer, Key: "ssd", Value: "true"}},
+		{"  spread   zone ", "worker", PlacementConstraint{Kind: ConstraintSpread, Process: "worker", Key: "zone"}},
+	}
+	for _, tt := range tests {
+		constraint, err := ParsePlacementConstraint(tt.value, tt.process)
+		c.Check(err, check.IsNil)
+		c.Check(constraint, check.DeepEquals, tt.expected)
+	}
+}
+
+func (s *S) TestParsePlacementConstraintInvalid(c *check.C) {
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{"", `invalid placement constraint: "", expected <kind> <expression>`},
+		{"require zone = a", `invalid placement constraint: "require zone = a", expected <kind> <expression>`},
+		{"require zone", `invalid placement constraint: "zone", expected key=value or key!=value`},
+		{"prefer =a", `invalid placement constraint: "=a", expected key=value or key!=value`},
+		{"spread zone=a", `invalid placement constraint: "zone=a", spread expects a metadata key`},
+		{"avoid zone=a", `invalid placement constraint: unknown kind "avoid", expected require, prefer or spread`},
+	}
+	for _, tt := range tests {
+		_, err := ParsePlacementConstraint(tt.value, "")
+		c.Check(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestPlacementConstraintStringAndMatches(c *check.C) {
+	require := PlacementConstraint{Kind: ConstraintRequire, Key: "zone", Value: "a"}
+	exclude := PlacementConstraint{Kind: ConstraintRequire, Key: "zone", Value: "a", Exclude: true}
+	spread := PlacementConstraint{Kind: ConstraintSpread, Key: "zone"}
+	c.Assert(require.String(), check.Equals, "require zone=a")
+	c.Assert(exclude.String(), check.Equals, "require zone!=a")
+	c.Assert(spread.String(), check.Equals, "spread zone")
+	c.Assert(require.Matches(map[string]string{"zone": "a"}), check.Equals, true)
+	c.Assert(require.Matches(map[string]string{"zone": "b"}), check.Equals, false)
+	c.Assert(require.Matches(nil), check.Equals, false)
+	c.Assert(exclude.Matches(map[string]string{"zone": "a"}), check.Equals, false)
+	c.Assert(exclude.Matches(map[string]string{"zone": "b"}), check.Equals, true)
+	c.Assert(exclude.Matches(nil), check.Equals, true)
+	c.Assert(spread.Matches(nil), check.Equals, true)
+}
+
+func (s *S) TestAppConstraintsForProcess(c *check.C) {
+	all := PlacementConstraint{Kind: ConstraintSpread, Key: "zone"}
+	web := PlacementConstraint{Kind: ConstraintPrefer, Process: "web", Key: "ssd", Value: "true"}
+	worker := PlacementConstraint{Kind: ConstraintRequire, Process: "worker", Key: "gpu", Value: "true"}
+	a := App{Name: "myapp", Constraints: []PlacementConstraint{all, web, worker}}
+	c.Assert(a.ConstraintsForProcess("web"), check.DeepEquals, []PlacementConstraint{all, web})
+	c.Assert(a.ConstraintsForProcess("worker"), check.DeepEquals, []PlacementConstraint{all, worker})
+	c.Assert(a.ConstraintsForProcess("other"), check.DeepEquals, []PlacementConstraint{all})
+}
+
+func (s *S) TestAppAddRemoveConstraint(c *check.C) {
+	a := App{Name: "myapp", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	constraint := PlacementConstraint{Kind: ConstraintRequire, Process: "web", Key: "zone", Value: "a"}
+	err = a.AddConstraint(constraint)
+	c.Assert(err, check.IsNil)
+	err = a.AddConstraint(constraint)
+	c.Assert(err, check.Equals, ErrConstraintAlreadySet)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Constraints, check.DeepEquals, []PlacementConstraint{constraint})
+	err = a.RemoveConstraint(PlacementConstraint{Kind: ConstraintRequire, Key: "zone", Value: "a"})
+	c.Assert(err, check.Equals, ErrConstraintNotFound)
+	err = a.RemoveConstraint(constraint)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Constraints, check.HasLen, 0)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Constraints, check.HasLen, 0)
+}
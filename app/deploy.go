@@ -35,19 +35,20 @@ const (
 var reImageVersion = regexp.MustCompile("v[0-9]+$")
 
 type DeployData struct {
-	ID          bson.ObjectId `bson:"_id,omitempty"`
-	App         string
-	Timestamp   time.Time
-	Duration    time.Duration
-	Commit      string
-	Error       string
-	Image       string
-	Log         string
-	User        string
-	Origin      string
-	CanRollback bool
-	RemoveDate  time.Time `bson:",omitempty"`
-	Diff        string
+	ID           bson.ObjectId `bson:"_id,omitempty"`
+	App          string
+	Timestamp    time.Time
+	Duration     time.Duration
+	Commit       string
+	Error        string
+	Image        string
+	Log          string
+	User         string
+	Origin       string
+	CanRollback  bool
+	RemoveDate   time.Time `bson:",omitempty"`
+	Diff         string
+	AutoRollback string
 }
 
 func findValidImages(apps ...string) (set, error) {
@@ -133,6 +134,7 @@ func eventToDeployData(evt *event.Event, validImages set, full bool) *DeployData
 		err = evt.OtherData(&otherData)
 		if err == nil {
 			data.Diff = otherData["diff"]
+			data.AutoRollback = otherData["autoRollback"]
 		}
 	}
 	var endData map[string]string
@@ -162,6 +164,7 @@ type DeployOptions struct {
 	Origin       string
 	Rollback     bool
 	Build        bool
+	Dockerfile   bool
 	Event        *event.Event `bson:"-"`
 	Kind         DeployKind
 	Message      string
@@ -236,11 +239,11 @@ func deployToProvisioner(opts *DeployOptions, evt *event.Event) (string, error)
 		fallthrough
 	case DeployUpload, DeployUploadBuild:
 		if deployer, ok := Provisioner.(provision.UploadDeployer); ok {
-			return deployer.UploadDeploy(opts.App, opts.File, opts.FileSize, opts.Build, evt)
+			return deployer.UploadDeploy(opts.App, opts.File, opts.FileSize, opts.Build, opts.Dockerfile, evt)
 		}
 		fallthrough
 	default:
-		return Provisioner.(provision.ArchiveDeployer).ArchiveDeploy(opts.App, opts.ArchiveURL, evt)
+		return Provisioner.(provision.ArchiveDeployer).ArchiveDeploy(opts.App, opts.ArchiveURL, opts.Dockerfile, evt)
 	}
 }
 
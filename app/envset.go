@@ -0,0 +1,327 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrEnvSetNotFound        = errors.New("env set not found")
+	ErrEnvSetAlreadyExists   = errors.New("env set already exists")
+	ErrEnvSetInvalidOwner    = errors.New("env set must be owned by exactly one team or pool")
+	ErrEnvSetInUse           = errors.New("env set is attached to apps, detach it before removing")
+	ErrEnvSetAlreadyAttached = errors.New("env set already attached to this app")
+	ErrEnvSetNotAttached     = errors.New("env set is not attached to this app")
+	ErrEnvSetNotAllowed      = errors.New("env set is not available to the app's teams or pool")
+)
+
+type EnvSetValidationError struct{ field string }
+
+func (e EnvSetValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.field)
+}
+
+// EnvSet is a named group of environment variables owned by a team or by a
+// pool. Apps may attach to env sets, receiving their variables with lower
+// precedence than the ones set directly in the app or by bound services.
+type EnvSet struct {
+	Name string                 `bson:"_id" json:"name"`
+	Team string                 `json:"team,omitempty"`
+	Pool string                 `json:"pool,omitempty"`
+	Envs map[string]bind.EnvVar `json:"envs"`
+}
+
+// Create validates and stores a new env set.
+func (s *EnvSet) Create() error {
+	if !nameRegexp.MatchString(s.Name) {
+		return EnvSetValidationError{"name"}
+	}
+	if (s.Team == "") == (s.Pool == "") {
+		return ErrEnvSetInvalidOwner
+	}
+	if s.Envs == nil {
+		s.Envs = map[string]bind.EnvVar{}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.EnvSets().Insert(s)
+	if mgo.IsDup(err) {
+		return ErrEnvSetAlreadyExists
+	}
+	return err
+}
+
+// IsAvailableTo returns whether the env set may be attached to the given app,
+// i.e. the set is owned by one of the app's teams or by the app's pool.
+func (s *EnvSet) IsAvailableTo(app *App) bool {
+	if s.Pool != "" {
+		return s.Pool == app.Pool
+	}
+	for _, team := range app.Teams {
+		if team == s.Team {
+			return true
+		}
+	}
+	return false
+}
+
+// Apps returns the list of apps attached to the env set.
+func (s *EnvSet) Apps() ([]App, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{"envsets": s.Name}).Sort("name").All(&apps)
+	return apps, err
+}
+
+// SetEnvs adds or replaces variables in the env set and propagates the change
+// to every attached app. When shouldRestart is true, attached apps with units
+// are restarted one at a time.
+func (s *EnvSet) SetEnvs(envs []bind.EnvVar, shouldRestart bool, w io.Writer) error {
+	if len(envs) == 0 {
+		return nil
+	}
+	if s.Envs == nil {
+		s.Envs = map[string]bind.EnvVar{}
+	}
+	for _, env := range envs {
+		env.InstanceName = ""
+		s.Envs[env.Name] = env
+	}
+	err := s.save()
+	if err != nil {
+		return err
+	}
+	return s.propagate(shouldRestart, w)
+}
+
+// UnsetEnvs removes variables from the env set and propagates the change to
+// every attached app.
+func (s *EnvSet) UnsetEnvs(names []string, shouldRestart bool, w io.Writer) error {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		delete(s.Envs, name)
+	}
+	err := s.save()
+	if err != nil {
+		return err
+	}
+	return s.propagate(shouldRestart, w)
+}
+
+func (s *EnvSet) save() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.EnvSets().UpdateId(s.Name, bson.M{"$set": bson.M{"envs": s.Envs}})
+	if err == mgo.ErrNotFound {
+		return ErrEnvSetNotFound
+	}
+	return err
+}
+
+// propagate restarts the attached apps sequentially, so that only one app is
+// being restarted at any given time. Failures are reported in w and do not
+// stop the remaining apps from being restarted.
+func (s *EnvSet) propagate(shouldRestart bool, w io.Writer) error {
+	if !shouldRestart {
+		return nil
+	}
+	apps, err := s.Apps()
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for i := range apps {
+		a := &apps[i]
+		units, err := a.GetUnits()
+		if err != nil || len(units) == 0 {
+			continue
+		}
+		if w != nil {
+			fmt.Fprintf(w, "---- Restarting app %q (%d of %d) to apply env set %q ----\n", a.Name, i+1, len(apps), s.Name)
+		}
+		err = a.Restart("", w)
+		if err != nil {
+			log.Errorf("[env set %s] unable to restart app %s: %s", s.Name, a.Name, err)
+			if w != nil {
+				fmt.Fprintf(w, "---- Unable to restart app %q: %s ----\n", a.Name, err)
+			}
+			failed = append(failed, a.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to restart apps: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// GetEnvSet returns the env set with the given name.
+func GetEnvSet(name string) (*EnvSet, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var set EnvSet
+	err = conn.EnvSets().FindId(name).One(&set)
+	if err == mgo.ErrNotFound {
+		return nil, ErrEnvSetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// ListEnvSets returns the env sets matching the given query.
+func ListEnvSets(query bson.M) ([]EnvSet, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var sets []EnvSet
+	err = conn.EnvSets().Find(query).Sort("_id").All(&sets)
+	return sets, err
+}
+
+// RemoveEnvSet removes the env set with the given name. Env sets attached to
+// apps cannot be removed.
+func RemoveEnvSet(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	count, err := conn.Apps().Find(bson.M{"envsets": name}).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEnvSetInUse
+	}
+	err = conn.EnvSets().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrEnvSetNotFound
+	}
+	return err
+}
+
+// AttachEnvSet attaches the env set to the app. Sets attached later take
+// precedence over sets attached earlier when they define the same variable.
+func (app *App) AttachEnvSet(name string, shouldRestart bool, w io.Writer) error {
+	for _, setName := range app.EnvSets {
+		if setName == name {
+			return ErrEnvSetAlreadyAttached
+		}
+	}
+	set, err := GetEnvSet(name)
+	if err != nil {
+		return err
+	}
+	if !set.IsAvailableTo(app) {
+		return ErrEnvSetNotAllowed
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "envsets": bson.M{"$ne": name}},
+		bson.M{"$push": bson.M{"envsets": name}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrEnvSetAlreadyAttached
+	}
+	if err != nil {
+		return err
+	}
+	app.EnvSets = append(app.EnvSets, name)
+	return app.restartForEnvChange(shouldRestart, w)
+}
+
+// DetachEnvSet removes the env set from the app.
+func (app *App) DetachEnvSet(name string, shouldRestart bool, w io.Writer) error {
+	index := -1
+	for i, setName := range app.EnvSets {
+		if setName == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrEnvSetNotAttached
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"envsets": name}})
+	if err != nil {
+		return err
+	}
+	app.EnvSets = append(app.EnvSets[:index], app.EnvSets[index+1:]...)
+	return app.restartForEnvChange(shouldRestart, w)
+}
+
+func (app *App) restartForEnvChange(shouldRestart bool, w io.Writer) error {
+	if !shouldRestart {
+		return nil
+	}
+	units, err := app.GetUnits()
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	return Provisioner.Restart(app, "", w)
+}
+
+// envSets returns the env sets attached to the app, in the order they were
+// attached. Sets that no longer exist are ignored.
+func (app *App) envSets() ([]EnvSet, error) {
+	if len(app.EnvSets) == 0 {
+		return nil, nil
+	}
+	sets, err := ListEnvSets(bson.M{"_id": bson.M{"$in": app.EnvSets}})
+	if err != nil {
+		return nil, err
+	}
+	setMap := make(map[string]EnvSet, len(sets))
+	for _, set := range sets {
+		setMap[set.Name] = set
+	}
+	result := make([]EnvSet, 0, len(sets))
+	for _, name := range app.EnvSets {
+		if set, ok := setMap[name]; ok {
+			result = append(result, set)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestEnvSetCreate(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	dbSet, err := GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSet, check.DeepEquals, &EnvSet{Name: "tracing", Team: s.team.Name, Envs: map[string]bind.EnvVar{}})
+}
+
+func (s *S) TestEnvSetCreateInvalid(c *check.C) {
+	invalid := []EnvSet{
+		{Name: "", Team: "t1"},
+		{Name: "tracing"},
+		{Name: "tracing", Team: "t1", Pool: "p1"},
+	}
+	expected := []error{EnvSetValidationError{"name"}, ErrEnvSetInvalidOwner, ErrEnvSetInvalidOwner}
+	for i, set := range invalid {
+		err := set.Create()
+		c.Check(err, check.Equals, expected[i])
+	}
+}
+
+func (s *S) TestEnvSetCreateDuplicated(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	set = EnvSet{Name: "tracing", Pool: "pool1"}
+	err = set.Create()
+	c.Assert(err, check.Equals, ErrEnvSetAlreadyExists)
+}
+
+func (s *S) TestGetEnvSetNotFound(c *check.C) {
+	_, err := GetEnvSet("unknown")
+	c.Assert(err, check.Equals, ErrEnvSetNotFound)
+}
+
+func (s *S) TestRemoveEnvSet(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	err = RemoveEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	_, err = GetEnvSet("tracing")
+	c.Assert(err, check.Equals, ErrEnvSetNotFound)
+	err = RemoveEnvSet("tracing")
+	c.Assert(err, check.Equals, ErrEnvSetNotFound)
+}
+
+func (s *S) TestRemoveEnvSetInUse(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Teams: []string{s.team.Name}, EnvSets: []string{"tracing"}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = RemoveEnvSet("tracing")
+	c.Assert(err, check.Equals, ErrEnvSetInUse)
+}
+
+func (s *S) TestEnvSetIsAvailableTo(c *check.C) {
+	a := App{Name: "myapp", Teams: []string{"t1", "t2"}, Pool: "p1"}
+	c.Assert((&EnvSet{Team: "t2"}).IsAvailableTo(&a), check.Equals, true)
+	c.Assert((&EnvSet{Team: "t3"}).IsAvailableTo(&a), check.Equals, false)
+	c.Assert((&EnvSet{Pool: "p1"}).IsAvailableTo(&a), check.Equals, true)
+	c.Assert((&EnvSet{Pool: "p2"}).IsAvailableTo(&a), check.Equals, false)
+}
+
+func (s *S) TestAppAttachEnvSet(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Teams: []string{s.team.Name}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	var buf bytes.Buffer
+	err = a.AttachEnvSet("tracing", true, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.EnvSets, check.DeepEquals, []string{"tracing"})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.DeepEquals, []string{"tracing"})
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 1)
+	err = a.AttachEnvSet("tracing", true, &buf)
+	c.Assert(err, check.Equals, ErrEnvSetAlreadyAttached)
+}
+
+func (s *S) TestAppAttachEnvSetAlreadyAttachedConcurrently(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Teams: []string{s.team.Name}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	stale := a
+	err = a.AttachEnvSet("tracing", false, nil)
+	c.Assert(err, check.IsNil)
+	err = stale.AttachEnvSet("tracing", false, nil)
+	c.Assert(err, check.Equals, ErrEnvSetAlreadyAttached)
+	c.Assert(stale.EnvSets, check.HasLen, 0)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.DeepEquals, []string{"tracing"})
+}
+
+func (s *S) TestAppAttachEnvSetNotAllowed(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: "otherteam"}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Teams: []string{s.team.Name}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.AttachEnvSet("tracing", false, nil)
+	c.Assert(err, check.Equals, ErrEnvSetNotAllowed)
+}
+
+func (s *S) TestAppDetachEnvSet(c *check.C) {
+	for _, name := range []string{"s1", "s2"} {
+		set := EnvSet{Name: name, Pool: "pool1"}
+		err := set.Create()
+		c.Assert(err, check.IsNil)
+	}
+	a := App{Name: "myapp", Pool: "pool1", EnvSets: []string{"s1", "s2"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.DetachEnvSet("s1", false, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.EnvSets, check.DeepEquals, []string{"s2"})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.EnvSets, check.DeepEquals, []string{"s2"})
+	err = a.DetachEnvSet("s1", false, nil)
+	c.Assert(err, check.Equals, ErrEnvSetNotAttached)
+}
+
+func (s *S) TestEnvsWithEnvSetsPrecedence(c *check.C) {
+	s1 := EnvSet{Name: "s1", Team: s.team.Name, Envs: map[string]bind.EnvVar{
+		"A": {Name: "A", Value: "s1", Public: true},
+		"B": {Name: "B", Value: "s1", Public: true},
+		"C": {Name: "C", Value: "s1", Public: true},
+		"D": {Name: "D", Value: "s1", Public: true},
+	}}
+	s2 := EnvSet{Name: "s2", Team: s.team.Name, Envs: map[string]bind.EnvVar{
+		"B": {Name: "B", Value: "s2", Public: true},
+	}}
+	c.Assert(s1.Create(), check.IsNil)
+	c.Assert(s2.Create(), check.IsNil)
+	a := App{
+		Name:    "myapp",
+		Teams:   []string{s.team.Name},
+		EnvSets: []string{"s1", "s2"},
+		Env: map[string]bind.EnvVar{
+			"C": {Name: "C", Value: "service", InstanceName: "mydb"},
+			"D": {Name: "D", Value: "app", Public: true},
+		},
+	}
+	envs, err := a.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]bind.EnvVar{
+		"A": {Name: "A", Value: "s1", Public: true},
+		"B": {Name: "B", Value: "s2", Public: true},
+		"C": {Name: "C", Value: "service", InstanceName: "mydb"},
+		"D": {Name: "D", Value: "app", Public: true},
+	})
+}
+
+func (s *S) TestEnvSetSetEnvsPropagates(c *check.C) {
+	set := EnvSet{Name: "tracing", Team: s.team.Name}
+	err := set.Create()
+	c.Assert(err, check.IsNil)
+	a1 := App{Name: "myapp1", Teams: []string{s.team.Name}, EnvSets: []string{"tracing"}}
+	a2 := App{Name: "myapp2", Teams: []string{s.team.Name}, EnvSets: []string{"tracing"}}
+	a3 := App{Name: "myapp3", Teams: []string{s.team.Name}}
+	for _, a := range []App{a1, a2, a3} {
+		err = s.conn.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	s.provisioner.Provision(&a1)
+	defer s.provisioner.Destroy(&a1)
+	s.provisioner.AddUnits(&a1, 1, "web", nil)
+	var buf bytes.Buffer
+	err = set.SetEnvs([]bind.EnvVar{{Name: "TRACING_URL", Value: "http://tracing", Public: true}}, true, &buf)
+	c.Assert(err, check.IsNil)
+	dbSet, err := GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSet.Envs, check.DeepEquals, map[string]bind.EnvVar{
+		"TRACING_URL": {Name: "TRACING_URL", Value: "http://tracing", Public: true},
+	})
+	c.Assert(s.provisioner.Restarts(&a1, ""), check.Equals, 1)
+	c.Assert(s.provisioner.Restarts(&a2, ""), check.Equals, 0)
+	dbApp, err := GetByName(a2.Name)
+	c.Assert(err, check.IsNil)
+	envs, err := dbApp.Envs()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs["TRACING_URL"].Value, check.Equals, "http://tracing")
+	err = set.UnsetEnvs([]string{"TRACING_URL"}, false, &buf)
+	c.Assert(err, check.IsNil)
+	dbSet, err = GetEnvSet("tracing")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSet.Envs, check.DeepEquals, map[string]bind.EnvVar{})
+	c.Assert(s.provisioner.Restarts(&a1, ""), check.Equals, 1)
+}
+
+func (s *S) TestListEnvSets(c *check.C) {
+	for _, set := range []EnvSet{{Name: "b", Team: "t1"}, {Name: "a", Pool: "p1"}, {Name: "c", Team: "t2"}} {
+		err := set.Create()
+		c.Assert(err, check.IsNil)
+	}
+	sets, err := ListEnvSets(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 3)
+	c.Assert(sets[0].Name, check.Equals, "a")
+	sets, err = ListEnvSets(bson.M{"team": "t1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 1)
+	c.Assert(sets[0].Name, check.Equals, "b")
+}
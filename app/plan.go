@@ -21,8 +21,11 @@ type Plan struct {
 	Memory   int64  `json:"memory"`
 	Swap     int64  `json:"swap"`
 	CpuShare int    `json:"cpushare"`
-	Default  bool   `json:"default,omitempty"`
-	Router   string `json:"router,omitempty"`
+	// CpuLimit is the hard limit of CPUs available to each unit, enforced
+	// with the CFS quota. Zero means no limit.
+	CpuLimit float64 `json:"cpulimit,omitempty"`
+	Default  bool    `json:"default,omitempty"`
+	Router   string  `json:"router,omitempty"`
 }
 
 type PlanValidationError struct{ field string }
@@ -37,6 +40,7 @@ var (
 	ErrPlanDefaultAmbiguous = errors.New("more than one default plan found")
 	ErrLimitOfCpuShare      = errors.New("The minimum allowed cpu-shares is 2")
 	ErrLimitOfMemory        = errors.New("The minimum allowed memory is 4MB")
+	ErrLimitOfCpuLimit      = errors.New("The minimum allowed cpu limit is 0.01")
 )
 
 func (plan *Plan) Save() error {
@@ -49,6 +53,9 @@ func (plan *Plan) Save() error {
 	if plan.Memory > 0 && plan.Memory < 4194304 {
 		return ErrLimitOfMemory
 	}
+	if plan.CpuLimit < 0 || (plan.CpuLimit > 0 && plan.CpuLimit < 0.01) {
+		return ErrLimitOfCpuLimit
+	}
 	if plan.Router != "" {
 		_, err := router.Get(plan.Router)
 		if err != nil {
@@ -82,6 +82,14 @@ func (s *S) TestPlanAddInvalid(c *check.C) {
 	}
 }
 
+func (s *S) TestPlanAddInvalidCpuLimit(c *check.C) {
+	for _, limit := range []float64{-1, 0.001} {
+		p := Plan{Name: "plan1", CpuShare: 100, CpuLimit: limit}
+		err := p.Save()
+		c.Assert(err, check.Equals, ErrLimitOfCpuLimit)
+	}
+}
+
 func (s *S) TestPlanAddDupp(c *check.C) {
 	p := Plan{
 		Name:     "plan1",
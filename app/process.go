@@ -0,0 +1,165 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ProcessSettings overrides the settings of the app for the units of a single
+// process.
+type ProcessSettings struct {
+	// Plan replaces the plan of the app (memory, swap and cpu) for the units
+	// of the process.
+	Plan *Plan `bson:",omitempty" json:"plan,omitempty"`
+	// MaxUnits limits the number of units of the process. Zero means no
+	// limit.
+	MaxUnits int `bson:",omitempty" json:"maxUnits,omitempty"`
+}
+
+type ProcessUnitLimitError struct {
+	Process   string
+	Max       int
+	Requested int
+}
+
+func (e *ProcessUnitLimitError) Error() string {
+	return fmt.Sprintf("process %q is limited to %d units, requested %d", e.Process, e.Max, e.Requested)
+}
+
+// PlanForProcess returns the plan used by the units of the given process.
+func (app *App) PlanForProcess(process string) Plan {
+	if settings, ok := app.Processes[process]; ok && settings.Plan != nil {
+		return *settings.Plan
+	}
+	return app.Plan
+}
+
+// GetUnitResources returns the resources reserved for each unit of the given
+// process.
+func (app *App) GetUnitResources(process string) provision.UnitResources {
+	plan := app.PlanForProcess(process)
+	return provision.UnitResources{
+		Memory:   plan.Memory,
+		Swap:     plan.Swap,
+		CpuShare: plan.CpuShare,
+		CpuLimit: plan.CpuLimit,
+	}
+}
+
+// GetMaxUnits returns the maximum number of units of the given process, zero
+// means no limit.
+func (app *App) GetMaxUnits(process string) int {
+	return app.Processes[process].MaxUnits
+}
+
+// SetProcessPlan changes the plan used by the units of a process, restarting
+// them. An empty plan name makes the process use the plan of the app again.
+func (app *App) SetProcessPlan(process, planName string, w io.Writer) error {
+	settings := app.Processes[process]
+	if planName == "" {
+		settings.Plan = nil
+	} else {
+		plan, err := findPlanByName(planName)
+		if err != nil {
+			return err
+		}
+		settings.Plan = plan
+	}
+	err := app.saveProcessSettings(process, settings)
+	if err != nil {
+		return err
+	}
+	units, err := app.unitsForProcess(process)
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	return app.Restart(process, w)
+}
+
+// SetProcessMaxUnits limits the number of units of a process, zero removes the
+// limit. It fails if the process already has more units than the limit.
+func (app *App) SetProcessMaxUnits(process string, max int) error {
+	if max < 0 {
+		return fmt.Errorf("invalid max units for process %q: %d", process, max)
+	}
+	if max > 0 {
+		units, err := app.unitsForProcess(process)
+		if err != nil {
+			return err
+		}
+		if len(units) > max {
+			return &ProcessUnitLimitError{Process: process, Max: max, Requested: len(units)}
+		}
+	}
+	settings := app.Processes[process]
+	settings.MaxUnits = max
+	return app.saveProcessSettings(process, settings)
+}
+
+// checkProcessUnitLimit returns an error if adding n units to the process
+// would exceed its limit.
+func (app *App) checkProcessUnitLimit(process string, n int) error {
+	max := app.GetMaxUnits(process)
+	if max == 0 {
+		return nil
+	}
+	units, err := app.unitsForProcess(process)
+	if err != nil {
+		return err
+	}
+	if len(units)+n > max {
+		return &ProcessUnitLimitError{Process: process, Max: max, Requested: len(units) + n}
+	}
+	return nil
+}
+
+func (app *App) unitsForProcess(process string) ([]provision.Unit, error) {
+	units, err := app.Units()
+	if err != nil {
+		return nil, err
+	}
+	var result []provision.Unit
+	for _, u := range units {
+		if u.ProcessName == process {
+			result = append(result, u)
+		}
+	}
+	return result, nil
+}
+
+func (app *App) saveProcessSettings(process string, settings ProcessSettings) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	key := "processes." + process
+	update := bson.M{"$set": bson.M{key: settings}}
+	if settings == (ProcessSettings{}) {
+		update = bson.M{"$unset": bson.M{key: ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	if settings == (ProcessSettings{}) {
+		delete(app.Processes, process)
+		return nil
+	}
+	if app.Processes == nil {
+		app.Processes = make(map[string]ProcessSettings)
+	}
+	app.Processes[process] = settings
+	return nil
+}
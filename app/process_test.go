@@ -0,0 +1,94 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestAppPlanForProcess(c *check.C) {
+	small := Plan{Name: "small", Memory: 64, Swap: 32, CpuShare: 10, CpuLimit: 0.2}
+	a := App{
+		Name: "myapp",
+		Plan: Plan{Name: "large", Memory: 1024, Swap: 512, CpuShare: 100, CpuLimit: 2},
+		Processes: map[string]ProcessSettings{
+			"cron":   {Plan: &small, MaxUnits: 1},
+			"worker": {MaxUnits: 3},
+		},
+	}
+	c.Assert(a.PlanForProcess("cron"), check.DeepEquals, small)
+	c.Assert(a.PlanForProcess("worker"), check.DeepEquals, a.Plan)
+	c.Assert(a.PlanForProcess("web"), check.DeepEquals, a.Plan)
+	c.Assert(a.GetUnitResources("cron"), check.DeepEquals, provision.UnitResources{Memory: 64, Swap: 32, CpuShare: 10, CpuLimit: 0.2})
+	c.Assert(a.GetUnitResources("web"), check.DeepEquals, provision.UnitResources{Memory: 1024, Swap: 512, CpuShare: 100, CpuLimit: 2})
+	c.Assert(a.GetMaxUnits("cron"), check.Equals, 1)
+	c.Assert(a.GetMaxUnits("worker"), check.Equals, 3)
+	c.Assert(a.GetMaxUnits("web"), check.Equals, 0)
+}
+
+func (s *S) TestAppSetProcessPlan(c *check.C) {
+	plan := Plan{Name: "small", Memory: 4194304, CpuShare: 10}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Plans().RemoveId(plan.Name)
+	a := App{Name: "myapp", Platform: "python", Quota: quota.Unlimited}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 1, "cron", nil)
+	var buf bytes.Buffer
+	err = a.SetProcessPlan("cron", "small", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Restarts(&a, "cron"), check.Equals, 1)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.DeepEquals, map[string]ProcessSettings{"cron": {Plan: &plan}})
+	err = a.SetProcessPlan("worker", "small", &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Restarts(&a, "worker"), check.Equals, 0)
+	err = a.SetProcessPlan("cron", "", &buf)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.DeepEquals, map[string]ProcessSettings{"worker": {Plan: &plan}})
+	err = a.SetProcessPlan("cron", "unknown", &buf)
+	c.Assert(err, check.Equals, ErrPlanNotFound)
+}
+
+func (s *S) TestAppSetProcessMaxUnits(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", Quota: quota.Unlimited}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddUnits(2, "worker", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetProcessMaxUnits("worker", 1)
+	c.Assert(err, check.DeepEquals, &ProcessUnitLimitError{Process: "worker", Max: 1, Requested: 2})
+	err = a.SetProcessMaxUnits("worker", 3)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.DeepEquals, map[string]ProcessSettings{"worker": {MaxUnits: 3}})
+	err = a.AddUnits(2, "worker", nil)
+	c.Assert(err, check.DeepEquals, &ProcessUnitLimitError{Process: "worker", Max: 3, Requested: 4})
+	err = a.AddUnits(1, "worker", nil)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(5, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetProcessMaxUnits("worker", 0)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Processes, check.HasLen, 0)
+}
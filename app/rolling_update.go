@@ -0,0 +1,41 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GetRollingUpdate returns how the units of the app are replaced in deploys
+// and restarts.
+func (app *App) GetRollingUpdate() provision.RollingUpdate {
+	return app.RollingUpdate
+}
+
+// SetRollingUpdate changes how the units of the app are replaced in deploys
+// and restarts. The zero value makes tsuru replace all units at once again.
+func (app *App) SetRollingUpdate(r provision.RollingUpdate) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"rollingupdate": r}}
+	if !r.Enabled() {
+		update = bson.M{"$unset": bson.M{"rollingupdate": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.RollingUpdate = r
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestAppSetRollingUpdate(c *check.C) {
+	a := App{Name: "myapp", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	rolling := provision.RollingUpdate{MaxSurge: 2, MaxUnavailable: 1, Pause: 30}
+	err = a.SetRollingUpdate(rolling)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.GetRollingUpdate(), check.DeepEquals, rolling)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.RollingUpdate, check.DeepEquals, rolling)
+	err = a.SetRollingUpdate(provision.RollingUpdate{})
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.RollingUpdate.Enabled(), check.Equals, false)
+}
+
+func (s *S) TestAppSetRollingUpdateInvalid(c *check.C) {
+	a := App{Name: "myapp", Platform: "python"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetRollingUpdate(provision.RollingUpdate{BatchSize: 2})
+	c.Assert(err, check.Equals, provision.ErrInvalidRollingUpdate)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.RollingUpdate.Enabled(), check.Equals, false)
+}
@@ -0,0 +1,408 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// VolumeTypeHost volumes are directories in the nodes running the units,
+	// they are local to the node where they were first used.
+	VolumeTypeHost = "host"
+	// VolumeTypeNFS volumes are directories in a NFS server, mounted in the
+	// units using the local docker volume driver.
+	VolumeTypeNFS = "nfs"
+	// VolumeTypeDriver volumes are provided by a docker volume driver.
+	VolumeTypeDriver = "driver"
+)
+
+var (
+	ErrVolumePlanNotFound      = errors.New("volume plan not found")
+	ErrVolumePlanAlreadyExists = errors.New("volume plan already exists")
+	ErrVolumePlanInUse         = errors.New("volume plan is used by volumes, remove them before removing the plan")
+	ErrVolumeNotFound          = errors.New("volume not found")
+	ErrVolumeAlreadyExists     = errors.New("volume already exists")
+	ErrVolumeInUse             = errors.New("volume is bound to apps, unbind it before removing")
+	ErrVolumeAlreadyBound      = errors.New("volume already bound to this app at this mount point")
+	ErrVolumeNotBound          = errors.New("volume is not bound to this app at this mount point")
+	ErrVolumePoolMismatch      = errors.New("volume and app must be in the same pool")
+	ErrVolumeMountPointInUse   = errors.New("mount point already used by another volume in this app")
+)
+
+type VolumeValidationError struct{ field string }
+
+func (e VolumeValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.field)
+}
+
+// VolumePlan describes how the volumes of a pool are provided. Host plans
+// require the "path" option, the base directory of the volumes in the nodes.
+// NFS plans require the "server" and "path" options, the address of the NFS
+// server and the exported base directory of the volumes. Driver plans require
+// the name of the docker volume driver, options are passed to the driver.
+type VolumePlan struct {
+	Name   string            `json:"name"`
+	Pool   string            `json:"pool"`
+	Type   string            `json:"type"`
+	Driver string            `json:"driver,omitempty"`
+	Opts   map[string]string `json:"opts,omitempty"`
+}
+
+func (p *VolumePlan) validate() error {
+	if !nameRegexp.MatchString(p.Name) {
+		return VolumeValidationError{"name"}
+	}
+	if p.Pool == "" {
+		return VolumeValidationError{"pool"}
+	}
+	switch p.Type {
+	case VolumeTypeHost:
+		if !path.IsAbs(p.Opts["path"]) {
+			return VolumeValidationError{"path"}
+		}
+	case VolumeTypeNFS:
+		if p.Opts["server"] == "" {
+			return VolumeValidationError{"server"}
+		}
+		if !path.IsAbs(p.Opts["path"]) {
+			return VolumeValidationError{"path"}
+		}
+	case VolumeTypeDriver:
+		if p.Driver == "" {
+			return VolumeValidationError{"driver"}
+		}
+	default:
+		return VolumeValidationError{"type"}
+	}
+	return nil
+}
+
+// IsLocal returns whether the volumes of the plan are local to a single node.
+func (p *VolumePlan) IsLocal() bool {
+	return p.Type == VolumeTypeHost
+}
+
+// AddVolumePlan validates and stores a new volume plan.
+func AddVolumePlan(plan VolumePlan) error {
+	err := plan.validate()
+	if err != nil {
+		return err
+	}
+	_, err = provision.GetPoolByName(plan.Pool)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.VolumePlans().Insert(plan)
+	if mgo.IsDup(err) {
+		return ErrVolumePlanAlreadyExists
+	}
+	return err
+}
+
+// GetVolumePlan returns the volume plan with the given name in the pool.
+func GetVolumePlan(pool, name string) (*VolumePlan, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var plan VolumePlan
+	err = conn.VolumePlans().Find(bson.M{"pool": pool, "name": name}).One(&plan)
+	if err == mgo.ErrNotFound {
+		return nil, ErrVolumePlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ListVolumePlans returns the volume plans of the given pools, or of every
+// pool when no pool is given.
+func ListVolumePlans(pools ...string) ([]VolumePlan, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var query bson.M
+	if len(pools) > 0 {
+		query = bson.M{"pool": bson.M{"$in": pools}}
+	}
+	var plans []VolumePlan
+	err = conn.VolumePlans().Find(query).Sort("pool", "name").All(&plans)
+	return plans, err
+}
+
+// RemoveVolumePlan removes the volume plan with the given name in the pool.
+// Plans used by volumes cannot be removed.
+func RemoveVolumePlan(pool, name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	count, err := conn.Volumes().Find(bson.M{"pool": pool, "plan": name}).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVolumePlanInUse
+	}
+	err = conn.VolumePlans().Remove(bson.M{"pool": pool, "name": name})
+	if err == mgo.ErrNotFound {
+		return ErrVolumePlanNotFound
+	}
+	return err
+}
+
+// Volume is a named persistent volume owned by a team, created using one of
+// the volume plans of a pool. Volumes may be bound to the apps of the same
+// pool.
+type Volume struct {
+	Name      string `bson:"_id" json:"name"`
+	Pool      string `json:"pool"`
+	Plan      string `json:"plan"`
+	TeamOwner string `json:"teamOwner"`
+	// Node is the address of the node holding a local volume, set when the
+	// first unit using it is scheduled.
+	Node string `bson:",omitempty" json:"node,omitempty"`
+}
+
+type VolumeBindID struct {
+	Volume     string `json:"volume"`
+	App        string `json:"app"`
+	MountPoint string `json:"mountPoint"`
+}
+
+// VolumeBind is the bind between a volume and an app, mounting the volume in
+// every unit of the app at the mount point.
+type VolumeBind struct {
+	ID       VolumeBindID `bson:"_id" json:"id"`
+	ReadOnly bool         `json:"readOnly"`
+}
+
+// Create validates and stores a new volume.
+func (v *Volume) Create() error {
+	if !nameRegexp.MatchString(v.Name) {
+		return VolumeValidationError{"name"}
+	}
+	_, err := GetVolumePlan(v.Pool, v.Plan)
+	if err != nil {
+		return err
+	}
+	_, err = auth.GetTeam(v.TeamOwner)
+	if err != nil {
+		return err
+	}
+	v.Node = ""
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Volumes().Insert(v)
+	if mgo.IsDup(err) {
+		return ErrVolumeAlreadyExists
+	}
+	return err
+}
+
+// VolumePlan returns the plan used by the volume.
+func (v *Volume) VolumePlan() (*VolumePlan, error) {
+	return GetVolumePlan(v.Pool, v.Plan)
+}
+
+// Binds returns the binds of the volume.
+func (v *Volume) Binds() ([]VolumeBind, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var binds []VolumeBind
+	err = conn.VolumeBinds().Find(bson.M{"_id.volume": v.Name}).All(&binds)
+	return binds, err
+}
+
+// Bind mounts the volume in the units of the app at the given mount point.
+// When shouldRestart is true, the app is restarted to mount the volume.
+func (v *Volume) Bind(app *App, mountPoint string, readOnly, shouldRestart bool, w io.Writer) error {
+	if !path.IsAbs(mountPoint) || strings.Contains(mountPoint, ":") {
+		return VolumeValidationError{"mount point"}
+	}
+	mountPoint = path.Clean(mountPoint)
+	if app.Pool != v.Pool {
+		return ErrVolumePoolMismatch
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	id := VolumeBindID{Volume: v.Name, App: app.Name, MountPoint: mountPoint}
+	count, err := conn.VolumeBinds().FindId(id).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVolumeAlreadyBound
+	}
+	count, err = conn.VolumeBinds().Find(bson.M{"_id.app": app.Name, "_id.mountpoint": mountPoint}).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVolumeMountPointInUse
+	}
+	err = conn.VolumeBinds().Insert(VolumeBind{ID: id, ReadOnly: readOnly})
+	if mgo.IsDup(err) {
+		return ErrVolumeAlreadyBound
+	}
+	if err != nil {
+		return err
+	}
+	return app.restartForVolumeChange(shouldRestart, w)
+}
+
+// Unbind removes the volume from the units of the app. When shouldRestart is
+// true, the app is restarted to unmount the volume.
+func (v *Volume) Unbind(app *App, mountPoint string, shouldRestart bool, w io.Writer) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.VolumeBinds().RemoveId(VolumeBindID{Volume: v.Name, App: app.Name, MountPoint: path.Clean(mountPoint)})
+	if err == mgo.ErrNotFound {
+		return ErrVolumeNotBound
+	}
+	if err != nil {
+		return err
+	}
+	return app.restartForVolumeChange(shouldRestart, w)
+}
+
+// SetNode assigns a local volume to the node holding it. It returns false if
+// the volume was already assigned to another node.
+func (v *Volume) SetNode(address string) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	err = conn.Volumes().Update(
+		bson.M{"_id": v.Name, "node": bson.M{"$in": []interface{}{nil, "", address}}},
+		bson.M{"$set": bson.M{"node": address}},
+	)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v.Node = address
+	return true, nil
+}
+
+// GetVolume returns the volume with the given name.
+func GetVolume(name string) (*Volume, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var v Volume
+	err = conn.Volumes().FindId(name).One(&v)
+	if err == mgo.ErrNotFound {
+		return nil, ErrVolumeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListVolumes returns the volumes matching the given query.
+func ListVolumes(query bson.M) ([]Volume, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var volumes []Volume
+	err = conn.Volumes().Find(query).Sort("_id").All(&volumes)
+	return volumes, err
+}
+
+// RemoveVolume removes the volume with the given name. Volumes bound to apps
+// cannot be removed. Data stored in the volume is not removed.
+func RemoveVolume(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	count, err := conn.VolumeBinds().Find(bson.M{"_id.volume": name}).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVolumeInUse
+	}
+	err = conn.Volumes().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrVolumeNotFound
+	}
+	return err
+}
+
+// VolumeBinds returns the binds of volumes to the app.
+func (app *App) VolumeBinds() ([]VolumeBind, error) {
+	return GetVolumeBindsByApp(app.Name)
+}
+
+// GetVolumeBindsByApp returns the binds of volumes to the app with the given
+// name, sorted by mount point.
+func GetVolumeBindsByApp(appName string) ([]VolumeBind, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var binds []VolumeBind
+	err = conn.VolumeBinds().Find(bson.M{"_id.app": appName}).Sort("_id.mountpoint").All(&binds)
+	return binds, err
+}
+
+func (app *App) restartForVolumeChange(shouldRestart bool, w io.Writer) error {
+	if !shouldRestart {
+		return nil
+	}
+	units, err := app.GetUnits()
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	return Provisioner.Restart(app, "", w)
+}
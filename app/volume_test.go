@@ -0,0 +1,202 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAddVolumePlan(c *check.C) {
+	plan := VolumePlan{Name: "nfs1", Pool: s.Pool, Type: VolumeTypeNFS, Opts: map[string]string{"server": "10.0.0.1", "path": "/exports"}}
+	err := AddVolumePlan(plan)
+	c.Assert(err, check.IsNil)
+	dbPlan, err := GetVolumePlan(s.Pool, "nfs1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbPlan, check.DeepEquals, &plan)
+	err = AddVolumePlan(plan)
+	c.Assert(err, check.Equals, ErrVolumePlanAlreadyExists)
+}
+
+func (s *S) TestAddVolumePlanInvalid(c *check.C) {
+	invalid := []VolumePlan{
+		{Name: "", Pool: s.Pool, Type: VolumeTypeHost, Opts: map[string]string{"path": "/data"}},
+		{Name: "p1", Type: VolumeTypeHost, Opts: map[string]string{"path": "/data"}},
+		{Name: "p1", Pool: s.Pool, Type: VolumeTypeHost},
+		{Name: "p1", Pool: s.Pool, Type: VolumeTypeHost, Opts: map[string]string{"path": "data"}},
+		{Name: "p1", Pool: s.Pool, Type: VolumeTypeNFS, Opts: map[string]string{"path": "/exports"}},
+		{Name: "p1", Pool: s.Pool, Type: VolumeTypeDriver},
+		{Name: "p1", Pool: s.Pool, Type: "ceph"},
+	}
+	expected := []error{
+		VolumeValidationError{"name"},
+		VolumeValidationError{"pool"},
+		VolumeValidationError{"path"},
+		VolumeValidationError{"path"},
+		VolumeValidationError{"server"},
+		VolumeValidationError{"driver"},
+		VolumeValidationError{"type"},
+	}
+	for i, plan := range invalid {
+		err := AddVolumePlan(plan)
+		c.Check(err, check.Equals, expected[i])
+	}
+}
+
+func (s *S) TestAddVolumePlanPoolNotFound(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: "unknown", Type: VolumeTypeDriver, Driver: "rexray"}
+	err := AddVolumePlan(plan)
+	c.Assert(err, check.Equals, provision.ErrPoolNotFound)
+}
+
+func (s *S) TestListVolumePlans(c *check.C) {
+	err := provision.AddPool(provision.AddPoolOptions{Name: "pool2"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool2")
+	plans := []VolumePlan{
+		{Name: "b", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"},
+		{Name: "a", Pool: "pool2", Type: VolumeTypeDriver, Driver: "rexray"},
+		{Name: "a", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"},
+	}
+	for _, p := range plans {
+		c.Assert(AddVolumePlan(p), check.IsNil)
+	}
+	result, err := ListVolumePlans()
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 3)
+	c.Assert(result[0].Name, check.Equals, "a")
+	c.Assert(result[0].Pool, check.Equals, s.Pool)
+	c.Assert(result[1].Name, check.Equals, "b")
+	c.Assert(result[2].Pool, check.Equals, "pool2")
+	result, err = ListVolumePlans("pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].Pool, check.Equals, "pool2")
+}
+
+func (s *S) TestRemoveVolumePlan(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.IsNil)
+	err := RemoveVolumePlan(s.Pool, "p1")
+	c.Assert(err, check.Equals, ErrVolumePlanInUse)
+	c.Assert(RemoveVolume("data"), check.IsNil)
+	err = RemoveVolumePlan(s.Pool, "p1")
+	c.Assert(err, check.IsNil)
+	_, err = GetVolumePlan(s.Pool, "p1")
+	c.Assert(err, check.Equals, ErrVolumePlanNotFound)
+	err = RemoveVolumePlan(s.Pool, "p1")
+	c.Assert(err, check.Equals, ErrVolumePlanNotFound)
+}
+
+func (s *S) TestVolumeCreate(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeHost, Opts: map[string]string{"path": "/data"}}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	err := v.Create()
+	c.Assert(err, check.IsNil)
+	dbVolume, err := GetVolume("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbVolume, check.DeepEquals, &v)
+	err = v.Create()
+	c.Assert(err, check.Equals, ErrVolumeAlreadyExists)
+}
+
+func (s *S) TestVolumeCreateInvalid(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeHost, Opts: map[string]string{"path": "/data"}}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "Data!", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.Equals, VolumeValidationError{"name"})
+	v = Volume{Name: "data", Pool: s.Pool, Plan: "p2", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.Equals, ErrVolumePlanNotFound)
+	v = Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: "unknown"}
+	c.Assert(v.Create(), check.NotNil)
+}
+
+func (s *S) TestVolumeBindUnbind(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.IsNil)
+	a := App{Name: "myapp", Pool: s.Pool, Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	var buf bytes.Buffer
+	err = v.Bind(&a, "/var/data/", true, true, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 1)
+	binds, err := a.VolumeBinds()
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []VolumeBind{
+		{ID: VolumeBindID{Volume: "data", App: "myapp", MountPoint: "/var/data"}, ReadOnly: true},
+	})
+	err = v.Bind(&a, "/var/data", false, false, nil)
+	c.Assert(err, check.Equals, ErrVolumeAlreadyBound)
+	err = v.Bind(&a, "relative", false, false, nil)
+	c.Assert(err, check.Equals, VolumeValidationError{"mount point"})
+	c.Assert(RemoveVolume("data"), check.Equals, ErrVolumeInUse)
+	err = v.Unbind(&a, "/var/data", false, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 1)
+	binds, err = v.Binds()
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+	err = v.Unbind(&a, "/var/data", false, nil)
+	c.Assert(err, check.Equals, ErrVolumeNotBound)
+}
+
+func (s *S) TestVolumeBindMountPointInUse(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v1 := Volume{Name: "data1", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v1.Create(), check.IsNil)
+	v2 := Volume{Name: "data2", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v2.Create(), check.IsNil)
+	a := App{Name: "myapp", Pool: s.Pool, Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = v1.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.IsNil)
+	err = v2.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.Equals, ErrVolumeMountPointInUse)
+}
+
+func (s *S) TestVolumeBindPoolMismatch(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeDriver, Driver: "rexray"}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.IsNil)
+	a := App{Name: "myapp", Pool: "otherpool", Teams: []string{s.team.Name}}
+	err := v.Bind(&a, "/data", false, false, nil)
+	c.Assert(err, check.Equals, ErrVolumePoolMismatch)
+}
+
+func (s *S) TestVolumeSetNode(c *check.C) {
+	plan := VolumePlan{Name: "p1", Pool: s.Pool, Type: VolumeTypeHost, Opts: map[string]string{"path": "/data"}}
+	c.Assert(AddVolumePlan(plan), check.IsNil)
+	v := Volume{Name: "data", Pool: s.Pool, Plan: "p1", TeamOwner: s.team.Name}
+	c.Assert(v.Create(), check.IsNil)
+	ok, err := v.SetNode("10.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(v.Node, check.Equals, "10.0.0.1")
+	ok, err = v.SetNode("10.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	other, err := GetVolume("data")
+	c.Assert(err, check.IsNil)
+	ok, err = other.SetNode("10.0.0.2")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+	other, err = GetVolume("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(other.Node, check.Equals, "10.0.0.1")
+}
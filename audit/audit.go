@@ -0,0 +1,161 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package audit provides an append-only log of mutating requests received by
+// the tsuru API.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	OwnerTypeUser      = "user"
+	OwnerTypeApp       = "app"
+	OwnerTypeAnonymous = "anonymous"
+
+	filterMaxLimit = 1000
+)
+
+// Entry is a single audit record, describing one API request and its outcome.
+type Entry struct {
+	ID         bson.ObjectId `bson:"_id" json:"id"`
+	Date       time.Time     `json:"date"`
+	OwnerType  string        `json:"ownerType"`
+	Owner      string        `json:"owner,omitempty"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	App        string        `json:"app,omitempty"`
+	Team       string        `json:"team,omitempty"`
+	StatusCode int           `json:"statusCode"`
+	Duration   time.Duration `json:"duration"`
+	RequestID  string        `json:"requestID,omitempty"`
+	ClientIP   string        `json:"clientIP,omitempty"`
+}
+
+// Record stores a new entry in the audit log. Entries are never updated nor
+// removed by tsuru.
+func Record(e *Entry) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if e.ID == "" {
+		e.ID = bson.NewObjectId()
+	}
+	if e.Date.IsZero() {
+		e.Date = time.Now().UTC()
+	}
+	return conn.AuditLog().Insert(e)
+}
+
+// Filter is used to query the audit log. Zero values are ignored.
+type Filter struct {
+	OwnerType  string
+	Owner      string
+	Method     string
+	App        string
+	Team       string
+	StatusCode int
+	Since      time.Time
+	Until      time.Time
+
+	Limit int
+	Skip  int
+}
+
+// PruneUserValues limits the amount of entries that can be retrieved by a
+// single query.
+func (f *Filter) PruneUserValues() {
+	if f.Limit > filterMaxLimit || f.Limit <= 0 {
+		f.Limit = filterMaxLimit
+	}
+}
+
+func (f *Filter) toQuery() bson.M {
+	query := bson.M{}
+	if f == nil {
+		return query
+	}
+	if f.OwnerType != "" {
+		query["ownertype"] = f.OwnerType
+	}
+	if f.Owner != "" {
+		query["owner"] = f.Owner
+	}
+	if f.Method != "" {
+		query["method"] = f.Method
+	}
+	if f.App != "" {
+		query["app"] = f.App
+	}
+	if f.Team != "" {
+		query["team"] = f.Team
+	}
+	if f.StatusCode != 0 {
+		query["statuscode"] = f.StatusCode
+	}
+	var timeParts []bson.M
+	if !f.Since.IsZero() {
+		timeParts = append(timeParts, bson.M{"date": bson.M{"$gte": f.Since}})
+	}
+	if !f.Until.IsZero() {
+		timeParts = append(timeParts, bson.M{"date": bson.M{"$lte": f.Until}})
+	}
+	if len(timeParts) != 0 {
+		query["$and"] = timeParts
+	}
+	return query
+}
+
+// List returns the entries matching the filter, most recent first.
+func List(filter *Filter) ([]Entry, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := conn.AuditLog().Find(filter.toQuery()).Sort("-date")
+	if filter != nil {
+		if filter.Skip > 0 {
+			query = query.Skip(filter.Skip)
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+	}
+	var entries []Entry
+	err = query.All(&entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Export writes every entry matching the filter to w as JSON lines, oldest
+// first. Limit and Skip in the filter are ignored.
+func Export(w io.Writer, filter *Filter) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	iter := conn.AuditLog().Find(filter.toQuery()).Sort("date").Iter()
+	encoder := json.NewEncoder(w)
+	var entry Entry
+	for iter.Next(&entry) {
+		err = encoder.Encode(entry)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestRecord(c *check.C) {
+	entry := Entry{
+		OwnerType:  OwnerTypeUser,
+		Owner:      "me@me.com",
+		Method:     "POST",
+		Path:       "/apps/myapp/env",
+		App:        "myapp",
+		StatusCode: 200,
+		Duration:   time.Second,
+		RequestID:  "abc",
+		ClientIP:   "10.0.0.1",
+	}
+	err := Record(&entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.ID, check.Not(check.Equals), "")
+	c.Assert(entry.Date.IsZero(), check.Equals, false)
+	entries, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].ID, check.Equals, entry.ID)
+	c.Assert(entries[0].Owner, check.Equals, "me@me.com")
+	c.Assert(entries[0].Path, check.Equals, "/apps/myapp/env")
+	c.Assert(entries[0].StatusCode, check.Equals, 200)
+	c.Assert(entries[0].Duration, check.Equals, time.Second)
+}
+
+func (s *S) TestListFilter(c *check.C) {
+	now := time.Now().UTC()
+	entries := []Entry{
+		{Date: now.Add(-2 * time.Hour), OwnerType: OwnerTypeUser, Owner: "a@a.com", Method: "POST", App: "app1", StatusCode: 200},
+		{Date: now.Add(-time.Hour), OwnerType: OwnerTypeUser, Owner: "b@b.com", Method: "DELETE", Team: "team1", StatusCode: 403},
+		{Date: now, OwnerType: OwnerTypeAnonymous, Method: "POST", StatusCode: 401},
+	}
+	for i := range entries {
+		err := Record(&entries[i])
+		c.Assert(err, check.IsNil)
+	}
+	result, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 3)
+	c.Assert(result[0].ID, check.Equals, entries[2].ID)
+	c.Assert(result[2].ID, check.Equals, entries[0].ID)
+	result, err = List(&Filter{Owner: "b@b.com"})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, entries[1].ID)
+	result, err = List(&Filter{App: "app1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, entries[0].ID)
+	result, err = List(&Filter{StatusCode: 401})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, entries[2].ID)
+	result, err = List(&Filter{Since: now.Add(-90 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 2)
+	result, err = List(&Filter{Limit: 1, Skip: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, entries[1].ID)
+}
+
+func (s *S) TestFilterPruneUserValues(c *check.C) {
+	f := Filter{Limit: 5000}
+	f.PruneUserValues()
+	c.Assert(f.Limit, check.Equals, filterMaxLimit)
+	f = Filter{Limit: 10}
+	f.PruneUserValues()
+	c.Assert(f.Limit, check.Equals, 10)
+}
+
+func (s *S) TestExport(c *check.C) {
+	now := time.Now().UTC()
+	for i, owner := range []string{"a@a.com", "b@b.com"} {
+		err := Record(&Entry{Date: now.Add(time.Duration(i) * time.Minute), OwnerType: OwnerTypeUser, Owner: owner, Method: "POST"})
+		c.Assert(err, check.IsNil)
+	}
+	var buf bytes.Buffer
+	err := Export(&buf, nil)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	var entry Entry
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.Owner, check.Equals, "a@a.com")
+	err = json.Unmarshal([]byte(lines[1]), &entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.Owner, check.Equals, "b@b.com")
+}
@@ -0,0 +1,312 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package authtest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/go-asn1-ber/asn1-ber"
+)
+
+const (
+	ldapBindRequest       = 0
+	ldapBindResponse      = 1
+	ldapUnbindRequest     = 2
+	ldapSearchRequest     = 3
+	ldapSearchResultEntry = 4
+	ldapSearchResultDone  = 5
+	ldapExtendedResponse  = 24
+)
+
+const (
+	ldapResultSuccess            = 0
+	ldapResultProtocolError      = 2
+	ldapResultInvalidCredentials = 49
+	ldapResultUnwillingToPerform = 53
+)
+
+const (
+	ldapFilterAnd           = 0
+	ldapFilterOr            = 1
+	ldapFilterNot           = 2
+	ldapFilterEqualityMatch = 3
+	ldapFilterPresent       = 7
+)
+
+const (
+	ldapScopeBaseObject  = 0
+	ldapScopeSingleLevel = 1
+
+	ldapAllAttributes = "*"
+)
+
+// LDAPEntry is an entry in the fake LDAP directory. Entries with a Password
+// can be used in simple binds.
+type LDAPEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+func (e *LDAPEntry) attribute(name string) []string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// LDAPServer is a fake LDAP server implementation.
+//
+// It supports only simple binds and searches using equality, presence, and,
+// or and not filters, comparing values case insensitively. It's supposed to
+// be used in tests only.
+//
+// Use NewLDAPServer to create a new instance and start serving;
+// LDAPServer.URL() will get you the URL of the server and Stop will stop the
+// server, closing the listener. Successful binds are recorded in the Binds
+// slice.
+type LDAPServer struct {
+	// Binds stores the DNs of all successful binds, use the mutex to access
+	// it.
+	Binds []string
+	sync.RWMutex
+	entries  []LDAPEntry
+	listener net.Listener
+}
+
+// NewLDAPServer creates a new LDAP server holding the given entries, for
+// testing purposes.
+func NewLDAPServer(entries ...LDAPEntry) (*LDAPServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := LDAPServer{listener: l, entries: entries}
+	go s.serve()
+	return &s, nil
+}
+
+// Addr returns the address of the server, in the form <host>:<port>.
+func (s *LDAPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL returns the URL of the server, in the form ldap://<host>:<port>.
+func (s *LDAPServer) URL() string {
+	return "ldap://" + s.Addr()
+}
+
+// Stop stops the server. It's safe to call this method multiple times.
+func (s *LDAPServer) Stop() {
+	s.listener.Close()
+}
+
+// AddEntry adds a new entry to the directory.
+func (s *LDAPServer) AddEntry(e LDAPEntry) {
+	s.Lock()
+	s.entries = append(s.entries, e)
+	s.Unlock()
+}
+
+// Reset resets the server, cleaning up the recorded binds.
+func (s *LDAPServer) Reset() {
+	s.Lock()
+	s.Binds = nil
+	s.Unlock()
+}
+
+func (s *LDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *LDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldapBindRequest:
+			responses = []*ber.Packet{s.bind(op)}
+		case ldapUnbindRequest:
+			return
+		case ldapSearchRequest:
+			responses = s.search(op)
+		default:
+			responses = []*ber.Packet{ldapResult(ldapExtendedResponse, ldapResultProtocolError, "operation not supported")}
+		}
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+			envelope.AppendChild(response)
+			_, err = conn.Write(envelope.Bytes())
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func ldapResult(tag ber.Tag, code int64, message string) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return result
+}
+
+func packetString(p *ber.Packet) string {
+	if p.Data == nil {
+		return ""
+	}
+	return p.Data.String()
+}
+
+func (s *LDAPServer) bind(op *ber.Packet) *ber.Packet {
+	if len(op.Children) < 3 {
+		return ldapResult(ldapBindResponse, ldapResultProtocolError, "invalid bind request")
+	}
+	dn := packetString(op.Children[1])
+	password := packetString(op.Children[2])
+	if dn == "" && password == "" {
+		return ldapResult(ldapBindResponse, ldapResultSuccess, "")
+	}
+	if password == "" {
+		return ldapResult(ldapBindResponse, ldapResultUnwillingToPerform, "unauthenticated bind not allowed")
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.DN, dn) && e.Password != "" && e.Password == password {
+			s.Binds = append(s.Binds, e.DN)
+			return ldapResult(ldapBindResponse, ldapResultSuccess, "")
+		}
+	}
+	return ldapResult(ldapBindResponse, ldapResultInvalidCredentials, "invalid credentials")
+}
+
+func (s *LDAPServer) search(op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{ldapResult(ldapSearchResultDone, ldapResultProtocolError, "invalid search request")}
+	}
+	base := strings.ToLower(packetString(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var attributes []string
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, packetString(attr))
+	}
+	s.RLock()
+	defer s.RUnlock()
+	var responses []*ber.Packet
+	for i := range s.entries {
+		e := &s.entries[i]
+		if !inScope(strings.ToLower(e.DN), base, scope) || !matchFilter(e, filter) {
+			continue
+		}
+		responses = append(responses, searchEntry(e, attributes))
+	}
+	return append(responses, ldapResult(ldapSearchResultDone, ldapResultSuccess, ""))
+}
+
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ldapScopeBaseObject:
+		return dn == base
+	case ldapScopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == base
+	}
+	return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+func matchFilter(e *LDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldapFilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(e, child) {
+				return false
+			}
+		}
+		return true
+	case ldapFilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(e, child) {
+				return true
+			}
+		}
+		return false
+	case ldapFilterNot:
+		return len(filter.Children) == 1 && !matchFilter(e, filter.Children[0])
+	case ldapFilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		attr := packetString(filter.Children[0])
+		value := packetString(filter.Children[1])
+		if strings.EqualFold(attr, "dn") {
+			return strings.EqualFold(e.DN, value)
+		}
+		for _, v := range e.attribute(attr) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldapFilterPresent:
+		return len(e.attribute(packetString(filter))) > 0
+	}
+	return false
+}
+
+func searchEntry(e *LDAPEntry, attributes []string) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	all := len(attributes) == 0
+	for _, attr := range attributes {
+		if attr == ldapAllAttributes {
+			all = true
+		}
+	}
+	for name, values := range e.Attributes {
+		if !all && !containsFold(attributes, name) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	entry.AppendChild(attrs)
+	return entry
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
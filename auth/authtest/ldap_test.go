@@ -0,0 +1,77 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package authtest
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newLDAPServer(c *check.C) *LDAPServer {
+	server, err := NewLDAPServer(
+		LDAPEntry{
+			DN:       "uid=gopher,ou=people,dc=tsuru,dc=io",
+			Password: "secret",
+			Attributes: map[string][]string{
+				"uid":  {"gopher"},
+				"mail": {"gopher@tsuru.io"},
+			},
+		},
+		LDAPEntry{
+			DN: "cn=devs,ou=groups,dc=tsuru,dc=io",
+			Attributes: map[string][]string{
+				"cn":     {"devs"},
+				"member": {"uid=gopher,ou=people,dc=tsuru,dc=io"},
+			},
+		},
+	)
+	c.Assert(err, check.IsNil)
+	return server
+}
+
+func (s *S) TestLDAPServerBind(c *check.C) {
+	server := s.newLDAPServer(c)
+	defer server.Stop()
+	conn, err := ldap.DialURL(server.URL())
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Bind("uid=gopher,ou=people,dc=tsuru,dc=io", "wrong")
+	c.Assert(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials), check.Equals, true)
+	err = conn.Bind("uid=gopher,ou=people,dc=tsuru,dc=io", "secret")
+	c.Assert(err, check.IsNil)
+	server.RLock()
+	defer server.RUnlock()
+	c.Assert(server.Binds, check.DeepEquals, []string{"uid=gopher,ou=people,dc=tsuru,dc=io"})
+}
+
+func (s *S) TestLDAPServerSearch(c *check.C) {
+	server := s.newLDAPServer(c)
+	defer server.Stop()
+	conn, err := ldap.DialURL(server.URL())
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	result, err := conn.Search(ldap.NewSearchRequest(
+		"ou=people,dc=tsuru,dc=io", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=*)(uid=GOPHER))", []string{"mail"}, nil,
+	))
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Entries, check.HasLen, 0)
+	result, err = conn.Search(ldap.NewSearchRequest(
+		"ou=people,dc=tsuru,dc=io", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(mail=*)(uid=GOPHER))", []string{"mail"}, nil,
+	))
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Entries, check.HasLen, 1)
+	c.Assert(result.Entries[0].DN, check.Equals, "uid=gopher,ou=people,dc=tsuru,dc=io")
+	c.Assert(result.Entries[0].GetAttributeValue("mail"), check.Equals, "gopher@tsuru.io")
+	c.Assert(result.Entries[0].GetAttributeValue("uid"), check.Equals, "")
+	result, err = conn.Search(ldap.NewSearchRequest(
+		"dc=tsuru,dc=io", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(|(member=uid=gopher,ou=people,dc=tsuru,dc=io)(cn=admins))", []string{"cn"}, nil,
+	))
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Entries, check.HasLen, 1)
+	c.Assert(result.Entries[0].GetAttributeValue("cn"), check.Equals, "devs")
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import "github.com/tsuru/tsuru/permission"
+
+// ExplainPermission evaluates a permission check for the token, describing
+// the permissions involved in the check. The roles granting or denying each
+// permission are included whenever the token permissions come directly from
+// roles, which isn't the case for app tokens and scoped personal tokens.
+func ExplainPermission(t Token, scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) (permission.Explanation, error) {
+	var roles []RoleInstance
+	switch token := t.(type) {
+	case *ServiceAccountToken:
+		roles = token.Account.Roles
+	case *PersonalToken:
+		if len(token.Scopes) > 0 {
+			return explainTokenPermissions(t, scheme, contexts)
+		}
+		u, err := token.User()
+		if err != nil {
+			return permission.Explanation{}, err
+		}
+		roles = u.Roles
+	default:
+		if t.IsAppToken() {
+			return explainTokenPermissions(t, scheme, contexts)
+		}
+		u, err := t.User()
+		if err != nil {
+			return permission.Explanation{}, err
+		}
+		roles = u.Roles
+	}
+	return ExplainRolesPermission(roles, scheme, contexts...)
+}
+
+// ExplainRolesPermission evaluates a permission check for the given role
+// instances, like the ones assigned to an user, including the roles inherited
+// by nested teams. Expired role instances are ignored.
+func ExplainRolesPermission(roleInstances []RoleInstance, scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) (permission.Explanation, error) {
+	assignments := make([]permission.RoleAssignment, 0, len(roleInstances))
+	roles := make(map[string]*permission.Role)
+	var children map[string][]string
+	for _, roleData := range roleInstances {
+		if roleData.IsExpired() {
+			continue
+		}
+		role := roles[roleData.Name]
+		if role == nil {
+			foundRole, err := permission.FindRole(roleData.Name)
+			if err == permission.ErrRoleNotFound {
+				continue
+			}
+			if err != nil {
+				return permission.Explanation{}, err
+			}
+			role = &foundRole
+			roles[roleData.Name] = role
+		}
+		assignments = append(assignments, permission.RoleAssignment{Role: *role, ContextValue: roleData.ContextValue})
+		if role.ContextType != permission.CtxTeam {
+			continue
+		}
+		if children == nil {
+			var err error
+			children, err = teamChildren()
+			if err != nil {
+				return permission.Explanation{}, err
+			}
+		}
+		for _, team := range descendants(children, roleData.ContextValue) {
+			assignments = append(assignments, permission.RoleAssignment{Role: *role, ContextValue: team})
+		}
+	}
+	return permission.ExplainRoles(assignments, scheme, contexts...), nil
+}
+
+func explainTokenPermissions(t Token, scheme *permission.PermissionScheme, contexts []permission.PermissionContext) (permission.Explanation, error) {
+	perms, err := t.Permissions()
+	if err != nil {
+		return permission.Explanation{}, err
+	}
+	return permission.Explain(perms, scheme, contexts...), nil
+}
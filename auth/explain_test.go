@@ -0,0 +1,73 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestExplainPermissionPersonalToken(c *check.C) {
+	role, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-member", s.team.Name)
+	c.Assert(err, check.IsNil)
+	token, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	exp, err := ExplainPermission(token, permission.PermAppDeploy, permission.Context(permission.CtxTeam, s.team.Name))
+	c.Assert(err, check.IsNil)
+	c.Assert(exp, check.DeepEquals, permission.Explanation{
+		Permission: "app.deploy",
+		Allowed:    true,
+		Reason:     `granted by app(team cobrateam) in role "team-member"`,
+		Matches: []permission.PermissionMatch{
+			{Permission: "app(team cobrateam)", Role: "team-member", Result: permission.MatchGranted},
+		},
+	})
+}
+
+func (s *S) TestExplainPermissionScopedPersonalToken(c *check.C) {
+	role, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-member", s.team.Name)
+	c.Assert(err, check.IsNil)
+	token, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []TokenScope{{Scheme: "app.read"}})
+	c.Assert(err, check.IsNil)
+	exp, err := ExplainPermission(token, permission.PermAppDeploy, permission.Context(permission.CtxTeam, s.team.Name))
+	c.Assert(err, check.IsNil)
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Reason, check.Equals, "no role includes app.deploy")
+}
+
+func (s *S) TestExplainPermissionServiceAccount(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	sa := ServiceAccount{Name: "ci", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	err = sa.AddRole("deployer", s.team.Name)
+	c.Assert(err, check.IsNil)
+	exp, err := ExplainPermission(&ServiceAccountToken{Account: &sa}, permission.PermAppDeploy, permission.Context(permission.CtxTeam, "otherteam"))
+	c.Assert(err, check.IsNil)
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Matches, check.DeepEquals, []permission.PermissionMatch{
+		{Permission: "app.deploy(team cobrateam)", Role: "deployer", Result: permission.MatchContextMismatch},
+	})
+}
+
+func (s *S) TestExplainRolesPermissionIgnoresRemovedRoles(c *check.C) {
+	exp, err := ExplainRolesPermission([]RoleInstance{{Name: "removed", ContextValue: "x"}}, permission.PermAppDeploy)
+	c.Assert(err, check.IsNil)
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Matches, check.HasLen, 0)
+}
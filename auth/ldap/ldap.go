@@ -0,0 +1,425 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ldap implements an authentication scheme backed by an LDAP server,
+// such as OpenLDAP or Active Directory.
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	ldapclient "github.com/go-ldap/ldap/v3"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/validation"
+)
+
+const (
+	defaultUserFilter         = "(uid={username})"
+	defaultEmailAttribute     = "mail"
+	defaultGroupFilter        = "(member={dn})"
+	defaultGroupNameAttribute = "cn"
+	defaultTimeout            = 10 * time.Second
+)
+
+var (
+	ErrMissingUsername     = &errors.ValidationError{Message: "you must provide a username to login"}
+	ErrMissingPassword     = &errors.ValidationError{Message: "you must provide a password to login"}
+	ErrInvalidCredentials  = auth.AuthenticationFailure{Message: "Authentication failed, invalid username or password."}
+	ErrInvalidEmail        = &errors.ValidationError{Message: "the email attribute of the LDAP user is not a valid email"}
+	ErrMultipleUserEntries = stderrors.New("more than one LDAP entry matches the user filter")
+)
+
+// GroupMapping maps members of an LDAP group to tsuru roles. When Team is set
+// roles are assigned in the context of the team, unless Context is also set.
+type GroupMapping struct {
+	Group   string
+	Team    string
+	Context string
+	Roles   []string
+}
+
+func (m *GroupMapping) contextValue() string {
+	if m.Context != "" {
+		return m.Context
+	}
+	return m.Team
+}
+
+type ldapConfig struct {
+	URL                string
+	StartTLS           bool
+	TLSConfig          *tls.Config
+	Timeout            time.Duration
+	BindDN             string
+	BindPassword       string
+	UserBaseDN         string
+	UserFilter         string
+	EmailAttribute     string
+	GroupBaseDN        string
+	GroupFilter        string
+	GroupNameAttribute string
+	GroupMappings      []GroupMapping
+}
+
+type LDAPScheme struct{}
+
+func init() {
+	auth.RegisterScheme("ldap", LDAPScheme{})
+}
+
+func getString(key, defaultValue string) string {
+	value, err := config.GetString(key)
+	if err != nil || value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func loadConfig() (*ldapConfig, error) {
+	serverURL, err := config.GetString("auth:ldap:url")
+	if err != nil {
+		return nil, err
+	}
+	userBaseDN, err := config.GetString("auth:ldap:user-base-dn")
+	if err != nil {
+		return nil, err
+	}
+	conf := ldapConfig{
+		URL:                serverURL,
+		Timeout:            defaultTimeout,
+		BindDN:             getString("auth:ldap:bind-dn", ""),
+		BindPassword:       getString("auth:ldap:bind-password", ""),
+		UserBaseDN:         userBaseDN,
+		UserFilter:         getString("auth:ldap:user-filter", defaultUserFilter),
+		EmailAttribute:     getString("auth:ldap:email-attribute", defaultEmailAttribute),
+		GroupBaseDN:        getString("auth:ldap:group-base-dn", userBaseDN),
+		GroupFilter:        getString("auth:ldap:group-filter", defaultGroupFilter),
+		GroupNameAttribute: getString("auth:ldap:group-name-attribute", defaultGroupNameAttribute),
+	}
+	conf.StartTLS, _ = config.GetBool("auth:ldap:start-tls")
+	if timeout, err := config.GetInt("auth:ldap:timeout"); err == nil && timeout > 0 {
+		conf.Timeout = time.Duration(timeout) * time.Second
+	}
+	conf.TLSConfig, err = loadTLSConfig(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	conf.GroupMappings, err = loadGroupMappings()
+	if err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+func loadTLSConfig(serverURL string) (*tls.Config, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP url %q: %s", serverURL, err)
+	}
+	tlsConfig := tls.Config{ServerName: u.Hostname()}
+	tlsConfig.InsecureSkipVerify, _ = config.GetBool("auth:ldap:tls-insecure-skip-verify")
+	caFile, _ := config.GetString("auth:ldap:tls-ca-file")
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read LDAP CA file: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no valid certificates found in LDAP CA file %q", caFile)
+		}
+	}
+	return &tlsConfig, nil
+}
+
+func loadGroupMappings() ([]GroupMapping, error) {
+	data, err := config.Get("auth:ldap:group-mappings")
+	if err != nil {
+		return nil, nil
+	}
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, stderrors.New("auth:ldap:group-mappings must be a list")
+	}
+	mappings := make([]GroupMapping, 0, len(list))
+	for i, item := range list {
+		fields := map[string]interface{}{}
+		switch value := item.(type) {
+		case map[interface{}]interface{}:
+			for k, v := range value {
+				fields[fmt.Sprint(k)] = v
+			}
+		case map[string]interface{}:
+			fields = value
+		default:
+			return nil, fmt.Errorf("invalid LDAP group mapping at position %d", i)
+		}
+		var m GroupMapping
+		m.Group, _ = fields["group"].(string)
+		m.Team, _ = fields["team"].(string)
+		m.Context, _ = fields["context"].(string)
+		switch roles := fields["roles"].(type) {
+		case []interface{}:
+			for _, r := range roles {
+				m.Roles = append(m.Roles, fmt.Sprint(r))
+			}
+		case []string:
+			m.Roles = roles
+		case string:
+			m.Roles = []string{roles}
+		}
+		if m.Group == "" || len(m.Roles) == 0 {
+			return nil, fmt.Errorf("LDAP group mapping at position %d must have a group and at least one role", i)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+func (c *ldapConfig) dial() (*ldapclient.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	conn, err := ldapclient.DialURL(c.URL, ldapclient.DialWithDialer(dialer), ldapclient.DialWithTLSConfig(c.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(c.Timeout)
+	if c.StartTLS {
+		err = conn.StartTLS(c.TLSConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindService authenticates the connection with the configured bind DN,
+// keeping the connection anonymous when there's none.
+func (c *ldapConfig) bindService(conn *ldapclient.Conn) error {
+	if c.BindDN == "" {
+		return nil
+	}
+	return conn.Bind(c.BindDN, c.BindPassword)
+}
+
+func (c *ldapConfig) findUser(conn *ldapclient.Conn, username string) (*ldapclient.Entry, error) {
+	err := c.bindService(conn)
+	if err != nil {
+		return nil, err
+	}
+	filter := strings.Replace(c.UserFilter, "{username}", ldapclient.EscapeFilter(username), -1)
+	result, err := conn.Search(ldapclient.NewSearchRequest(
+		c.UserBaseDN, ldapclient.ScopeWholeSubtree, ldapclient.NeverDerefAliases, 2, 0, false,
+		filter, []string{c.EmailAttribute}, nil,
+	))
+	if err != nil && (result == nil || !ldapclient.IsErrorWithCode(err, ldapclient.LDAPResultSizeLimitExceeded)) {
+		return nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return result.Entries[0], nil
+	}
+	return nil, ErrMultipleUserEntries
+}
+
+// userGroups returns the names and DNs of the groups the user is a member of,
+// lower cased.
+func (c *ldapConfig) userGroups(conn *ldapclient.Conn, username, userDN string) (map[string]bool, error) {
+	err := c.bindService(conn)
+	if err != nil {
+		return nil, err
+	}
+	filter := strings.Replace(c.GroupFilter, "{dn}", ldapclient.EscapeFilter(userDN), -1)
+	filter = strings.Replace(filter, "{username}", ldapclient.EscapeFilter(username), -1)
+	result, err := conn.Search(ldapclient.NewSearchRequest(
+		c.GroupBaseDN, ldapclient.ScopeWholeSubtree, ldapclient.NeverDerefAliases, 0, 0, false,
+		filter, []string{c.GroupNameAttribute}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]bool)
+	for _, entry := range result.Entries {
+		groups[strings.ToLower(entry.DN)] = true
+		for _, name := range entry.GetAttributeValues(c.GroupNameAttribute) {
+			groups[strings.ToLower(name)] = true
+		}
+	}
+	return groups, nil
+}
+
+// syncRoles adds to the user the roles mapped from the LDAP groups they're a
+// member of, and removes mapped roles from groups they're no longer part of.
+// Roles not present in any mapping are never touched.
+func (c *ldapConfig) syncRoles(user *auth.User, groups map[string]bool) error {
+	current := make(map[auth.RoleInstance]bool)
+	for _, r := range user.Roles {
+		current[r] = true
+	}
+	desired := make(map[auth.RoleInstance]bool)
+	var managed []auth.RoleInstance
+	for _, m := range c.GroupMappings {
+		member := groups[strings.ToLower(m.Group)]
+		if member && m.Team != "" {
+			if _, err := auth.GetTeam(m.Team); err != nil {
+				log.Errorf("[ldap] unable to map group %q to team %q: %s", m.Group, m.Team, err)
+				member = false
+			}
+		}
+		for _, roleName := range m.Roles {
+			role := auth.RoleInstance{Name: roleName, ContextValue: m.contextValue()}
+			managed = append(managed, role)
+			if member {
+				desired[role] = true
+			}
+		}
+	}
+	for _, role := range managed {
+		if desired[role] && !current[role] {
+			err := user.AddRole(role.Name, role.ContextValue)
+			if err == permission.ErrRoleNotFound {
+				log.Errorf("[ldap] unable to add role %q to user %q: %s", role.Name, user.Email, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			current[role] = true
+		} else if !desired[role] && current[role] {
+			err := user.RemoveRole(role.Name, role.ContextValue)
+			if err != nil {
+				return err
+			}
+			delete(current, role)
+		}
+	}
+	return nil
+}
+
+func (s LDAPScheme) Login(params map[string]string) (auth.Token, error) {
+	username := params["username"]
+	if username == "" {
+		username = params["email"]
+	}
+	if username == "" {
+		return nil, ErrMissingUsername
+	}
+	password := params["password"]
+	if password == "" {
+		// an empty password would result in an unauthenticated bind, which
+		// most servers accept as successful.
+		return nil, ErrMissingPassword
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := conf.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	entry, err := conf.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Bind(entry.DN, password)
+	if ldapclient.IsErrorWithCode(err, ldapclient.LDAPResultInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	email := entry.GetAttributeValue(conf.EmailAttribute)
+	if email == "" {
+		email = username
+	}
+	if !validation.ValidateEmail(email) {
+		return nil, ErrInvalidEmail
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user = &auth.User{Email: email}
+		err = user.Create()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.GroupMappings) > 0 {
+		groups, err := conf.userGroups(conn, username, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		err = conf.syncRoles(user, groups)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return native.CreateUserToken(user)
+}
+
+func (s LDAPScheme) Auth(token string) (auth.Token, error) {
+	return native.NativeScheme{}.Auth(token)
+}
+
+func (s LDAPScheme) Logout(token string) error {
+	return native.NativeScheme{}.Logout(token)
+}
+
+func (s LDAPScheme) AppLogin(appName string) (auth.Token, error) {
+	return native.NativeScheme{}.AppLogin(appName)
+}
+
+func (s LDAPScheme) AppLogout(token string) error {
+	return native.NativeScheme{}.AppLogout(token)
+}
+
+func (s LDAPScheme) Name() string {
+	return "ldap"
+}
+
+func (s LDAPScheme) Info() (auth.SchemeInfo, error) {
+	return nil, nil
+}
+
+// Create registers a user in tsuru. Passwords are never stored, as they're
+// always checked against the LDAP server.
+func (s LDAPScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	err := user.Create()
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s LDAPScheme) Remove(u *auth.User) error {
+	err := native.DeleteAllTokens(u.Email)
+	if err != nil {
+		return err
+	}
+	return u.Delete()
+}
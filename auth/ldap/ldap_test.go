@@ -0,0 +1,156 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoginCreatesUser(c *check.C) {
+	scheme := LDAPScheme{}
+	token, err := scheme.Login(map[string]string{"username": "jane", "password": "janepass"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "jane@example.com")
+	c.Assert(token.(*native.Token).UserEmail, check.Equals, "jane@example.com")
+	user, err := auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Password, check.Equals, "")
+	c.Assert(s.server.Binds, check.DeepEquals, []string{
+		"cn=admin,dc=example,dc=com",
+		"uid=jane,ou=people,dc=example,dc=com",
+	})
+	authToken, err := scheme.Auth(token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, "jane@example.com")
+}
+
+func (s *S) TestLoginExistingUser(c *check.C) {
+	user := &auth.User{Email: "jane@example.com"}
+	err := user.Create()
+	c.Assert(err, check.IsNil)
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	token, err := LDAPScheme{}.Login(map[string]string{"email": "jane", "password": "janepass"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "jane@example.com")
+}
+
+func (s *S) TestLoginUserRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	_, err := LDAPScheme{}.Login(map[string]string{"username": "jane", "password": "janepass"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginWrongPassword(c *check.C) {
+	_, err := LDAPScheme{}.Login(map[string]string{"username": "jane", "password": "wrong"})
+	c.Assert(err, check.Equals, ErrInvalidCredentials)
+	_, err = auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginUnknownUser(c *check.C) {
+	_, err := LDAPScheme{}.Login(map[string]string{"username": "mary", "password": "marypass"})
+	c.Assert(err, check.Equals, ErrInvalidCredentials)
+}
+
+func (s *S) TestLoginMissingCredentials(c *check.C) {
+	_, err := LDAPScheme{}.Login(map[string]string{"password": "janepass"})
+	c.Assert(err, check.Equals, ErrMissingUsername)
+	_, err = LDAPScheme{}.Login(map[string]string{"username": "jane"})
+	c.Assert(err, check.Equals, ErrMissingPassword)
+	c.Assert(s.server.Binds, check.HasLen, 0)
+}
+
+func (s *S) TestLoginInvalidEmail(c *check.C) {
+	_, err := LDAPScheme{}.Login(map[string]string{"username": "john", "password": "johnpass"})
+	c.Assert(err, check.Equals, ErrInvalidEmail)
+}
+
+func (s *S) TestLoginSyncRoles(c *check.C) {
+	err := s.conn.Teams().Insert(auth.Team{Name: "devteam"})
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("ops", "global", "")
+	c.Assert(err, check.IsNil)
+	config.Set("auth:ldap:group-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "developers", "team": "devteam", "roles": []interface{}{"team-member"}},
+		map[interface{}]interface{}{"group": "cn=ops,ou=groups,dc=example,dc=com", "roles": []interface{}{"ops"}},
+	})
+	user := &auth.User{Email: "jane@example.com"}
+	err = user.Create()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("ops", "")
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("team-member", "otherteam")
+	c.Assert(err, check.IsNil)
+	_, err = LDAPScheme{}.Login(map[string]string{"username": "jane", "password": "janepass"})
+	c.Assert(err, check.IsNil)
+	user, err = auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "team-member", ContextValue: "otherteam"},
+		{Name: "team-member", ContextValue: "devteam"},
+	})
+}
+
+func (s *S) TestLoginSyncRolesMissingTeamAndRole(c *check.C) {
+	config.Set("auth:ldap:group-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "developers", "team": "devteam", "roles": []interface{}{"team-member"}},
+		map[interface{}]interface{}{"group": "developers", "roles": []interface{}{"unknown"}},
+	})
+	_, err := LDAPScheme{}.Login(map[string]string{"username": "jane", "password": "janepass"})
+	c.Assert(err, check.IsNil)
+	user, err := auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestLoadGroupMappings(c *check.C) {
+	config.Set("auth:ldap:group-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "developers", "team": "devteam", "roles": []interface{}{"team-member", "deployer"}},
+		map[interface{}]interface{}{"group": "ops", "roles": "admin"},
+		map[interface{}]interface{}{"group": "pool-users", "context": "mypool", "roles": []interface{}{"pool-user"}},
+	})
+	mappings, err := loadGroupMappings()
+	c.Assert(err, check.IsNil)
+	c.Assert(mappings, check.DeepEquals, []GroupMapping{
+		{Group: "developers", Team: "devteam", Roles: []string{"team-member", "deployer"}},
+		{Group: "ops", Roles: []string{"admin"}},
+		{Group: "pool-users", Context: "mypool", Roles: []string{"pool-user"}},
+	})
+	c.Assert(mappings[0].contextValue(), check.Equals, "devteam")
+	c.Assert(mappings[2].contextValue(), check.Equals, "mypool")
+}
+
+func (s *S) TestLoadGroupMappingsInvalid(c *check.C) {
+	config.Set("auth:ldap:group-mappings", []interface{}{
+		map[interface{}]interface{}{"group": "developers"},
+	})
+	_, err := loadGroupMappings()
+	c.Assert(err, check.ErrorMatches, "LDAP group mapping at position 0 must have a group and at least one role")
+	config.Set("auth:ldap:group-mappings", "developers")
+	_, err = loadGroupMappings()
+	c.Assert(err, check.ErrorMatches, "auth:ldap:group-mappings must be a list")
+}
+
+func (s *S) TestLoadConfigRequiredFields(c *check.C) {
+	config.Unset("auth:ldap:url")
+	_, err := loadConfig()
+	c.Assert(err, check.NotNil)
+	config.Set("auth:ldap:url", s.server.URL())
+	config.Unset("auth:ldap:user-base-dn")
+	_, err = loadConfig()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestName(c *check.C) {
+	c.Assert(LDAPScheme{}.Name(), check.Equals, "ldap")
+}
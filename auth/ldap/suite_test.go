@@ -0,0 +1,81 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth/authtest"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn   *db.Storage
+	server *authtest.LDAPServer
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.server, err = authtest.NewLDAPServer(
+		authtest.LDAPEntry{DN: "cn=admin,dc=example,dc=com", Password: "adminpass"},
+		authtest.LDAPEntry{
+			DN:       "uid=jane,ou=people,dc=example,dc=com",
+			Password: "janepass",
+			Attributes: map[string][]string{
+				"uid":  {"jane"},
+				"mail": {"jane@example.com"},
+			},
+		},
+		authtest.LDAPEntry{
+			DN:       "uid=john,ou=people,dc=example,dc=com",
+			Password: "johnpass",
+			Attributes: map[string][]string{
+				"uid": {"john"},
+			},
+		},
+		authtest.LDAPEntry{
+			DN: "cn=developers,ou=groups,dc=example,dc=com",
+			Attributes: map[string][]string{
+				"cn":     {"developers"},
+				"member": {"uid=jane,ou=people,dc=example,dc=com"},
+			},
+		},
+	)
+	c.Assert(err, check.IsNil)
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_ldap_test")
+	config.Set("auth:user-registration", true)
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	s.server.Reset()
+	config.Set("auth:ldap:url", s.server.URL())
+	config.Set("auth:ldap:bind-dn", "cn=admin,dc=example,dc=com")
+	config.Set("auth:ldap:bind-password", "adminpass")
+	config.Set("auth:ldap:user-base-dn", "ou=people,dc=example,dc=com")
+	config.Set("auth:ldap:group-base-dn", "ou=groups,dc=example,dc=com")
+	config.Unset("auth:ldap:group-mappings")
+	repositorytest.Reset()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.server.Stop()
+	config.Unset("auth:ldap")
+}
@@ -135,7 +135,7 @@ func (s NativeScheme) ResetPassword(user *auth.User, resetToken string) error {
 }
 
 func (s NativeScheme) Remove(u *auth.User) error {
-	err := deleteAllTokens(u.Email)
+	err := DeleteAllTokens(u.Email)
 	if err != nil {
 		return err
 	}
@@ -176,6 +176,16 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err := checkPassword(u.Password, password); err != nil {
 		return nil, err
 	}
+	return CreateUserToken(u)
+}
+
+// CreateUserToken issues and stores a new token for the given user, without
+// checking credentials. It's used by schemes that authenticate users by
+// other means but share the token format and storage with the native scheme.
+func CreateUserToken(u *auth.User) (*Token, error) {
+	if u.Email == "" {
+		return nil, errors.New("User does not have an email")
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -223,7 +233,8 @@ func deleteToken(token string) error {
 	return conn.Tokens().Remove(bson.M{"token": token})
 }
 
-func deleteAllTokens(email string) error {
+// DeleteAllTokens removes all tokens of the user with the given email.
+func DeleteAllTokens(email string) error {
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -273,6 +273,18 @@ func (s *S) TestCreateTokenShouldValidateThePassword(c *check.C) {
 	c.Assert(err, check.NotNil)
 }
 
+func (s *S) TestCreateUserTokenDoesNotCheckPassword(c *check.C) {
+	u := auth.User{Email: "cyclops@xmen.com"}
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": u.Email})
+	t, err := CreateUserToken(&u)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.UserEmail, check.Equals, u.Email)
+	var result Token
+	err = s.conn.Tokens().Find(bson.M{"token": t.Token}).One(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.UserEmail, check.Equals, u.Email)
+}
+
 func (s *S) TestGetToken(c *check.C) {
 	t, err := getToken("bearer " + s.token.GetValue())
 	c.Assert(err, check.IsNil)
@@ -444,7 +456,7 @@ func (s *S) TestDeleteAllTokens(c *check.C) {
 	c.Assert(err, check.IsNil)
 	err = s.conn.Tokens().Insert(tokens[2])
 	c.Assert(err, check.IsNil)
-	err = deleteAllTokens("x@x.com")
+	err = DeleteAllTokens("x@x.com")
 	c.Assert(err, check.IsNil)
 	var tokensDB []Token
 	err = s.conn.Tokens().Find(bson.M{"useremail": "x@x.com"}).All(&tokensDB)
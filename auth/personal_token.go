@@ -0,0 +1,227 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// personalTokenTouchInterval is the minimum interval between updates to the
+// LastUsed field of a personal token, avoiding a database write in every
+// request.
+var personalTokenTouchInterval = time.Minute
+
+var (
+	ErrPersonalTokenNotFound      = stderrors.New("personal token not found")
+	ErrPersonalTokenAlreadyExists = stderrors.New("personal token already exists")
+	ErrPersonalTokenInvalidName   = stderrors.New("personal token name is required")
+	ErrPersonalTokenInvalidExpire = stderrors.New("personal token expiration date must be in the future")
+	ErrPersonalTokenExpired       = &errors.HTTP{Code: http.StatusUnauthorized, Message: "personal token expired"}
+)
+
+// TokenScope limits the permissions of a personal token to a permission
+// scheme in a context. An empty ContextType means any context in which the
+// user holds the permission.
+type TokenScope struct {
+	Scheme       string `json:"scheme"`
+	ContextType  string `json:"contexttype,omitempty"`
+	ContextValue string `json:"contextvalue,omitempty"`
+}
+
+func (s TokenScope) permission() (permission.Permission, error) {
+	return permission.ParsePermission(s.Scheme, s.ContextType, s.ContextValue)
+}
+
+// PersonalToken is a named, expiring token created by a user. Its permissions
+// are the user's permissions, optionally limited by a list of scopes. Only a
+// hash of the token value is stored.
+type PersonalToken struct {
+	Name         string       `json:"name"`
+	UserEmail    string       `json:"email"`
+	TokenHash    string       `json:"-"`
+	CreationDate time.Time    `json:"creationdate"`
+	ExpiresAt    time.Time    `json:"expiresat"`
+	LastUsed     time.Time    `json:"lastused"`
+	Scopes       []TokenScope `json:"scopes,omitempty"`
+
+	value string
+}
+
+func (t *PersonalToken) GetValue() string {
+	return t.value
+}
+
+func (t *PersonalToken) User() (*User, error) {
+	return GetUserByEmail(t.UserEmail)
+}
+
+func (t *PersonalToken) IsAppToken() bool {
+	return false
+}
+
+func (t *PersonalToken) GetUserName() string {
+	return t.UserEmail
+}
+
+func (t *PersonalToken) GetAppName() string {
+	return ""
+}
+
+// Permissions returns the permissions of the token's owner, restricted to the
+// token scopes when there are any.
+func (t *PersonalToken) Permissions() ([]permission.Permission, error) {
+	perms, err := BaseTokenPermission(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Scopes) == 0 {
+		return perms, nil
+	}
+	limits := make([]permission.Permission, 0, len(t.Scopes))
+	for _, scope := range t.Scopes {
+		limit, err := scope.permission()
+		if err != nil {
+			// permission schemes might be removed or renamed, scopes
+			// referencing them simply grant nothing.
+			continue
+		}
+		limits = append(limits, limit)
+	}
+	return permission.Intersect(perms, limits), nil
+}
+
+// IsExpired returns whether the token expiration date has passed.
+func (t *PersonalToken) IsExpired() bool {
+	return !t.ExpiresAt.After(time.Now())
+}
+
+func hashToken(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+}
+
+// CreatePersonalToken creates a new personal token for the user. The token
+// value is only available in the returned token, through GetValue.
+func CreatePersonalToken(u *User, name string, expiresAt time.Time, scopes []TokenScope) (*PersonalToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrPersonalTokenInvalidName
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil, ErrPersonalTokenInvalidExpire
+	}
+	for _, scope := range scopes {
+		if _, err := scope.permission(); err != nil {
+			return nil, err
+		}
+	}
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	value := fmt.Sprintf("%x", randomBytes)
+	t := PersonalToken{
+		Name:         name,
+		UserEmail:    u.Email,
+		TokenHash:    hashToken(value),
+		CreationDate: time.Now().UTC(),
+		ExpiresAt:    expiresAt.UTC(),
+		Scopes:       scopes,
+		value:        value,
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.PersonalTokens().Insert(&t)
+	if mgo.IsDup(err) {
+		return nil, ErrPersonalTokenAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListPersonalTokens returns the personal tokens of the user, sorted by name.
+func ListPersonalTokens(email string) ([]PersonalToken, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tokens []PersonalToken
+	err = conn.PersonalTokens().Find(bson.M{"useremail": email}).Sort("name").All(&tokens)
+	return tokens, err
+}
+
+// RevokePersonalToken removes the user's personal token with the given name.
+func RevokePersonalToken(email, name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.PersonalTokens().Remove(bson.M{"useremail": email, "name": name})
+	if err == mgo.ErrNotFound {
+		return ErrPersonalTokenNotFound
+	}
+	return err
+}
+
+func removePersonalTokens(email string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.PersonalTokens().RemoveAll(bson.M{"useremail": email})
+	return err
+}
+
+// PersonalTokenAuth returns the personal token matching the given
+// authorization header, tracking its last use.
+func PersonalTokenAuth(header string) (*PersonalToken, error) {
+	value, err := ParseToken(header)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var t PersonalToken
+	err = conn.PersonalTokens().Find(bson.M{"tokenhash": hashToken(value)}).One(&t)
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.IsExpired() {
+		return nil, ErrPersonalTokenExpired
+	}
+	t.value = value
+	now := time.Now().UTC()
+	if now.Sub(t.LastUsed) >= personalTokenTouchInterval {
+		t.LastUsed = now
+		conn.PersonalTokens().Update(bson.M{"tokenhash": t.TokenHash}, bson.M{"$set": bson.M{"lastused": now}})
+	}
+	return &t, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestCreatePersonalToken(c *check.C) {
+	expires := time.Now().Add(time.Hour)
+	t, err := CreatePersonalToken(s.user, "ci", expires, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.GetValue(), check.Not(check.Equals), "")
+	c.Assert(t.GetUserName(), check.Equals, s.user.Email)
+	var dbToken PersonalToken
+	err = s.conn.PersonalTokens().Find(bson.M{"name": "ci"}).One(&dbToken)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbToken.TokenHash, check.Equals, hashToken(t.GetValue()))
+	c.Assert(dbToken.GetValue(), check.Equals, "")
+}
+
+func (s *S) TestCreatePersonalTokenInvalid(c *check.C) {
+	_, err := CreatePersonalToken(s.user, " ", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.Equals, ErrPersonalTokenInvalidName)
+	_, err = CreatePersonalToken(s.user, "ci", time.Now().Add(-time.Hour), nil)
+	c.Assert(err, check.Equals, ErrPersonalTokenInvalidExpire)
+	_, err = CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []TokenScope{{Scheme: "app.nothing"}})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestCreatePersonalTokenDuplicated(c *check.C) {
+	_, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	_, err = CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.Equals, ErrPersonalTokenAlreadyExists)
+}
+
+func (s *S) TestListPersonalTokens(c *check.C) {
+	for _, name := range []string{"deploy", "ci"} {
+		_, err := CreatePersonalToken(s.user, name, time.Now().Add(time.Hour), nil)
+		c.Assert(err, check.IsNil)
+	}
+	tokens, err := ListPersonalTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 2)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+	c.Assert(tokens[1].Name, check.Equals, "deploy")
+	tokens, err = ListPersonalTokens("other@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+}
+
+func (s *S) TestRevokePersonalToken(c *check.C) {
+	t, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	err = RevokePersonalToken(s.user.Email, "ci")
+	c.Assert(err, check.IsNil)
+	_, err = PersonalTokenAuth("bearer " + t.GetValue())
+	c.Assert(err, check.Equals, ErrInvalidToken)
+	err = RevokePersonalToken(s.user.Email, "ci")
+	c.Assert(err, check.Equals, ErrPersonalTokenNotFound)
+}
+
+func (s *S) TestPersonalTokenAuth(c *check.C) {
+	t, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	authToken, err := PersonalTokenAuth("bearer " + t.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetValue(), check.Equals, t.GetValue())
+	c.Assert(authToken.GetUserName(), check.Equals, s.user.Email)
+	c.Assert(authToken.LastUsed.IsZero(), check.Equals, false)
+	var dbToken PersonalToken
+	err = s.conn.PersonalTokens().Find(bson.M{"name": "ci"}).One(&dbToken)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbToken.LastUsed.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestPersonalTokenAuthExpired(c *check.C) {
+	t, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.PersonalTokens().Update(bson.M{"name": "ci"}, bson.M{"$set": bson.M{"expiresat": time.Now().Add(-time.Minute)}})
+	c.Assert(err, check.IsNil)
+	_, err = PersonalTokenAuth("bearer " + t.GetValue())
+	c.Assert(err, check.Equals, ErrPersonalTokenExpired)
+}
+
+func (s *S) TestPersonalTokenPermissionsWithScopes(c *check.C) {
+	r1, err := permission.NewRole("r1", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy", "app.update.env")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("r1", "team1")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("r1", "team2")
+	c.Assert(err, check.IsNil)
+	t, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []TokenScope{
+		{Scheme: "app.deploy", ContextType: "team", ContextValue: "team1"},
+	})
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, "team1")},
+	})
+}
+
+func (s *S) TestPersonalTokenPermissionsWithAppScope(c *check.C) {
+	r1, err := permission.NewRole("r1", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("r1", "team1")
+	c.Assert(err, check.IsNil)
+	t, err := CreatePersonalToken(s.user, "ci", time.Now().Add(time.Hour), []TokenScope{
+		{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	appContexts := func(name, team string) []permission.PermissionContext {
+		return []permission.PermissionContext{
+			permission.Context(permission.CtxTeam, team),
+			permission.Context(permission.CtxApp, name),
+			permission.Context(permission.CtxPool, "pool1"),
+		}
+	}
+	c.Assert(permission.Check(t, permission.PermAppDeploy, appContexts("myapp", "team1")...), check.Equals, true)
+	c.Assert(permission.Check(t, permission.PermAppDeploy, appContexts("myapp", "team2")...), check.Equals, false)
+	c.Assert(permission.Check(t, permission.PermAppDeploy, appContexts("otherapp", "team1")...), check.Equals, false)
+}
+
+func (s *S) TestUserDeleteRemovesPersonalTokens(c *check.C) {
+	u := User{Email: "me@tsuru.com", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	_, err = CreatePersonalToken(&u, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	err = u.Delete()
+	c.Assert(err, check.IsNil)
+	tokens, err := ListPersonalTokens(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+}
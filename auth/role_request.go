@@ -0,0 +1,207 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrRoleRequestNotFound        = stderrors.New("role request not found")
+	ErrRoleRequestNotPending      = stderrors.New("role request was already reviewed")
+	ErrRoleRequestSelfReview      = stderrors.New("users can't review their own role requests")
+	ErrRoleRequestInvalidDuration = stderrors.New("role request duration must be positive and within the maximum duration")
+)
+
+// RoleRequestStatus is the status of a role request in its review.
+type RoleRequestStatus string
+
+const (
+	RoleRequestPending  = RoleRequestStatus("pending")
+	RoleRequestApproved = RoleRequestStatus("approved")
+	RoleRequestRejected = RoleRequestStatus("rejected")
+)
+
+// RoleRequest is a request from a user to be temporarily assigned a role. Once
+// approved, the role is assigned to the user for the requested duration,
+// starting at the approval.
+type RoleRequest struct {
+	ID           bson.ObjectId     `bson:"_id" json:"id"`
+	UserEmail    string            `json:"email"`
+	RoleName     string            `json:"role"`
+	ContextValue string            `json:"context"`
+	Duration     time.Duration     `json:"duration"`
+	Reason       string            `json:"reason"`
+	Status       RoleRequestStatus `json:"status"`
+	Reviewer     string            `json:"reviewer,omitempty"`
+	CreationDate time.Time         `json:"creationdate"`
+	ReviewDate   time.Time         `json:"reviewdate"`
+	ExpiresAt    time.Time         `json:"expiresat"`
+}
+
+// CreateRoleRequest stores a new pending request from the user for the role
+// in the context value. The duration can't exceed maxDuration.
+func CreateRoleRequest(u *User, roleName, contextValue string, duration, maxDuration time.Duration, reason string) (*RoleRequest, error) {
+	_, err := permission.FindRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 || duration > maxDuration {
+		return nil, ErrRoleRequestInvalidDuration
+	}
+	req := RoleRequest{
+		ID:           bson.NewObjectId(),
+		UserEmail:    u.Email,
+		RoleName:     roleName,
+		ContextValue: contextValue,
+		Duration:     duration,
+		Reason:       reason,
+		Status:       RoleRequestPending,
+		CreationDate: time.Now().UTC(),
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.RoleRequests().Insert(&req)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// GetRoleRequest returns the role request with the given id.
+func GetRoleRequest(id string) (*RoleRequest, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrRoleRequestNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var req RoleRequest
+	err = conn.RoleRequests().FindId(bson.ObjectIdHex(id)).One(&req)
+	if err == mgo.ErrNotFound {
+		return nil, ErrRoleRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListRoleRequests returns the role requests, newest first, optionally
+// filtered by the requesting user and by status.
+func ListRoleRequests(email string, status RoleRequestStatus) ([]RoleRequest, error) {
+	query := bson.M{}
+	if email != "" {
+		query["useremail"] = email
+	}
+	if status != "" {
+		query["status"] = status
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var requests []RoleRequest
+	err = conn.RoleRequests().Find(query).Sort("-creationdate").All(&requests)
+	return requests, err
+}
+
+// Approve approves the pending request, temporarily assigning the role to the
+// requesting user, recording the reviewer as the approver.
+// The request is moved back to pending when the role can't be assigned, so it
+// may be reviewed again.
+func (r *RoleRequest) Approve(reviewer string) error {
+	u, err := GetUserByEmail(r.UserEmail)
+	if err != nil {
+		return err
+	}
+	err = r.review(reviewer, RoleRequestApproved)
+	if err != nil {
+		return err
+	}
+	err = u.AddTemporaryRole(RoleInstance{
+		Name:         r.RoleName,
+		ContextValue: r.ContextValue,
+		ExpiresAt:    r.ExpiresAt,
+		Reason:       r.Reason,
+		Approver:     reviewer,
+	})
+	if err != nil {
+		if rollbackErr := r.reopen(); rollbackErr != nil {
+			log.Errorf("unable to move role request %s back to pending: %s", r.ID.Hex(), rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Reject rejects the pending request.
+func (r *RoleRequest) Reject(reviewer string) error {
+	return r.review(reviewer, RoleRequestRejected)
+}
+
+func (r *RoleRequest) review(reviewer string, status RoleRequestStatus) error {
+	if r.UserEmail == reviewer {
+		return ErrRoleRequestSelfReview
+	}
+	now := time.Now().UTC()
+	update := bson.M{"status": status, "reviewer": reviewer, "reviewdate": now}
+	var expiresAt time.Time
+	if status == RoleRequestApproved {
+		expiresAt = now.Add(r.Duration)
+		update["expiresat"] = expiresAt
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.RoleRequests().Update(bson.M{"_id": r.ID, "status": RoleRequestPending}, bson.M{"$set": update})
+	if err == mgo.ErrNotFound {
+		return ErrRoleRequestNotPending
+	}
+	if err != nil {
+		return err
+	}
+	r.Status = status
+	r.Reviewer = reviewer
+	r.ReviewDate = now
+	r.ExpiresAt = expiresAt
+	return nil
+}
+
+// reopen moves a request approved by r back to pending, undoing review.
+func (r *RoleRequest) reopen() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.RoleRequests().Update(bson.M{"_id": r.ID, "status": r.Status, "reviewer": r.Reviewer}, bson.M{
+		"$set":   bson.M{"status": RoleRequestPending},
+		"$unset": bson.M{"reviewer": "", "reviewdate": "", "expiresat": ""},
+	})
+	if err != nil {
+		return err
+	}
+	r.Status = RoleRequestPending
+	r.Reviewer = ""
+	r.ReviewDate = time.Time{}
+	r.ExpiresAt = time.Time{}
+	return nil
+}
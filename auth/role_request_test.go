@@ -0,0 +1,166 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCreateRoleRequest(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, 8*time.Hour, "incident")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.ID.Valid(), check.Equals, true)
+	c.Assert(req.UserEmail, check.Equals, s.user.Email)
+	c.Assert(req.RoleName, check.Equals, "deployer")
+	c.Assert(req.ContextValue, check.Equals, "myapp")
+	c.Assert(req.Duration, check.Equals, time.Hour)
+	c.Assert(req.Reason, check.Equals, "incident")
+	c.Assert(req.Status, check.Equals, RoleRequestPending)
+	dbReq, err := GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.ID, check.Equals, req.ID)
+	c.Assert(dbReq.Status, check.Equals, RoleRequestPending)
+	c.Assert(dbReq.Duration, check.Equals, time.Hour)
+}
+
+func (s *S) TestCreateRoleRequestInvalid(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	_, err = CreateRoleRequest(s.user, "unknown", "myapp", time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.Equals, permission.ErrRoleNotFound)
+	_, err = CreateRoleRequest(s.user, "deployer", "myapp", 0, 8*time.Hour, "")
+	c.Assert(err, check.Equals, ErrRoleRequestInvalidDuration)
+	_, err = CreateRoleRequest(s.user, "deployer", "myapp", 9*time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.Equals, ErrRoleRequestInvalidDuration)
+}
+
+func (s *S) TestGetRoleRequestNotFound(c *check.C) {
+	_, err := GetRoleRequest("invalid")
+	c.Assert(err, check.Equals, ErrRoleRequestNotFound)
+	_, err = GetRoleRequest("5807a2a5e74fbb0fa0cc1df1")
+	c.Assert(err, check.Equals, ErrRoleRequestNotFound)
+}
+
+func (s *S) TestListRoleRequests(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	other := User{Email: "other@tsuru.com", Password: "123456"}
+	err = other.Create()
+	c.Assert(err, check.IsNil)
+	req1, err := CreateRoleRequest(s.user, "deployer", "app1", time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.IsNil)
+	req2, err := CreateRoleRequest(&other, "deployer", "app2", time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.IsNil)
+	err = req2.Reject(s.user.Email)
+	c.Assert(err, check.IsNil)
+	requests, err := ListRoleRequests("", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 2)
+	requests, err = ListRoleRequests(s.user.Email, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].ID, check.Equals, req1.ID)
+	requests, err = ListRoleRequests("", RoleRequestRejected)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].ID, check.Equals, req2.ID)
+}
+
+func (s *S) TestRoleRequestApprove(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, 8*time.Hour, "incident")
+	c.Assert(err, check.IsNil)
+	err = req.Approve("admin@tsuru.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, RoleRequestApproved)
+	c.Assert(req.Reviewer, check.Equals, "admin@tsuru.com")
+	c.Assert(req.ExpiresAt.Sub(req.ReviewDate), check.Equals, time.Hour)
+	dbReq, err := GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, RoleRequestApproved)
+	c.Assert(dbReq.Reviewer, check.Equals, "admin@tsuru.com")
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].Name, check.Equals, "deployer")
+	c.Assert(u.Roles[0].ContextValue, check.Equals, "myapp")
+	c.Assert(u.Roles[0].Reason, check.Equals, "incident")
+	c.Assert(u.Roles[0].Approver, check.Equals, "admin@tsuru.com")
+	c.Assert(u.Roles[0].ExpiresAt.Unix(), check.Equals, req.ExpiresAt.Unix())
+	err = req.Approve("admin@tsuru.com")
+	c.Assert(err, check.Equals, ErrRoleRequestNotPending)
+	err = req.Reject("admin@tsuru.com")
+	c.Assert(err, check.Equals, ErrRoleRequestNotPending)
+}
+
+func (s *S) TestRoleRequestApproveRoleRemoved(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, 8*time.Hour, "incident")
+	c.Assert(err, check.IsNil)
+	err = permission.DestroyRole("deployer")
+	c.Assert(err, check.IsNil)
+	err = req.Approve("admin@tsuru.com")
+	c.Assert(err, check.Equals, permission.ErrRoleNotFound)
+	c.Assert(req.Status, check.Equals, RoleRequestPending)
+	c.Assert(req.Reviewer, check.Equals, "")
+	dbReq, err := GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, RoleRequestPending)
+	c.Assert(dbReq.Reviewer, check.Equals, "")
+	c.Assert(dbReq.ExpiresAt.IsZero(), check.Equals, true)
+	_, err = permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	err = req.Approve("admin@tsuru.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, RoleRequestApproved)
+}
+
+func (s *S) TestRoleRequestApproveUserNotFound(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "ghost@tsuru.com"}
+	req, err := CreateRoleRequest(&u, "deployer", "myapp", time.Hour, 8*time.Hour, "incident")
+	c.Assert(err, check.IsNil)
+	err = req.Approve("admin@tsuru.com")
+	c.Assert(err, check.Equals, ErrUserNotFound)
+	dbReq, err := GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, RoleRequestPending)
+}
+
+func (s *S) TestRoleRequestReject(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.IsNil)
+	err = req.Reject("admin@tsuru.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, RoleRequestRejected)
+	c.Assert(req.ExpiresAt.IsZero(), check.Equals, true)
+	u, err := GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestRoleRequestSelfReview(c *check.C) {
+	_, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	req, err := CreateRoleRequest(s.user, "deployer", "myapp", time.Hour, 8*time.Hour, "")
+	c.Assert(err, check.IsNil)
+	err = req.Approve(s.user.Email)
+	c.Assert(err, check.Equals, ErrRoleRequestSelfReview)
+	err = req.Reject(s.user.Email)
+	c.Assert(err, check.Equals, ErrRoleRequestSelfReview)
+	dbReq, err := GetRoleRequest(req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, RoleRequestPending)
+}
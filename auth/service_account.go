@@ -0,0 +1,288 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ServiceAccountPrefix is prepended to the name of service accounts when
+// they're identified as owners of events and requests. It can't be part of a
+// valid email, so service accounts never clash with users.
+const ServiceAccountPrefix = "service-account:"
+
+var (
+	ErrServiceAccountNotFound      = stderrors.New("service account not found")
+	ErrServiceAccountAlreadyExists = stderrors.New("service account already exists")
+	ErrServiceAccountInvalidName   = stderrors.New("invalid service account name, it must contain only lower case letters, numbers or dashes and start with a letter")
+	ErrServiceAccountNotUser       = &errors.HTTP{Code: http.StatusForbidden, Message: "operation not available for service accounts"}
+
+	serviceAccountNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]{0,39}$`)
+)
+
+// ServiceAccount is a non-interactive identity owned by a team. Service
+// accounts hold roles just like users, but can only authenticate using the
+// token generated by RotateToken.
+type ServiceAccount struct {
+	Name           string         `bson:"_id" json:"name"`
+	Team           string         `json:"team"`
+	Description    string         `json:"description,omitempty"`
+	CreatedBy      string         `json:"createdBy"`
+	Roles          []RoleInstance `json:"roles,omitempty" bson:",omitempty"`
+	TokenHash      string         `json:"-" bson:",omitempty"`
+	TokenCreatedAt time.Time      `json:"tokenCreatedAt"`
+}
+
+// Identity returns the name used to identify the service account as the
+// owner of events and requests.
+func (sa *ServiceAccount) Identity() string {
+	return ServiceAccountPrefix + sa.Name
+}
+
+// Create validates and stores a new service account. Its team must exist.
+func (sa *ServiceAccount) Create() error {
+	if !serviceAccountNameRegexp.MatchString(sa.Name) {
+		return ErrServiceAccountInvalidName
+	}
+	if _, err := GetTeam(sa.Team); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	sa.Roles = nil
+	sa.TokenHash = ""
+	sa.TokenCreatedAt = time.Time{}
+	err = conn.ServiceAccounts().Insert(sa)
+	if mgo.IsDup(err) {
+		return ErrServiceAccountAlreadyExists
+	}
+	return err
+}
+
+// GetServiceAccount returns the service account with the given name.
+func GetServiceAccount(name string) (*ServiceAccount, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var sa ServiceAccount
+	err = conn.ServiceAccounts().FindId(name).One(&sa)
+	if err == mgo.ErrNotFound {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// ListServiceAccounts returns the service accounts matching the filter,
+// sorted by name.
+func ListServiceAccounts(filter bson.M) ([]ServiceAccount, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var accounts []ServiceAccount
+	err = conn.ServiceAccounts().Find(filter).Sort("_id").All(&accounts)
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// RemoveServiceAccount removes the service account with the given name,
+// immediately invalidating its token.
+func RemoveServiceAccount(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.ServiceAccounts().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrServiceAccountNotFound
+	}
+	return err
+}
+
+func (sa *ServiceAccount) reload() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ServiceAccounts().FindId(sa.Name).One(sa)
+}
+
+// RotateToken generates a new token for the service account, replacing the
+// previous one. The token value is returned only once, as only its hash is
+// stored.
+func (sa *ServiceAccount) RotateToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	value := fmt.Sprintf("%x", randomBytes)
+	hash := hashToken(value)
+	now := time.Now().UTC()
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	err = conn.ServiceAccounts().UpdateId(sa.Name, bson.M{
+		"$set": bson.M{"tokenhash": hash, "tokencreatedat": now},
+	})
+	if err == mgo.ErrNotFound {
+		return "", ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	sa.TokenHash = hash
+	sa.TokenCreatedAt = now
+	return value, nil
+}
+
+func (sa *ServiceAccount) Permissions() ([]permission.Permission, error) {
+	return rolesPermissions(sa.Roles)
+}
+
+func (sa *ServiceAccount) AddRole(roleName string, contextValue string) error {
+	_, err := permission.FindRole(roleName)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.ServiceAccounts().UpdateId(sa.Name, bson.M{
+		"$addToSet": bson.M{
+			"roles": bson.D([]bson.DocElem{
+				{Name: "name", Value: roleName},
+				{Name: "contextvalue", Value: contextValue},
+			}),
+		},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return sa.reload()
+}
+
+func (sa *ServiceAccount) RemoveRole(roleName string, contextValue string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.ServiceAccounts().UpdateId(sa.Name, bson.M{
+		"$pull": bson.M{
+			"roles": bson.D([]bson.DocElem{
+				{Name: "name", Value: roleName},
+				{Name: "contextvalue", Value: contextValue},
+			}),
+		},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return sa.reload()
+}
+
+func RemoveRoleFromAllServiceAccounts(roleName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ServiceAccounts().UpdateAll(bson.M{"roles.name": roleName}, bson.M{
+		"$pull": bson.M{
+			"roles": bson.M{"name": roleName},
+		},
+	})
+	return err
+}
+
+// ServiceAccountToken is the token used by a service account to authenticate.
+type ServiceAccountToken struct {
+	Account *ServiceAccount
+	value   string
+}
+
+func (t *ServiceAccountToken) GetValue() string {
+	return t.value
+}
+
+// User always fails, service accounts are not users and can't be used in
+// operations that act on a user, like managing keys or passwords.
+func (t *ServiceAccountToken) User() (*User, error) {
+	return nil, ErrServiceAccountNotUser
+}
+
+func (t *ServiceAccountToken) IsAppToken() bool {
+	return false
+}
+
+func (t *ServiceAccountToken) GetUserName() string {
+	return t.Account.Identity()
+}
+
+func (t *ServiceAccountToken) GetAppName() string {
+	return ""
+}
+
+func (t *ServiceAccountToken) Permissions() ([]permission.Permission, error) {
+	return t.Account.Permissions()
+}
+
+// ServiceAccountAuth returns the service account token matching the given
+// authorization header.
+func ServiceAccountAuth(header string) (*ServiceAccountToken, error) {
+	value, err := ParseToken(header)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var sa ServiceAccount
+	err = conn.ServiceAccounts().Find(bson.M{"tokenhash": hashToken(value)}).One(&sa)
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceAccountToken{Account: &sa, value: value}, nil
+}
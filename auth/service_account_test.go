@@ -0,0 +1,136 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestServiceAccountCreate(c *check.C) {
+	sa := ServiceAccount{Name: "ci-bot", Team: s.team.Name, CreatedBy: s.user.Email}
+	err := sa.Create()
+	c.Assert(err, check.IsNil)
+	dbSA, err := GetServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSA.Team, check.Equals, s.team.Name)
+	c.Assert(dbSA.TokenHash, check.Equals, "")
+	c.Assert(dbSA.Identity(), check.Equals, "service-account:ci-bot")
+	other := ServiceAccount{Name: "deploy-bot", Team: s.team.Name}
+	err = other.Create()
+	c.Assert(err, check.IsNil)
+	err = sa.Create()
+	c.Assert(err, check.Equals, ErrServiceAccountAlreadyExists)
+}
+
+func (s *S) TestServiceAccountCreateInvalid(c *check.C) {
+	sa := ServiceAccount{Name: "CI Bot", Team: s.team.Name}
+	err := sa.Create()
+	c.Assert(err, check.Equals, ErrServiceAccountInvalidName)
+	sa = ServiceAccount{Name: "ci-bot", Team: "unknown"}
+	err = sa.Create()
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestListServiceAccounts(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "otherteam"})
+	c.Assert(err, check.IsNil)
+	for _, sa := range []ServiceAccount{{Name: "b", Team: s.team.Name}, {Name: "a", Team: "otherteam"}} {
+		err = sa.Create()
+		c.Assert(err, check.IsNil)
+	}
+	accounts, err := ListServiceAccounts(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(accounts, check.HasLen, 2)
+	c.Assert(accounts[0].Name, check.Equals, "a")
+	accounts, err = ListServiceAccounts(bson.M{"team": s.team.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(accounts, check.HasLen, 1)
+	c.Assert(accounts[0].Name, check.Equals, "b")
+}
+
+func (s *S) TestRemoveServiceAccount(c *check.C) {
+	sa := ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err := sa.Create()
+	c.Assert(err, check.IsNil)
+	err = RemoveServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	_, err = GetServiceAccount("ci-bot")
+	c.Assert(err, check.Equals, ErrServiceAccountNotFound)
+	err = RemoveServiceAccount("ci-bot")
+	c.Assert(err, check.Equals, ErrServiceAccountNotFound)
+}
+
+func (s *S) TestServiceAccountRotateToken(c *check.C) {
+	sa := ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err := sa.Create()
+	c.Assert(err, check.IsNil)
+	first, err := sa.RotateToken()
+	c.Assert(err, check.IsNil)
+	t, err := ServiceAccountAuth("bearer " + first)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.GetUserName(), check.Equals, "service-account:ci-bot")
+	c.Assert(t.IsAppToken(), check.Equals, false)
+	_, err = t.User()
+	c.Assert(err, check.Equals, ErrServiceAccountNotUser)
+	second, err := sa.RotateToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(second, check.Not(check.Equals), first)
+	_, err = ServiceAccountAuth("bearer " + first)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+	_, err = ServiceAccountAuth("bearer " + second)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestServiceAccountRoles(c *check.C) {
+	r1, err := permission.NewRole("r1", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	sa := ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	err = sa.AddRole("r1", s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sa.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: s.team.Name}})
+	value, err := sa.RotateToken()
+	c.Assert(err, check.IsNil)
+	t, err := ServiceAccountAuth("bearer " + value)
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, s.team.Name)},
+	})
+	err = sa.RemoveRole("r1", s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(sa.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveRoleFromAllServiceAccounts(c *check.C) {
+	_, err := permission.NewRole("r1", "team", "")
+	c.Assert(err, check.IsNil)
+	sa := ServiceAccount{Name: "ci-bot", Team: s.team.Name}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	err = sa.AddRole("r1", s.team.Name)
+	c.Assert(err, check.IsNil)
+	err = RemoveRoleFromAllServiceAccounts("r1")
+	c.Assert(err, check.IsNil)
+	dbSA, err := GetServiceAccount("ci-bot")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbSA.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveTeamWithServiceAccount(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "citeam"})
+	c.Assert(err, check.IsNil)
+	sa := ServiceAccount{Name: "ci-bot", Team: "citeam"}
+	err = sa.Create()
+	c.Assert(err, check.IsNil)
+	err = RemoveTeam("citeam")
+	c.Assert(err, check.DeepEquals, &ErrTeamStillUsed{ServiceAccounts: []string{"ci-bot"}})
+}
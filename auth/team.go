@@ -18,9 +18,11 @@ import (
 )
 
 var (
-	ErrInvalidTeamName   = errors.New("invalid team name")
-	ErrTeamAlreadyExists = errors.New("team already exists")
-	ErrTeamNotFound      = errors.New("team not found")
+	ErrInvalidTeamName    = errors.New("invalid team name")
+	ErrTeamAlreadyExists  = errors.New("team already exists")
+	ErrTeamNotFound       = errors.New("team not found")
+	ErrParentTeamNotFound = errors.New("parent team not found")
+	ErrTeamParentCycle    = errors.New("a team can't be nested under itself or one of its descendants")
 
 	teamNameRegexp = regexp.MustCompile(`^[a-zA-Z][-@_.+\w]+$`)
 )
@@ -28,19 +30,30 @@ var (
 type ErrTeamStillUsed struct {
 	Apps             []string
 	ServiceInstances []string
+	ServiceAccounts  []string
+	Teams            []string
 }
 
 func (e *ErrTeamStillUsed) Error() string {
 	if len(e.Apps) > 0 {
 		return fmt.Sprintf("Apps: %s", strings.Join(e.Apps, ", "))
 	}
-	return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	if len(e.ServiceInstances) > 0 {
+		return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	}
+	if len(e.ServiceAccounts) > 0 {
+		return fmt.Sprintf("Service accounts: %s", strings.Join(e.ServiceAccounts, ", "))
+	}
+	return fmt.Sprintf("Child teams: %s", strings.Join(e.Teams, ", "))
 }
 
 // Team represents a real world team, a team has one creating user and a name.
+// A team may be nested under a parent team, in which case roles granted in the
+// context of any of its ancestors also apply to it.
 type Team struct {
 	Name         string `bson:"_id" json:"name"`
 	CreatingUser string
+	Parent       string `bson:",omitempty" json:"parent,omitempty"`
 }
 
 // AllowedApps returns the apps that the team has access.
@@ -147,6 +160,22 @@ func RemoveTeam(teamName string) error {
 	if len(serviceInstances) > 0 {
 		return &ErrTeamStillUsed{ServiceInstances: serviceInstances}
 	}
+	var serviceAccounts []string
+	err = conn.ServiceAccounts().Find(bson.M{"team": teamName}).Distinct("_id", &serviceAccounts)
+	if err != nil {
+		return err
+	}
+	if len(serviceAccounts) > 0 {
+		return &ErrTeamStillUsed{ServiceAccounts: serviceAccounts}
+	}
+	var children []string
+	err = conn.Teams().Find(bson.M{"parent": teamName}).Distinct("_id", &children)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return &ErrTeamStillUsed{Teams: children}
+	}
 	err = conn.Teams().RemoveId(teamName)
 	if err == mgo.ErrNotFound {
 		return ErrTeamNotFound
@@ -167,3 +196,122 @@ func ListTeams() ([]Team, error) {
 	}
 	return teams, nil
 }
+
+// SetTeamParent nests the team under the parent team. An empty parent turns
+// the team into a top level team.
+func SetTeamParent(name, parent string) error {
+	_, err := GetTeam(name)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if parent == "" {
+		return conn.Teams().UpdateId(name, bson.M{"$unset": bson.M{"parent": ""}})
+	}
+	_, err = GetTeam(parent)
+	if err == ErrTeamNotFound {
+		return ErrParentTeamNotFound
+	}
+	if err != nil {
+		return err
+	}
+	nested, err := TeamDescendants(name)
+	if err != nil {
+		return err
+	}
+	if parent == name {
+		return ErrTeamParentCycle
+	}
+	for _, d := range nested {
+		if d == parent {
+			return ErrTeamParentCycle
+		}
+	}
+	return conn.Teams().UpdateId(name, bson.M{"$set": bson.M{"parent": parent}})
+}
+
+// TeamDescendants returns the names of the teams nested under the team,
+// directly or through other teams.
+func TeamDescendants(name string) ([]string, error) {
+	children, err := teamChildren()
+	if err != nil {
+		return nil, err
+	}
+	return descendants(children, name), nil
+}
+
+// InheritTeamPermissions returns the permissions along with copies of the
+// permissions in the context of a team for each of its descendants.
+func InheritTeamPermissions(perms []permission.Permission) ([]permission.Permission, error) {
+	var hasTeamPerms bool
+	for _, p := range perms {
+		if p.Context.CtxType == permission.CtxTeam {
+			hasTeamPerms = true
+			break
+		}
+	}
+	if !hasTeamPerms {
+		return perms, nil
+	}
+	children, err := teamChildren()
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return perms, nil
+	}
+	for i, n := 0, len(perms); i < n; i++ {
+		p := perms[i]
+		if p.Context.CtxType != permission.CtxTeam {
+			continue
+		}
+		for _, team := range descendants(children, p.Context.Value) {
+			inherited := p
+			inherited.Context = permission.Context(permission.CtxTeam, team)
+			perms = append(perms, inherited)
+		}
+	}
+	return perms, nil
+}
+
+// teamChildren returns the names of the children of each parent team.
+func teamChildren() (map[string][]string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var teams []Team
+	err = conn.Teams().Find(bson.M{"parent": bson.M{"$exists": true}}).All(&teams)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[string][]string)
+	for _, t := range teams {
+		children[t.Parent] = append(children[t.Parent], t.Name)
+	}
+	return children, nil
+}
+
+func descendants(children map[string][]string, name string) []string {
+	var result []string
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range children[current] {
+			if visited[child] {
+				continue
+			}
+			visited[child] = true
+			result = append(result, child)
+			queue = append(queue, child)
+		}
+	}
+	return result
+}
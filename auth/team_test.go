@@ -7,6 +7,7 @@ package auth
 import (
 	"sort"
 
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -148,3 +149,102 @@ func (s *S) TestListTeams(c *check.C) {
 	sort.Strings(names)
 	c.Assert(names, check.DeepEquals, []string{"cobrateam", "corrino", "fenring"})
 }
+
+func (s *S) TestRemoveTeamWithChildTeams(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "atreides"}, Team{Name: "fremen", Parent: "atreides"})
+	c.Assert(err, check.IsNil)
+	err = RemoveTeam("atreides")
+	c.Assert(err, check.DeepEquals, &ErrTeamStillUsed{Teams: []string{"fremen"}})
+	c.Assert(err, check.ErrorMatches, "Child teams: fremen")
+}
+
+func (s *S) TestSetTeamParent(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "atreides"}, Team{Name: "fremen"})
+	c.Assert(err, check.IsNil)
+	err = SetTeamParent("fremen", "atreides")
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam("fremen")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Parent, check.Equals, "atreides")
+	err = SetTeamParent("fremen", "")
+	c.Assert(err, check.IsNil)
+	team, err = GetTeam("fremen")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Parent, check.Equals, "")
+}
+
+func (s *S) TestSetTeamParentNotFound(c *check.C) {
+	err := SetTeamParent("unknown", s.team.Name)
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+	err = SetTeamParent(s.team.Name, "unknown")
+	c.Assert(err, check.Equals, ErrParentTeamNotFound)
+}
+
+func (s *S) TestSetTeamParentCycle(c *check.C) {
+	err := s.conn.Teams().Insert(
+		Team{Name: "atreides"},
+		Team{Name: "fremen", Parent: "atreides"},
+		Team{Name: "sietch", Parent: "fremen"},
+	)
+	c.Assert(err, check.IsNil)
+	err = SetTeamParent("atreides", "atreides")
+	c.Assert(err, check.Equals, ErrTeamParentCycle)
+	err = SetTeamParent("atreides", "sietch")
+	c.Assert(err, check.Equals, ErrTeamParentCycle)
+	err = SetTeamParent("sietch", "atreides")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTeamDescendants(c *check.C) {
+	err := s.conn.Teams().Insert(
+		Team{Name: "atreides"},
+		Team{Name: "fremen", Parent: "atreides"},
+		Team{Name: "sietch", Parent: "fremen"},
+		Team{Name: "guild", Parent: "cobrateam"},
+	)
+	c.Assert(err, check.IsNil)
+	teams, err := TeamDescendants("atreides")
+	c.Assert(err, check.IsNil)
+	c.Assert(teams, check.DeepEquals, []string{"fremen", "sietch"})
+	teams, err = TeamDescendants("sietch")
+	c.Assert(err, check.IsNil)
+	c.Assert(teams, check.HasLen, 0)
+}
+
+func (s *S) TestInheritTeamPermissions(c *check.C) {
+	err := s.conn.Teams().Insert(
+		Team{Name: "atreides"},
+		Team{Name: "fremen", Parent: "atreides"},
+		Team{Name: "sietch", Parent: "fremen"},
+	)
+	c.Assert(err, check.IsNil)
+	perms, err := InheritTeamPermissions([]permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, "fremen")},
+		{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxGlobal, "")},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, "fremen")},
+		{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxGlobal, "")},
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, "sietch")},
+	})
+}
+
+func (s *S) TestUserPermissionsInheritedFromParentTeam(c *check.C) {
+	err := s.conn.Teams().Insert(Team{Name: "fremen", Parent: s.team.Name})
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-member", s.team.Name)
+	c.Assert(err, check.IsNil)
+	perms, err := s.user.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(permission.CheckFromPermList(perms, permission.PermAppDeploy, permission.Context(permission.CtxTeam, "fremen")), check.Equals, true)
+	contexts := permission.ContextsFromListForPermission(perms, permission.PermAppDeploy, permission.CtxTeam)
+	c.Assert(contexts, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxTeam, s.team.Name),
+		permission.Context(permission.CtxTeam, "fremen"),
+	})
+}
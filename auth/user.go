@@ -20,18 +20,38 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 var (
-	ErrUserNotFound = stderrors.New("user not found")
-	ErrInvalidKey   = stderrors.New("invalid key")
-	ErrKeyDisabled  = stderrors.New("key management is disabled")
+	ErrUserNotFound          = stderrors.New("user not found")
+	ErrInvalidKey            = stderrors.New("invalid key")
+	ErrKeyDisabled           = stderrors.New("key management is disabled")
+	ErrRoleExpirationInvalid = stderrors.New("role expiration date must be in the future")
 )
 
+// RoleInstance is a role assigned to a user in a context value. Temporary
+// assignments have an expiration date, after which they grant nothing and are
+// eventually removed, and may record the reason of the assignment and who
+// approved it.
 type RoleInstance struct {
 	Name         string
 	ContextValue string
+	ExpiresAt    time.Time `bson:",omitempty"`
+	Reason       string    `bson:",omitempty" json:",omitempty"`
+	Approver     string    `bson:",omitempty" json:",omitempty"`
+}
+
+// IsTemporary returns whether the role assignment has an expiration date.
+func (r *RoleInstance) IsTemporary() bool {
+	return !r.ExpiresAt.IsZero()
+}
+
+// IsExpired returns whether the expiration date of a temporary role
+// assignment has passed.
+func (r *RoleInstance) IsExpired() bool {
+	return r.IsTemporary() && !r.ExpiresAt.After(time.Now())
 }
 
 type User struct {
@@ -149,6 +169,10 @@ func (u *User) Delete() error {
 	if err != nil {
 		log.Errorf("failed to remove user %q from the repository manager: %s", u.Email, err)
 	}
+	err = removePersonalTokens(u.Email)
+	if err != nil {
+		log.Errorf("failed to remove personal tokens of user %q: %s", u.Email, err)
+	}
 	return nil
 }
 
@@ -232,9 +256,16 @@ func (u *User) Reload() error {
 }
 
 func (u *User) Permissions() ([]permission.Permission, error) {
+	return rolesPermissions(u.Roles)
+}
+
+func rolesPermissions(roleInstances []RoleInstance) ([]permission.Permission, error) {
 	var permissions []permission.Permission
 	roles := make(map[string]*permission.Role)
-	for _, roleData := range u.Roles {
+	for _, roleData := range roleInstances {
+		if roleData.IsExpired() {
+			continue
+		}
 		role := roles[roleData.Name]
 		if role == nil {
 			foundRole, err := permission.FindRole(roleData.Name)
@@ -246,7 +277,7 @@ func (u *User) Permissions() ([]permission.Permission, error) {
 		}
 		permissions = append(permissions, role.PermissionsFor(roleData.ContextValue)...)
 	}
-	return permissions, nil
+	return InheritTeamPermissions(permissions)
 }
 
 func (u *User) AddRole(roleName string, contextValue string) error {
@@ -259,6 +290,14 @@ func (u *User) AddRole(roleName string, contextValue string) error {
 		return err
 	}
 	defer conn.Close()
+	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
+		"$pull": bson.M{
+			"roles": bson.M{"name": roleName, "contextvalue": contextValue, "expiresat": bson.M{"$exists": true}},
+		},
+	})
+	if err != nil {
+		return err
+	}
 	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
 		"$addToSet": bson.M{
 			// Order matters in $addToSet, that's why bson.D is used instead
@@ -275,6 +314,73 @@ func (u *User) AddRole(roleName string, contextValue string) error {
 	return u.Reload()
 }
 
+// AddTemporaryRole assigns the role to the user until its expiration date,
+// replacing any other temporary assignment of the role in the same context
+// value. Roles permanently assigned to the user are kept as they are.
+func (u *User) AddTemporaryRole(role RoleInstance) error {
+	_, err := permission.FindRole(role.Name)
+	if err != nil {
+		return err
+	}
+	if !role.ExpiresAt.After(time.Now()) {
+		return ErrRoleExpirationInvalid
+	}
+	role.ExpiresAt = role.ExpiresAt.UTC()
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
+		"$pull": bson.M{
+			"roles": bson.M{"name": role.Name, "contextvalue": role.ContextValue, "expiresat": bson.M{"$exists": true}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = conn.Users().Update(bson.M{
+		"email": u.Email,
+		"roles": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"name":         role.Name,
+			"contextvalue": role.ContextValue,
+			"expiresat":    bson.M{"$exists": false},
+		}}},
+	}, bson.M{"$push": bson.M{"roles": role}})
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return u.Reload()
+}
+
+// RemoveExpiredRole removes the temporary assignment of the role in the
+// context value if it's expired, returning whether it was removed.
+func (u *User) RemoveExpiredRole(roleName string, contextValue string) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	expired := bson.M{"name": roleName, "contextvalue": contextValue, "expiresat": bson.M{"$lte": time.Now().UTC()}}
+	err = conn.Users().Update(bson.M{
+		"email": u.Email,
+		"roles": bson.M{"$elemMatch": expired},
+	}, bson.M{"$pull": bson.M{"roles": expired}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, u.Reload()
+}
+
+// ListUsersWithExpiredRoles returns the users with at least one expired
+// temporary role assignment.
+func ListUsersWithExpiredRoles() ([]User, error) {
+	return listUsers(bson.M{"roles.expiresat": bson.M{"$lte": time.Now().UTC()}})
+}
+
 func RemoveRoleFromAllUsers(roleName string) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -6,6 +6,7 @@ package auth
 
 import (
 	"sort"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -481,3 +482,135 @@ func (s *S) TestAddRolesForEvent(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "team1"}})
 }
+
+func (s *S) TestUserAddTemporaryRole(c *check.C) {
+	_, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	expiresAt := time.Now().Add(time.Hour)
+	err = u.AddTemporaryRole(RoleInstance{Name: "r1", ContextValue: "myapp", ExpiresAt: expiresAt, Reason: "incident", Approver: "admin@tsuru.com"})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].Name, check.Equals, "r1")
+	c.Assert(u.Roles[0].ContextValue, check.Equals, "myapp")
+	c.Assert(u.Roles[0].ExpiresAt.Unix(), check.Equals, expiresAt.Unix())
+	c.Assert(u.Roles[0].Reason, check.Equals, "incident")
+	c.Assert(u.Roles[0].Approver, check.Equals, "admin@tsuru.com")
+	c.Assert(u.Roles[0].IsTemporary(), check.Equals, true)
+	c.Assert(u.Roles[0].IsExpired(), check.Equals, false)
+	expiresAt = expiresAt.Add(time.Hour)
+	err = u.AddTemporaryRole(RoleInstance{Name: "r1", ContextValue: "myapp", ExpiresAt: expiresAt})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].ExpiresAt.Unix(), check.Equals, expiresAt.Unix())
+}
+
+func (s *S) TestUserAddTemporaryRoleInvalid(c *check.C) {
+	_, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddTemporaryRole(RoleInstance{Name: "r1", ContextValue: "myapp", ExpiresAt: time.Now().Add(-time.Minute)})
+	c.Assert(err, check.Equals, ErrRoleExpirationInvalid)
+	err = u.AddTemporaryRole(RoleInstance{Name: "unknown", ContextValue: "myapp", ExpiresAt: time.Now().Add(time.Minute)})
+	c.Assert(err, check.Equals, permission.ErrRoleNotFound)
+	c.Assert(u.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestUserAddTemporaryRoleKeepsPermanentRole(c *check.C) {
+	_, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("r1", "myapp")
+	c.Assert(err, check.IsNil)
+	err = u.AddTemporaryRole(RoleInstance{Name: "r1", ContextValue: "myapp", ExpiresAt: time.Now().Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "myapp"}})
+}
+
+func (s *S) TestUserAddRoleReplacesTemporaryRole(c *check.C) {
+	_, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddTemporaryRole(RoleInstance{Name: "r1", ContextValue: "myapp", ExpiresAt: time.Now().Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("r1", "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "myapp"}})
+}
+
+func (s *S) TestUserPermissionsIgnoresExpiredRoles(c *check.C) {
+	r1, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	u := User{
+		Email:    "me@tsuru.com",
+		Password: "123",
+		Roles: []RoleInstance{
+			{Name: "r1", ContextValue: "expired", ExpiresAt: time.Now().Add(-time.Minute)},
+			{Name: "r1", ContextValue: "valid", ExpiresAt: time.Now().Add(time.Minute)},
+		},
+	}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	perms, err := u.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxApp, "valid")},
+	})
+}
+
+func (s *S) TestUserRemoveExpiredRole(c *check.C) {
+	u := User{
+		Email:    "me@tsuru.com",
+		Password: "123",
+		Roles: []RoleInstance{
+			{Name: "r1", ContextValue: "expired", ExpiresAt: time.Now().Add(-time.Minute)},
+			{Name: "r1", ContextValue: "valid", ExpiresAt: time.Now().Add(time.Minute)},
+			{Name: "r1", ContextValue: "permanent"},
+		},
+	}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	removed, err := u.RemoveExpiredRole("r1", "valid")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, false)
+	removed, err = u.RemoveExpiredRole("r1", "permanent")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, false)
+	removed, err = u.RemoveExpiredRole("r1", "expired")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, true)
+	c.Assert(u.Roles, check.HasLen, 2)
+	c.Assert(u.Roles[0].ContextValue, check.Equals, "valid")
+	c.Assert(u.Roles[1].ContextValue, check.Equals, "permanent")
+	removed, err = u.RemoveExpiredRole("r1", "expired")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, false)
+}
+
+func (s *S) TestListUsersWithExpiredRoles(c *check.C) {
+	u1 := User{Email: "me1@tsuru.com", Password: "123", Roles: []RoleInstance{
+		{Name: "r1", ContextValue: "a", ExpiresAt: time.Now().Add(-time.Minute)},
+	}}
+	err := u1.Create()
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "me2@tsuru.com", Password: "123", Roles: []RoleInstance{
+		{Name: "r1", ContextValue: "a", ExpiresAt: time.Now().Add(time.Minute)},
+		{Name: "r1", ContextValue: "b"},
+	}}
+	err = u2.Create()
+	c.Assert(err, check.IsNil)
+	users, err := ListUsersWithExpiredRoles()
+	c.Assert(err, check.IsNil)
+	c.Assert(users, check.HasLen, 1)
+	c.Assert(users[0].Email, check.Equals, "me1@tsuru.com")
+}
@@ -79,6 +79,7 @@ func BuildBaseManager(name, version, versionHeader string, lookup Lookup) *Manag
 	m.Register(&targetRemove{})
 	m.Register(&targetSet{})
 	m.Register(userInfo{})
+	m.Register(&permissionCheck{})
 	m.RegisterTopic("target", fmt.Sprintf(targetTopic, name))
 	return m
 }
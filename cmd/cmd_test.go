@@ -652,6 +652,13 @@ func (s *S) TestUserInfoIsRegisteredByBaseManager(c *check.C) {
 	c.Assert(info, check.FitsTypeOf, userInfo{})
 }
 
+func (s *S) TestPermissionCheckIsRegisteredByBaseManager(c *check.C) {
+	mngr := BuildBaseManager("tsuru", "1.0", "", nil)
+	cmd, ok := mngr.Commands["permission-check"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(cmd, check.FitsTypeOf, &permissionCheck{})
+}
+
 func (s *S) TestInvalidCommandFuzzyMatch01(c *check.C) {
 	mngr := BuildBaseManager("tsuru", "1.0", "", nil)
 	var stdout, stderr bytes.Buffer
@@ -0,0 +1,140 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/gnuflag"
+)
+
+type permissionMatch struct {
+	Permission string
+	Role       string
+	Deny       bool
+	Conditions []struct {
+		Attribute string
+		Values    []string
+	}
+	Result string
+}
+
+type permissionCheckResult struct {
+	Subject    string
+	Permission string
+	Allowed    bool
+	Reason     string
+	Matches    []permissionMatch
+}
+
+type permissionCheck struct {
+	fs         *gnuflag.FlagSet
+	user       string
+	token      string
+	contexts   StringSliceFlag
+	attributes StringSliceFlag
+}
+
+func (c *permissionCheck) Info() *Info {
+	return &Info{
+		Name:  "permission-check",
+		Usage: "permission-check <permission> [-c/--context <type>:<value>]... [-a/--attribute <name>=<value>]... [-u/--user <email>|-t/--token <token>]",
+		Desc: `Checks whether a permission is allowed in the given contexts, explaining
+which roles and permissions were considered in the check.
+
+By default the check is done for the current user, the --user flag checks
+the permissions of another user and the --token flag checks the
+permissions of a token, like a personal or a service account token.
+
+Contexts are in the form <type>:<value>, like "app:myapp" or "pool:prod", and
+should include all the contexts of the checked action, e.g. checking a deploy
+to an app requires the app, its pool and its teams. Attributes, in the form
+<name>=<value>, are used to evaluate role conditions, like "env=DB_PASSWORD".`,
+		MinArgs: 1,
+		MaxArgs: 1,
+	}
+}
+
+func (c *permissionCheck) Run(context *Context, client *Client) error {
+	if c.user != "" && c.token != "" {
+		return fmt.Errorf("either --user or --token must be used, not both")
+	}
+	v := url.Values{}
+	v.Set("permission", context.Args[0])
+	if c.user != "" {
+		v.Set("user", c.user)
+	}
+	if c.token != "" {
+		v.Set("token", c.token)
+	}
+	for _, ctx := range c.contexts {
+		v.Add("context", ctx)
+	}
+	for _, attr := range c.attributes {
+		v.Add("attribute", attr)
+	}
+	u, err := GetURL("/permissions/check")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result permissionCheckResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	status := "DENIED"
+	if result.Allowed {
+		status = "ALLOWED"
+	}
+	fmt.Fprintf(context.Stdout, "%s: %s for %s\n", status, result.Permission, result.Subject)
+	fmt.Fprintf(context.Stdout, "Reason: %s\n", result.Reason)
+	if len(result.Matches) == 0 {
+		return nil
+	}
+	table := NewTable()
+	table.Headers = Row{"Permission", "Role", "Type", "Conditions", "Result"}
+	for _, m := range result.Matches {
+		kind := "allow"
+		if m.Deny {
+			kind = "deny"
+		}
+		conditions := make([]string, len(m.Conditions))
+		for i, cond := range m.Conditions {
+			conditions[i] = fmt.Sprintf("%s in [%s]", cond.Attribute, strings.Join(cond.Values, ", "))
+		}
+		table.AddRow(Row{m.Permission, m.Role, kind, strings.Join(conditions, "\n"), m.Result})
+	}
+	fmt.Fprint(context.Stdout, table.String())
+	return nil
+}
+
+func (c *permissionCheck) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("permission-check", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.user, "user", "", "Email of the user whose permissions are checked")
+		c.fs.StringVar(&c.user, "u", "", "Email of the user whose permissions are checked")
+		c.fs.StringVar(&c.token, "token", "", "Token whose permissions are checked")
+		c.fs.StringVar(&c.token, "t", "", "Token whose permissions are checked")
+		c.fs.Var(&c.contexts, "context", "Context of the checked action, in the form <type>:<value>")
+		c.fs.Var(&c.contexts, "c", "Context of the checked action, in the form <type>:<value>")
+		c.fs.Var(&c.attributes, "attribute", "Attribute of the checked action, in the form <name>=<value>")
+		c.fs.Var(&c.attributes, "a", "Attribute of the checked action, in the form <name>=<value>")
+	}
+	return c.fs
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPermissionCheckInfo(c *check.C) {
+	c.Assert((&permissionCheck{}).Info(), check.NotNil)
+}
+
+func (s *S) TestPermissionCheckRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := Context{
+		Args:   []string{"app.update.env.set"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `{"subject":"admin@example.com","permission":"app.update.env.set","allowed":false,
+"reason":"denied by app.update.env.set(global) in role \"no-db-envs\"",
+"matches":[
+	{"permission":"app(team myteam)","role":"team-member","deny":false,"result":"granted"},
+	{"permission":"app.update.env.set(global)","role":"no-db-envs","deny":true,
+	 "conditions":[{"scheme_name":"app.update.env.set","attribute":"env","values":["DB_*"]}],"result":"denied"}
+]}`
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			return req.Method == "POST" && req.URL.Path == "/1.0/permissions/check" &&
+				req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" &&
+				req.Form.Get("permission") == "app.update.env.set" &&
+				req.Form.Get("user") == "admin@example.com" &&
+				len(req.Form["context"]) == 2 && req.Form["context"][1] == "pool:prod" &&
+				req.Form.Get("attribute") == "env=DB_PASSWORD"
+		},
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, globalManager)
+	command := permissionCheck{}
+	command.Flags().Parse(true, []string{"-u", "admin@example.com", "-c", "team:myteam", "--context", "pool:prod", "-a", "env=DB_PASSWORD"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `DENIED: app.update.env.set for admin@example.com
+Reason: denied by app.update.env.set(global) in role "no-db-envs"
++----------------------------+-------------+-------+---------------+---------+
+| Permission                 | Role        | Type  | Conditions    | Result  |
++----------------------------+-------------+-------+---------------+---------+
+| app(team myteam)           | team-member | allow |               | granted |
+| app.update.env.set(global) | no-db-envs  | deny  | env in [DB_*] | denied  |
++----------------------------+-------------+-------+---------------+---------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestPermissionCheckRunUserAndToken(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := Context{Args: []string{"app.deploy"}, Stdout: &stdout, Stderr: &stderr}
+	command := permissionCheck{}
+	command.Flags().Parse(true, []string{"-u", "admin@example.com", "-t", "abc"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "either --user or --token must be used, not both")
+}
+
@@ -116,6 +116,32 @@ func (s *Storage) Plans() *storage.Collection {
 	return s.Collection("plans")
 }
 
+// EnvSets returns the env sets collection.
+func (s *Storage) EnvSets() *storage.Collection {
+	return s.Collection("envsets")
+}
+
+// VolumePlans returns the volume plans collection.
+func (s *Storage) VolumePlans() *storage.Collection {
+	nameIndex := mgo.Index{Key: []string{"pool", "name"}, Unique: true}
+	coll := s.Collection("volume_plans")
+	coll.EnsureIndex(nameIndex)
+	return coll
+}
+
+// Volumes returns the volumes collection.
+func (s *Storage) Volumes() *storage.Collection {
+	return s.Collection("volumes")
+}
+
+// VolumeBinds returns the collection of binds between volumes and apps.
+func (s *Storage) VolumeBinds() *storage.Collection {
+	appIndex := mgo.Index{Key: []string{"_id.app"}}
+	coll := s.Collection("volume_binds")
+	coll.EnsureIndex(appIndex)
+	return coll
+}
+
 // Pools returns the pool collection.
 func (s *Storage) Pools() *storage.Collection {
 	return s.Collection("pool")
@@ -135,6 +161,36 @@ func (s *Storage) Tokens() *storage.Collection {
 	return coll
 }
 
+// PersonalTokens returns the personal tokens collection from MongoDB.
+func (s *Storage) PersonalTokens() *storage.Collection {
+	hashIndex := mgo.Index{Key: []string{"tokenhash"}, Unique: true}
+	nameIndex := mgo.Index{Key: []string{"useremail", "name"}, Unique: true}
+	coll := s.Collection("personal_tokens")
+	coll.EnsureIndex(hashIndex)
+	coll.EnsureIndex(nameIndex)
+	return coll
+}
+
+// ServiceAccounts returns the service accounts collection from MongoDB.
+func (s *Storage) ServiceAccounts() *storage.Collection {
+	teamIndex := mgo.Index{Key: []string{"team"}}
+	hashIndex := mgo.Index{Key: []string{"tokenhash"}, Unique: true, Sparse: true}
+	coll := s.Collection("service_accounts")
+	coll.EnsureIndex(teamIndex)
+	coll.EnsureIndex(hashIndex)
+	return coll
+}
+
+// RoleRequests returns the role requests collection from MongoDB.
+func (s *Storage) RoleRequests() *storage.Collection {
+	userIndex := mgo.Index{Key: []string{"useremail"}}
+	statusIndex := mgo.Index{Key: []string{"status"}}
+	coll := s.Collection("role_requests")
+	coll.EnsureIndex(userIndex)
+	coll.EnsureIndex(statusIndex)
+	return coll
+}
+
 func (s *Storage) PasswordTokens() *storage.Collection {
 	return s.Collection("password_tokens")
 }
@@ -210,6 +266,16 @@ func (s *Storage) Limiter() *storage.Collection {
 	return s.Collection("limiter")
 }
 
+// AuditLog returns the audit log collection from MongoDB.
+func (s *Storage) AuditLog() *storage.Collection {
+	dateIndex := mgo.Index{Key: []string{"-date"}}
+	ownerIndex := mgo.Index{Key: []string{"owner"}}
+	c := s.Collection("audit_log")
+	c.EnsureIndex(dateIndex)
+	c.EnsureIndex(ownerIndex)
+	return c
+}
+
 func (s *Storage) Events() *storage.Collection {
 	ownerIndex := mgo.Index{Key: []string{"owner"}}
 	kindIndex := mgo.Index{Key: []string{"kind"}}
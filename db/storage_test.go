@@ -141,6 +141,93 @@ func (s *S) TestPlans(c *check.C) {
 	c.Assert(plans, check.DeepEquals, plansc)
 }
 
+func (s *S) TestEnvSets(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	envSets := storage.EnvSets()
+	envSetsc := storage.Collection("envsets")
+	c.Assert(envSets, check.DeepEquals, envSetsc)
+}
+
+func (s *S) TestAuditLog(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	auditLog := storage.AuditLog()
+	auditLogc := storage.Collection("audit_log")
+	c.Assert(auditLog, check.DeepEquals, auditLogc)
+	indexes, err := auditLog.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 3)
+}
+
+func (s *S) TestVolumePlans(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	plans := storage.VolumePlans()
+	plansc := storage.Collection("volume_plans")
+	c.Assert(plans, check.DeepEquals, plansc)
+	indexes, err := plans.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 2)
+}
+
+func (s *S) TestVolumes(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	volumes := storage.Volumes()
+	volumesc := storage.Collection("volumes")
+	c.Assert(volumes, check.DeepEquals, volumesc)
+}
+
+func (s *S) TestVolumeBinds(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	binds := storage.VolumeBinds()
+	bindsc := storage.Collection("volume_binds")
+	c.Assert(binds, check.DeepEquals, bindsc)
+}
+
+func (s *S) TestPersonalTokens(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	tokens := storage.PersonalTokens()
+	tokensc := storage.Collection("personal_tokens")
+	c.Assert(tokens, check.DeepEquals, tokensc)
+	indexes, err := tokens.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 3)
+}
+
+func (s *S) TestServiceAccounts(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	accounts := storage.ServiceAccounts()
+	accountsc := storage.Collection("service_accounts")
+	c.Assert(accounts, check.DeepEquals, accountsc)
+	indexes, err := accounts.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 3)
+}
+
+func (s *S) TestRoleRequests(c *check.C) {
+	storage, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer storage.Close()
+	requests := storage.RoleRequests()
+	requestsc := storage.Collection("role_requests")
+	c.Assert(requests, check.DeepEquals, requestsc)
+	indexes, err := requests.Indexes()
+	c.Assert(err, check.IsNil)
+	c.Assert(indexes, check.HasLen, 3)
+}
+
 func (s *S) TestPools(c *check.C) {
 	storage, err := Conn()
 	c.Assert(err, check.IsNil)
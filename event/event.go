@@ -63,6 +63,9 @@ var (
 	TargetTypeRole            = TargetType("role")
 	TargetTypePlatform        = TargetType("platform")
 	TargetTypePlan            = TargetType("plan")
+	TargetTypeEnvSet          = TargetType("envset")
+	TargetTypeServiceAccount  = TargetType("service-account")
+	TargetTypeVolume          = TargetType("volume")
 )
 
 const (
@@ -705,6 +708,27 @@ func (e *Event) Write(data []byte) (int, error) {
 	return e.logBuffer.Write(data)
 }
 
+// Writer is implemented by writers logging to an event, like Event itself,
+// allowing the event to be found through writers wrapping it.
+type Writer interface {
+	io.Writer
+	Event() *Event
+}
+
+// Event returns the event itself, implementing Writer.
+func (e *Event) Event() *Event {
+	return e
+}
+
+// FromWriter returns the event w logs to, or nil if w doesn't implement
+// Writer.
+func FromWriter(w io.Writer) *Event {
+	if ew, ok := w.(Writer); ok {
+		return ew.Event()
+	}
+	return nil
+}
+
 func (e *Event) TryCancel(reason, owner string) error {
 	if !e.Cancelable || !e.Running {
 		return ErrNotCancelable
@@ -7,10 +7,17 @@
 package exec
 
 import (
+	"errors"
 	"io"
 	"os/exec"
+	"time"
 )
 
+// ErrTimeout is returned by Execute when the command, along with any process
+// it started, is killed for not finishing before the timeout set in
+// ExecuteOptions.
+var ErrTimeout = errors.New("command timed out")
+
 // ExecuteOptions specify parameters to the Execute method.
 type ExecuteOptions struct {
 	Cmd    string
@@ -20,6 +27,8 @@ type ExecuteOptions struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+	// Timeout is the maximum duration of the command, zero means no timeout.
+	Timeout time.Duration
 }
 
 type Executor interface {
@@ -36,5 +45,24 @@ func (OsExecutor) Execute(opts ExecuteOptions) error {
 	c.Stderr = opts.Stderr
 	c.Env = opts.Envs
 	c.Dir = opts.Dir
-	return c.Run()
+	if opts.Timeout <= 0 {
+		return c.Run()
+	}
+	setProcessGroup(c)
+	err := c.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(opts.Timeout):
+		killProcessGroup(c)
+		<-done
+		return ErrTimeout
+	}
 }
@@ -7,6 +7,7 @@ package exec
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/tsuru/commandmocker"
 	"gopkg.in/check.v1"
@@ -59,3 +60,40 @@ func (s *S) TestExecuteWithoutArgs(c *check.C) {
 	c.Assert(commandmocker.Parameters(tmpdir), check.IsNil)
 	c.Assert(b.String(), check.Equals, "ok")
 }
+
+func (s *S) TestExecuteTimeout(c *check.C) {
+	var e OsExecutor
+	var b bytes.Buffer
+	opts := ExecuteOptions{
+		Cmd:     "sh",
+		Args:    []string{"-c", "echo started >&2; exec sleep 10"},
+		Stdout:  &b,
+		Stderr:  &b,
+		Timeout: 100 * time.Millisecond,
+	}
+	err := e.Execute(opts)
+	c.Assert(err, check.Equals, ErrTimeout)
+	c.Assert(b.String(), check.Equals, "started\n")
+}
+
+func (s *S) TestExecuteTimeoutKillsChildren(c *check.C) {
+	var e OsExecutor
+	var b bytes.Buffer
+	opts := ExecuteOptions{
+		Cmd:     "sh",
+		Args:    []string{"-c", "sleep 100 & sleep 100"},
+		Stdout:  &b,
+		Stderr:  &b,
+		Timeout: 100 * time.Millisecond,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Execute(opts)
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, check.Equals, ErrTimeout)
+	case <-time.After(10 * time.Second):
+		c.Fatal("Execute did not return after the timeout")
+	}
+}
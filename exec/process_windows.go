@@ -0,0 +1,13 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import "os/exec"
+
+func setProcessGroup(c *exec.Cmd) {}
+
+func killProcessGroup(c *exec.Cmd) error {
+	return c.Process.Kill()
+}
@@ -25,6 +25,8 @@ import (
 
 const defaultRegion = "us-east-1"
 
+var spotPollInterval = 5 * time.Second
+
 func init() {
 	iaas.RegisterIaasProvider("ec2", newEC2IaaS)
 }
@@ -61,12 +63,17 @@ func (i *EC2IaaS) createEC2Handler(regionOrEndpoint string) (*ec2.EC2, error) {
 	return ec2.New(session.New(&config)), nil
 }
 
-func (i *EC2IaaS) waitForDnsName(ec2Inst *ec2.EC2, instanceID string, createParams map[string]string) (string, error) {
+func (i *EC2IaaS) waitTimeout() int {
 	rawWait, _ := i.base.GetConfigString("wait-timeout")
 	maxWaitTime, _ := strconv.Atoi(rawWait)
 	if maxWaitTime == 0 {
 		maxWaitTime = 300
 	}
+	return maxWaitTime
+}
+
+func (i *EC2IaaS) waitForDnsName(ec2Inst *ec2.EC2, instanceID string, createParams map[string]string) (string, error) {
+	maxWaitTime := i.waitTimeout()
 	q, err := queue.Queue()
 	if err != nil {
 		return "", err
@@ -115,6 +122,8 @@ Optional params:
   region=<region>          Chosen region, defaults to us-east-1
   securityGroup=<group>    Chosen security group
   keyName=<key name>       Key name for machine
+  spot=<true|false>        Request a spot instance
+  spot-price=<price>       Maximum hourly price for spot instances
 `
 }
 
@@ -299,19 +308,29 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := ec2Inst.RunInstances(&options)
-	if err != nil {
-		return nil, err
-	}
-	if len(resp.Instances) == 0 {
-		return nil, fmt.Errorf("no instance created")
+	var runInst *ec2.Instance
+	spot, _ := strconv.ParseBool(params["spot"])
+	if spot {
+		runInst, err = i.requestSpotInstance(ec2Inst, &options, params)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		resp, err := ec2Inst.RunInstances(&options)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Instances) == 0 {
+			return nil, fmt.Errorf("no instance created")
+		}
+		runInst = resp.Instances[0]
 	}
-	runInst := resp.Instances[0]
+	ec2Tags := []*ec2.Tag{{
+		Key:   aws.String(iaas.MachineTag),
+		Value: aws.String(i.base.IaaSName),
+	}}
 	if tags, ok := params["tags"]; ok {
-		var ec2Tags []*ec2.Tag
-		tagList := strings.Split(tags, ",")
-		ec2Tags = make([]*ec2.Tag, 0, len(tagList))
-		for _, tag := range tagList {
+		for _, tag := range strings.Split(tags, ",") {
 			if strings.Contains(tag, ":") {
 				parts := strings.SplitN(tag, ":", 2)
 				ec2Tags = append(ec2Tags, &ec2.Tag{
@@ -320,16 +339,14 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 				})
 			}
 		}
-		if len(ec2Tags) > 0 {
-			input := ec2.CreateTagsInput{
-				Resources: []*string{runInst.InstanceId},
-				Tags:      ec2Tags,
-			}
-			_, err = ec2Inst.CreateTags(&input)
-			if err != nil {
-				log.Errorf("failed to tag EC2 instance: %s", err)
-			}
-		}
+	}
+	input := ec2.CreateTagsInput{
+		Resources: []*string{runInst.InstanceId},
+		Tags:      ec2Tags,
+	}
+	_, err = ec2Inst.CreateTags(&input)
+	if err != nil {
+		log.Errorf("failed to tag EC2 instance: %s", err)
 	}
 	dnsName, err := i.waitForDnsName(ec2Inst, aws.StringValue(runInst.InstanceId), params)
 	if err != nil {
@@ -339,10 +356,194 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 		Id:      aws.StringValue(runInst.InstanceId),
 		Status:  aws.StringValue(runInst.State.Name),
 		Address: dnsName,
+		Spot:    spot,
 	}
 	return &machine, nil
 }
 
+// requestSpotInstance requests a one-time spot instance using the same launch
+// options of on-demand instances and waits for the request to be fulfilled.
+// The request is cancelled when it isn't fulfilled before the wait timeout.
+func (i *EC2IaaS) requestSpotInstance(ec2Inst *ec2.EC2, options *ec2.RunInstancesInput, params map[string]string) (*ec2.Instance, error) {
+	price := params["spot-price"]
+	if price == "" {
+		price, _ = i.base.GetConfigString("spot-price")
+	}
+	if price == "" {
+		return nil, fmt.Errorf("the parameter %q is required for spot instances", "spot-price")
+	}
+	spec := ec2.RequestSpotLaunchSpecification{
+		BlockDeviceMappings: options.BlockDeviceMappings,
+		EbsOptimized:        options.EbsOptimized,
+		IamInstanceProfile:  options.IamInstanceProfile,
+		ImageId:             options.ImageId,
+		InstanceType:        options.InstanceType,
+		KernelId:            options.KernelId,
+		KeyName:             options.KeyName,
+		Monitoring:          options.Monitoring,
+		NetworkInterfaces:   options.NetworkInterfaces,
+		RamdiskId:           options.RamdiskId,
+		SecurityGroupIds:    options.SecurityGroupIds,
+		SecurityGroups:      options.SecurityGroups,
+		SubnetId:            options.SubnetId,
+		UserData:            options.UserData,
+	}
+	if options.Placement != nil {
+		spec.Placement = &ec2.SpotPlacement{
+			AvailabilityZone: options.Placement.AvailabilityZone,
+			GroupName:        options.Placement.GroupName,
+		}
+	}
+	resp, err := ec2Inst.RequestSpotInstances(&ec2.RequestSpotInstancesInput{
+		InstanceCount:       aws.Int64(1),
+		SpotPrice:           aws.String(price),
+		Type:                aws.String(ec2.SpotInstanceTypeOneTime),
+		LaunchSpecification: &spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.SpotInstanceRequests) == 0 {
+		return nil, fmt.Errorf("no spot instance request created")
+	}
+	requestID := resp.SpotInstanceRequests[0].SpotInstanceRequestId
+	timeout := time.Duration(i.waitTimeout()) * time.Second
+	deadline := time.Now().Add(timeout)
+	for {
+		input := ec2.DescribeSpotInstanceRequestsInput{SpotInstanceRequestIds: []*string{requestID}}
+		out, err := ec2Inst.DescribeSpotInstanceRequests(&input)
+		if err != nil {
+			return nil, err
+		}
+		if len(out.SpotInstanceRequests) > 0 {
+			req := out.SpotInstanceRequests[0]
+			if req.InstanceId != nil && *req.InstanceId != "" {
+				return &ec2.Instance{
+					InstanceId: req.InstanceId,
+					State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNamePending)},
+				}, nil
+			}
+			switch state := aws.StringValue(req.State); state {
+			case ec2.SpotInstanceStateClosed, ec2.SpotInstanceStateCancelled, ec2.SpotInstanceStateFailed:
+				var msg string
+				if req.Status != nil {
+					msg = aws.StringValue(req.Status.Message)
+				}
+				return nil, fmt.Errorf("ec2: spot instance request %s %s: %s", aws.StringValue(requestID), state, msg)
+			}
+		}
+		if time.Now().After(deadline) {
+			cancelInput := ec2.CancelSpotInstanceRequestsInput{SpotInstanceRequestIds: []*string{requestID}}
+			_, err = ec2Inst.CancelSpotInstanceRequests(&cancelInput)
+			if err != nil {
+				log.Errorf("failed to cancel EC2 spot instance request %s: %s", aws.StringValue(requestID), err)
+			}
+			return nil, fmt.Errorf("ec2: time out after %v waiting for spot instance request %s to be fulfilled", timeout, aws.StringValue(requestID))
+		}
+		time.Sleep(spotPollInterval)
+	}
+}
+
+// ListMachines returns the running instances tagged with the IaaS name and
+// the known instances still running, looking for them in the regions and
+// endpoints of the known machines and in the ones listed in the regions
+// config, a comma separated list defaulting to the default region.
+func (i *EC2IaaS) ListMachines(known []iaas.Machine) ([]iaas.Machine, error) {
+	var regions []string
+	regionsConfig, _ := i.base.GetConfigString("regions")
+	for _, region := range strings.Split(regionsConfig, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == 0 {
+		regions = []string{defaultRegion}
+	}
+	knownIDs := map[string][]*string{}
+	for _, m := range known {
+		regionOrEndpoint := getRegionOrEndpoint(m.CreationParams, true)
+		if _, ok := knownIDs[regionOrEndpoint]; !ok {
+			regions = append(regions, regionOrEndpoint)
+		}
+		knownIDs[regionOrEndpoint] = append(knownIDs[regionOrEndpoint], aws.String(m.Id))
+	}
+	var machines []iaas.Machine
+	seen := map[string]bool{}
+	queried := map[string]bool{}
+	for _, regionOrEndpoint := range regions {
+		if queried[regionOrEndpoint] {
+			continue
+		}
+		queried[regionOrEndpoint] = true
+		ec2Inst, err := i.createEC2Handler(regionOrEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		filters := [][]*ec2.Filter{{{
+			Name:   aws.String("tag:" + iaas.MachineTag),
+			Values: []*string{aws.String(i.base.IaaSName)},
+		}}}
+		if ids := knownIDs[regionOrEndpoint]; len(ids) > 0 {
+			filters = append(filters, []*ec2.Filter{{
+				Name:   aws.String("instance-id"),
+				Values: ids,
+			}})
+		}
+		for _, filter := range filters {
+			input := ec2.DescribeInstancesInput{Filters: filter}
+			err = ec2Inst.DescribeInstancesPages(&input, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+				for _, r := range resp.Reservations {
+					for _, inst := range r.Instances {
+						id := aws.StringValue(inst.InstanceId)
+						if seen[id] || !isRunningState(inst.State) {
+							continue
+						}
+						seen[id] = true
+						machines = append(machines, i.machineFromInstance(inst, regionOrEndpoint))
+					}
+				}
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return machines, nil
+}
+
+func (i *EC2IaaS) machineFromInstance(inst *ec2.Instance, regionOrEndpoint string) iaas.Machine {
+	params := map[string]string{"iaas-id": aws.StringValue(inst.InstanceId)}
+	if strings.HasPrefix(regionOrEndpoint, "http") {
+		params["endpoint"] = regionOrEndpoint
+	} else {
+		params["region"] = regionOrEndpoint
+	}
+	address := aws.StringValue(inst.PublicDnsName)
+	if address == "" {
+		address = aws.StringValue(inst.PrivateDnsName)
+	}
+	return iaas.Machine{
+		Id:             aws.StringValue(inst.InstanceId),
+		Iaas:           i.base.IaaSName,
+		Status:         aws.StringValue(inst.State.Name),
+		Address:        address,
+		CreationParams: params,
+		CreationDate:   aws.TimeValue(inst.LaunchTime).UTC(),
+	}
+}
+
+func isRunningState(state *ec2.InstanceState) bool {
+	if state == nil {
+		return false
+	}
+	switch aws.StringValue(state.Name) {
+	case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
+		return false
+	}
+	return true
+}
+
 func getRegionOrEndpoint(params map[string]string, useDefault bool) string {
 	regionOrEndpoint := params["endpoint"]
 	if regionOrEndpoint == "" {
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -329,3 +330,197 @@ func (s *S) TestDeleteMachineValidations(c *check.C) {
 	err = ec2iaas.DeleteMachine(m)
 	c.Assert(err, check.ErrorMatches, `region or endpoint creation param required`)
 }
+
+func (s *S) TestListMachines(c *check.C) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.FormValue("Action"), check.Equals, "DescribeInstances")
+		filters = append(filters, r.FormValue("Filter.1.Name")+"="+r.FormValue("Filter.1.Value.1"))
+		instances := `
+          <item>
+            <instanceId>i-1</instanceId>
+            <instanceState><code>16</code><name>running</name></instanceState>
+            <dnsName>i-1.example.com</dnsName>
+            <launchTime>2016-05-10T10:00:00.000Z</launchTime>
+          </item>
+          <item>
+            <instanceId>i-2</instanceId>
+            <instanceState><code>48</code><name>terminated</name></instanceState>
+          </item>`
+		if r.FormValue("Filter.1.Name") == "instance-id" {
+			instances = `
+          <item>
+            <instanceId>i-3</instanceId>
+            <instanceState><code>16</code><name>running</name></instanceState>
+            <privateDnsName>i-3.internal</privateDnsName>
+          </item>`
+		}
+		w.Write([]byte(`
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>
+<reservationSet>
+      <item>
+        <reservationId>r-1</reservationId>
+        <instancesSet>` + instances + `
+        </instancesSet>
+      </item>
+</reservationSet>
+</DescribeInstancesResponse>`))
+	}))
+	defer server.Close()
+	config.Set("iaas:ec2:regions", server.URL)
+	defer config.Unset("iaas:ec2:regions")
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	known := []iaas.Machine{
+		{Id: "i-3", Iaas: "ec2", CreationParams: map[string]string{"endpoint": server.URL}},
+	}
+	machines, err := ec2iaas.ListMachines(known)
+	c.Assert(err, check.IsNil)
+	c.Assert(filters, check.DeepEquals, []string{"tag:tsuru-iaas=ec2", "instance-id=i-3"})
+	c.Assert(machines, check.HasLen, 2)
+	c.Assert(machines[0].Id, check.Equals, "i-1")
+	c.Assert(machines[0].Address, check.Equals, "i-1.example.com")
+	c.Assert(machines[0].Status, check.Equals, "running")
+	c.Assert(machines[0].CreationParams, check.DeepEquals, map[string]string{"iaas-id": "i-1", "endpoint": server.URL})
+	c.Assert(machines[0].CreationDate.Format(time.RFC3339), check.Equals, "2016-05-10T10:00:00Z")
+	c.Assert(machines[1].Id, check.Equals, "i-3")
+	c.Assert(machines[1].Address, check.Equals, "i-3.internal")
+}
+
+func (s *S) spotServer(c *check.C, states ...string) (*httptest.Server, *[]string) {
+	var calledActions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.FormValue("Action")
+		calledActions = append(calledActions, action)
+		switch action {
+		case "RequestSpotInstances":
+			c.Check(r.FormValue("SpotPrice"), check.Equals, "0.05")
+			c.Check(r.FormValue("LaunchSpecification.ImageId"), check.Equals, "ami-xxxxxx")
+			c.Check(r.FormValue("LaunchSpecification.InstanceType"), check.Equals, "m1.micro")
+			w.Write([]byte(`
+<RequestSpotInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>
+<spotInstanceRequestSet>
+  <item>
+    <spotInstanceRequestId>sir-1</spotInstanceRequestId>
+    <state>open</state>
+  </item>
+</spotInstanceRequestSet>
+</RequestSpotInstancesResponse>`))
+		case "DescribeSpotInstanceRequests":
+			c.Check(r.FormValue("SpotInstanceRequestId.1"), check.Equals, "sir-1")
+			state := states[0]
+			if len(states) > 1 {
+				states = states[1:]
+			}
+			var instanceID string
+			if state == "active" {
+				instanceID = "<instanceId>i-1</instanceId>"
+			}
+			w.Write([]byte(`
+<DescribeSpotInstanceRequestsResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>
+<spotInstanceRequestSet>
+  <item>
+    <spotInstanceRequestId>sir-1</spotInstanceRequestId>
+    <state>` + state + `</state>
+    <status><code>price-too-low</code><message>Your price is too low.</message></status>` + instanceID + `
+  </item>
+</spotInstanceRequestSet>
+</DescribeSpotInstanceRequestsResponse>`))
+		case "CancelSpotInstanceRequests":
+			w.Write([]byte(`
+<CancelSpotInstanceRequestsResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>
+<spotInstanceRequestSet/>
+</CancelSpotInstanceRequestsResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	return server, &calledActions
+}
+
+func (s *S) TestRequestSpotInstance(c *check.C) {
+	spotPollInterval = time.Millisecond
+	defer func() { spotPollInterval = 5 * time.Second }()
+	server, calledActions := s.spotServer(c, "open", "open", "active")
+	defer server.Close()
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	ec2Inst, err := ec2iaas.createEC2Handler(server.URL)
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"image": "ami-xxxxxx", "type": "m1.micro", "spot": "true", "spot-price": "0.05"}
+	options, err := ec2iaas.buildRunInstancesOptions(params)
+	c.Assert(err, check.IsNil)
+	inst, err := ec2iaas.requestSpotInstance(ec2Inst, &options, params)
+	c.Assert(err, check.IsNil)
+	c.Assert(aws.StringValue(inst.InstanceId), check.Equals, "i-1")
+	c.Assert(aws.StringValue(inst.State.Name), check.Equals, "pending")
+	c.Assert(*calledActions, check.DeepEquals, []string{
+		"RequestSpotInstances",
+		"DescribeSpotInstanceRequests",
+		"DescribeSpotInstanceRequests",
+		"DescribeSpotInstanceRequests",
+	})
+}
+
+func (s *S) TestRequestSpotInstancePriceFromConfig(c *check.C) {
+	config.Set("iaas:ec2:spot-price", "0.05")
+	defer config.Unset("iaas:ec2:spot-price")
+	server, _ := s.spotServer(c, "active")
+	defer server.Close()
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	ec2Inst, err := ec2iaas.createEC2Handler(server.URL)
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"image": "ami-xxxxxx", "type": "m1.micro", "spot": "true"}
+	options, err := ec2iaas.buildRunInstancesOptions(params)
+	c.Assert(err, check.IsNil)
+	inst, err := ec2iaas.requestSpotInstance(ec2Inst, &options, params)
+	c.Assert(err, check.IsNil)
+	c.Assert(aws.StringValue(inst.InstanceId), check.Equals, "i-1")
+}
+
+func (s *S) TestRequestSpotInstanceWithoutPrice(c *check.C) {
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	ec2Inst, err := ec2iaas.createEC2Handler("myregion")
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"image": "ami-xxxxxx", "type": "m1.micro", "spot": "true"}
+	options, err := ec2iaas.buildRunInstancesOptions(params)
+	c.Assert(err, check.IsNil)
+	_, err = ec2iaas.requestSpotInstance(ec2Inst, &options, params)
+	c.Assert(err, check.ErrorMatches, `the parameter "spot-price" is required for spot instances`)
+}
+
+func (s *S) TestRequestSpotInstanceFailed(c *check.C) {
+	spotPollInterval = time.Millisecond
+	defer func() { spotPollInterval = 5 * time.Second }()
+	server, _ := s.spotServer(c, "open", "closed")
+	defer server.Close()
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	ec2Inst, err := ec2iaas.createEC2Handler(server.URL)
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"image": "ami-xxxxxx", "type": "m1.micro", "spot": "true", "spot-price": "0.05"}
+	options, err := ec2iaas.buildRunInstancesOptions(params)
+	c.Assert(err, check.IsNil)
+	_, err = ec2iaas.requestSpotInstance(ec2Inst, &options, params)
+	c.Assert(err, check.ErrorMatches, `ec2: spot instance request sir-1 closed: Your price is too low.`)
+}
+
+func (s *S) TestRequestSpotInstanceTimeout(c *check.C) {
+	spotPollInterval = 100 * time.Millisecond
+	defer func() { spotPollInterval = 5 * time.Second }()
+	config.Set("iaas:ec2:wait-timeout", "1")
+	defer config.Unset("iaas:ec2:wait-timeout")
+	server, calledActions := s.spotServer(c, "open")
+	defer server.Close()
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	ec2Inst, err := ec2iaas.createEC2Handler(server.URL)
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"image": "ami-xxxxxx", "type": "m1.micro", "spot": "true", "spot-price": "0.05"}
+	options, err := ec2iaas.buildRunInstancesOptions(params)
+	c.Assert(err, check.IsNil)
+	_, err = ec2iaas.requestSpotInstance(ec2Inst, &options, params)
+	c.Assert(err, check.ErrorMatches, `ec2: time out after 1s waiting for spot instance request sir-1 to be fulfilled`)
+	actions := *calledActions
+	c.Assert(actions[len(actions)-1], check.Equals, "CancelSpotInstanceRequests")
+}
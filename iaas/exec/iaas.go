@@ -0,0 +1,188 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package exec provides an IaaS backed by external executables, allowing any
+// provisioning tool to create and destroy nodes.
+//
+// The create command receives the machine params as a JSON object in its
+// standard input and must write a JSON description of the created machine to
+// its standard output:
+//
+//     {"id": "vm-1", "address": "10.0.0.5", "status": "running", "port": 2375}
+//
+// Only id and address are required. The delete command receives the
+// description of the machine, including the params used to create it, in its
+// standard input. Both commands must exit with a non-zero status on failure,
+// and the name of the IaaS is available in the TSURU_IAAS environment
+// variable.
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tsuruExec "github.com/tsuru/tsuru/exec"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+)
+
+const (
+	defaultTimeout = 300
+	maxErrorOutput = 1024
+)
+
+var execut tsuruExec.Executor
+
+func executor() tsuruExec.Executor {
+	if execut == nil {
+		execut = tsuruExec.OsExecutor{}
+	}
+	return execut
+}
+
+func init() {
+	iaas.RegisterIaasProvider("exec", newExecIaaS)
+	hc.AddChecker("exec IaaS", iaas.BuildHealthCheck("exec"))
+}
+
+type execIaaS struct {
+	base iaas.NamedIaaS
+}
+
+func newExecIaaS(name string) iaas.IaaS {
+	return &execIaaS{base: iaas.NamedIaaS{BaseIaaSName: "exec", IaaSName: name}}
+}
+
+// machineDescription is the JSON representation of a machine exchanged with
+// the commands.
+type machineDescription struct {
+	ID             string            `json:"id"`
+	Address        string            `json:"address"`
+	Status         string            `json:"status,omitempty"`
+	Port           int               `json:"port,omitempty"`
+	CreationParams map[string]string `json:"creationParams,omitempty"`
+}
+
+func (i *execIaaS) Describe() string {
+	description, _ := i.base.GetConfigString("description")
+	if description != "" {
+		return description
+	}
+	return `Exec IaaS params are sent, as a JSON object, to the configured create
+command, check its documentation for the accepted params.
+`
+}
+
+func (i *execIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	input, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	output, err := i.run("create-command", input)
+	if err != nil {
+		return nil, err
+	}
+	var desc machineDescription
+	err = json.Unmarshal(output, &desc)
+	if err != nil {
+		return nil, fmt.Errorf("exec: invalid output from create command: %s - Output: %s", err, truncate(output))
+	}
+	if desc.ID == "" || desc.Address == "" {
+		return nil, fmt.Errorf("exec: create command output must include the machine id and address - Output: %s", truncate(output))
+	}
+	if desc.Status == "" {
+		desc.Status = "running"
+	}
+	m := iaas.Machine{
+		Id:      desc.ID,
+		Address: desc.Address,
+		Status:  desc.Status,
+		Port:    desc.Port,
+	}
+	return &m, nil
+}
+
+func (i *execIaaS) DeleteMachine(m *iaas.Machine) error {
+	input, err := json.Marshal(machineDescription{
+		ID:             m.Id,
+		Address:        m.Address,
+		Status:         m.Status,
+		Port:           m.Port,
+		CreationParams: m.CreationParams,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = i.run("delete-command", input)
+	return err
+}
+
+// HealthCheck runs the optional healthcheck command, which must exit with a
+// non-zero status when the backing tool is unavailable.
+func (i *execIaaS) HealthCheck() error {
+	if cmd, _ := i.base.GetConfigString("healthcheck-command"); cmd == "" {
+		return nil
+	}
+	_, err := i.run("healthcheck-command", nil)
+	return err
+}
+
+// run executes the command configured in the given key, writing input to
+// its standard input and returning its standard output. The command is
+// killed when it doesn't finish before the configured timeout.
+func (i *execIaaS) run(key string, input []byte) ([]byte, error) {
+	cmdline, err := i.base.GetConfigString(key)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(cmdline)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("exec: %s is required", key)
+	}
+	rawTimeout, _ := i.base.GetConfigString("timeout")
+	timeout, _ := strconv.Atoi(rawTimeout)
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	var stdout, stderr bytes.Buffer
+	err = executor().Execute(tsuruExec.ExecuteOptions{
+		Cmd:     parts[0],
+		Args:    parts[1:],
+		Envs:    append(os.Environ(), "TSURU_IAAS="+i.iaasName()),
+		Stdin:   bytes.NewReader(input),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Timeout: time.Duration(timeout) * time.Second,
+	})
+	if err == tsuruExec.ErrTimeout {
+		err = fmt.Errorf("timed out after %d seconds", timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(truncate(stderr.Bytes()))
+		if msg == "" {
+			return nil, fmt.Errorf("exec: %s failed: %s", key, err)
+		}
+		return nil, fmt.Errorf("exec: %s failed: %s: %s", key, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (i *execIaaS) iaasName() string {
+	if i.base.IaaSName != "" {
+		return i.base.IaaSName
+	}
+	return i.base.BaseIaaSName
+}
+
+func truncate(output []byte) string {
+	if len(output) > maxErrorOutput {
+		return string(output[:maxErrorOutput]) + "..."
+	}
+	return string(output)
+}
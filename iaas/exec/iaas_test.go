@@ -0,0 +1,192 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/tsuru/config"
+	tsuruExec "github.com/tsuru/tsuru/exec"
+	"github.com/tsuru/tsuru/exec/exectest"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type execSuite struct {
+	dir string
+}
+
+var _ = check.Suite(&execSuite{})
+
+func (s *execSuite) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+}
+
+func (s *execSuite) TearDownTest(c *check.C) {
+	config.Unset("iaas:exec")
+	config.Unset("iaas:custom")
+	execut = nil
+}
+
+func (s *execSuite) script(c *check.C, name, content string) string {
+	path := filepath.Join(s.dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+content), 0755)
+	c.Assert(err, check.IsNil)
+	return path
+}
+
+func (s *execSuite) readJSON(c *check.C, name string, value interface{}) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	c.Assert(err, check.IsNil)
+	err = json.Unmarshal(data, value)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *execSuite) TestRegistered(c *check.C) {
+	desc, err := iaas.Describe("exec")
+	c.Assert(err, check.IsNil)
+	c.Assert(desc, check.Matches, "(?s)Exec IaaS params.*")
+	config.Set("iaas:exec:description", "libvirt params: memory, cpus")
+	desc = newExecIaaS("exec").(iaas.Describer).Describe()
+	c.Assert(desc, check.Equals, "libvirt params: memory, cpus")
+}
+
+func (s *execSuite) TestCreateMachine(c *check.C) {
+	script := s.script(c, "create", `cat > `+s.dir+`/input
+echo "$TSURU_IAAS $1" > `+s.dir+`/env
+echo '{"id": "vm-1", "address": "10.0.0.5", "port": 4243}'
+`)
+	config.Set("iaas:exec:create-command", script+" --create")
+	m, err := newExecIaaS("exec").CreateMachine(map[string]string{"memory": "2048", "cpus": "2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(*m, check.DeepEquals, iaas.Machine{
+		Id:      "vm-1",
+		Address: "10.0.0.5",
+		Status:  "running",
+		Port:    4243,
+	})
+	var input map[string]string
+	s.readJSON(c, "input", &input)
+	c.Assert(input, check.DeepEquals, map[string]string{"memory": "2048", "cpus": "2"})
+	env, err := ioutil.ReadFile(filepath.Join(s.dir, "env"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(env), check.Equals, "exec --create\n")
+}
+
+func (s *execSuite) TestCreateMachineCustomIaaS(c *check.C) {
+	script := s.script(c, "create", `echo "$TSURU_IAAS" > `+s.dir+`/env
+echo '{"id": "vm-1", "address": "10.0.0.5", "status": "started"}'
+`)
+	config.Set("iaas:custom:libvirt:provider", "exec")
+	config.Set("iaas:custom:libvirt:create-command", script)
+	m, err := newExecIaaS("libvirt").CreateMachine(map[string]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Status, check.Equals, "started")
+	env, err := ioutil.ReadFile(filepath.Join(s.dir, "env"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(env), check.Equals, "libvirt\n")
+}
+
+func (s *execSuite) TestCreateMachineCommandFailure(c *check.C) {
+	script := s.script(c, "create", "echo 'no space left' >&2\nexit 3\n")
+	config.Set("iaas:exec:create-command", script)
+	_, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "exec: create-command failed: exit status 3: no space left")
+}
+
+func (s *execSuite) TestCreateMachineInvalidOutput(c *check.C) {
+	script := s.script(c, "create", "echo 'created!'\n")
+	config.Set("iaas:exec:create-command", script)
+	_, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "(?s)exec: invalid output from create command: .* - Output: created!\n")
+	script = s.script(c, "create-noaddr", `echo '{"id": "vm-1"}'`+"\n")
+	config.Set("iaas:exec:create-command", script)
+	_, err = newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "(?s)exec: create command output must include the machine id and address - Output: .*")
+}
+
+func (s *execSuite) TestCreateMachineTimeout(c *check.C) {
+	script := s.script(c, "create", "exec sleep 10\n")
+	config.Set("iaas:exec:create-command", script)
+	config.Set("iaas:exec:timeout", 1)
+	_, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "exec: create-command failed: timed out after 1 seconds")
+}
+
+func (s *execSuite) TestCreateMachineUsesExecutor(c *check.C) {
+	fexec := &exectest.FakeExecutor{
+		Output: map[string][][]byte{
+			"--create --verbose": {[]byte(`{"id": "vm-1", "address": "10.0.0.5"}`)},
+		},
+	}
+	execut = fexec
+	config.Set("iaas:exec:create-command", "provision --create --verbose")
+	m, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "vm-1")
+	c.Assert(fexec.ExecutedCmd("provision", []string{"--create", "--verbose"}), check.Equals, true)
+	cmds := fexec.GetCommands("provision")
+	c.Assert(cmds, check.HasLen, 1)
+	envs := cmds[0].GetEnvs()
+	c.Assert(envs[len(envs)-1], check.Equals, "TSURU_IAAS=exec")
+}
+
+func (s *execSuite) TestCreateMachineExecutorTimeout(c *check.C) {
+	execut = &exectest.ErrorExecutor{Err: tsuruExec.ErrTimeout}
+	config.Set("iaas:exec:create-command", "provision")
+	config.Set("iaas:exec:timeout", 30)
+	_, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "exec: create-command failed: timed out after 30 seconds")
+}
+
+func (s *execSuite) TestCreateMachineWithoutCommand(c *check.C) {
+	_, err := newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.NotNil)
+	config.Set("iaas:exec:create-command", "")
+	_, err = newExecIaaS("exec").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "exec: create-command is required")
+}
+
+func (s *execSuite) TestDeleteMachine(c *check.C) {
+	script := s.script(c, "delete", "cat > "+s.dir+"/input\n")
+	config.Set("iaas:exec:delete-command", script)
+	m := iaas.Machine{
+		Id:             "vm-1",
+		Address:        "10.0.0.5",
+		Status:         "running",
+		CreationParams: map[string]string{"memory": "2048", "iaas": "exec"},
+	}
+	err := newExecIaaS("exec").DeleteMachine(&m)
+	c.Assert(err, check.IsNil)
+	var input map[string]interface{}
+	s.readJSON(c, "input", &input)
+	c.Assert(input, check.DeepEquals, map[string]interface{}{
+		"id":             "vm-1",
+		"address":        "10.0.0.5",
+		"status":         "running",
+		"creationParams": map[string]interface{}{"memory": "2048", "iaas": "exec"},
+	})
+}
+
+func (s *execSuite) TestDeleteMachineFailure(c *check.C) {
+	script := s.script(c, "delete", "exit 1\n")
+	config.Set("iaas:exec:delete-command", script)
+	err := newExecIaaS("exec").DeleteMachine(&iaas.Machine{Id: "vm-1"})
+	c.Assert(err, check.ErrorMatches, "exec: delete-command failed: exit status 1")
+}
+
+func (s *execSuite) TestHealthCheck(c *check.C) {
+	hc := newExecIaaS("exec").(iaas.HealthChecker)
+	c.Assert(hc.HealthCheck(), check.IsNil)
+	config.Set("iaas:exec:healthcheck-command", s.script(c, "hc", "exit 0\n"))
+	c.Assert(hc.HealthCheck(), check.IsNil)
+	config.Set("iaas:exec:healthcheck-command", s.script(c, "hc-fail", "echo 'libvirtd down' >&2\nexit 1\n"))
+	c.Assert(hc.HealthCheck(), check.ErrorMatches, "exec: healthcheck-command failed: exit status 1: libvirtd down")
+}
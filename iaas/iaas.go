@@ -20,6 +20,10 @@ const (
 curl -sL https://raw.github.com/tsuru/now/master/run.bash | bash -s -- --docker-only
 `
 	defaultIaaSProviderName = "ec2"
+
+	// MachineTag is the name of the tag added by IaaS providers to the
+	// machines created by tsuru, holding the name of the IaaS.
+	MachineTag = "tsuru-iaas"
 )
 
 // Every Tsuru IaaS must implement this interface.
@@ -35,6 +39,17 @@ type Describer interface {
 	Describe() string
 }
 
+// Lister is implemented by IaaS providers able to list the machines running
+// in the cloud, allowing tsuru to detect machines removed out-of-band and
+// orphan machines.
+type Lister interface {
+	// ListMachines returns the running machines tagged by tsuru for the
+	// IaaS, along with the known machines, the ones stored by tsuru, that
+	// are still running. The returned machines must include the creation
+	// params required to delete them.
+	ListMachines(known []Machine) ([]Machine, error)
+}
+
 type HealthChecker interface {
 	HealthCheck() error
 }
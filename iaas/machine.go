@@ -8,6 +8,7 @@ package iaas
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -24,6 +25,10 @@ type Machine struct {
 	Address        string
 	Port           int
 	CreationParams map[string]string
+	CreationDate   time.Time `bson:",omitempty"`
+	// Spot tells whether the machine is a spot (or preemptible) instance,
+	// which may be reclaimed by the cloud provider.
+	Spot bool `bson:",omitempty"`
 }
 
 func CreateMachine(params map[string]string) (*Machine, error) {
@@ -53,6 +58,9 @@ func CreateMachineForIaaS(iaasName string, params map[string]string) (*Machine,
 	params["iaas-id"] = m.Id
 	m.Iaas = iaasName
 	m.CreationParams = params
+	if m.CreationDate.IsZero() {
+		m.CreationDate = time.Now().UTC()
+	}
 	err = m.saveToDB()
 	if err != nil {
 		m.Destroy()
@@ -0,0 +1,407 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const (
+	defaultDomain      = "Default"
+	serverStatusActive = "ACTIVE"
+	serverStatusError  = "ERROR"
+)
+
+// pollInterval is the interval between checks of the status of a server
+// while waiting for it to become active.
+var pollInterval = time.Second
+
+var errNotFound = errors.New("openstack: resource not found")
+
+func init() {
+	iaas.RegisterIaasProvider("openstack", newOpenStackIaaS)
+	hc.AddChecker("OpenStack", iaas.BuildHealthCheck("openstack"))
+}
+
+type OpenStackIaaS struct {
+	base iaas.UserDataIaaS
+
+	mu         sync.Mutex
+	token      string
+	expiresAt  time.Time
+	computeURL string
+}
+
+func newOpenStackIaaS(name string) iaas.IaaS {
+	return &OpenStackIaaS{base: iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "openstack", IaaSName: name}}}
+}
+
+func (i *OpenStackIaaS) Describe() string {
+	return `OpenStack IaaS required params:
+  flavor=<flavor>                     Name or ID of the flavor (e.g.: m1.small)
+  image=<image>                       Name or ID of the image
+
+There are also some optional parameters:
+
+  name=<name>                         Name of the server, defaults to a generated name
+  networks=<ids>                      Comma separated list of network IDs
+  network=<name>                      Name of the network whose address will be used
+                                      to reach the node, defaults to the first network
+  security-groups=<names>             Comma separated list of security group names
+  key-name=<key>                      Name of the key pair injected in the server
+  availability-zone=<zone>            Availability zone of the server
+`
+}
+
+func (i *OpenStackIaaS) HealthCheck() error {
+	var resp flavorsResponse
+	err := i.do("GET", "/flavors", nil, &resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Flavors) < 1 {
+		name := i.base.IaaSName
+		if name == "" {
+			name = i.base.BaseIaaSName
+		}
+		return fmt.Errorf("%q - not enough flavors available, want at least 1, got %d", name, len(resp.Flavors))
+	}
+	return nil
+}
+
+func (i *OpenStackIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	for _, p := range []string{"flavor", "image"} {
+		if params[p] == "" {
+			return nil, fmt.Errorf("param %q is mandatory", p)
+		}
+	}
+	flavorID, err := i.findResource("/flavors", params["flavor"])
+	if err != nil {
+		return nil, err
+	}
+	if flavorID == "" {
+		return nil, fmt.Errorf("flavor %q not found", params["flavor"])
+	}
+	imageID, err := i.findResource("/images", params["image"])
+	if err != nil {
+		return nil, err
+	}
+	if imageID == "" {
+		return nil, fmt.Errorf("image %q not found", params["image"])
+	}
+	userData, err := i.base.ReadUserData()
+	if err != nil {
+		return nil, err
+	}
+	name := params["name"]
+	if name == "" {
+		name = fmt.Sprintf("tsuru-%d", time.Now().UnixNano())
+	}
+	req := createServerRequest{Server: createServer{
+		Name:             name,
+		FlavorRef:        flavorID,
+		ImageRef:         imageID,
+		KeyName:          params["key-name"],
+		AvailabilityZone: params["availability-zone"],
+		Metadata:         map[string]string{iaas.MachineTag: i.base.IaaSName},
+	}}
+	if userData != "" {
+		req.Server.UserData = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+	for _, id := range splitList(params["networks"]) {
+		req.Server.Networks = append(req.Server.Networks, serverNetwork{UUID: id})
+	}
+	for _, group := range splitList(params["security-groups"]) {
+		req.Server.SecurityGroups = append(req.Server.SecurityGroups, securityGroup{Name: group})
+	}
+	var created serverResponse
+	err = i.do("POST", "/servers", req, &created)
+	if err != nil {
+		return nil, err
+	}
+	srv, address, err := i.waitServerActive(created.Server.ID, params["network"])
+	if err != nil {
+		if delErr := i.deleteServer(created.Server.ID); delErr != nil {
+			log.Errorf("openstack: unable to remove server %s: %s", created.Server.ID, delErr)
+		}
+		return nil, err
+	}
+	m := &iaas.Machine{
+		Id:      srv.ID,
+		Address: address,
+		Status:  strings.ToLower(srv.Status),
+	}
+	return m, nil
+}
+
+func (i *OpenStackIaaS) DeleteMachine(m *iaas.Machine) error {
+	err := i.deleteServer(m.Id)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+func (i *OpenStackIaaS) deleteServer(id string) error {
+	return i.do("DELETE", "/servers/"+id, nil, nil)
+}
+
+func (i *OpenStackIaaS) waitServerActive(id, network string) (*server, string, error) {
+	rawWait, _ := i.base.GetConfigString("wait-timeout")
+	maxWaitTime, _ := strconv.Atoi(rawWait)
+	if maxWaitTime == 0 {
+		maxWaitTime = 300
+	}
+	waitDuration := time.Duration(maxWaitTime) * time.Second
+	timeout := time.After(waitDuration)
+	for {
+		var resp serverResponse
+		err := i.do("GET", "/servers/"+id, nil, &resp)
+		if err != nil {
+			return nil, "", err
+		}
+		switch resp.Server.Status {
+		case serverStatusError:
+			return nil, "", fmt.Errorf("openstack: server %s failed to start: %s", id, resp.Server.Fault.Message)
+		case serverStatusActive:
+			address, err := serverAddressIn(&resp.Server, network)
+			if err != nil {
+				return nil, "", err
+			}
+			if address != "" {
+				return &resp.Server, address, nil
+			}
+		}
+		select {
+		case <-timeout:
+			return nil, "", fmt.Errorf("openstack: time out after %v waiting for instance %s to start", waitDuration, id)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// serverAddressIn returns the address of the server in the given network,
+// or in the first network sorted by name when network is empty, preferring
+// floating IPv4 addresses.
+func serverAddressIn(srv *server, network string) (string, error) {
+	if network == "" {
+		var names []string
+		for name := range srv.Addresses {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return "", nil
+		}
+		sort.Strings(names)
+		network = names[0]
+	}
+	addresses, ok := srv.Addresses[network]
+	if !ok {
+		return "", fmt.Errorf("openstack: server %s has no address in network %q", srv.ID, network)
+	}
+	var address string
+	for _, addr := range addresses {
+		if addr.Version != 4 {
+			continue
+		}
+		if addr.Type == "floating" {
+			return addr.Addr, nil
+		}
+		if address == "" {
+			address = addr.Addr
+		}
+	}
+	return address, nil
+}
+
+// findResource returns the ID of the flavor or image with the given name or
+// ID, or an empty string if there's none.
+func (i *OpenStackIaaS) findResource(path, nameOrID string) (string, error) {
+	var resources []namedResource
+	switch path {
+	case "/flavors":
+		var resp flavorsResponse
+		if err := i.do("GET", path, nil, &resp); err != nil {
+			return "", err
+		}
+		resources = resp.Flavors
+	default:
+		var resp imagesResponse
+		if err := i.do("GET", path, nil, &resp); err != nil {
+			return "", err
+		}
+		resources = resp.Images
+	}
+	for _, r := range resources {
+		if r.ID == nameOrID || r.Name == nameOrID {
+			return r.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// authenticate returns a Keystone v3 token scoped to the configured project
+// and the compute endpoint in the service catalog, reusing the last token
+// while it's valid.
+func (i *OpenStackIaaS) authenticate() (string, string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token != "" && time.Now().Add(time.Minute).Before(i.expiresAt) {
+		return i.token, i.computeURL, nil
+	}
+	authURL, err := i.base.GetConfigString("auth-url")
+	if err != nil {
+		return "", "", err
+	}
+	user, err := i.base.GetConfigString("user")
+	if err != nil {
+		return "", "", err
+	}
+	password, err := i.base.GetConfigString("password")
+	if err != nil {
+		return "", "", err
+	}
+	project, err := i.base.GetConfigString("project")
+	if err != nil {
+		return "", "", err
+	}
+	userDomain, _ := i.base.GetConfigString("user-domain")
+	if userDomain == "" {
+		userDomain = defaultDomain
+	}
+	projectDomain, _ := i.base.GetConfigString("project-domain")
+	if projectDomain == "" {
+		projectDomain = defaultDomain
+	}
+	region, _ := i.base.GetConfigString("region")
+	var req authRequest
+	req.Auth.Identity.Methods = []string{"password"}
+	req.Auth.Identity.Password.User = authUser{Name: user, Password: password, Domain: authDomain{Name: userDomain}}
+	req.Auth.Scope.Project = authProject{Name: project, Domain: authDomain{Name: projectDomain}}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := net.Dial5Full300Client.Post(strings.TrimRight(authURL, "/")+"/auth/tokens", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", "", fmt.Errorf("openstack: unable to authenticate, unexpected response code %d: %s", resp.StatusCode, string(data))
+	}
+	var result authResponse
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return "", "", fmt.Errorf("openstack: unexpected authentication response: %s", err)
+	}
+	computeURL := findEndpoint(result.Token.Catalog, "compute", region)
+	if computeURL == "" {
+		return "", "", fmt.Errorf("openstack: no public compute endpoint found in region %q", region)
+	}
+	i.token = resp.Header.Get("X-Subject-Token")
+	i.expiresAt = result.Token.ExpiresAt
+	i.computeURL = strings.TrimRight(computeURL, "/")
+	return i.token, i.computeURL, nil
+}
+
+func findEndpoint(catalog []catalogEntry, serviceType, region string) string {
+	for _, entry := range catalog {
+		if entry.Type != serviceType {
+			continue
+		}
+		for _, e := range entry.Endpoints {
+			if e.Interface != "public" {
+				continue
+			}
+			if region == "" || e.Region == region || e.RegionID == region {
+				return e.URL
+			}
+		}
+	}
+	return ""
+}
+
+func (i *OpenStackIaaS) do(method, path string, params, result interface{}) error {
+	token, computeURL, err := i.authenticate()
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, computeURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := net.Dial5Full300Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		i.mu.Lock()
+		i.token = ""
+		i.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("openstack: unexpected response code for %s %s %d: %s", method, path, resp.StatusCode, string(data))
+	}
+	if result != nil {
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return fmt.Errorf("openstack: unexpected result data for %s %s: %s - Body: %s", method, path, err, string(data))
+		}
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
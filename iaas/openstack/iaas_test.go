@@ -0,0 +1,316 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type openstackSuite struct {
+	server *fakeOpenStack
+}
+
+var _ = check.Suite(&openstackSuite{})
+
+func (s *openstackSuite) SetUpSuite(c *check.C) {
+	pollInterval = time.Millisecond
+}
+
+func (s *openstackSuite) SetUpTest(c *check.C) {
+	s.server = newFakeOpenStack()
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/v3")
+	config.Set("iaas:openstack:user", "admin")
+	config.Set("iaas:openstack:password", "secret")
+	config.Set("iaas:openstack:project", "tsuru")
+	config.Set("iaas:openstack:region", "RegionOne")
+	config.Set("iaas:openstack:user-data", s.server.URL+"/user-data")
+	config.Set("iaas:openstack:wait-timeout", 1)
+}
+
+func (s *openstackSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+	config.Unset("iaas:openstack")
+}
+
+// fakeOpenStack is a fake Keystone v3 and Nova server, holding servers that
+// become active after being checked activateAfter times.
+type fakeOpenStack struct {
+	*httptest.Server
+	mu            sync.Mutex
+	auths         []map[string]interface{}
+	creates       []map[string]interface{}
+	deleted       []string
+	status        string
+	fault         string
+	activateAfter int
+	checks        int
+	addresses     map[string][]serverAddress
+}
+
+func newFakeOpenStack() *fakeOpenStack {
+	f := &fakeOpenStack{
+		status:        serverStatusActive,
+		activateAfter: 2,
+		addresses: map[string][]serverAddress{
+			"private": {
+				{Addr: "fe80::1", Version: 6, Type: "fixed"},
+				{Addr: "10.0.0.5", Version: 4, Type: "fixed"},
+				{Addr: "172.16.0.5", Version: 4, Type: "floating"},
+			},
+			"storage": {{Addr: "192.168.0.5", Version: 4, Type: "fixed"}},
+		},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeOpenStack) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/user-data" {
+		w.Write([]byte("#!/bin/bash\necho hello"))
+		return
+	}
+	if r.URL.Path == "/v3/auth/tokens" && r.Method == "POST" {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.auths = append(f.auths, body)
+		w.Header().Set("X-Subject-Token", "token-123")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [
+			{"type": "identity", "endpoints": [{"interface": "public", "region": "RegionOne", "url": "%s/v3"}]},
+			{"type": "compute", "endpoints": [
+				{"interface": "internal", "region": "RegionOne", "url": "%s/internal"},
+				{"interface": "public", "region": "RegionTwo", "url": "%s/region-two"},
+				{"interface": "public", "region": "RegionOne", "url": "%s/compute/"}
+			]}
+		]}}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), f.URL, f.URL, f.URL, f.URL)
+		return
+	}
+	if r.Header.Get("X-Auth-Token") != "token-123" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == "/compute/flavors" && r.Method == "GET":
+		fmt.Fprintln(w, `{"flavors": [{"id": "1", "name": "m1.tiny"}, {"id": "2", "name": "m1.small"}]}`)
+	case r.URL.Path == "/compute/images" && r.Method == "GET":
+		fmt.Fprintln(w, `{"images": [{"id": "img-1", "name": "ubuntu-16.04"}]}`)
+	case r.URL.Path == "/compute/servers" && r.Method == "POST":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.creates = append(f.creates, body)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, `{"server": {"id": "srv-1"}}`)
+	case r.URL.Path == "/compute/servers/srv-1" && r.Method == "GET":
+		f.checks++
+		srv := server{ID: "srv-1", Status: "BUILD"}
+		if f.checks >= f.activateAfter {
+			srv.Status = f.status
+			srv.Addresses = f.addresses
+			srv.Fault.Message = f.fault
+		}
+		json.NewEncoder(w).Encode(serverResponse{Server: srv})
+	case r.URL.Path == "/compute/servers/srv-1" && r.Method == "DELETE":
+		f.deleted = append(f.deleted, "srv-1")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *openstackSuite) TestRegistered(c *check.C) {
+	desc, err := iaas.Describe("openstack")
+	c.Assert(err, check.IsNil)
+	c.Assert(desc, check.Matches, "(?s)OpenStack IaaS required params.*")
+}
+
+func (s *openstackSuite) TestCreateMachine(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	params := map[string]string{
+		"name":              "node1",
+		"flavor":            "m1.small",
+		"image":             "ubuntu-16.04",
+		"networks":          "net-1, net-2",
+		"security-groups":   "default,docker",
+		"key-name":          "mykey",
+		"availability-zone": "nova",
+	}
+	m, err := os.CreateMachine(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "srv-1")
+	c.Assert(m.Address, check.Equals, "172.16.0.5")
+	c.Assert(m.Status, check.Equals, "active")
+	c.Assert(s.server.auths, check.HasLen, 1)
+	c.Assert(s.server.auths[0], check.DeepEquals, map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []interface{}{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     "admin",
+						"password": "secret",
+						"domain":   map[string]interface{}{"name": "Default"},
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"name":   "tsuru",
+					"domain": map[string]interface{}{"name": "Default"},
+				},
+			},
+		},
+	})
+	c.Assert(s.server.creates, check.HasLen, 1)
+	c.Assert(s.server.creates[0], check.DeepEquals, map[string]interface{}{
+		"server": map[string]interface{}{
+			"name":              "node1",
+			"flavorRef":         "2",
+			"imageRef":          "img-1",
+			"user_data":         base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\necho hello")),
+			"key_name":          "mykey",
+			"availability_zone": "nova",
+			"networks":          []interface{}{map[string]interface{}{"uuid": "net-1"}, map[string]interface{}{"uuid": "net-2"}},
+			"security_groups":   []interface{}{map[string]interface{}{"name": "default"}, map[string]interface{}{"name": "docker"}},
+			"metadata":          map[string]interface{}{"tsuru-iaas": "openstack"},
+		},
+	})
+	c.Assert(s.server.checks, check.Equals, 2)
+	c.Assert(s.server.deleted, check.IsNil)
+}
+
+func (s *openstackSuite) TestCreateMachineCustomIaaS(c *check.C) {
+	config.Set("iaas:custom:private:provider", "openstack")
+	config.Set("iaas:custom:private:project", "other")
+	config.Set("iaas:custom:private:user-domain", "corp")
+	defer config.Unset("iaas:custom")
+	os := newOpenStackIaaS("private")
+	m, err := os.CreateMachine(map[string]string{"flavor": "1", "image": "img-1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "srv-1")
+	auth := s.server.auths[0]["auth"].(map[string]interface{})
+	user := auth["identity"].(map[string]interface{})["password"].(map[string]interface{})["user"].(map[string]interface{})
+	c.Assert(user["domain"], check.DeepEquals, map[string]interface{}{"name": "corp"})
+	project := auth["scope"].(map[string]interface{})["project"].(map[string]interface{})
+	c.Assert(project["name"], check.Equals, "other")
+	server := s.server.creates[0]["server"].(map[string]interface{})
+	c.Assert(server["flavorRef"], check.Equals, "1")
+	c.Assert(server["metadata"], check.DeepEquals, map[string]interface{}{"tsuru-iaas": "private"})
+	c.Assert(server["name"], check.Matches, `tsuru-\d+`)
+}
+
+func (s *openstackSuite) TestCreateMachineInNetwork(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	m, err := os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "ubuntu-16.04", "network": "storage"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Address, check.Equals, "192.168.0.5")
+}
+
+func (s *openstackSuite) TestCreateMachineInvalidNetwork(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "ubuntu-16.04", "network": "public"})
+	c.Assert(err, check.ErrorMatches, `openstack: server srv-1 has no address in network "public"`)
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"srv-1"})
+}
+
+func (s *openstackSuite) TestCreateMachineServerError(c *check.C) {
+	s.server.status = serverStatusError
+	s.server.fault = "No valid host was found"
+	os := newOpenStackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, "openstack: server srv-1 failed to start: No valid host was found")
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"srv-1"})
+}
+
+func (s *openstackSuite) TestCreateMachineTimeout(c *check.C) {
+	s.server.activateAfter = 1 << 30
+	os := newOpenStackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, `openstack: time out after 1s waiting for instance srv-1 to start`)
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"srv-1"})
+}
+
+func (s *openstackSuite) TestCreateMachineValidations(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, `param "flavor" is mandatory`)
+	_, err = os.CreateMachine(map[string]string{"flavor": "m1.tiny"})
+	c.Assert(err, check.ErrorMatches, `param "image" is mandatory`)
+	_, err = os.CreateMachine(map[string]string{"flavor": "m1.huge", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, `flavor "m1.huge" not found`)
+	_, err = os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "centos"})
+	c.Assert(err, check.ErrorMatches, `image "centos" not found`)
+	c.Assert(s.server.creates, check.IsNil)
+}
+
+func (s *openstackSuite) TestCreateMachineAuthError(c *check.C) {
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/invalid")
+	os := newOpenStackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"flavor": "m1.tiny", "image": "ubuntu-16.04"})
+	c.Assert(err, check.ErrorMatches, `openstack: unable to authenticate, unexpected response code 401: `)
+}
+
+func (s *openstackSuite) TestAuthenticateRegionWithoutCompute(c *check.C) {
+	config.Set("iaas:openstack:region", "RegionThree")
+	os := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	_, _, err := os.authenticate()
+	c.Assert(err, check.ErrorMatches, `openstack: no public compute endpoint found in region "RegionThree"`)
+}
+
+func (s *openstackSuite) TestAuthenticateReusesToken(c *check.C) {
+	os := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	token, computeURL, err := os.authenticate()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "token-123")
+	c.Assert(computeURL, check.Equals, s.server.URL+"/compute")
+	_, _, err = os.authenticate()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.auths, check.HasLen, 1)
+	os.expiresAt = time.Now()
+	_, _, err = os.authenticate()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.auths, check.HasLen, 2)
+}
+
+func (s *openstackSuite) TestDeleteMachine(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{Id: "srv-1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.deleted, check.DeepEquals, []string{"srv-1"})
+}
+
+func (s *openstackSuite) TestDeleteMachineNotFound(c *check.C) {
+	os := newOpenStackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{Id: "srv-2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.deleted, check.IsNil)
+}
+
+func (s *openstackSuite) TestHealthCheck(c *check.C) {
+	os := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	c.Assert(os.HealthCheck(), check.IsNil)
+}
+
+func (s *openstackSuite) TestHealthCheckFailure(c *check.C) {
+	config.Set("iaas:openstack:password", "wrong")
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/invalid")
+	os := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	c.Assert(os.HealthCheck(), check.NotNil)
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import "time"
+
+type authRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User authUser `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope struct {
+			Project authProject `json:"project"`
+		} `json:"scope"`
+	} `json:"auth"`
+}
+
+type authDomain struct {
+	Name string `json:"name"`
+}
+
+type authUser struct {
+	Name     string     `json:"name"`
+	Password string     `json:"password"`
+	Domain   authDomain `json:"domain"`
+}
+
+type authProject struct {
+	Name   string     `json:"name"`
+	Domain authDomain `json:"domain"`
+}
+
+type authResponse struct {
+	Token struct {
+		ExpiresAt time.Time      `json:"expires_at"`
+		Catalog   []catalogEntry `json:"catalog"`
+	} `json:"token"`
+}
+
+type catalogEntry struct {
+	Type      string     `json:"type"`
+	Endpoints []endpoint `json:"endpoints"`
+}
+
+type endpoint struct {
+	Interface string `json:"interface"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	URL       string `json:"url"`
+}
+
+type namedResource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type flavorsResponse struct {
+	Flavors []namedResource `json:"flavors"`
+}
+
+type imagesResponse struct {
+	Images []namedResource `json:"images"`
+}
+
+type serverNetwork struct {
+	UUID string `json:"uuid"`
+}
+
+type securityGroup struct {
+	Name string `json:"name"`
+}
+
+type createServer struct {
+	Name             string            `json:"name"`
+	FlavorRef        string            `json:"flavorRef"`
+	ImageRef         string            `json:"imageRef"`
+	UserData         string            `json:"user_data,omitempty"`
+	KeyName          string            `json:"key_name,omitempty"`
+	AvailabilityZone string            `json:"availability_zone,omitempty"`
+	Networks         []serverNetwork   `json:"networks,omitempty"`
+	SecurityGroups   []securityGroup   `json:"security_groups,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type createServerRequest struct {
+	Server createServer `json:"server"`
+}
+
+type serverAddress struct {
+	Addr    string `json:"addr"`
+	Version int    `json:"version"`
+	Type    string `json:"OS-EXT-IPS:type"`
+}
+
+type server struct {
+	ID        string                     `json:"id"`
+	Status    string                     `json:"status"`
+	Addresses map[string][]serverAddress `json:"addresses"`
+	Fault     struct {
+		Message string `json:"message"`
+	} `json:"fault"`
+}
+
+type serverResponse struct {
+	Server server `json:"server"`
+}
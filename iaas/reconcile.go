@@ -0,0 +1,233 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const defaultReconcileGracePeriod = 30 * time.Minute
+
+// DriftKind is the kind of divergence between the machines stored by tsuru,
+// the machines running in the IaaS and the nodes registered in the
+// provisioner.
+type DriftKind string
+
+const (
+	// DriftMissingMachine is a machine stored by tsuru that's no longer
+	// running in the IaaS, usually because it was removed out-of-band.
+	DriftMissingMachine = DriftKind("missing-machine")
+
+	// DriftOrphanMachine is a machine running in the IaaS, tagged by tsuru,
+	// that's not stored by tsuru. Orphan machines whose id or address match a
+	// registered node include the node address.
+	DriftOrphanMachine = DriftKind("orphan-machine")
+
+	// DriftNodeWithoutMachine is a node created by an IaaS whose machine is
+	// not stored by tsuru.
+	DriftNodeWithoutMachine = DriftKind("node-without-machine")
+)
+
+// Node is a node registered in a provisioner, checked against the stored
+// machines. Only nodes including the iaas metadata, added to nodes created
+// by an IaaS, are checked.
+type Node struct {
+	Address  string
+	Metadata map[string]string
+}
+
+// Drift is a divergence found by Reconcile.
+type Drift struct {
+	Kind    DriftKind `json:"kind"`
+	IaaS    string    `json:"iaas"`
+	Machine *Machine  `json:"machine,omitempty"`
+	Node    string    `json:"node,omitempty"`
+	Cleaned bool      `json:"cleaned"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (d *Drift) String() string {
+	if d.Machine != nil {
+		return fmt.Sprintf("%s: machine %q in %q", d.Kind, d.Machine.Id, d.IaaS)
+	}
+	return fmt.Sprintf("%s: node %q in %q", d.Kind, d.Node, d.IaaS)
+}
+
+// Cleanable returns whether the drift can be cleaned up by Cleanup. Nodes
+// without machines must be removed from the provisioner instead, and orphan
+// machines backing registered nodes are never destroyed.
+func (d *Drift) Cleanable() bool {
+	if d.Machine == nil {
+		return false
+	}
+	return d.Kind == DriftMissingMachine || (d.Kind == DriftOrphanMachine && d.Node == "")
+}
+
+// Cleanup fixes the drift, removing machines missing in the IaaS from the
+// database and destroying orphan machines in the IaaS.
+func (d *Drift) Cleanup() error {
+	var err error
+	switch {
+	case !d.Cleanable():
+		err = fmt.Errorf("%s can't be cleaned up", d.Kind)
+	case d.Kind == DriftMissingMachine:
+		err = d.Machine.removeFromDB()
+	default:
+		var provider IaaS
+		provider, err = getIaasProvider(d.IaaS)
+		if err == nil {
+			err = provider.DeleteMachine(d.Machine)
+		}
+	}
+	if err != nil {
+		d.Error = err.Error()
+		return err
+	}
+	d.Cleaned = true
+	return nil
+}
+
+func reconcileGracePeriod() time.Duration {
+	seconds, err := config.GetInt("iaas:reconcile:grace-period")
+	if err != nil {
+		return defaultReconcileGracePeriod
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Reconcile compares the machines stored by tsuru with the machines running
+// in every IaaS implementing Lister and with the given nodes, returning the
+// drift found. Machines created within the grace period, configured in
+// iaas:reconcile:grace-period, are ignored as they may not be stored or
+// listed yet. When iaasNames is not empty, only the given IaaSs are compared.
+func Reconcile(nodes []Node, iaasNames ...string) ([]Drift, error) {
+	machines, err := ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	grace := time.Now().Add(-reconcileGracePeriod())
+	stored := map[string][]Machine{}
+	for _, m := range machines {
+		stored[m.Iaas] = append(stored[m.Iaas], m)
+	}
+	names := iaasNames
+	if len(names) == 0 {
+		names = reconcileIaaSNames(stored)
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+	nodeByID := map[string]string{}
+	nodeByAddress := map[string]string{}
+	for _, n := range nodes {
+		if id := n.Metadata["iaas-id"]; id != "" {
+			nodeByID[id] = n.Address
+		}
+		if host := net.URLToHost(n.Address); host != "" {
+			nodeByAddress[host] = n.Address
+		}
+	}
+	var drifts []Drift
+	for _, name := range names {
+		provider, err := getIaasProvider(name)
+		if err != nil {
+			log.Errorf("[iaas reconcile] unable to get IaaS %q: %s", name, err)
+			continue
+		}
+		lister, ok := provider.(Lister)
+		if !ok {
+			continue
+		}
+		running, err := lister.ListMachines(stored[name])
+		if err != nil {
+			log.Errorf("[iaas reconcile] unable to list machines in IaaS %q: %s", name, err)
+			continue
+		}
+		drifts = append(drifts, machinesDrift(name, stored[name], running, grace, nodeByID, nodeByAddress)...)
+	}
+	byID := map[string]bool{}
+	byAddress := map[string]bool{}
+	for _, m := range machines {
+		byID[m.Id] = true
+		byAddress[m.Address] = true
+	}
+	for _, n := range nodes {
+		iaasName := n.Metadata["iaas"]
+		if iaasName == "" || (len(iaasNames) > 0 && !selected[iaasName]) {
+			continue
+		}
+		if id := n.Metadata["iaas-id"]; id != "" && byID[id] {
+			continue
+		}
+		if byAddress[net.URLToHost(n.Address)] {
+			continue
+		}
+		drifts = append(drifts, Drift{Kind: DriftNodeWithoutMachine, IaaS: iaasName, Node: n.Address})
+	}
+	return drifts, nil
+}
+
+func machinesDrift(iaasName string, stored, running []Machine, grace time.Time, nodeByID, nodeByAddress map[string]string) []Drift {
+	var drifts []Drift
+	runningIDs := make(map[string]bool, len(running))
+	for _, m := range running {
+		runningIDs[m.Id] = true
+	}
+	storedIDs := make(map[string]bool, len(stored))
+	for i := range stored {
+		m := stored[i]
+		storedIDs[m.Id] = true
+		if runningIDs[m.Id] || m.CreationDate.After(grace) {
+			continue
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingMachine, IaaS: iaasName, Machine: &m})
+	}
+	for i := range running {
+		m := running[i]
+		if storedIDs[m.Id] || m.CreationDate.After(grace) {
+			continue
+		}
+		m.Iaas = iaasName
+		node := nodeByID[m.Id]
+		if node == "" {
+			node = nodeByAddress[m.Address]
+		}
+		drifts = append(drifts, Drift{Kind: DriftOrphanMachine, IaaS: iaasName, Machine: &m, Node: node})
+	}
+	return drifts
+}
+
+// reconcileIaaSNames returns the names of the IaaSs with stored machines,
+// along with the default and custom IaaSs in the config, which may have
+// orphan machines even without stored machines.
+func reconcileIaaSNames(stored map[string][]Machine) []string {
+	names := map[string]bool{}
+	for name := range stored {
+		names[name] = true
+	}
+	if name, err := config.GetString("iaas:default"); err == nil {
+		names[name] = true
+	}
+	if custom, err := config.Get("iaas:custom"); err == nil {
+		if customMap, ok := custom.(map[interface{}]interface{}); ok {
+			for name := range customMap {
+				names[fmt.Sprint(name)] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
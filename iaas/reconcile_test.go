@@ -0,0 +1,198 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertMachines(c *check.C, machines ...Machine) {
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	for _, m := range machines {
+		err = coll.Insert(m)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *S) TestReconcile(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	old := time.Now().Add(-time.Hour).UTC()
+	s.insertMachines(c,
+		Machine{Id: "m1", Iaas: "lister-iaas", Address: "m1.somewhere.com", CreationDate: old},
+		Machine{Id: "m2", Iaas: "lister-iaas", Address: "m2.somewhere.com", CreationDate: old},
+		Machine{Id: "m3", Iaas: "lister-iaas", Address: "m3.somewhere.com", CreationDate: time.Now().UTC()},
+		Machine{Id: "m4", Iaas: "test-iaas", Address: "m4.somewhere.com", CreationDate: old},
+	)
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	provider.(*TestListerIaaS).running = []Machine{
+		{Id: "m1", Address: "m1.somewhere.com", CreationDate: old},
+		{Id: "o1", Address: "o1.somewhere.com", CreationDate: old},
+		{Id: "o2", Address: "o2.somewhere.com", CreationDate: time.Now().UTC()},
+	}
+	nodes := []Node{
+		{Address: "http://m1.somewhere.com:2375", Metadata: map[string]string{"iaas": "lister-iaas"}},
+		{Address: "http://m4.somewhere.com:2375", Metadata: map[string]string{"iaas": "test-iaas", "iaas-id": "m4"}},
+		{Address: "http://n1.somewhere.com:2375", Metadata: map[string]string{"iaas": "test-iaas", "iaas-id": "n1"}},
+		{Address: "http://n2.somewhere.com:2375", Metadata: map[string]string{"pool": "p1"}},
+	}
+	drifts, err := Reconcile(nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 3)
+	c.Assert(drifts[0].Kind, check.Equals, DriftMissingMachine)
+	c.Assert(drifts[0].IaaS, check.Equals, "lister-iaas")
+	c.Assert(drifts[0].Machine.Id, check.Equals, "m2")
+	c.Assert(drifts[1].Kind, check.Equals, DriftOrphanMachine)
+	c.Assert(drifts[1].IaaS, check.Equals, "lister-iaas")
+	c.Assert(drifts[1].Machine.Id, check.Equals, "o1")
+	c.Assert(drifts[1].Machine.Iaas, check.Equals, "lister-iaas")
+	c.Assert(drifts[2], check.DeepEquals, Drift{
+		Kind: DriftNodeWithoutMachine,
+		IaaS: "test-iaas",
+		Node: "http://n1.somewhere.com:2375",
+	})
+}
+
+func (s *S) TestReconcileOrphanMachineWithNode(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	old := time.Now().Add(-time.Hour).UTC()
+	provider.(*TestListerIaaS).running = []Machine{
+		{Id: "o1", Address: "o1.somewhere.com", CreationDate: old},
+		{Id: "o2", Address: "o2.somewhere.com", CreationDate: old},
+		{Id: "o3", Address: "o3.somewhere.com", CreationDate: old},
+	}
+	nodes := []Node{
+		{Address: "http://n1.somewhere.com:2375", Metadata: map[string]string{"iaas-id": "o1"}},
+		{Address: "http://o2.somewhere.com:2375", Metadata: map[string]string{"pool": "p1"}},
+	}
+	drifts, err := Reconcile(nodes, "lister-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 3)
+	c.Assert(drifts[0].Machine.Id, check.Equals, "o1")
+	c.Assert(drifts[0].Node, check.Equals, "http://n1.somewhere.com:2375")
+	c.Assert(drifts[0].Cleanable(), check.Equals, false)
+	c.Assert(drifts[1].Machine.Id, check.Equals, "o2")
+	c.Assert(drifts[1].Node, check.Equals, "http://o2.somewhere.com:2375")
+	c.Assert(drifts[1].Cleanable(), check.Equals, false)
+	c.Assert(drifts[2].Machine.Id, check.Equals, "o3")
+	c.Assert(drifts[2].Node, check.Equals, "")
+	c.Assert(drifts[2].Cleanable(), check.Equals, true)
+	err = drifts[0].Cleanup()
+	c.Assert(err, check.ErrorMatches, "orphan-machine can't be cleaned up")
+	c.Assert(provider.(*TestListerIaaS).cmds, check.IsNil)
+}
+
+func (s *S) TestReconcileOnlyGivenIaaS(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	RegisterIaasProvider("other-lister-iaas", newTestListerIaaS)
+	old := time.Now().Add(-time.Hour).UTC()
+	s.insertMachines(c,
+		Machine{Id: "m1", Iaas: "lister-iaas", Address: "m1.somewhere.com", CreationDate: old},
+		Machine{Id: "m2", Iaas: "other-lister-iaas", Address: "m2.somewhere.com", CreationDate: old},
+	)
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	nodes := []Node{
+		{Address: "http://n1.somewhere.com:2375", Metadata: map[string]string{"iaas": "lister-iaas"}},
+		{Address: "http://n2.somewhere.com:2375", Metadata: map[string]string{"iaas": "other-lister-iaas"}},
+	}
+	drifts, err := Reconcile(nodes, "other-lister-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 2)
+	c.Assert(drifts[0].Kind, check.Equals, DriftMissingMachine)
+	c.Assert(drifts[0].Machine.Id, check.Equals, "m2")
+	c.Assert(drifts[1], check.DeepEquals, Drift{
+		Kind: DriftNodeWithoutMachine,
+		IaaS: "other-lister-iaas",
+		Node: "http://n2.somewhere.com:2375",
+	})
+	c.Assert(provider.(*TestListerIaaS).listed, check.Equals, 0)
+}
+
+func (s *S) TestReconcileGracePeriod(c *check.C) {
+	config.Set("iaas:reconcile:grace-period", 0)
+	defer config.Unset("iaas:reconcile:grace-period")
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	s.insertMachines(c, Machine{Id: "m1", Iaas: "lister-iaas", CreationDate: time.Now().Add(-time.Second).UTC()})
+	drifts, err := Reconcile(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	c.Assert(drifts[0].Kind, check.Equals, DriftMissingMachine)
+}
+
+func (s *S) TestReconcileDefaultIaaSWithoutMachines(c *check.C) {
+	config.Set("iaas:default", "lister-iaas")
+	defer config.Unset("iaas:default")
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	provider.(*TestListerIaaS).running = []Machine{{Id: "o1", CreationDate: time.Now().Add(-time.Hour)}}
+	drifts, err := Reconcile(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	c.Assert(drifts[0].Kind, check.Equals, DriftOrphanMachine)
+	c.Assert(drifts[0].Machine.Id, check.Equals, "o1")
+}
+
+func (s *S) TestReconcileListError(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	s.insertMachines(c, Machine{Id: "m1", Iaas: "lister-iaas", CreationDate: time.Now().Add(-time.Hour).UTC()})
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	provider.(*TestListerIaaS).err = errors.New("cloud unavailable")
+	drifts, err := Reconcile(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+}
+
+func (s *S) TestDriftCleanupMissingMachine(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	m := Machine{Id: "m1", Iaas: "lister-iaas"}
+	s.insertMachines(c, m)
+	d := Drift{Kind: DriftMissingMachine, IaaS: "lister-iaas", Machine: &m}
+	err := d.Cleanup()
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Cleaned, check.Equals, true)
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.Find(bson.M{"_id": "m1"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(provider.(*TestListerIaaS).cmds, check.IsNil)
+}
+
+func (s *S) TestDriftCleanupOrphanMachine(c *check.C) {
+	RegisterIaasProvider("lister-iaas", newTestListerIaaS)
+	m := Machine{Id: "o1", Iaas: "lister-iaas"}
+	d := Drift{Kind: DriftOrphanMachine, IaaS: "lister-iaas", Machine: &m}
+	err := d.Cleanup()
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Cleaned, check.Equals, true)
+	c.Assert(m.Status, check.Equals, "destroyed")
+	provider, err := getIaasProvider("lister-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(provider.(*TestListerIaaS).cmds, check.DeepEquals, []string{"delete"})
+}
+
+func (s *S) TestDriftCleanupNodeWithoutMachine(c *check.C) {
+	d := Drift{Kind: DriftNodeWithoutMachine, IaaS: "test-iaas", Node: "http://n1:2375"}
+	c.Assert(d.Cleanable(), check.Equals, false)
+	err := d.Cleanup()
+	c.Assert(err, check.ErrorMatches, "node-without-machine can't be cleaned up")
+	c.Assert(d.Cleaned, check.Equals, false)
+	c.Assert(d.Error, check.Equals, "node-without-machine can't be cleaned up")
+}
@@ -116,3 +116,19 @@ func newTestDescriberIaaS(name string) IaaS {
 func newTestIaaS(name string) IaaS {
 	return &TestIaaS{}
 }
+
+type TestListerIaaS struct {
+	TestIaaS
+	running []Machine
+	err     error
+	listed  int
+}
+
+func (i *TestListerIaaS) ListMachines(known []Machine) ([]Machine, error) {
+	i.listed++
+	return i.running, i.err
+}
+
+func newTestListerIaaS(name string) IaaS {
+	return &TestListerIaaS{}
+}
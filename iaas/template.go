@@ -6,11 +6,25 @@ package iaas
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of template params.
+const (
+	ParamTypeString = "string"
+	ParamTypeInt    = "int"
+	ParamTypeFloat  = "float"
+	ParamTypeBool   = "bool"
 )
 
 type TemplateData struct {
@@ -24,10 +38,43 @@ func (l TemplateDataList) Len() int           { return len(l) }
 func (l TemplateDataList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l TemplateDataList) Less(i, j int) bool { return l[i].Name < l[j].Name }
 
+// TemplateParam declares a param accepted by a template. Params declared as
+// required must be set either by the template or by the user, and the values
+// of declared params must match the type and, when there are any, one of the
+// allowed Values.
+type TemplateParam struct {
+	Name     string
+	Type     string   `bson:",omitempty"`
+	Required bool     `bson:",omitempty"`
+	Values   []string `bson:",omitempty"`
+}
+
+type TemplateParamList []TemplateParam
+
+func (l TemplateParamList) Len() int           { return len(l) }
+func (l TemplateParamList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l TemplateParamList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+// Template is a named set of params used to create machines. A template may
+// extend a Parent template, inheriting its IaaS, data and params
+// declarations, which are overridden by the ones in the template itself.
 type Template struct {
 	Name     string `bson:"_id"`
 	IaaSName string
 	Data     TemplateDataList
+	Parent   string            `bson:",omitempty"`
+	Params   TemplateParamList `bson:",omitempty"`
+}
+
+// TemplateError is returned when a template, or the params used to create a
+// machine with it, are invalid.
+type TemplateError struct {
+	Template string
+	Errors   []string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %q: %s", e.Template, strings.Join(e.Errors, "; "))
 }
 
 func FindTemplate(name string) (*Template, error) {
@@ -43,7 +90,11 @@ func ExpandTemplate(name string, params map[string]string) (map[string]string, e
 	if err != nil {
 		return nil, err
 	}
-	templateParams := template.paramsMap()
+	resolved, err := template.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	templateParams := resolved.paramsMap()
 	delete(params, "template")
 	// User params will override template params
 	for k, v := range templateParams {
@@ -52,6 +103,9 @@ func ExpandTemplate(name string, params map[string]string) (map[string]string, e
 			params[k] = v
 		}
 	}
+	if errs := resolved.validateValues(params, true); len(errs) > 0 {
+		return nil, &TemplateError{Template: name, Errors: errs}
+	}
 	return params, nil
 }
 
@@ -66,6 +120,20 @@ func ListTemplates() ([]Template, error) {
 func DestroyTemplate(name string) error {
 	coll := template_collection()
 	defer coll.Close()
+	var children []Template
+	err := coll.Find(bson.M{"parent": name}).Sort("_id").All(&children)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		names := make([]string, len(children))
+		for i := range children {
+			names[i] = children[i].Name
+		}
+		return &TemplateError{Template: name, Errors: []string{
+			fmt.Sprintf("extended by templates: %s", strings.Join(names, ", ")),
+		}}
+	}
 	return coll.RemoveId(name)
 }
 
@@ -85,6 +153,10 @@ func (t *Template) Update(toMerge *Template) error {
 	for k, v := range currentMap {
 		t.Data = append(t.Data, TemplateData{Name: k, Value: v})
 	}
+	if toMerge.Parent != "" {
+		t.Parent = toMerge.Parent
+	}
+	t.Params = mergeParams(t.Params, toMerge.Params)
 	return t.Save()
 }
 
@@ -92,13 +164,177 @@ func (t *Template) Save() error {
 	if t.Name == "" {
 		return errors.New("template name cannot be empty")
 	}
-	_, err := getIaasProvider(t.IaaSName)
+	resolved, err := t.Resolve()
+	if err != nil {
+		return err
+	}
+	t.IaaSName = resolved.IaaSName
+	_, err = getIaasProvider(t.IaaSName)
 	if err != nil {
 		return err
 	}
+	errs := resolved.validateDeclarations()
+	if len(errs) == 0 {
+		errs = resolved.validateValues(resolved.paramsMap(), false)
+	}
+	if len(errs) > 0 {
+		return &TemplateError{Template: t.Name, Errors: errs}
+	}
 	return t.saveToDB()
 }
 
+// Resolve returns a copy of the template including the IaaS, data and params
+// declarations inherited from its ancestors.
+func (t *Template) Resolve() (*Template, error) {
+	chain := []*Template{t}
+	visited := map[string]bool{t.Name: true}
+	for current := t; current.Parent != ""; {
+		if visited[current.Parent] {
+			return nil, &TemplateError{Template: t.Name, Errors: []string{
+				fmt.Sprintf("inheritance cycle through template %q", current.Parent),
+			}}
+		}
+		parent, err := FindTemplate(current.Parent)
+		if err == mgo.ErrNotFound {
+			return nil, &TemplateError{Template: t.Name, Errors: []string{
+				fmt.Sprintf("parent template %q not found", current.Parent),
+			}}
+		}
+		if err != nil {
+			return nil, err
+		}
+		visited[parent.Name] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+	resolved := Template{Name: t.Name}
+	data := map[string]string{}
+	var params TemplateParamList
+	for i := len(chain) - 1; i >= 0; i-- {
+		tpl := chain[i]
+		if tpl.IaaSName != "" {
+			if resolved.IaaSName != "" && resolved.IaaSName != tpl.IaaSName {
+				return nil, &TemplateError{Template: t.Name, Errors: []string{
+					fmt.Sprintf("IaaS %q differs from the inherited IaaS %q", tpl.IaaSName, resolved.IaaSName),
+				}}
+			}
+			resolved.IaaSName = tpl.IaaSName
+		}
+		for _, item := range tpl.Data {
+			data[item.Name] = item.Value
+		}
+		params = mergeParams(params, tpl.Params)
+	}
+	for k, v := range data {
+		resolved.Data = append(resolved.Data, TemplateData{Name: k, Value: v})
+	}
+	sort.Sort(resolved.Data)
+	resolved.Params = params
+	return &resolved, nil
+}
+
+// mergeParams returns the declarations in current overridden by the ones with
+// the same name in override, sorted by name.
+func mergeParams(current, override TemplateParamList) TemplateParamList {
+	if len(current) == 0 && len(override) == 0 {
+		return nil
+	}
+	byName := map[string]TemplateParam{}
+	for _, p := range current {
+		byName[p.Name] = p
+	}
+	for _, p := range override {
+		byName[p.Name] = p
+	}
+	result := make(TemplateParamList, 0, len(byName))
+	for _, p := range byName {
+		result = append(result, p)
+	}
+	sort.Sort(result)
+	return result
+}
+
+func (t *Template) validateDeclarations() []string {
+	var errs []string
+	for _, p := range t.Params {
+		if p.Name == "" {
+			errs = append(errs, "param name cannot be empty")
+			continue
+		}
+		if !validParamType(p.Type) {
+			errs = append(errs, fmt.Sprintf("param %q has invalid type %q", p.Name, p.Type))
+			continue
+		}
+		for _, v := range p.Values {
+			if !p.matchesType(v) {
+				errs = append(errs, fmt.Sprintf("param %q allowed value %q is not a valid %s", p.Name, v, p.typeName()))
+			}
+		}
+	}
+	return errs
+}
+
+// validateValues checks the given params against the declarations in the
+// template. Missing required params are only reported when checkRequired is
+// set, as they may be set by the user when creating machines.
+func (t *Template) validateValues(params map[string]string, checkRequired bool) []string {
+	var errs []string
+	for _, p := range t.Params {
+		value, isSet := params[p.Name]
+		if !isSet || value == "" {
+			if checkRequired && p.Required {
+				errs = append(errs, fmt.Sprintf("param %q is required", p.Name))
+			}
+			continue
+		}
+		if !p.matchesType(value) {
+			errs = append(errs, fmt.Sprintf("param %q must be a valid %s, got %q", p.Name, p.typeName(), value))
+			continue
+		}
+		if len(p.Values) > 0 && !p.allows(value) {
+			errs = append(errs, fmt.Sprintf("param %q must be one of [%s], got %q", p.Name, strings.Join(p.Values, ", "), value))
+		}
+	}
+	return errs
+}
+
+func validParamType(paramType string) bool {
+	switch paramType {
+	case "", ParamTypeString, ParamTypeInt, ParamTypeFloat, ParamTypeBool:
+		return true
+	}
+	return false
+}
+
+func (p *TemplateParam) typeName() string {
+	if p.Type == "" {
+		return ParamTypeString
+	}
+	return p.Type
+}
+
+func (p *TemplateParam) matchesType(value string) bool {
+	var err error
+	switch p.Type {
+	case ParamTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamTypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamTypeBool:
+		_, err = strconv.ParseBool(value)
+	}
+	return err == nil
+}
+
+func (p *TemplateParam) allows(value string) bool {
+	for _, v := range p.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Template) saveToDB() error {
 	coll := template_collection()
 	defer coll.Close()
@@ -196,3 +196,180 @@ func (s *S) TestExpandTemplate(c *check.C) {
 		"iaas": "test-iaas",
 	})
 }
+
+func (s *S) TestTemplateSaveWithParent(c *check.C) {
+	parent := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "image", Value: "ubuntu"},
+			{Name: "size", Value: "small"},
+		},
+		Params: TemplateParamList{
+			{Name: "size", Values: []string{"small", "large"}},
+			{Name: "zone", Required: true},
+		},
+	}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "large",
+		Parent: "base",
+		Data:   TemplateDataList{{Name: "size", Value: "large"}},
+		Params: TemplateParamList{{Name: "disk", Type: ParamTypeInt}},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	c.Assert(child.IaaSName, check.Equals, "test-iaas")
+	dbTpl, err := FindTemplate("large")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "base")
+	c.Assert(dbTpl.IaaSName, check.Equals, "test-iaas")
+	c.Assert(dbTpl.Data, check.DeepEquals, TemplateDataList{{Name: "size", Value: "large"}})
+	resolved, err := dbTpl.Resolve()
+	c.Assert(err, check.IsNil)
+	c.Assert(resolved, check.DeepEquals, &Template{
+		Name:     "large",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "image", Value: "ubuntu"},
+			{Name: "size", Value: "large"},
+		},
+		Params: TemplateParamList{
+			{Name: "disk", Type: ParamTypeInt},
+			{Name: "size", Values: []string{"small", "large"}},
+			{Name: "zone", Required: true},
+		},
+	})
+}
+
+func (s *S) TestTemplateSaveParentNotFound(c *check.C) {
+	t := Template{Name: "tpl1", Parent: "missing"}
+	err := t.Save()
+	c.Assert(err, check.FitsTypeOf, &TemplateError{})
+	c.Assert(err, check.ErrorMatches, `template "tpl1": parent template "missing" not found`)
+}
+
+func (s *S) TestTemplateSaveParentWithOtherIaaS(c *check.C) {
+	RegisterIaasProvider("other-iaas", newTestIaaS)
+	parent := Template{Name: "base", IaaSName: "test-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	t := Template{Name: "tpl1", IaaSName: "other-iaas", Parent: "base"}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": IaaS "other-iaas" differs from the inherited IaaS "test-iaas"`)
+}
+
+func (s *S) TestTemplateSaveCycle(c *check.C) {
+	t1 := Template{Name: "tpl1", IaaSName: "test-iaas"}
+	err := t1.Save()
+	c.Assert(err, check.IsNil)
+	t2 := Template{Name: "tpl2", Parent: "tpl1"}
+	err = t2.Save()
+	c.Assert(err, check.IsNil)
+	err = t1.Update(&Template{Parent: "tpl2"})
+	c.Assert(err, check.ErrorMatches, `template "tpl1": inheritance cycle through template "tpl1"`)
+	dbTpl, err := FindTemplate("tpl1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "")
+}
+
+func (s *S) TestTemplateSaveInvalidDeclarations(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params: TemplateParamList{
+			{Name: "cpus", Type: "integer"},
+			{Name: "disk", Type: ParamTypeInt, Values: []string{"10", "big"}},
+		},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": param "cpus" has invalid type "integer"; param "disk" allowed value "big" is not a valid int`)
+}
+
+func (s *S) TestTemplateSaveInvalidValues(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "cpus", Value: "two"},
+			{Name: "size", Value: "huge"},
+		},
+		Params: TemplateParamList{
+			{Name: "cpus", Type: ParamTypeInt},
+			{Name: "size", Values: []string{"small", "large"}},
+			{Name: "zone", Required: true},
+		},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": param "cpus" must be a valid int, got "two"; param "size" must be one of \[small, large\], got "huge"`)
+	templates, err := ListTemplates()
+	c.Assert(err, check.IsNil)
+	c.Assert(templates, check.HasLen, 0)
+}
+
+func (s *S) TestDestroyTemplateWithChildren(c *check.C) {
+	parent := Template{Name: "base", IaaSName: "test-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.ErrorMatches, `template "base": extended by templates: child`)
+	err = DestroyTemplate("child")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestExpandTemplateWithParent(c *check.C) {
+	parent := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "image", Value: "ubuntu"},
+			{Name: "size", Value: "small"},
+		},
+	}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "large",
+		Parent: "base",
+		Data:   TemplateDataList{{Name: "size", Value: "large"}},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	data, err := ExpandTemplate("large", map[string]string{"template": "large", "pool": "p1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]string{
+		"image": "ubuntu",
+		"size":  "large",
+		"pool":  "p1",
+		"iaas":  "test-iaas",
+	})
+}
+
+func (s *S) TestExpandTemplateValidatesParams(c *check.C) {
+	tpl := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Data:     TemplateDataList{{Name: "size", Value: "small"}},
+		Params: TemplateParamList{
+			{Name: "size", Values: []string{"small", "large"}},
+			{Name: "disk", Type: ParamTypeInt},
+			{Name: "spot", Type: ParamTypeBool},
+			{Name: "zone", Required: true},
+		},
+	}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	_, err = ExpandTemplate("tpl1", map[string]string{"size": "huge", "disk": "10GB", "spot": "yes"})
+	c.Assert(err, check.FitsTypeOf, &TemplateError{})
+	c.Assert(err, check.ErrorMatches, `template "tpl1": param "disk" must be a valid int, got "10GB"; `+
+		`param "size" must be one of \[small, large\], got "huge"; param "spot" must be a valid bool, got "yes"; param "zone" is required`)
+	data, err := ExpandTemplate("tpl1", map[string]string{"disk": "10", "spot": "true", "zone": "a"})
+	c.Assert(err, check.IsNil)
+	c.Assert(data["size"], check.Equals, "small")
+}
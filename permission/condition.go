@@ -0,0 +1,238 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// attributePrefix is prepended to the context type of attribute contexts,
+// ensuring they're never matched by the context of a role.
+const attributePrefix = "attribute:"
+
+var ErrInvalidCondition = errors.New("a condition requires an attribute and at least one valid value pattern")
+
+// Condition restricts a permission in a role to checks in which an attribute
+// matches one of the Values patterns, using path.Match syntax. Attributes are
+// either context types, like "pool" or "team", or values passed explicitly to
+// the check with Attribute, like "env".
+//
+// A condition on an allowed permission is met when every value of the
+// attribute matches a pattern, while a condition on a denied permission is met
+// when any value matches, so that a single denied value is enough to deny the
+// action. Deny tells whether the condition applies to the denied or to the
+// granted permission with SchemeName.
+type Condition struct {
+	SchemeName string   `json:"scheme_name"`
+	Deny       bool     `json:"deny,omitempty"`
+	Attribute  string   `json:"attribute"`
+	Values     []string `json:"values"`
+}
+
+func (c *Condition) validate() error {
+	if c.Attribute == "" || len(c.Values) == 0 {
+		return ErrInvalidCondition
+	}
+	for _, v := range c.Values {
+		if _, err := path.Match(v, ""); err != nil || v == "" {
+			return ErrInvalidCondition
+		}
+	}
+	return nil
+}
+
+func (c *Condition) matchesValue(value string) bool {
+	for _, pattern := range c.Values {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Condition) met(attrs map[string][]string, deny bool) bool {
+	values := attrs[c.Attribute]
+	if deny {
+		for _, v := range values {
+			if c.matchesValue(v) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if !c.matchesValue(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s in [%s]", c.Attribute, strings.Join(c.Values, ", "))
+}
+
+// Attribute returns a context holding the value of an attribute of the checked
+// action, used only to evaluate role conditions.
+func Attribute(name, value string) PermissionContext {
+	return PermissionContext{CtxType: contextType(attributePrefix + name), Value: value}
+}
+
+// Attributes returns one attribute context for each value.
+func Attributes(name string, values []string) []PermissionContext {
+	contexts := make([]PermissionContext, len(values))
+	for i, v := range values {
+		contexts[i] = Attribute(name, v)
+	}
+	return contexts
+}
+
+func attributesFromContexts(contexts []PermissionContext) map[string][]string {
+	attrs := make(map[string][]string)
+	for _, ctx := range contexts {
+		name := strings.TrimPrefix(string(ctx.CtxType), attributePrefix)
+		attrs[name] = append(attrs[name], ctx.Value)
+	}
+	return attrs
+}
+
+// MatchResult is the outcome of evaluating a single permission in a check.
+type MatchResult string
+
+const (
+	MatchGranted         = MatchResult("granted")
+	MatchDenied          = MatchResult("denied")
+	MatchContextMismatch = MatchResult("context-mismatch")
+	MatchConditionNotMet = MatchResult("condition-not-met")
+)
+
+func (p *Permission) appliesTo(contexts []PermissionContext) bool {
+	if p.Context.CtxType == CtxGlobal {
+		return true
+	}
+	for _, ctx := range contexts {
+		if ctx == p.Context {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Permission) evaluate(contexts []PermissionContext, attrs map[string][]string) MatchResult {
+	if !p.appliesTo(contexts) {
+		return MatchContextMismatch
+	}
+	for _, cond := range p.Conditions {
+		if !cond.met(attrs, p.Deny) {
+			return MatchConditionNotMet
+		}
+	}
+	if p.Deny {
+		return MatchDenied
+	}
+	return MatchGranted
+}
+
+// PermissionMatch describes how a permission covering the checked scheme was
+// evaluated. Role is the name of the role including the permission, when
+// known.
+type PermissionMatch struct {
+	Permission string      `json:"permission"`
+	Role       string      `json:"role,omitempty"`
+	Deny       bool        `json:"deny"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Result     MatchResult `json:"result"`
+}
+
+// Explanation describes why a permission check passed or failed.
+type Explanation struct {
+	Permission string            `json:"permission"`
+	Allowed    bool              `json:"allowed"`
+	Reason     string            `json:"reason"`
+	Matches    []PermissionMatch `json:"matches"`
+}
+
+// RoleAssignment is a role applied in a context value.
+type RoleAssignment struct {
+	Role         Role
+	ContextValue string
+}
+
+// Explain evaluates a permission check like CheckFromPermList, describing the
+// result of every permission covering the checked scheme.
+func Explain(perms []Permission, scheme *PermissionScheme, contexts ...PermissionContext) Explanation {
+	return explain(perms, nil, scheme, contexts)
+}
+
+// ExplainRoles is like Explain, evaluating the permissions of the assigned
+// roles and reporting the role including each permission.
+func ExplainRoles(assignments []RoleAssignment, scheme *PermissionScheme, contexts ...PermissionContext) Explanation {
+	var perms []Permission
+	var origins []string
+	for i := range assignments {
+		rolePerms := assignments[i].Role.PermissionsFor(assignments[i].ContextValue)
+		perms = append(perms, rolePerms...)
+		for range rolePerms {
+			origins = append(origins, assignments[i].Role.Name)
+		}
+	}
+	return explain(perms, origins, scheme, contexts)
+}
+
+func explain(perms []Permission, origins []string, scheme *PermissionScheme, contexts []PermissionContext) Explanation {
+	exp := Explanation{Permission: scheme.FullName(), Matches: []PermissionMatch{}}
+	attrs := attributesFromContexts(contexts)
+	var granted, denied *PermissionMatch
+	for i := range perms {
+		perm := &perms[i]
+		if !perm.Scheme.IsParent(scheme) {
+			continue
+		}
+		match := PermissionMatch{
+			Permission: perm.String(),
+			Deny:       perm.Deny,
+			Conditions: perm.Conditions,
+			Result:     perm.evaluate(contexts, attrs),
+		}
+		if origins != nil {
+			match.Role = origins[i]
+		}
+		exp.Matches = append(exp.Matches, match)
+	}
+	for i := range exp.Matches {
+		match := &exp.Matches[i]
+		if match.Result == MatchDenied && denied == nil {
+			denied = match
+		}
+		if match.Result == MatchGranted && granted == nil {
+			granted = match
+		}
+	}
+	switch {
+	case denied != nil:
+		exp.Reason = "denied by " + denied.describe()
+	case granted != nil:
+		exp.Allowed = true
+		exp.Reason = "granted by " + granted.describe()
+	case len(exp.Matches) == 0:
+		exp.Reason = fmt.Sprintf("no role includes %s", exp.Permission)
+	default:
+		exp.Reason = fmt.Sprintf("no permission including %s applies to the given contexts and conditions", exp.Permission)
+	}
+	return exp
+}
+
+func (m *PermissionMatch) describe() string {
+	if m.Role == "" {
+		return m.Permission
+	}
+	return fmt.Sprintf("%s in role %q", m.Permission, m.Role)
+}
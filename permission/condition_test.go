@@ -0,0 +1,113 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package permission
+
+import "gopkg.in/check.v1"
+
+func (s *S) TestCheckDeny(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxGlobal, "")},
+		{Scheme: PermAppDeploy, Context: Context(CtxPool, "prod"), Deny: true},
+	}
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "dev")), check.Equals, true)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "prod")), check.Equals, false)
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, Context(CtxPool, "prod")), check.Equals, true)
+	perms = append(perms, Permission{Scheme: PermAppUpdate, Context: Context(CtxGlobal, ""), Deny: true})
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, Context(CtxPool, "dev")), check.Equals, false)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "dev")), check.Equals, true)
+}
+
+func (s *S) TestCheckAllowCondition(c *check.C) {
+	perms := []Permission{
+		{
+			Scheme:     PermAppDeploy,
+			Context:    Context(CtxGlobal, ""),
+			Conditions: []Condition{{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev", "staging-*"}}},
+		},
+	}
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "dev")), check.Equals, true)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "staging-1")), check.Equals, true)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxPool, "prod")), check.Equals, false)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxApp, "myapp")), check.Equals, false)
+}
+
+func (s *S) TestCheckDenyCondition(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermAppUpdateEnv, Context: Context(CtxTeam, "myteam")},
+		{
+			Scheme:     PermAppUpdateEnvSet,
+			Context:    Context(CtxGlobal, ""),
+			Deny:       true,
+			Conditions: []Condition{{SchemeName: "app.update.env.set", Attribute: "env", Values: []string{"DB_*"}}},
+		},
+	}
+	team := Context(CtxTeam, "myteam")
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, team, Attribute("env", "PORT")), check.Equals, true)
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, append([]PermissionContext{team}, Attributes("env", []string{"PORT", "DB_PASSWORD"})...)...), check.Equals, false)
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvUnset, team, Attribute("env", "DB_PASSWORD")), check.Equals, true)
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, team), check.Equals, true)
+}
+
+func (s *S) TestAttributeNeverMatchesRoleContext(c *check.C) {
+	perms := []Permission{{Scheme: PermAppDeploy, Context: Context(CtxPool, "prod")}}
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Attribute("pool", "prod")), check.Equals, false)
+}
+
+func (s *S) TestConditionValidate(c *check.C) {
+	c.Assert((&Condition{Attribute: "env", Values: []string{"DB_*"}}).validate(), check.IsNil)
+	c.Assert((&Condition{Values: []string{"DB_*"}}).validate(), check.Equals, ErrInvalidCondition)
+	c.Assert((&Condition{Attribute: "env"}).validate(), check.Equals, ErrInvalidCondition)
+	c.Assert((&Condition{Attribute: "env", Values: []string{"[DB"}}).validate(), check.Equals, ErrInvalidCondition)
+}
+
+func (s *S) TestExplain(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "myteam")},
+		{Scheme: PermAppDeploy, Context: Context(CtxPool, "prod"), Deny: true},
+		{Scheme: PermTeam, Context: Context(CtxGlobal, "")},
+	}
+	exp := Explain(perms, PermAppDeploy, Context(CtxTeam, "myteam"), Context(CtxPool, "dev"))
+	c.Assert(exp, check.DeepEquals, Explanation{
+		Permission: "app.deploy",
+		Allowed:    true,
+		Reason:     "granted by app(team myteam)",
+		Matches: []PermissionMatch{
+			{Permission: "app(team myteam)", Result: MatchGranted},
+			{Permission: "app.deploy(pool prod)", Deny: true, Result: MatchContextMismatch},
+		},
+	})
+	exp = Explain(perms, PermAppDeploy, Context(CtxTeam, "myteam"), Context(CtxPool, "prod"))
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Reason, check.Equals, "denied by app.deploy(pool prod)")
+	c.Assert(exp.Allowed, check.Equals, CheckFromPermList(perms, PermAppDeploy, Context(CtxTeam, "myteam"), Context(CtxPool, "prod")))
+	exp = Explain(perms, PermAppDeploy, Context(CtxTeam, "otherteam"))
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Reason, check.Equals, "no permission including app.deploy applies to the given contexts and conditions")
+	exp = Explain(perms, PermServiceCreate)
+	c.Assert(exp.Allowed, check.Equals, false)
+	c.Assert(exp.Reason, check.Equals, "no role includes service.create")
+	c.Assert(exp.Matches, check.DeepEquals, []PermissionMatch{})
+}
+
+func (s *S) TestContextsFromListForPermissionDeny(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "myteam")},
+		{Scheme: PermAppDeploy, Context: Context(CtxPool, "prod"), Deny: true},
+	}
+	c.Assert(CandidateContextsFromListForPermission(perms, PermAppDeploy), check.DeepEquals, []PermissionContext{Context(CtxTeam, "myteam")})
+	c.Assert(ContextsFromListForPermission(perms, PermAppDeploy), check.IsNil)
+	perms = append(perms, Permission{Scheme: PermAppDeploy, Context: Context(CtxGlobal, ""), Deny: true})
+	c.Assert(CandidateContextsFromListForPermission(perms, PermAppDeploy), check.IsNil)
+}
+
+func (s *S) TestIntersectKeepsDeny(c *check.C) {
+	deny := Permission{Scheme: PermAppDeploy, Context: Context(CtxGlobal, ""), Deny: true}
+	perms := []Permission{{Scheme: PermApp, Context: Context(CtxGlobal, "")}, deny}
+	result := Intersect(perms, []Permission{{Scheme: PermAppUpdate, Context: Context(CtxTeam, "myteam")}})
+	c.Assert(result, check.DeepEquals, []Permission{
+		{Scheme: PermAppUpdate, Context: Context(CtxTeam, "myteam")},
+		deny,
+	})
+}
@@ -66,6 +66,15 @@ func parseContext(ctx string) (contextType, error) {
 	return "", fmt.Errorf("invalid context type %q", ctx)
 }
 
+// ParseContext returns the context with the given type name and value.
+func ParseContext(ctxType, value string) (PermissionContext, error) {
+	t, err := parseContext(ctxType)
+	if err != nil {
+		return PermissionContext{}, err
+	}
+	return Context(t, value), nil
+}
+
 func (l PermissionSchemeList) Len() int           { return len(l) }
 func (l PermissionSchemeList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l PermissionSchemeList) Less(i, j int) bool { return l[i].FullName() < l[j].FullName() }
@@ -133,9 +142,14 @@ func (s *PermissionScheme) AllowedContexts() []contextType {
 	return contexts
 }
 
+// Permission is a permission scheme in a context, granted by a role. Denied
+// permissions take precedence over granted ones, and both only apply when all
+// of their conditions are met.
 type Permission struct {
-	Scheme  *PermissionScheme
-	Context PermissionContext
+	Scheme     *PermissionScheme
+	Context    PermissionContext
+	Deny       bool
+	Conditions []Condition
 }
 
 func (p *Permission) String() string {
@@ -150,25 +164,92 @@ type Token interface {
 	Permissions() ([]Permission, error)
 }
 
+// ContextsFromListForPermission returns the contexts in which the list of
+// permissions grants the scheme to every item they contain, to be used as
+// filters by listing handlers. Grants with conditions are left out, as well as
+// contexts that may hold items matched by a denied permission, with or
+// without conditions.
 func ContextsFromListForPermission(perms []Permission, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
+	var denies []PermissionContext
+	for _, perm := range perms {
+		if !perm.Deny || !perm.Scheme.IsParent(scheme) {
+			continue
+		}
+		if perm.Context.CtxType == CtxGlobal {
+			return nil
+		}
+		denies = append(denies, perm.Context)
+	}
 	var contexts []PermissionContext
+	for _, ctx := range grantedContexts(perms, scheme, false, ctxTypes) {
+		if !mayOverlap(ctx, denies) {
+			contexts = append(contexts, ctx)
+		}
+	}
+	return contexts
+}
+
+// CandidateContextsFromListForPermission returns the contexts in which the
+// list of permissions may grant the scheme, including grants with
+// conditions. Only contexts in which the scheme is denied without conditions
+// are left out, so listing handlers using it must check every listed item
+// with CheckFromPermList.
+func CandidateContextsFromListForPermission(perms []Permission, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
+	denied := make(map[PermissionContext]bool)
 	for _, perm := range perms {
-		if perm.Scheme.IsParent(scheme) {
-			if len(ctxTypes) > 0 {
-				for _, t := range ctxTypes {
-					if t == perm.Context.CtxType {
-						contexts = append(contexts, perm.Context)
-					}
-				}
-			} else {
-				contexts = append(contexts, perm.Context)
+		if !perm.Deny || len(perm.Conditions) > 0 || !perm.Scheme.IsParent(scheme) {
+			continue
+		}
+		if perm.Context.CtxType == CtxGlobal {
+			return nil
+		}
+		denied[perm.Context] = true
+	}
+	var contexts []PermissionContext
+	for _, ctx := range grantedContexts(perms, scheme, true, ctxTypes) {
+		if !denied[ctx] {
+			contexts = append(contexts, ctx)
+		}
+	}
+	return contexts
+}
 
+func grantedContexts(perms []Permission, scheme *PermissionScheme, withConditions bool, ctxTypes []contextType) []PermissionContext {
+	var contexts []PermissionContext
+	for _, perm := range perms {
+		if perm.Deny || !perm.Scheme.IsParent(scheme) {
+			continue
+		}
+		if !withConditions && len(perm.Conditions) > 0 {
+			continue
+		}
+		if len(ctxTypes) > 0 {
+			for _, t := range ctxTypes {
+				if t == perm.Context.CtxType {
+					contexts = append(contexts, perm.Context)
+				}
 			}
+		} else {
+			contexts = append(contexts, perm.Context)
 		}
 	}
 	return contexts
 }
 
+// mayOverlap returns whether items in ctx may also be in any of the given
+// contexts. Contexts of the same type may overlap because items may belong to
+// many of them, like an app owned by many teams, and contexts of different
+// types when one may contain the other, like a team and its apps.
+func mayOverlap(ctx PermissionContext, others []PermissionContext) bool {
+	for _, other := range others {
+		if ctx.CtxType == CtxGlobal || other.CtxType == ctx.CtxType ||
+			canContain(ctx.CtxType, other.CtxType) || canContain(other.CtxType, ctx.CtxType) {
+			return true
+		}
+	}
+	return false
+}
+
 func ContextsForPermission(token Token, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
 	perms, err := token.Permissions()
 	if err != nil {
@@ -185,20 +266,117 @@ func Check(token Token, scheme *PermissionScheme, contexts ...PermissionContext)
 	return CheckFromPermList(perms, scheme, contexts...)
 }
 
+// CheckFromPermList returns whether the list of permissions allows the scheme
+// in any of the given contexts. Attribute contexts are only used to evaluate
+// conditions. A single matching denied permission fails the check.
 func CheckFromPermList(perms []Permission, scheme *PermissionScheme, contexts ...PermissionContext) bool {
+	var attrs map[string][]string
+	allowed := false
+	for i := range perms {
+		perm := &perms[i]
+		if !perm.Scheme.IsParent(scheme) {
+			continue
+		}
+		if attrs == nil && len(perm.Conditions) > 0 {
+			attrs = attributesFromContexts(contexts)
+		}
+		switch perm.evaluate(contexts, attrs) {
+		case MatchDenied:
+			return false
+		case MatchGranted:
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// ParsePermission returns the permission identified by the given scheme name
+// and context, validating that the scheme exists and that it may be used with
+// the context type. An empty context type means the global context.
+func ParsePermission(schemeName, ctxType, ctxValue string) (Permission, error) {
+	if schemeName == "*" {
+		schemeName = ""
+	}
+	reg := PermissionRegistry.getSubRegistry(schemeName)
+	if reg == nil {
+		return Permission{}, &ErrPermissionNotFound{permission: schemeName}
+	}
+	if ctxType == "" {
+		ctxType = string(CtxGlobal)
+	}
+	t, err := parseContext(ctxType)
+	if err != nil {
+		return Permission{}, err
+	}
+	for _, allowed := range reg.AllowedContexts() {
+		if allowed == t {
+			return Permission{Scheme: &reg.PermissionScheme, Context: Context(t, ctxValue)}, nil
+		}
+	}
+	return Permission{}, &ErrPermissionNotAllowed{permission: schemeName, contextType: t}
+}
+
+// containerContexts maps context types to the types of the contexts that may
+// contain them, like the team owning an app or the pool an app is in.
+var containerContexts = map[contextType][]contextType{
+	CtxApp:  {CtxTeam, CtxPool},
+	CtxPool: {CtxTeam},
+}
+
+func canContain(container, ctxType contextType) bool {
+	for _, t := range containerContexts[ctxType] {
+		if t == container {
+			return true
+		}
+	}
+	return false
+}
+
+var patternEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// Intersect returns the permissions that are granted both by perms and by
+// limits. A permission is kept when its scheme and context are covered by a
+// permission in limits, narrowed down to the most specific scheme and context
+// of the pair. When the context in limits may be contained in the context of
+// the permission, like an app in a team, the permission keeps its context and
+// gets a condition on the narrower one, so it's only granted when both match.
+// Denied permissions are always kept.
+func Intersect(perms []Permission, limits []Permission) []Permission {
+	var result []Permission
 	for _, perm := range perms {
-		if perm.Scheme.IsParent(scheme) {
-			if perm.Context.CtxType == CtxGlobal {
-				return true
+		if perm.Deny {
+			result = append(result, perm)
+			continue
+		}
+		for _, limit := range limits {
+			var scheme *PermissionScheme
+			switch {
+			case perm.Scheme.IsParent(limit.Scheme):
+				scheme = limit.Scheme
+			case limit.Scheme.IsParent(perm.Scheme):
+				scheme = perm.Scheme
+			default:
+				continue
 			}
-			for _, ctx := range contexts {
-				if ctx.CtxType == perm.Context.CtxType && ctx.Value == perm.Context.Value {
-					return true
-				}
+			ctx := perm.Context
+			conditions := perm.Conditions
+			switch {
+			case perm.Context.CtxType == CtxGlobal:
+				ctx = limit.Context
+			case limit.Context.CtxType == CtxGlobal || limit.Context == perm.Context:
+			case canContain(perm.Context.CtxType, limit.Context.CtxType):
+				conditions = append(conditions[:len(conditions):len(conditions)], Condition{
+					SchemeName: scheme.FullName(),
+					Attribute:  string(limit.Context.CtxType),
+					Values:     []string{patternEscaper.Replace(limit.Context.Value)},
+				})
+			default:
+				continue
 			}
+			result = append(result, Permission{Scheme: scheme, Context: ctx, Conditions: conditions})
 		}
 	}
-	return false
+	return result
 }
 
 func TeamForPermission(t Token, scheme *PermissionScheme) (string, error) {
@@ -92,6 +92,54 @@ func (s *S) TestCheckSuperToken(c *check.C) {
 	c.Assert(Check(t, PermAppUpdateEnvUnset), check.Equals, true)
 }
 
+func (s *S) TestContextsFromListForPermissionWithDeny(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team2")},
+		{Scheme: PermApp, Context: Context(CtxTeam, "team2"), Deny: true},
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team3")},
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team3"), Deny: true, Conditions: []Condition{
+			{SchemeName: "app.read", Deny: true, Attribute: "pool", Values: []string{"prod"}},
+		}},
+	}
+	contexts := CandidateContextsFromListForPermission(perms, PermAppRead)
+	c.Assert(contexts, check.DeepEquals, []PermissionContext{Context(CtxTeam, "team1"), Context(CtxTeam, "team3")})
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.IsNil)
+	perms = append(perms, Permission{Scheme: PermAppRead, Context: Context(CtxGlobal, ""), Deny: true})
+	c.Assert(CandidateContextsFromListForPermission(perms, PermAppRead), check.IsNil)
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.IsNil)
+}
+
+func (s *S) TestContextsFromListForPermissionWithConditions(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team2"), Conditions: []Condition{
+			{SchemeName: "app.read", Attribute: "app", Values: []string{"myapp"}},
+		}},
+		{Scheme: PermServiceRead, Context: Context(CtxTeam, "team3")},
+	}
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.DeepEquals, []PermissionContext{Context(CtxTeam, "team1")})
+	c.Assert(CandidateContextsFromListForPermission(perms, PermAppRead), check.DeepEquals, []PermissionContext{
+		Context(CtxTeam, "team1"),
+		Context(CtxTeam, "team2"),
+	})
+}
+
+func (s *S) TestContextsFromListForPermissionWithOverlappingDeny(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppRead, Context: Context(CtxPool, "pool1")},
+		{Scheme: PermServiceRead, Context: Context(CtxTeam, "team2")},
+		{Scheme: PermAppRead, Context: Context(CtxApp, "myapp"), Deny: true},
+	}
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.IsNil)
+	c.Assert(ContextsFromListForPermission(perms, PermServiceRead), check.DeepEquals, []PermissionContext{Context(CtxTeam, "team2")})
+	c.Assert(CandidateContextsFromListForPermission(perms, PermAppRead), check.DeepEquals, []PermissionContext{
+		Context(CtxTeam, "team1"),
+		Context(CtxPool, "pool1"),
+	})
+}
+
 func (s *S) TestGetTeamForPermission(c *check.C) {
 	t := &userToken{
 		permissions: []Permission{
@@ -125,3 +173,64 @@ func (s *S) TestGetTeamForPermissionGlobalMustSpecifyTeam(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.Equals, ErrTooManyTeams)
 }
+
+func (s *S) TestParsePermission(c *check.C) {
+	perm, err := ParsePermission("app.deploy", "team", "team1")
+	c.Assert(err, check.IsNil)
+	c.Assert(perm, check.DeepEquals, Permission{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1")})
+	perm, err = ParsePermission("*", "", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(perm, check.DeepEquals, Permission{Scheme: PermAll, Context: Context(CtxGlobal, "")})
+	_, err = ParsePermission("app.invalid", "team", "team1")
+	c.Assert(err, check.ErrorMatches, `permission named "app.invalid" not found`)
+	_, err = ParsePermission("app.deploy", "iaas", "x")
+	c.Assert(err, check.ErrorMatches, `permission "app.deploy" not allowed with context of type "iaas"`)
+	_, err = ParsePermission("app.deploy", "invalid", "x")
+	c.Assert(err, check.ErrorMatches, `invalid context type "invalid"`)
+}
+
+func (s *S) TestIntersect(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppDeploy, Context: Context(CtxGlobal, "")},
+		{Scheme: PermNode, Context: Context(CtxPool, "pool1")},
+	}
+	limits := []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxGlobal, "")},
+		{Scheme: PermAppRead, Context: Context(CtxTeam, "team2")},
+		{Scheme: PermAll, Context: Context(CtxPool, "pool2")},
+	}
+	c.Assert(Intersect(perms, limits), check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermApp, Context: Context(CtxTeam, "team1"), Conditions: []Condition{
+			{SchemeName: "app", Attribute: "pool", Values: []string{"pool2"}},
+		}},
+		{Scheme: PermAppDeploy, Context: Context(CtxGlobal, "")},
+		{Scheme: PermAppDeploy, Context: Context(CtxPool, "pool2")},
+	})
+	c.Assert(Intersect(perms, nil), check.IsNil)
+}
+
+func (s *S) TestIntersectContainedContext(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppRead, Context: Context(CtxApp, "otherapp")},
+	}
+	limits := []Permission{{Scheme: PermAppDeploy, Context: Context(CtxApp, "myapp")}}
+	result := Intersect(perms, limits)
+	c.Assert(result, check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1"), Conditions: []Condition{
+			{SchemeName: "app.deploy", Attribute: "app", Values: []string{"myapp"}},
+		}},
+	})
+	appContexts := func(name, team string) []PermissionContext {
+		return []PermissionContext{Context(CtxTeam, team), Context(CtxApp, name), Context(CtxPool, "pool1")}
+	}
+	c.Assert(CheckFromPermList(result, PermAppDeploy, appContexts("myapp", "team1")...), check.Equals, true)
+	c.Assert(CheckFromPermList(result, PermAppDeploy, appContexts("myapp", "team2")...), check.Equals, false)
+	c.Assert(CheckFromPermList(result, PermAppDeploy, appContexts("otherapp", "team1")...), check.Equals, false)
+	c.Assert(CheckFromPermList(result, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, false)
+	result = Intersect(perms, []Permission{{Scheme: PermAppDeploy, Context: Context(CtxApp, "my*app")}})
+	c.Assert(result[0].Conditions[0].Values, check.DeepEquals, []string{`my\*app`})
+	c.Assert(CheckFromPermList(result, PermAppDeploy, appContexts("myotherapp", "team1")...), check.Equals, false)
+}
@@ -32,21 +32,30 @@ var (
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
+	PermAppUpdateAutoRollback            = PermissionRegistry.get("app.update.auto-rollback")            // [global app team pool]
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")                     // [global app team pool]
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")                    // [global app team pool]
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
+	PermAppUpdateConstraint              = PermissionRegistry.get("app.update.constraint")               // [global app team pool]
+	PermAppUpdateConstraintAdd           = PermissionRegistry.get("app.update.constraint.add")           // [global app team pool]
+	PermAppUpdateConstraintRemove        = PermissionRegistry.get("app.update.constraint.remove")        // [global app team pool]
 	PermAppUpdateDescription             = PermissionRegistry.get("app.update.description")              // [global app team pool]
 	PermAppUpdateEnv                     = PermissionRegistry.get("app.update.env")                      // [global app team pool]
 	PermAppUpdateEnvSet                  = PermissionRegistry.get("app.update.env.set")                  // [global app team pool]
 	PermAppUpdateEnvUnset                = PermissionRegistry.get("app.update.env.unset")                // [global app team pool]
+	PermAppUpdateEnvset                  = PermissionRegistry.get("app.update.envset")                   // [global app team pool]
+	PermAppUpdateEnvsetAttach            = PermissionRegistry.get("app.update.envset.attach")            // [global app team pool]
+	PermAppUpdateEnvsetDetach            = PermissionRegistry.get("app.update.envset.detach")            // [global app team pool]
 	PermAppUpdateEvents                  = PermissionRegistry.get("app.update.events")                   // [global app team pool]
 	PermAppUpdateGrant                   = PermissionRegistry.get("app.update.grant")                    // [global app team pool]
 	PermAppUpdateLog                     = PermissionRegistry.get("app.update.log")                      // [global app team pool]
 	PermAppUpdatePlan                    = PermissionRegistry.get("app.update.plan")                     // [global app team pool]
 	PermAppUpdatePool                    = PermissionRegistry.get("app.update.pool")                     // [global app team pool]
+	PermAppUpdateProcess                 = PermissionRegistry.get("app.update.process")                  // [global app team pool]
 	PermAppUpdateRestart                 = PermissionRegistry.get("app.update.restart")                  // [global app team pool]
 	PermAppUpdateRevoke                  = PermissionRegistry.get("app.update.revoke")                   // [global app team pool]
+	PermAppUpdateRollingUpdate           = PermissionRegistry.get("app.update.rolling-update")           // [global app team pool]
 	PermAppUpdateSleep                   = PermissionRegistry.get("app.update.sleep")                    // [global app team pool]
 	PermAppUpdateStart                   = PermissionRegistry.get("app.update.start")                    // [global app team pool]
 	PermAppUpdateStop                    = PermissionRegistry.get("app.update.stop")                     // [global app team pool]
@@ -58,7 +67,17 @@ var (
 	PermAppUpdateUnitRegister            = PermissionRegistry.get("app.update.unit.register")            // [global app team pool]
 	PermAppUpdateUnitRemove              = PermissionRegistry.get("app.update.unit.remove")              // [global app team pool]
 	PermAppUpdateUnitStatus              = PermissionRegistry.get("app.update.unit.status")              // [global app team pool]
+	PermAppUpdateVolume                  = PermissionRegistry.get("app.update.volume")                   // [global app team pool]
+	PermAppUpdateVolumeBind              = PermissionRegistry.get("app.update.volume.bind")              // [global app team pool]
+	PermAppUpdateVolumeUnbind            = PermissionRegistry.get("app.update.volume.unbind")            // [global app team pool]
+	PermAudit                            = PermissionRegistry.get("audit")                               // [global]
+	PermAuditRead                        = PermissionRegistry.get("audit.read")                          // [global]
 	PermDebug                            = PermissionRegistry.get("debug")                               // [global]
+	PermEnvset                           = PermissionRegistry.get("envset")                              // [global team pool]
+	PermEnvsetCreate                     = PermissionRegistry.get("envset.create")                       // [global team pool]
+	PermEnvsetDelete                     = PermissionRegistry.get("envset.delete")                       // [global team pool]
+	PermEnvsetRead                       = PermissionRegistry.get("envset.read")                         // [global team pool]
+	PermEnvsetUpdate                     = PermissionRegistry.get("envset.update")                       // [global team pool]
 	PermHealing                          = PermissionRegistry.get("healing")                             // [global pool]
 	PermHealingRead                      = PermissionRegistry.get("healing.read")                        // [global pool]
 	PermHealingUpdate                    = PermissionRegistry.get("healing.update")                      // [global pool]
@@ -80,6 +99,7 @@ var (
 	PermNodeDelete                       = PermissionRegistry.get("node.delete")                         // [global pool]
 	PermNodeRead                         = PermissionRegistry.get("node.read")                           // [global pool]
 	PermNodeUpdate                       = PermissionRegistry.get("node.update")                         // [global pool]
+	PermNodeUpdateDrain                  = PermissionRegistry.get("node.update.drain")                   // [global pool]
 	PermNodecontainer                    = PermissionRegistry.get("nodecontainer")                       // [global pool]
 	PermNodecontainerCreate              = PermissionRegistry.get("nodecontainer.create")                // [global pool]
 	PermNodecontainerDelete              = PermissionRegistry.get("nodecontainer.delete")                // [global pool]
@@ -101,6 +121,7 @@ var (
 	PermPoolUpdate                       = PermissionRegistry.get("pool.update")                         // [global pool]
 	PermPoolUpdateEvents                 = PermissionRegistry.get("pool.update.events")                  // [global pool]
 	PermPoolUpdateLogs                   = PermissionRegistry.get("pool.update.logs")                    // [global pool]
+	PermPoolUpdateScheduler              = PermissionRegistry.get("pool.update.scheduler")               // [global pool]
 	PermPoolUpdateTeam                   = PermissionRegistry.get("pool.update.team")                    // [global pool]
 	PermPoolUpdateTeamAdd                = PermissionRegistry.get("pool.update.team.add")                // [global pool]
 	PermPoolUpdateTeamRemove             = PermissionRegistry.get("pool.update.team.remove")             // [global pool]
@@ -114,12 +135,25 @@ var (
 	PermRoleReadEvents                   = PermissionRegistry.get("role.read.events")                    // [global]
 	PermRoleUpdate                       = PermissionRegistry.get("role.update")                         // [global]
 	PermRoleUpdateAssign                 = PermissionRegistry.get("role.update.assign")                  // [global]
+	PermRoleUpdateCondition              = PermissionRegistry.get("role.update.condition")               // [global]
+	PermRoleUpdateConditionAdd           = PermissionRegistry.get("role.update.condition.add")           // [global]
+	PermRoleUpdateConditionRemove        = PermissionRegistry.get("role.update.condition.remove")        // [global]
+	PermRoleUpdateDeny                   = PermissionRegistry.get("role.update.deny")                    // [global]
+	PermRoleUpdateDenyAdd                = PermissionRegistry.get("role.update.deny.add")                // [global]
+	PermRoleUpdateDenyRemove             = PermissionRegistry.get("role.update.deny.remove")             // [global]
 	PermRoleUpdateDissociate             = PermissionRegistry.get("role.update.dissociate")              // [global]
 	PermRoleUpdateEvents                 = PermissionRegistry.get("role.update.events")                  // [global]
 	PermRoleUpdatePermission             = PermissionRegistry.get("role.update.permission")              // [global]
 	PermRoleUpdatePermissionAdd          = PermissionRegistry.get("role.update.permission.add")          // [global]
 	PermRoleUpdatePermissionRemove       = PermissionRegistry.get("role.update.permission.remove")       // [global]
 	PermService                          = PermissionRegistry.get("service")                             // [global service team]
+	PermServiceAccount                   = PermissionRegistry.get("service-account")                     // [global team]
+	PermServiceAccountCreate             = PermissionRegistry.get("service-account.create")              // [global team]
+	PermServiceAccountDelete             = PermissionRegistry.get("service-account.delete")              // [global team]
+	PermServiceAccountRead               = PermissionRegistry.get("service-account.read")                // [global team]
+	PermServiceAccountUpdate             = PermissionRegistry.get("service-account.update")              // [global team]
+	PermServiceAccountUpdateRole         = PermissionRegistry.get("service-account.update.role")         // [global team]
+	PermServiceAccountUpdateToken        = PermissionRegistry.get("service-account.update.token")        // [global team]
 	PermServiceInstance                  = PermissionRegistry.get("service-instance")                    // [global service-instance team]
 	PermServiceInstanceCreate            = PermissionRegistry.get("service-instance.create")             // [global team]
 	PermServiceInstanceDelete            = PermissionRegistry.get("service-instance.delete")             // [global service-instance team]
@@ -153,6 +187,7 @@ var (
 	PermTeamReadEvents                   = PermissionRegistry.get("team.read.events")                    // [global team]
 	PermTeamUpdate                       = PermissionRegistry.get("team.update")                         // [global team]
 	PermTeamUpdateEvents                 = PermissionRegistry.get("team.update.events")                  // [global team]
+	PermTeamUpdateParent                 = PermissionRegistry.get("team.update.parent")                  // [global team]
 	PermUser                             = PermissionRegistry.get("user")                                // [global]
 	PermUserCreate                       = PermissionRegistry.get("user.create")                         // [global]
 	PermUserDelete                       = PermissionRegistry.get("user.delete")                         // [global]
@@ -167,4 +202,13 @@ var (
 	PermUserUpdateQuota                  = PermissionRegistry.get("user.update.quota")                   // [global]
 	PermUserUpdateReset                  = PermissionRegistry.get("user.update.reset")                   // [global]
 	PermUserUpdateToken                  = PermissionRegistry.get("user.update.token")                   // [global]
+	PermVolume                           = PermissionRegistry.get("volume")                              // [global team pool]
+	PermVolumeCreate                     = PermissionRegistry.get("volume.create")                       // [global team pool]
+	PermVolumeDelete                     = PermissionRegistry.get("volume.delete")                       // [global team pool]
+	PermVolumePlan                       = PermissionRegistry.get("volume.plan")                         // [global team pool]
+	PermVolumePlanCreate                 = PermissionRegistry.get("volume.plan.create")                  // [global team pool]
+	PermVolumePlanDelete                 = PermissionRegistry.get("volume.plan.delete")                  // [global team pool]
+	PermVolumeRead                       = PermissionRegistry.get("volume.read")                         // [global team pool]
+	PermVolumeUpdate                     = PermissionRegistry.get("volume.update")                       // [global team pool]
+	PermVolumeUpdateBind                 = PermissionRegistry.get("volume.update.bind")                  // [global team pool]
 )
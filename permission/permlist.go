@@ -20,6 +20,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.unit.status",
 	"app.update.env.set",
 	"app.update.env.unset",
+	"app.update.envset.attach",
+	"app.update.envset.detach",
+	"app.update.volume.bind",
+	"app.update.volume.unbind",
+	"app.update.constraint.add",
+	"app.update.constraint.remove",
+	"app.update.process",
+	"app.update.rolling-update",
+	"app.update.auto-rollback",
 	"app.update.restart",
 	"app.update.sleep",
 	"app.update.start",
@@ -59,6 +68,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"node.create",
 	"node.read",
 	"node.update",
+	"node.update.drain",
 	"node.delete",
 	"node.autoscale",
 ).addWithCtx(
@@ -81,6 +91,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.read.events",
 	"team.delete",
 	"team.update.events",
+	"team.update.parent",
 ).add(
 	"user.create",
 	"user.delete",
@@ -130,6 +141,10 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"role.update.dissociate",
 	"role.update.permission.add",
 	"role.update.permission.remove",
+	"role.update.deny.add",
+	"role.update.deny.remove",
+	"role.update.condition.add",
+	"role.update.condition.remove",
 	"role.default.create",
 	"role.default.delete",
 ).add(
@@ -139,6 +154,30 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"plan.create",
 	"plan.delete",
+).addWithCtx(
+	"envset", []contextType{CtxTeam, CtxPool},
+).add(
+	"envset.create",
+	"envset.read",
+	"envset.update",
+	"envset.delete",
+).addWithCtx(
+	"volume", []contextType{CtxTeam, CtxPool},
+).add(
+	"volume.create",
+	"volume.read",
+	"volume.update.bind",
+	"volume.delete",
+	"volume.plan.create",
+	"volume.plan.delete",
+).addWithCtx(
+	"service-account", []contextType{CtxTeam},
+).add(
+	"service-account.create",
+	"service-account.read",
+	"service-account.update.token",
+	"service-account.update.role",
+	"service-account.delete",
 ).addWithCtx(
 	"pool", []contextType{CtxPool},
 ).addWithCtx(
@@ -149,9 +188,12 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"pool.update.team.remove",
 	"pool.update.events",
 	"pool.update.logs",
+	"pool.update.scheduler",
 	"pool.delete",
 ).add(
 	"debug",
+).add(
+	"audit.read",
 ).add(
 	"healing.read",
 ).addWithCtx(
@@ -77,11 +77,13 @@ func (e *RoleEvent) String() string {
 }
 
 type Role struct {
-	Name        string      `bson:"_id" json:"name"`
-	ContextType contextType `json:"context"`
-	Description string
-	SchemeNames []string `json:"scheme_names,omitempty"`
-	Events      []string `json:"events,omitempty"`
+	Name            string      `bson:"_id" json:"name"`
+	ContextType     contextType `json:"context"`
+	Description     string
+	SchemeNames     []string    `json:"scheme_names,omitempty"`
+	DenySchemeNames []string    `json:"deny_scheme_names,omitempty"`
+	Conditions      []Condition `json:"conditions,omitempty"`
+	Events          []string    `json:"events,omitempty"`
 }
 
 func NewRole(name string, ctx string, description string) (Role, error) {
@@ -191,7 +193,7 @@ func DestroyRole(name string) error {
 	return err
 }
 
-func (r *Role) AddPermissions(permNames ...string) error {
+func (r *Role) validatePermissions(permNames []string) error {
 	for _, permName := range permNames {
 		if permName == "" {
 			return ErrInvalidPermissionName
@@ -217,12 +219,19 @@ func (r *Role) AddPermissions(permNames ...string) error {
 			}
 		}
 	}
+	return nil
+}
+
+func (r *Role) update(change bson.M) error {
 	coll, err := rolesCollection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
-	err = coll.UpdateId(r.Name, bson.M{"$addToSet": bson.M{"schemenames": bson.M{"$each": permNames}}})
+	err = coll.UpdateId(r.Name, change)
+	if err == mgo.ErrNotFound {
+		return ErrRoleNotFound
+	}
 	if err != nil {
 		return err
 	}
@@ -231,16 +240,22 @@ func (r *Role) AddPermissions(permNames ...string) error {
 		return err
 	}
 	r.SchemeNames = dbRole.SchemeNames
+	r.DenySchemeNames = dbRole.DenySchemeNames
+	r.Conditions = dbRole.Conditions
 	return nil
 }
 
-func (r *Role) RemovePermissions(permNames ...string) error {
+func (r *Role) AddPermissions(permNames ...string) error {
+	err := r.validatePermissions(permNames)
+	if err != nil {
+		return err
+	}
 	coll, err := rolesCollection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
-	err = coll.UpdateId(r.Name, bson.M{"$pullAll": bson.M{"schemenames": permNames}})
+	err = coll.UpdateId(r.Name, bson.M{"$addToSet": bson.M{"schemenames": bson.M{"$each": permNames}}})
 	if err != nil {
 		return err
 	}
@@ -252,11 +267,85 @@ func (r *Role) RemovePermissions(permNames ...string) error {
 	return nil
 }
 
+// AddDenyPermissions adds permissions explicitly denied by the role. Denied
+// permissions take precedence over permissions granted by any role.
+func (r *Role) AddDenyPermissions(permNames ...string) error {
+	err := r.validatePermissions(permNames)
+	if err != nil {
+		return err
+	}
+	return r.update(bson.M{"$addToSet": bson.M{"denyschemenames": bson.M{"$each": permNames}}})
+}
+
+func (r *Role) RemoveDenyPermissions(permNames ...string) error {
+	return r.update(bson.M{
+		"$pullAll": bson.M{"denyschemenames": permNames},
+		"$pull":    bson.M{"conditions": conditionsFilter(permNames, true)},
+	})
+}
+
+func conditionsFilter(permNames []string, deny bool) bson.M {
+	filter := bson.M{"schemename": bson.M{"$in": permNames}}
+	if deny {
+		filter["deny"] = true
+	} else {
+		filter["deny"] = bson.M{"$ne": true}
+	}
+	return filter
+}
+
+// AddCondition adds a condition to a permission granted or denied by the role,
+// according to cond.Deny, replacing any existing condition on the same
+// attribute of the same permission.
+func (r *Role) AddCondition(cond Condition) error {
+	if cond.SchemeName == "" {
+		return ErrInvalidPermissionName
+	}
+	err := r.validatePermissions([]string{cond.SchemeName})
+	if err != nil {
+		return err
+	}
+	err = cond.validate()
+	if err != nil {
+		return err
+	}
+	err = r.RemoveCondition(cond.SchemeName, cond.Deny, cond.Attribute)
+	if err != nil {
+		return err
+	}
+	return r.update(bson.M{"$push": bson.M{"conditions": cond}})
+}
+
+// RemoveCondition removes the condition on the attribute from a permission
+// granted or denied by the role. An empty attribute removes all conditions
+// from the permission.
+func (r *Role) RemoveCondition(schemeName string, deny bool, attribute string) error {
+	filter := conditionsFilter([]string{schemeName}, deny)
+	if attribute != "" {
+		filter["attribute"] = attribute
+	}
+	return r.update(bson.M{"$pull": bson.M{"conditions": filter}})
+}
+
+func (r *Role) RemovePermissions(permNames ...string) error {
+	return r.update(bson.M{
+		"$pullAll": bson.M{"schemenames": permNames},
+		"$pull":    bson.M{"conditions": conditionsFilter(permNames, false)},
+	})
+}
+
 func (r *Role) filterValidSchemes() PermissionSchemeList {
-	schemes := make(PermissionSchemeList, 0, len(r.SchemeNames))
-	sort.Strings(r.SchemeNames)
-	for i := 0; i < len(r.SchemeNames); i++ {
-		schemeName := r.SchemeNames[i]
+	r.DenySchemeNames, _ = filterValidSchemeNames(r.DenySchemeNames)
+	var schemes PermissionSchemeList
+	r.SchemeNames, schemes = filterValidSchemeNames(r.SchemeNames)
+	return schemes
+}
+
+func filterValidSchemeNames(schemeNames []string) ([]string, PermissionSchemeList) {
+	schemes := make(PermissionSchemeList, 0, len(schemeNames))
+	sort.Strings(schemeNames)
+	for i := 0; i < len(schemeNames); i++ {
+		schemeName := schemeNames[i]
 		if schemeName == "*" {
 			schemeName = ""
 		}
@@ -264,26 +353,44 @@ func (r *Role) filterValidSchemes() PermissionSchemeList {
 		if scheme == nil {
 			// permission schemes might be removed or renamed, invalid entries
 			// in the database shouldn't be a problem.
-			r.SchemeNames = append(r.SchemeNames[:i], r.SchemeNames[i+1:]...)
+			schemeNames = append(schemeNames[:i], schemeNames[i+1:]...)
 			i--
 			continue
 		}
 		schemes = append(schemes, &scheme.PermissionScheme)
 	}
-	return schemes
+	return schemeNames, schemes
+}
+
+func (r *Role) conditionsFor(schemeName string, deny bool) []Condition {
+	var conditions []Condition
+	for _, cond := range r.Conditions {
+		if cond.SchemeName == schemeName && cond.Deny == deny {
+			conditions = append(conditions, cond)
+		}
+	}
+	return conditions
 }
 
 func (r *Role) PermissionsFor(contextValue string) []Permission {
 	schemes := r.filterValidSchemes()
-	permissions := make([]Permission, len(schemes))
+	_, denySchemes := filterValidSchemeNames(r.DenySchemeNames)
+	permissions := make([]Permission, 0, len(schemes)+len(denySchemes))
+	ctx := PermissionContext{CtxType: r.ContextType, Value: contextValue}
 	for i, scheme := range schemes {
-		permissions[i] = Permission{
-			Scheme: scheme,
-			Context: PermissionContext{
-				CtxType: r.ContextType,
-				Value:   contextValue,
-			},
-		}
+		permissions = append(permissions, Permission{
+			Scheme:     scheme,
+			Context:    ctx,
+			Conditions: r.conditionsFor(r.SchemeNames[i], false),
+		})
+	}
+	for i, scheme := range denySchemes {
+		permissions = append(permissions, Permission{
+			Scheme:     scheme,
+			Context:    ctx,
+			Deny:       true,
+			Conditions: r.conditionsFor(r.DenySchemeNames[i], true),
+		})
 	}
 	return permissions
 }
@@ -208,3 +208,116 @@ func (s *S) TestListRolesForEvent(c *check.C) {
 	c.Assert(roles, check.HasLen, 1)
 	c.Assert(roles[0].Name, check.Equals, "myrole2")
 }
+
+func (s *S) TestRoleAddDenyPermissions(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.deploy", "app.update.env.set")
+	c.Assert(err, check.IsNil)
+	expected := []string{"app.deploy", "app.update.env.set"}
+	c.Assert(r.DenySchemeNames, check.DeepEquals, expected)
+	dbR, err := FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.DenySchemeNames, check.DeepEquals, expected)
+	c.Assert(dbR.SchemeNames, check.HasLen, 0)
+	err = r.AddDenyPermissions("pool.create")
+	c.Assert(err, check.FitsTypeOf, &ErrPermissionNotAllowed{})
+	err = r.RemoveDenyPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.DenySchemeNames, check.DeepEquals, []string{"app.update.env.set"})
+}
+
+func (s *S) TestRoleAddCondition(c *check.C) {
+	r, err := NewRole("myrole", "global", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddCondition(Condition{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev"}})
+	c.Assert(err, check.IsNil)
+	err = r.AddCondition(Condition{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev", "staging"}})
+	c.Assert(err, check.IsNil)
+	err = r.AddCondition(Condition{SchemeName: "app.update.env.set", Attribute: "env", Values: []string{"DB_*"}})
+	c.Assert(err, check.IsNil)
+	expected := []Condition{
+		{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev", "staging"}},
+		{SchemeName: "app.update.env.set", Attribute: "env", Values: []string{"DB_*"}},
+	}
+	c.Assert(r.Conditions, check.DeepEquals, expected)
+	dbR, err := FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.Conditions, check.DeepEquals, expected)
+	err = r.AddCondition(Condition{SchemeName: "app.deploy", Attribute: "pool"})
+	c.Assert(err, check.Equals, ErrInvalidCondition)
+	err = r.AddCondition(Condition{SchemeName: "invalid", Attribute: "pool", Values: []string{"dev"}})
+	c.Assert(err, check.FitsTypeOf, &ErrPermissionNotFound{})
+	err = r.RemoveCondition("app.deploy", false, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, expected[1:])
+}
+
+func (s *S) TestRolePermissionsForWithDenyAndConditions(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.update.env.set")
+	c.Assert(err, check.IsNil)
+	cond := Condition{SchemeName: "app.update.env.set", Deny: true, Attribute: "env", Values: []string{"DB_*"}}
+	err = r.AddCondition(cond)
+	c.Assert(err, check.IsNil)
+	perms := r.PermissionsFor("myteam")
+	c.Assert(perms, check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "myteam")},
+		{Scheme: PermAppUpdateEnvSet, Context: Context(CtxTeam, "myteam"), Deny: true, Conditions: []Condition{cond}},
+	})
+}
+
+func (s *S) TestRoleConditionsArePerPermission(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	grantCond := Condition{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev"}}
+	err = r.AddCondition(grantCond)
+	c.Assert(err, check.IsNil)
+	denyCond := Condition{SchemeName: "app.deploy", Deny: true, Attribute: "pool", Values: []string{"prod"}}
+	err = r.AddCondition(denyCond)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []Condition{grantCond, denyCond})
+	perms := r.PermissionsFor("myteam")
+	c.Assert(perms, check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "myteam"), Conditions: []Condition{grantCond}},
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "myteam"), Deny: true, Conditions: []Condition{denyCond}},
+	})
+	err = r.RemoveCondition("app.deploy", true, "pool")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []Condition{grantCond})
+}
+
+func (s *S) TestRoleRemovePermissionsRemovesConditions(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app.deploy", "app.update.env.set")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	envCond := Condition{SchemeName: "app.update.env.set", Attribute: "env", Values: []string{"DB_*"}}
+	denyCond := Condition{SchemeName: "app.deploy", Deny: true, Attribute: "pool", Values: []string{"prod"}}
+	for _, cond := range []Condition{
+		{SchemeName: "app.deploy", Attribute: "pool", Values: []string{"dev"}},
+		envCond,
+		denyCond,
+	} {
+		err = r.AddCondition(cond)
+		c.Assert(err, check.IsNil)
+	}
+	err = r.RemovePermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []Condition{envCond, denyCond})
+	err = r.RemoveDenyPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, []Condition{envCond})
+	dbR, err := FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.Conditions, check.DeepEquals, []Condition{envCond})
+}
@@ -137,6 +137,19 @@ var insertEmptyContainerInDB = action.Action{
 		if err := checkCanceled(args.event); err != nil {
 			return nil, err
 		}
+		var ports []container.ContainerPort
+		var shutdown provision.TsuruYamlShutdown
+		if !args.isDeploy {
+			var err error
+			ports, err = processPorts(args.imageID, args.processName)
+			if err != nil {
+				return nil, err
+			}
+			shutdown, err = imageShutdown(args.imageID)
+			if err != nil {
+				return nil, err
+			}
+		}
 		contName := args.app.GetName() + "-" + randomString()
 		cont := container.Container{
 			AppName:       args.app.GetName(),
@@ -147,6 +160,8 @@ var insertEmptyContainerInDB = action.Action{
 			Image:         args.imageID,
 			BuildingImage: args.buildingImage,
 			ExposedPort:   args.exposedPort,
+			Ports:         ports,
+			Shutdown:      shutdown,
 		}
 		coll := args.provisioner.Collection()
 		defer coll.Close()
@@ -199,6 +214,20 @@ var createContainer = action.Action{
 		if args.buildingImage != "" {
 			building = true
 		}
+		var volumes []string
+		if !args.isDeploy {
+			var err error
+			volumes, err = appVolumeBinds(args.app.GetName())
+			if err != nil {
+				return nil, err
+			}
+			if len(volumes) > 0 && len(args.destinationHosts) > 0 {
+				err = prepareVolumesInHost(args.provisioner, args.app.GetName(), args.destinationHosts[0])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 		err := cont.Create(&container.CreateArgs{
 			ImageID:          args.imageID,
 			Commands:         args.commands,
@@ -208,6 +237,7 @@ var createContainer = action.Action{
 			DestinationHosts: args.destinationHosts,
 			ProcessName:      args.processName,
 			Building:         building,
+			Volumes:          volumes,
 		})
 		if err != nil {
 			log.Errorf("error on create container for app %s - %s", args.app.GetName(), err)
@@ -270,6 +300,7 @@ var setNetworkInfo = action.Action{
 		}
 		c.IP = info.IP
 		c.HostPort = info.HTTPHostPort
+		c.Ports = info.Ports
 		return c, nil
 	},
 }
@@ -444,6 +475,10 @@ var addNewRoutes = action.Action{
 		if len(newContainers) > 0 {
 			fmt.Fprintf(writer, "\n---- Adding routes to new units ----\n")
 		}
+		err = addPortRoutes(r, args.app.GetName(), newContainers)
+		if err != nil {
+			return nil, err
+		}
 		var routesToAdd []*url.URL
 		for i, c := range newContainers {
 			if c.ProcessName != webProcessName {
@@ -460,6 +495,7 @@ var addNewRoutes = action.Action{
 		err = r.AddRoutes(args.app.GetName(), routesToAdd)
 		if err != nil {
 			r.RemoveRoutes(args.app.GetName(), routesToAdd)
+			removePortRoutes(r, args.app.GetName(), newContainers)
 			return nil, err
 		}
 		for _, c := range newContainers {
@@ -481,6 +517,10 @@ var addNewRoutes = action.Action{
 			w = ioutil.Discard
 		}
 		fmt.Fprintf(w, "\n---- Removing routes from created units ----\n")
+		err = removePortRoutes(r, args.app.GetName(), newContainers)
+		if err != nil {
+			log.Errorf("[add-new-routes:Backward] Error removing port routes: %s", err.Error())
+		}
 		var routesToRemove []*url.URL
 		for _, c := range newContainers {
 			if c.Routable {
@@ -592,6 +632,10 @@ var removeOldRoutes = action.Action{
 		if len(args.toRemove) > 0 {
 			fmt.Fprintf(writer, "\n---- Removing routes from old units ----\n")
 		}
+		err = removePortRoutes(r, args.app.GetName(), args.toRemove)
+		if err != nil {
+			return
+		}
 		currentImageName, err := appCurrentImageName(args.app.GetName())
 		if err != nil && err != errNoImagesAvailable {
 			return
@@ -617,6 +661,7 @@ var removeOldRoutes = action.Action{
 		if err != nil {
 			if !args.appDestroy {
 				r.AddRoutes(args.app.GetName(), routesToRemove)
+				addPortRoutes(r, args.app.GetName(), args.toRemove)
 			}
 			return
 		}
@@ -638,6 +683,10 @@ var removeOldRoutes = action.Action{
 			w = ioutil.Discard
 		}
 		fmt.Fprintf(w, "\n---- Adding back routes to old units ----\n")
+		err = addPortRoutes(r, args.app.GetName(), args.toRemove)
+		if err != nil {
+			log.Errorf("[remove-old-routes:Backward] Error adding back port routes: %s", err.Error())
+		}
 		var routesToAdd []*url.URL
 		for _, c := range args.toRemove {
 			if c.Routable {
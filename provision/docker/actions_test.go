@@ -100,6 +100,111 @@ func (s *S) TestInsertEmptyContainerInDBForward(c *check.C) {
 	c.Assert(retrieved.Name, check.Equals, cont.Name)
 }
 
+func (s *S) TestInsertEmptyContainerInDBForwardWithPorts(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"broker": "mosquitto",
+		},
+		"ports": map[string]interface{}{
+			"broker": []interface{}{
+				map[string]interface{}{"port": 1883},
+				map[string]interface{}{"port": 5683, "protocol": "udp"},
+				map[string]interface{}{"port": 8080, "protocol": "http"},
+			},
+		},
+	}
+	err := saveImageCustomData("image-id", customData)
+	c.Assert(err, check.IsNil)
+	args := runContainerActionsArgs{
+		app:         app,
+		processName: "broker",
+		imageID:     "image-id",
+		provisioner: s.p,
+	}
+	context := action.FWContext{Params: []interface{}{args}}
+	r, err := insertEmptyContainerInDB.Forward(context)
+	c.Assert(err, check.IsNil)
+	cont := r.(container.Container)
+	coll := s.p.Collection()
+	defer coll.Close()
+	defer coll.Remove(bson.M{"name": cont.Name})
+	c.Assert(cont.Ports, check.DeepEquals, []container.ContainerPort{
+		{Port: 1883, Protocol: "tcp"},
+		{Port: 5683, Protocol: "udp"},
+		{Port: 8080, Protocol: "tcp"},
+	})
+	args.processName = "web"
+	context = action.FWContext{Params: []interface{}{args}}
+	r, err = insertEmptyContainerInDB.Forward(context)
+	c.Assert(err, check.IsNil)
+	cont = r.(container.Container)
+	defer coll.Remove(bson.M{"name": cont.Name})
+	c.Assert(cont.Ports, check.IsNil)
+}
+
+func (s *S) TestInsertEmptyContainerInDBForwardWithShutdown(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python web.py",
+		},
+		"shutdown": map[string]interface{}{
+			"signal":       "SIGQUIT",
+			"grace_period": 30,
+			"pre_stop":     "curl -XPOST localhost:8888/drain",
+		},
+	}
+	err := saveImageCustomData("image-id", customData)
+	c.Assert(err, check.IsNil)
+	args := runContainerActionsArgs{
+		app:         app,
+		processName: "web",
+		imageID:     "image-id",
+		provisioner: s.p,
+	}
+	context := action.FWContext{Params: []interface{}{args}}
+	r, err := insertEmptyContainerInDB.Forward(context)
+	c.Assert(err, check.IsNil)
+	cont := r.(container.Container)
+	coll := s.p.Collection()
+	defer coll.Close()
+	defer coll.Remove(bson.M{"name": cont.Name})
+	expected := provision.TsuruYamlShutdown{
+		Signal:      "SIGQUIT",
+		GracePeriod: 30,
+		PreStop:     "curl -XPOST localhost:8888/drain",
+	}
+	c.Assert(cont.Shutdown, check.DeepEquals, expected)
+	var retrieved container.Container
+	err = coll.Find(bson.M{"name": cont.Name}).One(&retrieved)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrieved.Shutdown, check.DeepEquals, expected)
+}
+
+func (s *S) TestInsertEmptyContainerInDBForwardInvalidShutdown(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python web.py",
+		},
+		"shutdown": map[string]interface{}{
+			"grace_period": -1,
+		},
+	}
+	err := saveImageCustomData("image-id", customData)
+	c.Assert(err, check.IsNil)
+	args := runContainerActionsArgs{
+		app:         app,
+		processName: "web",
+		imageID:     "image-id",
+		provisioner: s.p,
+	}
+	context := action.FWContext{Params: []interface{}{args}}
+	_, err = insertEmptyContainerInDB.Forward(context)
+	c.Assert(err, check.ErrorMatches, "invalid shutdown grace period: -1")
+}
+
 func (s *S) TestInsertEmptyContainerInDBBackward(c *check.C) {
 	cont := container.Container{Name: "myName"}
 	coll := s.p.Collection()
@@ -282,6 +387,44 @@ func (s *S) TestAddNewRouteForward(c *check.C) {
 	c.Assert(containers[2].ID, check.Equals, "ble-3")
 }
 
+func (s *S) TestAddNewRouteForwardWithPorts(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	imageName := "tsuru/app-" + app.GetName()
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "python myapi.py",
+			"broker": "mosquitto",
+		},
+	}
+	err := saveImageCustomData(imageName, customData)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	mqtt := router.PortRoute{Port: 1883, Protocol: "tcp"}
+	cont1 := container.Container{ID: "ble-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.1", HostPort: "1234"}
+	cont2 := container.Container{
+		ID: "ble-2", AppName: app.GetName(), ProcessName: "broker", HostAddr: "127.0.0.2", HostPort: "4321",
+		Ports: []container.ContainerPort{{Port: 1883, Protocol: "tcp", HostPort: "32001"}},
+	}
+	defer cont1.Remove(s.p)
+	defer cont2.Remove(s.p)
+	args := changeUnitsPipelineArgs{
+		app:         app,
+		provisioner: s.p,
+		imageId:     imageName,
+	}
+	context := action.FWContext{Previous: []container.Container{cont1, cont2}, Params: []interface{}{args}}
+	r, err := addNewRoutes.Forward(context)
+	c.Assert(err, check.IsNil)
+	containers := r.([]container.Container)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont1.Address().String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont2.Address().String()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasPortRoute(app.GetName(), mqtt, "tcp://127.0.0.2:32001"), check.Equals, true)
+	addNewRoutes.Backward(action.BWContext{FWResult: containers, Params: []interface{}{args}})
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), cont1.Address().String()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasPortRoute(app.GetName(), mqtt, "tcp://127.0.0.2:32001"), check.Equals, false)
+}
+
 func (s *S) TestAddNewRouteForwardNoWeb(c *check.C) {
 	app := provisiontest.NewFakeApp("myapp", "python", 1)
 	routertest.FakeRouter.AddBackend(app.GetName())
@@ -562,6 +705,31 @@ func (s *S) TestRemoveOldRoutesForward(c *check.C) {
 	c.Assert(args.toRemove[2].Routable, check.Equals, false)
 }
 
+func (s *S) TestRemoveOldRoutesForwardWithPorts(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	dns := router.PortRoute{Port: 53, Protocol: "udp"}
+	cont := container.Container{
+		ID: "ble-1", AppName: app.GetName(), ProcessName: "dns", HostAddr: "127.0.0.1", HostPort: "1234",
+		Ports: []container.ContainerPort{{Port: 53, Protocol: "udp", HostPort: "32053"}},
+	}
+	defer cont.Remove(s.p)
+	err := routertest.FakeRouter.AddPortRoutes(app.GetName(), dns, []*url.URL{cont.PortAddress(cont.Ports[0])})
+	c.Assert(err, check.IsNil)
+	args := changeUnitsPipelineArgs{
+		app:         app,
+		toRemove:    []container.Container{cont},
+		provisioner: s.p,
+	}
+	context := action.FWContext{Previous: []container.Container{}, Params: []interface{}{args}}
+	_, err = removeOldRoutes.Forward(context)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasPortRoute(app.GetName(), dns, "udp://127.0.0.1:32053"), check.Equals, false)
+	removeOldRoutes.Backward(action.BWContext{Params: []interface{}{args}})
+	c.Assert(routertest.FakeRouter.HasPortRoute(app.GetName(), dns, "udp://127.0.0.1:32053"), check.Equals, true)
+}
+
 func (s *S) TestRemoveOldRoutesForwardNoImageData(c *check.C) {
 	app := provisiontest.NewFakeApp("myapp", "python", 1)
 	err := appendAppImageName(app.GetName(), "img1")
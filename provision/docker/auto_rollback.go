@@ -0,0 +1,306 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// deployWatch holds the units of an image deployed to an app with auto
+// rollback enabled under watch, until the end of the auto rollback window.
+type deployWatch struct {
+	ID            bson.ObjectId `bson:"_id"`
+	App           string
+	Image         string
+	PreviousImage string
+	EventID       bson.ObjectId
+	AutoRollback  provision.AutoRollback
+	Start         time.Time
+	Until         time.Time
+	Errors        int
+}
+
+func deployWatchColl() (*dbStorage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_deploy_watch", name)), nil
+}
+
+// rollbackImage returns the image currently used by the app when it's still
+// available for rollbacks, or an empty string otherwise.
+func rollbackImage(appName string) string {
+	current, err := appCurrentImageName(appName)
+	if err != nil {
+		return ""
+	}
+	images, err := listAppImages(appName)
+	if err != nil {
+		return ""
+	}
+	for _, img := range images {
+		if img == current {
+			return current
+		}
+	}
+	return ""
+}
+
+// watchDeploy discards the watches of previous deploys of the app and, when
+// the app has auto rollback enabled and there's a previous image to roll back
+// to, starts watching the units of the image deployed in the given event.
+func watchDeploy(a provision.App, imageId, previousImage string, evt *event.Event) {
+	err := startDeployWatch(a, imageId, previousImage, evt)
+	if err != nil {
+		log.Errorf("[auto rollback] unable to watch deploy of %q: %s", a.GetName(), err)
+	}
+}
+
+func startDeployWatch(a provision.App, imageId, previousImage string, evt *event.Event) error {
+	err := removeDeployWatches(a.GetName())
+	if err != nil {
+		return err
+	}
+	autoRollback := a.GetAutoRollback()
+	if !autoRollback.Enabled() || evt == nil || previousImage == "" || previousImage == imageId {
+		return nil
+	}
+	coll, err := deployWatchColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	return coll.Insert(deployWatch{
+		ID:            bson.NewObjectId(),
+		App:           a.GetName(),
+		Image:         imageId,
+		PreviousImage: previousImage,
+		EventID:       evt.UniqueID,
+		AutoRollback:  autoRollback,
+		Start:         now,
+		Until:         now.Add(time.Duration(autoRollback.Window) * time.Second),
+	})
+}
+
+func removeDeployWatches(appName string) error {
+	coll, err := deployWatchColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": appName})
+	return err
+}
+
+// countDeployWatchError counts an error status reported by the container in
+// the watch of the deploy of its image, if there's one running.
+func countDeployWatchError(cont *container.Container) {
+	coll, err := deployWatchColl()
+	if err != nil {
+		log.Errorf("[auto rollback] unable to count error of unit %q: %s", cont.ID, err)
+		return
+	}
+	defer coll.Close()
+	_, err = coll.UpdateAll(bson.M{
+		"app":   cont.AppName,
+		"image": cont.Image,
+		"until": bson.M{"$gt": time.Now().UTC()},
+	}, bson.M{"$inc": bson.M{"errors": 1}})
+	if err != nil {
+		log.Errorf("[auto rollback] unable to count error of unit %q: %s", cont.ID, err)
+	}
+}
+
+// healerRestarts returns the number of units running the watched image
+// restarted by the container healer during the window, up to one more than
+// the allowed restarts.
+func (w *deployWatch) healerRestarts() (int, error) {
+	evts, err := event.List(&event.Filter{
+		Target:   event.Target{Type: event.TargetTypeContainer},
+		KindType: event.KindTypeInternal,
+		KindName: "healer",
+		Since:    w.Start,
+		Until:    w.Until,
+		Raw: bson.M{
+			"startcustomdata.appname": w.App,
+			"startcustomdata.image":   w.Image,
+		},
+		Limit: w.AutoRollback.MaxRestarts + 1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(evts), nil
+}
+
+// rollbackReason returns why the app must be rolled back, or an empty string
+// if the units of the watched image are within the auto rollback limits.
+func (w *deployWatch) rollbackReason() (string, error) {
+	if w.AutoRollback.MaxErrors > 0 && w.Errors > w.AutoRollback.MaxErrors {
+		return fmt.Sprintf("%d unit errors during the auto rollback window (max %d)", w.Errors, w.AutoRollback.MaxErrors), nil
+	}
+	if w.AutoRollback.MaxRestarts == 0 {
+		return "", nil
+	}
+	restarts, err := w.healerRestarts()
+	if err != nil {
+		return "", err
+	}
+	if restarts > w.AutoRollback.MaxRestarts {
+		return fmt.Sprintf("%d units restarted during the auto rollback window (max %d)", restarts, w.AutoRollback.MaxRestarts), nil
+	}
+	return "", nil
+}
+
+// deployWatcher periodically checks the running deploy watches, rolling back
+// the apps whose units exceeded the limits of their auto rollback.
+type deployWatcher struct {
+	interval time.Duration
+	done     chan bool
+}
+
+func (w *deployWatcher) run() {
+	for {
+		err := w.runOnce()
+		if err != nil {
+			log.Errorf("[auto rollback] %s", err)
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+func (w *deployWatcher) Shutdown() {
+	w.done <- true
+}
+
+func (w *deployWatcher) runOnce() error {
+	coll, err := deployWatchColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	var watches []deployWatch
+	err = coll.Find(nil).All(&watches)
+	if err != nil {
+		return err
+	}
+	for i := range watches {
+		watch := &watches[i]
+		reason, err := watch.rollbackReason()
+		if err != nil {
+			log.Errorf("[auto rollback] unable to check deploy of %q: %s", watch.App, err)
+			continue
+		}
+		expired := time.Now().UTC().After(watch.Until)
+		if reason != "" {
+			err = rollbackWatchedDeploy(watch, reason)
+			if err == nil {
+				continue
+			}
+			log.Errorf("[auto rollback] unable to roll back %q to %q: %s", watch.App, watch.PreviousImage, err)
+		}
+		if expired {
+			coll.RemoveId(watch.ID)
+		}
+	}
+	return nil
+}
+
+// rollbackWatchedDeploy rolls the app back to the image it used before the
+// watched deploy, recording the reason in the event of the deploy. The watch
+// is read again while holding the lock of the app, as other API instances may
+// have already rolled the app back or a new deploy may have replaced it.
+func rollbackWatchedDeploy(watch *deployWatch, reason string) error {
+	locked, err := app.AcquireApplicationLock(watch.App, app.InternalAppName, "auto rollback")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("unable to lock %q", watch.App)
+	}
+	defer app.ReleaseApplicationLock(watch.App)
+	coll, err := deployWatchColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.FindId(watch.ID).One(watch)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a, err := app.GetByName(watch.App)
+	if err == app.ErrAppNotFound {
+		return removeDeployWatches(watch.App)
+	}
+	if err != nil {
+		return err
+	}
+	opts := app.DeployOptions{
+		App:          a,
+		OutputStream: ioutil.Discard,
+		Image:        watch.PreviousImage,
+		User:         app.InternalAppName,
+		Origin:       "rollback",
+		Rollback:     true,
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:       permission.PermAppDeploy,
+		RawOwner:   event.Owner{Type: event.OwnerTypeInternal, Name: "auto-rollback"},
+		CustomData: opts,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(evt, "---- Automatic rollback to %s: %s ----\n", watch.PreviousImage, reason)
+	opts.Event = evt
+	imageID, err := app.Deploy(opts)
+	evt.DoneCustomData(err, map[string]string{"image": imageID})
+	if err != nil {
+		return err
+	}
+	err = coll.RemoveId(watch.ID)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	deployEvt, err := event.GetByID(watch.EventID)
+	if err != nil {
+		return err
+	}
+	otherData := map[string]string{}
+	err = deployEvt.OtherData(&otherData)
+	if err != nil {
+		return err
+	}
+	otherData["autoRollback"] = fmt.Sprintf("rolled back to %s: %s", watch.PreviousImage, reason)
+	return deployEvt.SetOtherCustomData(otherData)
+}
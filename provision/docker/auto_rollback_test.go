@@ -0,0 +1,245 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) listDeployWatches(c *check.C) []deployWatch {
+	coll, err := deployWatchColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var watches []deployWatch
+	err = coll.Find(nil).All(&watches)
+	c.Assert(err, check.IsNil)
+	return watches
+}
+
+func (s *S) insertDeployWatch(c *check.C, watch deployWatch) {
+	coll, err := deployWatchColl()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	watch.ID = bson.NewObjectId()
+	err = coll.Insert(watch)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRollbackImage(c *check.C) {
+	c.Assert(rollbackImage("myapp"), check.Equals, "")
+	err := appendAppImageName("myapp", "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(rollbackImage("myapp"), check.Equals, "tsuru/app-myapp:v1")
+}
+
+func (s *S) TestWatchDeploy(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.AutoRollback = provision.AutoRollback{Window: 300, MaxErrors: 2}
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	watchDeploy(a, "tsuru/app-myapp:v2", "tsuru/app-myapp:v1", evt)
+	watches := s.listDeployWatches(c)
+	c.Assert(watches, check.HasLen, 1)
+	c.Assert(watches[0].App, check.Equals, "myapp")
+	c.Assert(watches[0].Image, check.Equals, "tsuru/app-myapp:v2")
+	c.Assert(watches[0].PreviousImage, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(watches[0].EventID, check.Equals, evt.UniqueID)
+	c.Assert(watches[0].AutoRollback, check.DeepEquals, a.AutoRollback)
+	c.Assert(watches[0].Until.Sub(watches[0].Start), check.Equals, 300*time.Second)
+	watchDeploy(a, "tsuru/app-myapp:v1", "", evt)
+	c.Assert(s.listDeployWatches(c), check.HasLen, 0)
+	a.AutoRollback = provision.AutoRollback{}
+	watchDeploy(a, "tsuru/app-myapp:v2", "tsuru/app-myapp:v1", evt)
+	c.Assert(s.listDeployWatches(c), check.HasLen, 0)
+}
+
+func (s *S) TestProvisionerSetUnitStatusCountsDeployWatchErrors(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-someapp:v2", nil)
+	c.Assert(err, check.IsNil)
+	opts := newContainerOpts{Status: provision.StatusStarted.String(), AppName: "someapp", Image: "tsuru/app-someapp:v2"}
+	cont, err := s.newContainer(&opts, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	now := time.Now().UTC()
+	s.insertDeployWatch(c, deployWatch{
+		App:   "someapp",
+		Image: "tsuru/app-someapp:v2",
+		Start: now,
+		Until: now.Add(time.Minute),
+	})
+	unit := provision.Unit{ID: cont.ID, AppName: cont.AppName}
+	err = s.p.SetUnitStatus(unit, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	err = s.p.SetUnitStatus(unit, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	watches := s.listDeployWatches(c)
+	c.Assert(watches, check.HasLen, 1)
+	c.Assert(watches[0].Errors, check.Equals, 1)
+}
+
+func (s *S) TestDeployWatchRollbackReasonHealerRestarts(c *check.C) {
+	now := time.Now().UTC()
+	watch := deployWatch{
+		App:          "someapp",
+		Image:        "tsuru/app-someapp:v2",
+		AutoRollback: provision.AutoRollback{Window: 60, MaxRestarts: 1},
+		Start:        now.Add(-time.Second),
+		Until:        now.Add(time.Minute),
+	}
+	for i, image := range []string{"tsuru/app-someapp:v2", "tsuru/app-someapp:v1", "tsuru/app-someapp:v2"} {
+		reason, err := watch.rollbackReason()
+		c.Assert(err, check.IsNil)
+		c.Assert(reason, check.Equals, "")
+		evt, err := event.NewInternal(&event.Opts{
+			Target:       event.Target{Type: event.TargetTypeContainer, Value: string(rune('a' + i))},
+			InternalKind: "healer",
+			CustomData:   map[string]string{"appname": "someapp", "image": image},
+		})
+		c.Assert(err, check.IsNil)
+		evt.Done(nil)
+	}
+	reason, err := watch.rollbackReason()
+	c.Assert(err, check.IsNil)
+	c.Assert(reason, check.Equals, "2 units restarted during the auto rollback window (max 1)")
+}
+
+func (s *S) TestDeployWatcherRollback(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-otherapp:v1", nil)
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName("otherapp", "tsuru/app-otherapp:v1")
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName("otherapp", "tsuru/app-otherapp:v2")
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:         "otherapp",
+		Platform:     "python",
+		Quota:        quota.Unlimited,
+		AutoRollback: provision.AutoRollback{Window: 60, MaxErrors: 1},
+	}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.Name, Image: "tsuru/app-otherapp:v2"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.SetOtherCustomData(map[string]string{"diff": "some diff"})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	s.insertDeployWatch(c, deployWatch{
+		App:           a.Name,
+		Image:         "tsuru/app-otherapp:v2",
+		PreviousImage: "tsuru/app-otherapp:v1",
+		EventID:       evt.UniqueID,
+		AutoRollback:  a.AutoRollback,
+		Start:         now,
+		Until:         now.Add(time.Minute),
+		Errors:        2,
+	})
+	watcher := deployWatcher{}
+	err = watcher.runOnce()
+	c.Assert(err, check.IsNil)
+	conts, err := s.p.listContainersByApp(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(conts, check.HasLen, 1)
+	c.Assert(conts[0].Image, check.Equals, "tsuru/app-otherapp:v1")
+	c.Assert(s.listDeployWatches(c), check.HasLen, 0)
+	deployEvt, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	var otherData map[string]string
+	err = deployEvt.OtherData(&otherData)
+	c.Assert(err, check.IsNil)
+	c.Assert(otherData, check.DeepEquals, map[string]string{
+		"diff":         "some diff",
+		"autoRollback": "rolled back to tsuru/app-otherapp:v1: 2 unit errors during the auto rollback window (max 1)",
+	})
+	evts, err := event.List(&event.Filter{
+		Target:    event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		OwnerType: event.OwnerTypeInternal,
+		KindName:  permission.PermAppDeploy.FullName(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Error, check.Equals, "")
+}
+
+func (s *S) TestRollbackWatchedDeployRemovedWatch(c *check.C) {
+	a := app.App{
+		Name:         "otherapp",
+		Platform:     "python",
+		Quota:        quota.Unlimited,
+		AutoRollback: provision.AutoRollback{Window: 60, MaxErrors: 1},
+	}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	watch := deployWatch{
+		ID:            bson.NewObjectId(),
+		App:           a.Name,
+		Image:         "tsuru/app-otherapp:v2",
+		PreviousImage: "tsuru/app-otherapp:v1",
+		AutoRollback:  a.AutoRollback,
+		Start:         now,
+		Until:         now.Add(time.Minute),
+		Errors:        2,
+	}
+	err = rollbackWatchedDeploy(&watch, "2 unit errors")
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		KindName: permission.PermAppDeploy.FullName(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, false)
+}
+
+func (s *S) TestDeployWatcherRemovesExpiredWatches(c *check.C) {
+	now := time.Now().UTC()
+	s.insertDeployWatch(c, deployWatch{
+		App:          "someapp",
+		Image:        "tsuru/app-someapp:v2",
+		AutoRollback: provision.AutoRollback{Window: 60, MaxErrors: 1},
+		Start:        now.Add(-2 * time.Minute),
+		Until:        now.Add(-time.Minute),
+	})
+	s.insertDeployWatch(c, deployWatch{
+		App:          "otherapp",
+		Image:        "tsuru/app-otherapp:v2",
+		AutoRollback: provision.AutoRollback{Window: 60, MaxErrors: 1},
+		Start:        now,
+		Until:        now.Add(time.Minute),
+	})
+	watcher := deployWatcher{}
+	err := watcher.runOnce()
+	c.Assert(err, check.IsNil)
+	watches := s.listDeployWatches(c)
+	c.Assert(watches, check.HasLen, 1)
+	c.Assert(watches[0].App, check.Equals, "otherapp")
+}
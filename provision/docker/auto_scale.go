@@ -9,6 +9,7 @@ import (
 	"io"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +31,7 @@ import (
 
 const (
 	poolMetadataName   = "pool"
+	spotMetadataName   = "spot"
 	autoScaleEventKind = "autoscale"
 )
 
@@ -45,6 +47,7 @@ type autoScaleConfig struct {
 	WaitTimeNewMachine  time.Duration
 	RunInterval         time.Duration
 	TotalMemoryMetadata string
+	TotalCPUMetadata    string
 	Enabled             bool
 	provisioner         *dockerProvisioner
 	done                chan bool
@@ -85,6 +88,9 @@ func (a *autoScaleConfig) initialize() {
 	if a.TotalMemoryMetadata == "" {
 		a.TotalMemoryMetadata, _ = config.GetString("docker:scheduler:total-memory-metadata")
 	}
+	if a.TotalCPUMetadata == "" {
+		a.TotalCPUMetadata, _ = config.GetString("docker:scheduler:total-cpu-metadata")
+	}
 	if a.RunInterval == 0 {
 		a.RunInterval = time.Hour
 	}
@@ -97,7 +103,15 @@ func (a *autoScaleConfig) scalerForRule(rule *autoScaleRule) (autoScaler, error)
 	if rule.MaxContainerCount > 0 {
 		return &countScaler{autoScaleConfig: a, rule: rule}, nil
 	}
-	return &memoryScaler{autoScaleConfig: a, rule: rule}, nil
+	memory := &memoryScaler{autoScaleConfig: a, rule: rule}
+	if a.TotalCPUMetadata == "" || rule.MaxCPURatio <= 0 {
+		return memory, nil
+	}
+	cpu := &cpuScaler{autoScaleConfig: a, rule: rule}
+	if a.TotalMemoryMetadata == "" || rule.MaxMemoryRatio <= 0 {
+		return cpu, nil
+	}
+	return &reservationScaler{scalers: []autoScaler{memory, cpu}}, nil
 }
 
 func (a *autoScaleConfig) run() error {
@@ -246,7 +260,8 @@ func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
 	}
 	if sResult.ToAdd > 0 {
 		evt.Logf("running event \"add\" for %q: %#v", pool, sResult)
-		evtNodes, err = a.addMultipleNodes(evt, nodes, sResult.ToAdd)
+		spotCount := spotNodesToAdd(nodes, sResult.ToAdd, rule.SpotRatio)
+		evtNodes, err = a.addMultipleNodes(evt, nodes, sResult.ToAdd, spotCount)
 		if err != nil {
 			if len(evtNodes) == 0 {
 				retErr = err
@@ -285,7 +300,14 @@ func (a *autoScaleConfig) rebalanceIfNeeded(evt *event.Event, pool string, nodes
 	rebalanceFilter := map[string]string{poolMetadataName: pool}
 	if !sResult.ToRebalance {
 		// No action yet, check if we need rebalance
-		_, gap, err := a.provisioner.containerGapInNodes(nodes)
+		strategy, err := strategyForPool(pool)
+		if err != nil {
+			return fmt.Errorf("unable to load scheduler strategy for pool %q: %s", pool, err)
+		}
+		counts, err := a.provisioner.containerCountsInNodes(nodes)
+		if err != nil {
+			return fmt.Errorf("couldn't find containers from nodes: %s", err)
+		}
 		buf := safe.NewBuffer(nil)
 		dryProvisioner, err := a.provisioner.rebalanceContainersByFilter(buf, nil, rebalanceFilter, true)
 		if err != nil {
@@ -294,14 +316,14 @@ func (a *autoScaleConfig) rebalanceIfNeeded(evt *event.Event, pool string, nodes
 		if dryProvisioner == nil {
 			return nil
 		}
-		_, gapAfter, err := dryProvisioner.containerGapInNodes(nodes)
+		countsAfter, err := dryProvisioner.containerCountsInNodes(nodes)
 		if err != nil {
 			return fmt.Errorf("couldn't find containers from rebalanced nodes: %s", err)
 		}
-		if math.Abs((float64)(gap-gapAfter)) > 2.0 {
+		if reason := strategy.rebalanceReason(counts, countsAfter); reason != "" {
 			sResult.ToRebalance = true
 			if sResult.Reason == "" {
-				sResult.Reason = fmt.Sprintf("gap is %d, after rebalance gap will be %d", gap, gapAfter)
+				sResult.Reason = reason
 			}
 		}
 	}
@@ -317,21 +339,50 @@ func (a *autoScaleConfig) rebalanceIfNeeded(evt *event.Event, pool string, nodes
 	return nil
 }
 
-func (a *autoScaleConfig) addMultipleNodes(evt *event.Event, modelNodes []*cluster.Node, count int) ([]cluster.Node, error) {
+// spotNodesToAdd returns how many of the count nodes being added to the pool
+// must be spot instances so the fraction of spot nodes in the pool gets as
+// close as possible to the given ratio without exceeding it.
+func spotNodesToAdd(nodes []*cluster.Node, count int, ratio float32) int {
+	if ratio <= 0 {
+		return 0
+	}
+	var spotCount int
+	for _, n := range nodes {
+		if isSpotNode(n) {
+			spotCount++
+		}
+	}
+	total := float64(len(nodes) + count)
+	toAdd := int(math.Floor(float64(ratio)*total+1e-6)) - spotCount
+	if toAdd < 0 {
+		return 0
+	}
+	if toAdd > count {
+		return count
+	}
+	return toAdd
+}
+
+func isSpotNode(n *cluster.Node) bool {
+	spot, _ := strconv.ParseBool(n.Metadata[spotMetadataName])
+	return spot
+}
+
+func (a *autoScaleConfig) addMultipleNodes(evt *event.Event, modelNodes []*cluster.Node, count, spotCount int) ([]cluster.Node, error) {
 	wg := sync.WaitGroup{}
 	wg.Add(count)
 	nodesCh := make(chan *cluster.Node, count)
 	errCh := make(chan error, count)
 	for i := 0; i < count; i++ {
-		go func() {
+		go func(spot bool) {
 			defer wg.Done()
-			node, err := a.addNode(evt, modelNodes)
+			node, err := a.addNode(evt, modelNodes, spot)
 			if err != nil {
 				errCh <- err
 				return
 			}
 			nodesCh <- node
-		}()
+		}(i < spotCount)
 	}
 	wg.Wait()
 	close(nodesCh)
@@ -343,7 +394,7 @@ func (a *autoScaleConfig) addMultipleNodes(evt *event.Event, modelNodes []*clust
 	return nodes, <-errCh
 }
 
-func (a *autoScaleConfig) addNode(evt *event.Event, modelNodes []*cluster.Node) (*cluster.Node, error) {
+func (a *autoScaleConfig) addNode(evt *event.Event, modelNodes []*cluster.Node, spot bool) (*cluster.Node, error) {
 	metadata, err := chooseMetadataFromNodes(modelNodes)
 	if err != nil {
 		return nil, err
@@ -352,7 +403,21 @@ func (a *autoScaleConfig) addNode(evt *event.Event, modelNodes []*cluster.Node)
 	if !hasIaas {
 		return nil, fmt.Errorf("no IaaS information in nodes metadata: %#v", metadata)
 	}
-	machine, err := iaas.CreateMachineForIaaS(metadata["iaas"], metadata)
+	var machine *iaas.Machine
+	if spot {
+		metadata[spotMetadataName] = "true"
+		machine, err = iaas.CreateMachineForIaaS(metadata["iaas"], metadata)
+		if err != nil {
+			evt.Logf("unable to create spot machine, creating an on-demand one: %s", err)
+			delete(metadata, spotMetadataName)
+		} else if !machine.Spot {
+			evt.Logf("IaaS %q does not support spot machines, created an on-demand one", metadata["iaas"])
+			delete(metadata, spotMetadataName)
+		}
+	}
+	if machine == nil {
+		machine, err = iaas.CreateMachineForIaaS(metadata["iaas"], metadata)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to create machine: %s", err.Error())
 	}
@@ -488,8 +553,9 @@ func canRemoveNode(chosenNode *cluster.Node, nodes []*cluster.Node) (bool, error
 func cleanMetadata(n *cluster.Node) map[string]string {
 	// iaas-id is ignored because it wasn't created in previous tsuru versions
 	// and having nodes with and without it would cause unbalanced metadata
-	// errors.
-	ignoredMetadata := []string{"iaas-id"}
+	// errors. spot is ignored because pools mix spot and on-demand nodes, its
+	// value is chosen by the rule spot ratio.
+	ignoredMetadata := []string{"iaas-id", spotMetadataName}
 	metadata := n.CleanMetadata()
 	for _, val := range ignoredMetadata {
 		delete(metadata, val)
@@ -595,6 +661,20 @@ func (p *dockerProvisioner) runningContainersByNode(nodes []*cluster.Node) (map[
 	return result, nil
 }
 
+// containerCountsInNodes returns the number of running containers in each of
+// the given nodes.
+func (p *dockerProvisioner) containerCountsInNodes(nodes []*cluster.Node) ([]int, error) {
+	containersMap, err := p.runningContainersByNode(nodes)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int, 0, len(nodes))
+	for _, n := range nodes {
+		counts = append(counts, len(containersMap[n.Address]))
+	}
+	return counts, nil
+}
+
 func (p *dockerProvisioner) containerGapInNodes(nodes []*cluster.Node) (int, int, error) {
 	maxCount := 0
 	minCount := -1
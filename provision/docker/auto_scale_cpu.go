@@ -0,0 +1,146 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+)
+
+type cpuScaler struct {
+	*autoScaleConfig
+	rule *autoScaleRule
+}
+
+type nodeCPUData struct {
+	node      *cluster.Node
+	maxCPU    float64
+	reserved  float64
+	available float64
+}
+
+func (a *cpuScaler) nodesCPUData(nodes []*cluster.Node) (map[string]*nodeCPUData, error) {
+	nodesCPUData := make(map[string]*nodeCPUData)
+	containersMap, err := a.provisioner.runningContainersByNode(nodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		totalCPU, _ := strconv.ParseFloat(node.Metadata[a.TotalCPUMetadata], 64)
+		if totalCPU == 0.0 {
+			return nil, fmt.Errorf("no value found for cpu metadata (%s) in node %s", a.TotalCPUMetadata, node.Address)
+		}
+		data := &nodeCPUData{
+			node:   node,
+			maxCPU: float64(a.rule.MaxCPURatio) * totalCPU,
+		}
+		nodesCPUData[node.Address] = data
+		for _, cont := range containersMap[node.Address] {
+			a, err := app.GetByName(cont.AppName)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't find container app (%s): %s", cont.AppName, err)
+			}
+			data.reserved += a.PlanForProcess(cont.ProcessName).CpuLimit
+		}
+		data.available = data.maxCPU - data.reserved
+	}
+	return nodesCPUData, nil
+}
+
+func (a *cpuScaler) scale(groupMetadata string, nodes []*cluster.Node) (*scalerResult, error) {
+	plans, err := app.PlansList()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list plans: %s", err)
+	}
+	var maxPlanCPU float64
+	for _, plan := range plans {
+		if plan.CpuLimit > maxPlanCPU {
+			maxPlanCPU = plan.CpuLimit
+		}
+	}
+	if maxPlanCPU == 0 {
+		return &scalerResult{}, nil
+	}
+	cpuData, err := a.nodesCPUData(nodes)
+	if err != nil {
+		return nil, err
+	}
+	var totalReserved, totalCPU float64
+	canFitMax := false
+	for _, node := range nodes {
+		data := cpuData[node.Address]
+		if maxPlanCPU > data.maxCPU {
+			return nil, fmt.Errorf("aborting, impossible to fit max plan cpu limit of %0.4f CPUs, node max available cpu is %0.4f", maxPlanCPU, data.maxCPU)
+		}
+		totalReserved += data.reserved
+		totalCPU += data.maxCPU
+		if data.available >= maxPlanCPU {
+			canFitMax = true
+		}
+	}
+	cpuPerNode := totalCPU / float64(len(nodes))
+	scaledMaxPlan := maxPlanCPU * float64(a.rule.ScaleDownRatio)
+	toRemoveCount := len(nodes) - int(math.Floor((totalReserved+scaledMaxPlan)/cpuPerNode)+1)
+	if toRemoveCount > 0 {
+		chosenNodes := chooseNodeForRemoval(nodes, toRemoveCount)
+		if len(chosenNodes) > 0 {
+			return &scalerResult{
+				ToRemove: chosenNodes,
+				Reason:   fmt.Sprintf("containers can be distributed in only %d nodes", len(nodes)-len(chosenNodes)),
+			}, nil
+		}
+	}
+	if canFitMax {
+		return &scalerResult{}, nil
+	}
+	nodesToAdd := int((totalReserved + maxPlanCPU) / totalCPU)
+	if nodesToAdd == 0 {
+		return &scalerResult{}, nil
+	}
+	return &scalerResult{
+		ToAdd:  nodesToAdd,
+		Reason: fmt.Sprintf("can't add %0.4f CPUs to an existing node", maxPlanCPU),
+	}, nil
+}
+
+// reservationScaler combines the scalers of each reserved resource, adding
+// nodes when any of them needs more nodes and removing nodes only when all of
+// them agree that nodes can be removed.
+type reservationScaler struct {
+	scalers []autoScaler
+}
+
+func (a *reservationScaler) scale(groupMetadata string, nodes []*cluster.Node) (*scalerResult, error) {
+	var toAdd, toRemove *scalerResult
+	for _, scaler := range a.scalers {
+		// scalers may reorder the nodes slice when choosing nodes for
+		// removal, each one gets its own copy.
+		nodesCopy := make([]*cluster.Node, len(nodes))
+		copy(nodesCopy, nodes)
+		result, err := scaler.scale(groupMetadata, nodesCopy)
+		if err != nil {
+			return nil, err
+		}
+		if result.ToAdd > 0 && (toAdd == nil || result.ToAdd > toAdd.ToAdd) {
+			toAdd = result
+		}
+		if len(result.ToRemove) == 0 {
+			toRemove = &scalerResult{}
+		} else if toRemove == nil || len(result.ToRemove) < len(toRemove.ToRemove) {
+			toRemove = result
+		}
+	}
+	if toAdd != nil {
+		return toAdd, nil
+	}
+	if toRemove != nil && len(toRemove.ToRemove) > 0 {
+		return toRemove, nil
+	}
+	return &scalerResult{}, nil
+}
@@ -48,8 +48,9 @@ func (a *memoryScaler) nodesMemoryData(nodes []*cluster.Node) (map[string]*nodeM
 			if err != nil {
 				return nil, fmt.Errorf("couldn't find container app (%s): %s", cont.AppName, err)
 			}
-			data.containersMemory[cont.ID] = a.Plan.Memory
-			data.reserved += a.Plan.Memory
+			memory := a.PlanForProcess(cont.ProcessName).Memory
+			data.containersMemory[cont.ID] = memory
+			data.reserved += memory
 		}
 		data.available = data.maxMemory - data.reserved
 	}
@@ -20,8 +20,12 @@ type autoScaleRule struct {
 	MaxContainerCount int
 	ScaleDownRatio    float32
 	MaxMemoryRatio    float32
+	MaxCPURatio       float32
 	Enabled           bool
 	PreventRebalance  bool
+	// SpotRatio is the fraction of the nodes in the pool that should be
+	// created as spot (or preemptible) instances when scaling up.
+	SpotRatio float32
 }
 
 type autoScaleRuleList []autoScaleRule
@@ -38,12 +42,24 @@ func (r *autoScaleRule) normalize() error {
 		r.Error = err.Error()
 		return err
 	}
+	if r.SpotRatio < 0.0 || r.SpotRatio > 1.0 {
+		err := fmt.Errorf("invalid rule, spot ratio needs to be between 0.0 and 1.0, got %f", r.SpotRatio)
+		r.Error = err.Error()
+		return err
+	}
 	if r.MaxMemoryRatio == 0.0 {
 		maxMemoryRatio, _ := config.GetFloat("docker:scheduler:max-used-memory")
 		r.MaxMemoryRatio = float32(maxMemoryRatio)
 	}
+	if r.MaxCPURatio == 0.0 {
+		maxCPURatio, _ := config.GetFloat("docker:scheduler:max-used-cpu")
+		r.MaxCPURatio = float32(maxCPURatio)
+	}
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
-	if r.Enabled && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
+	TotalCPUMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
+	hasMemory := TotalMemoryMetadata != "" && r.MaxMemoryRatio > 0
+	hasCPU := TotalCPUMetadata != "" && r.MaxCPURatio > 0
+	if r.Enabled && r.MaxContainerCount <= 0 && !hasMemory && !hasCPU {
 		err := fmt.Errorf("invalid rule, either memory information or max container count must be set")
 		r.Error = err.Error()
 		return err
@@ -1197,6 +1197,88 @@ func (s *AutoScaleSuite) TestAutoScaleConfigRunMemoryBasedLockedApp(c *check.C)
 	c.Assert(evts, check.HasLen, 0)
 }
 
+func (s *AutoScaleSuite) TestAutoScaleConfigRunSpotRatio(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	iaas.RegisterIaasProvider("my-scale-iaas", func(string) iaas.IaaS {
+		return &dockertest.TestHealerIaaS{
+			Addrs:         []string{"localhost", "[::1]"},
+			Ports:         []int{dockertest.URLPort(s.node2.URL()), dockertest.URLPort(s.node3.URL())},
+			SpotSupported: true,
+		}
+	})
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(autoScaleRule{
+		MetadataFilter:    "pool1",
+		Enabled:           true,
+		MaxContainerCount: 2,
+		ScaleDownRatio:    1.333,
+		SpotRatio:         0.5,
+	})
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	newAddr := fmt.Sprintf("http://localhost:%d", dockertest.URLPort(s.node2.URL()))
+	for _, n := range nodes {
+		c.Assert(isSpotNode(&n), check.Equals, n.Address == newAddr)
+	}
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].CreationParams["spot"], check.Equals, "true")
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigRunSpotRatioNotSupportedByIaaS(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(autoScaleRule{
+		MetadataFilter:    "pool1",
+		Enabled:           true,
+		MaxContainerCount: 2,
+		ScaleDownRatio:    1.333,
+		SpotRatio:         0.5,
+	})
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	for _, n := range nodes {
+		c.Assert(isSpotNode(&n), check.Equals, false)
+	}
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Spot, check.Equals, false)
+}
+
 func (s *AutoScaleSuite) TestAutoScaleConfigRunOnceRulesPerPool(c *check.C) {
 	config.Set("docker:scheduler:total-memory-metadata", "totalMem")
 	defer config.Unset("docker:scheduler:total-memory-metadata")
@@ -1537,3 +1619,89 @@ func (s *S) TestChooseMetadataFromNodes(c *check.C) {
 	_, err = chooseMetadataFromNodes(nodes)
 	c.Assert(err, check.ErrorMatches, "unbalanced metadata for node group:.*")
 }
+
+func (s *S) TestSpotNodesToAdd(c *check.C) {
+	spot := &cluster.Node{Metadata: map[string]string{"pool": "pool1", "spot": "true"}}
+	onDemand := &cluster.Node{Metadata: map[string]string{"pool": "pool1"}}
+	tests := []struct {
+		nodes    []*cluster.Node
+		count    int
+		ratio    float32
+		expected int
+	}{
+		{nodes: []*cluster.Node{onDemand}, count: 1, ratio: 0, expected: 0},
+		{nodes: []*cluster.Node{onDemand}, count: 1, ratio: 0.5, expected: 1},
+		{nodes: []*cluster.Node{onDemand, spot}, count: 1, ratio: 0.5, expected: 0},
+		{nodes: []*cluster.Node{onDemand, onDemand, onDemand}, count: 7, ratio: 0.3, expected: 3},
+		{nodes: []*cluster.Node{onDemand, onDemand, onDemand}, count: 7, ratio: 0.7, expected: 7},
+		{nodes: []*cluster.Node{spot, spot, spot}, count: 1, ratio: 0.3, expected: 0},
+		{nodes: []*cluster.Node{onDemand}, count: 2, ratio: 1, expected: 2},
+	}
+	for i, tt := range tests {
+		c.Check(spotNodesToAdd(tt.nodes, tt.count, tt.ratio), check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestSplitMetadataIgnoresSpot(c *check.C) {
+	nodes := []*cluster.Node{
+		{Metadata: map[string]string{"pool": "pool1", "zone": "zone1", "spot": "true"}},
+		{Metadata: map[string]string{"pool": "pool1", "zone": "zone1"}},
+	}
+	metadata, err := chooseMetadataFromNodes(nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(metadata, check.DeepEquals, map[string]string{
+		"pool": "pool1",
+		"zone": "zone1",
+	})
+}
+
+type fixedScaler struct {
+	result *scalerResult
+}
+
+func (f *fixedScaler) scale(pool string, nodes []*cluster.Node) (*scalerResult, error) {
+	return f.result, nil
+}
+
+func (s *S) TestReservationScalerScale(c *check.C) {
+	node1 := cluster.Node{Address: "http://n1:2375"}
+	node2 := cluster.Node{Address: "http://n2:2375"}
+	nodes := []*cluster.Node{&node1, &node2}
+	scaler := reservationScaler{scalers: []autoScaler{
+		&fixedScaler{&scalerResult{ToAdd: 1, Reason: "memory"}},
+		&fixedScaler{&scalerResult{ToAdd: 2, Reason: "cpu"}},
+	}}
+	result, err := scaler.scale("pool1", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToAdd: 2, Reason: "cpu"})
+	scaler = reservationScaler{scalers: []autoScaler{
+		&fixedScaler{&scalerResult{ToRemove: []cluster.Node{node1, node2}, Reason: "memory"}},
+		&fixedScaler{&scalerResult{ToRemove: []cluster.Node{node1}, Reason: "cpu"}},
+	}}
+	result, err = scaler.scale("pool1", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToRemove: []cluster.Node{node1}, Reason: "cpu"})
+	scaler = reservationScaler{scalers: []autoScaler{
+		&fixedScaler{&scalerResult{ToRemove: []cluster.Node{node1}, Reason: "memory"}},
+		&fixedScaler{&scalerResult{}},
+	}}
+	result, err = scaler.scale("pool1", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{})
+}
+
+func (s *S) TestScalerForRuleWithCPU(c *check.C) {
+	conf := autoScaleConfig{TotalMemoryMetadata: "totalMemory", TotalCPUMetadata: "totalCPU"}
+	scaler, err := conf.scalerForRule(&autoScaleRule{MaxMemoryRatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &memoryScaler{})
+	scaler, err = conf.scalerForRule(&autoScaleRule{MaxCPURatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &cpuScaler{})
+	scaler, err = conf.scalerForRule(&autoScaleRule{MaxMemoryRatio: 0.8, MaxCPURatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &reservationScaler{})
+	scaler, err = conf.scalerForRule(&autoScaleRule{MaxContainerCount: 10, MaxCPURatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &countScaler{})
+}
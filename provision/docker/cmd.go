@@ -110,20 +110,26 @@ func (a *addNodeToSchedulerCmd) Flags() *gnuflag.FlagSet {
 }
 
 type updateNodeToSchedulerCmd struct {
-	fs      *gnuflag.FlagSet
-	disable bool
-	enable  bool
+	fs          *gnuflag.FlagSet
+	disable     bool
+	enable      bool
+	maintenance bool
 }
 
 func (updateNodeToSchedulerCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-node-update",
-		Usage: "docker-node-update <address> [param_name=param_value...] [--disable] [--enable]",
+		Usage: "docker-node-update <address> [param_name=param_value...] [--disable] [--enable] [--maintenance]",
 		Desc: `Modifies metadata associated to a docker node. If a parameter is set to an
 empty value, it will be removed from the node's metadata.
 
 If the [[--disable]] flag is used, the node will be marked as disabled and the
-scheduler won't consider it when selecting a node to receive containers.`,
+scheduler won't consider it when selecting a node to receive containers.
+
+If the [[--maintenance]] flag is used, the node will be put under maintenance:
+the scheduler won't select it to receive containers, but the containers
+running in it are kept there until the node is drained with [[docker-node-
+drain]]. Use [[--enable]] to bring the node back.`,
 		MinArgs: 1,
 	}
 }
@@ -133,16 +139,18 @@ func (a *updateNodeToSchedulerCmd) Flags() *gnuflag.FlagSet {
 		a.fs = gnuflag.NewFlagSet("", gnuflag.ExitOnError)
 		a.fs.BoolVar(&a.disable, "disable", false, "Disable node in scheduler.")
 		a.fs.BoolVar(&a.enable, "enable", false, "Enable node in scheduler.")
+		a.fs.BoolVar(&a.maintenance, "maintenance", false, "Put node under maintenance.")
 	}
 	return a.fs
 }
 
 func (a *updateNodeToSchedulerCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
 	opts := updateNodeOptions{
-		Address:  ctx.Args[0],
-		Disable:  a.disable,
-		Enable:   a.enable,
-		Metadata: map[string]string{},
+		Address:     ctx.Args[0],
+		Disable:     a.disable,
+		Enable:      a.enable,
+		Maintenance: a.maintenance,
+		Metadata:    map[string]string{},
 	}
 	for _, param := range ctx.Args[1:] {
 		if strings.Contains(param, "=") {
@@ -232,6 +240,70 @@ func (c *removeNodeFromSchedulerCmd) Flags() *gnuflag.FlagSet {
 	return c.fs
 }
 
+type drainNodeCmd struct {
+	cmd.ConfirmationCommand
+	fs           *gnuflag.FlagSet
+	minAvailable int
+}
+
+func (c *drainNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-drain",
+		Usage: "docker-node-drain <address> [--min-available <units>] [-y]",
+		Desc: `Puts a node under maintenance and moves all its containers to other nodes.
+
+Containers are moved app by app, in batches that keep at least [[--min-
+available]] units of each app running in other nodes while the containers are
+recreated. Defaults to 1.
+
+The drain is tracked as an event, and may be stopped using [[tsuru event-
+cancel]]. The node is kept under maintenance after the drain, use [[docker-
+node-update <address> --enable]] to bring it back.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *drainNodeCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.ConfirmationCommand.Flags()
+		c.fs.IntVar(&c.minAvailable, "min-available", 1, "Minimum number of units of each app kept available during the drain.")
+	}
+	return c.fs
+}
+
+func (c *drainNodeCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to drain node %q?", context.Args[0])) {
+		return nil
+	}
+	u, err := cmd.GetURL(fmt.Sprintf("/docker/node/%s/drain", context.Args[0]))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("min-available", strconv.Itoa(c.minAvailable))
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	w := tsuruIo.NewStreamWriter(context.Stdout, nil)
+	for n := int64(1); n > 0 && err == nil; n, err = io.Copy(w, response.Body) {
+	}
+	if err != nil {
+		return err
+	}
+	unparsed := w.Remaining()
+	if len(unparsed) > 0 {
+		return fmt.Errorf("unparsed message error: %s", string(unparsed))
+	}
+	return nil
+}
+
 type listNodesInTheSchedulerCmd struct {
 	fs         *gnuflag.FlagSet
 	filter     cmd.MapFlag
@@ -546,8 +618,10 @@ func (c *autoScaleInfoCmd) render(context *cmd.Context, config *autoScaleConfig,
 		"Pool",
 		"Max container count",
 		"Max memory ratio",
+		"Max cpu ratio",
 		"Scale down ratio",
 		"Rebalance on scale",
+		"Spot ratio",
 		"Enabled",
 	}
 	table.Headers = tableHeader
@@ -556,8 +630,10 @@ func (c *autoScaleInfoCmd) render(context *cmd.Context, config *autoScaleConfig,
 			rule.MetadataFilter,
 			strconv.Itoa(rule.MaxContainerCount),
 			strconv.FormatFloat(float64(rule.MaxMemoryRatio), 'f', 4, 32),
+			strconv.FormatFloat(float64(rule.MaxCPURatio), 'f', 4, 32),
 			strconv.FormatFloat(float64(rule.ScaleDownRatio), 'f', 4, 32),
 			strconv.FormatBool(!rule.PreventRebalance),
+			strconv.FormatFloat(float64(rule.SpotRatio), 'f', 4, 32),
 			strconv.FormatBool(rule.Enabled),
 		})
 	}
@@ -570,8 +646,10 @@ type autoScaleSetRuleCmd struct {
 	filterValue        string
 	maxContainerCount  int
 	maxMemoryRatio     float64
+	maxCPURatio        float64
 	scaleDownRatio     float64
 	noRebalanceOnScale bool
+	spotRatio          float64
 	enable             bool
 	disable            bool
 }
@@ -579,8 +657,8 @@ type autoScaleSetRuleCmd struct {
 func (c *autoScaleSetRuleCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-autoscale-rule-set",
-		Usage: "docker-autoscale-rule-set [-f/--filter-value <pool name>] [-c/--max-container-count 0] [-m/--max-memory-ratio 0.9] [-d/--scale-down-ratio 1.33] [--no-rebalance-on-scale] [--enable] [--disable]",
-		Desc:  "Creates or update an auto-scale rule. Using resources limitation (amount of container or memory usage).",
+		Usage: "docker-autoscale-rule-set [-f/--filter-value <pool name>] [-c/--max-container-count 0] [-m/--max-memory-ratio 0.9] [--max-cpu-ratio 0.9] [-d/--scale-down-ratio 1.33] [--no-rebalance-on-scale] [--spot-ratio 0.3] [--enable] [--disable]",
+		Desc:  "Creates or update an auto-scale rule. Using resources limitation (amount of container, memory or cpu usage).",
 	}
 }
 
@@ -592,8 +670,10 @@ func (c *autoScaleSetRuleCmd) Run(context *cmd.Context, client *cmd.Client) erro
 		MetadataFilter:    c.filterValue,
 		MaxContainerCount: c.maxContainerCount,
 		MaxMemoryRatio:    float32(c.maxMemoryRatio),
+		MaxCPURatio:       float32(c.maxCPURatio),
 		ScaleDownRatio:    float32(c.scaleDownRatio),
 		PreventRebalance:  c.noRebalanceOnScale,
+		SpotRatio:         float32(c.spotRatio),
 		Enabled:           c.enable,
 	}
 	val, err := form.EncodeToValues(rule)
@@ -630,11 +710,15 @@ func (c *autoScaleSetRuleCmd) Flags() *gnuflag.FlagSet {
 		msg = "The maximum memory usage per node. 0 means no limit, 1 means 100%. It is fine to use values greater than 1, which means that tsuru will overcommit memory in Docker nodes. Keep in mind that container count has higher precedence than memory ratio, so if --max-container-count is defined, the value of --max-memory-ratio will be ignored."
 		c.fs.Float64Var(&c.maxMemoryRatio, "max-memory-ratio", .0, msg)
 		c.fs.Float64Var(&c.maxMemoryRatio, "m", .0, msg)
+		msg = "The maximum cpu reservation per node, based on the cpu limit of the plans. 0 means no limit, 1 means 100%. Memory and cpu ratios may be used together, in which case new nodes are added when any of them is reached. As with memory, container count has higher precedence, so if --max-container-count is defined, the value of --max-cpu-ratio will be ignored."
+		c.fs.Float64Var(&c.maxCPURatio, "max-cpu-ratio", .0, msg)
 		msg = "The ratio for triggering an scale down event. The default value is 1.33, which mean that whenever it gets one third of the resource utilization (memory ratio or container count)."
 		c.fs.Float64Var(&c.scaleDownRatio, "scale-down-ratio", 1.33, msg)
 		c.fs.Float64Var(&c.scaleDownRatio, "d", 1.33, msg)
 		msg = "A boolean flag indicating whether containers should NOT be rebalanced after running an scale. The default behavior is to always rebalance the containers."
 		c.fs.BoolVar(&c.noRebalanceOnScale, "no-rebalance-on-scale", false, msg)
+		msg = "The fraction of nodes in the pool that should be spot (or preemptible) instances, from 0 to 1. New nodes are created as spot instances until this fraction is reached, falling back to on-demand instances when the IaaS is unable to create spot ones. The default value is 0, which means no spot instances."
+		c.fs.Float64Var(&c.spotRatio, "spot-ratio", .0, msg)
 		msg = "A boolean flag indicating whether the rule should be enabled"
 		c.fs.BoolVar(&c.enable, "enable", false, msg)
 		msg = "A boolean flag indicating whether the rule should be disabled"
@@ -830,3 +914,113 @@ func (c *dockerLogInfo) Run(context *cmd.Context, client *cmd.Client) error {
 	}
 	return nil
 }
+
+type schedulerUpdate struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *schedulerUpdate) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		desc := "Pool name where the strategy will be used."
+		c.fs.StringVar(&c.pool, "pool", "", desc)
+		c.fs.StringVar(&c.pool, "p", "", desc)
+	}
+	return c.fs
+}
+
+func (c *schedulerUpdate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-scheduler-update",
+		Usage: "docker-scheduler-update [-p/--pool poolname] <strategy>",
+		Desc: `Set the strategy used by the scheduler to choose the node where units are
+added and removed. Node auto scaling also uses the strategy to decide whether
+units should be rebalanced.
+
+Available strategies are:
+
+  spread: units of each app process are evenly distributed among nodes. This
+is the default strategy.
+
+  binpack: units are added to the nodes with most units first, keeping the
+other nodes empty so they can be removed by node auto scaling. Nodes capacity
+is given by the scheduler memory limits.
+
+  random: units are added to random nodes.
+
+If --pool is specified the strategy will only be used on nodes of the chosen
+pool.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *schedulerUpdate) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/scheduler")
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Set("strategy", context.Args[0])
+	values.Set("pool", c.pool)
+	request, err := http.NewRequest("POST", u, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Scheduler config successfully updated.")
+	return nil
+}
+
+type schedulerInfo struct{}
+
+func (c *schedulerInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-scheduler-info",
+		Usage:   "docker-scheduler-info",
+		Desc:    "Prints the strategy used by the scheduler in each pool.",
+		MinArgs: 0,
+	}
+}
+
+func (c *schedulerInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/scheduler")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var conf map[string]SchedulerConfig
+	err = json.NewDecoder(response.Body).Decode(&conf)
+	if err != nil {
+		return err
+	}
+	t := cmd.Table{Headers: cmd.Row([]string{"Pool", "Strategy"})}
+	baseStrategy := conf[""].Strategy
+	if baseStrategy == "" {
+		baseStrategy = defaultSchedulerStrategy
+	}
+	t.AddRow(cmd.Row([]string{"<default>", baseStrategy}))
+	delete(conf, "")
+	poolNames := make([]string, 0, len(conf))
+	for poolName := range conf {
+		poolNames = append(poolNames, poolName)
+	}
+	sort.Strings(poolNames)
+	for _, poolName := range poolNames {
+		t.AddRow(cmd.Row([]string{poolName, conf[poolName].Strategy}))
+	}
+	context.Stdout.Write(t.Bytes())
+	return nil
+}
@@ -102,6 +102,28 @@ func (s *S) TestRemoveNodeFromTheSchedulerCmdRun(c *check.C) {
 	c.Assert(buf.String(), check.Equals, "Node successfully removed.\n")
 }
 
+func (s *S) TestDrainNodeCmdRun(c *check.C) {
+	var stdout bytes.Buffer
+	msg, _ := json.Marshal(tsuruIo.SimpleJsonMessage{Message: "Node drained successfully!\n"})
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &stdout}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			url := strings.HasSuffix(req.URL.Path, "/1.0/docker/node/http://localhost:8080/drain")
+			method := req.Method == "POST"
+			req.ParseForm()
+			return url && method && req.Form.Get("min-available") == "2"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := drainNodeCmd{}
+	cmd.Flags().Parse(true, []string{"-y", "--min-available", "2"})
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Node drained successfully!\n")
+}
+
 func (s *S) TestRemoveNodeFromTheSchedulerWithDestroyCmdRun(c *check.C) {
 	var buf bytes.Buffer
 	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
@@ -486,6 +508,8 @@ func (s *S) TestAutoScaleInfoCmdRun(c *check.C) {
 		"ScaleDownRatio":1.33,
 		"PreventRebalance":true,
 		"MaxMemoryRatio":0.9,
+		"MaxCPURatio":0.8,
+		"SpotRatio":0.3,
 		"Error": ""
 	},
 	{
@@ -516,13 +540,13 @@ func (s *S) TestAutoScaleInfoCmdRun(c *check.C) {
 	err := command.Run(&context, client)
 	c.Assert(err, check.IsNil)
 	expected := `Rules:
-+-------+---------------------+------------------+------------------+--------------------+---------+
-| Pool  | Max container count | Max memory ratio | Scale down ratio | Rebalance on scale | Enabled |
-+-------+---------------------+------------------+------------------+--------------------+---------+
-| pool1 | 6                   | 1.2000           | 1.3300           | true               | true    |
-| pool2 | 13                  | 0.9000           | 1.3300           | false              | true    |
-| pool3 | 50                  | 1.2000           | 1.3300           | true               | false   |
-+-------+---------------------+------------------+------------------+--------------------+---------+
++-------+---------------------+------------------+---------------+------------------+--------------------+------------+---------+
+| Pool  | Max container count | Max memory ratio | Max cpu ratio | Scale down ratio | Rebalance on scale | Spot ratio | Enabled |
++-------+---------------------+------------------+---------------+------------------+--------------------+------------+---------+
+| pool1 | 6                   | 1.2000           | 0.0000        | 1.3300           | true               | 0.0000     | true    |
+| pool2 | 13                  | 0.9000           | 0.8000        | 1.3300           | false              | 0.3000     | true    |
+| pool3 | 50                  | 1.2000           | 0.0000        | 1.3300           | true               | 0.0000     | false   |
++-------+---------------------+------------------+---------------+------------------+--------------------+------------+---------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
 	c.Assert(calls, check.Equals, 2)
@@ -585,6 +609,76 @@ func (s *S) TestAutoScaleSetRuleCmdRun(c *check.C) {
 	c.Assert(buf.String(), check.Equals, "Rule successfully defined.\n")
 }
 
+func (s *S) TestAutoScaleSetRuleCmdRunWithSpotRatio(c *check.C) {
+	var called bool
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			err := req.ParseForm()
+			c.Assert(err, check.IsNil)
+			var rule autoScaleRule
+			err = form.DecodeValues(&rule, req.Form)
+			c.Assert(err, check.IsNil)
+			c.Assert(rule, check.DeepEquals, autoScaleRule{
+				MetadataFilter:    "pool1",
+				Enabled:           true,
+				MaxContainerCount: 10,
+				ScaleDownRatio:    1.33,
+				SpotRatio:         0.3,
+			})
+			return req.Method == "POST" && req.URL.Path == "/1.0/docker/autoscale/rules"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleSetRuleCmd
+	flags := []string{"-f", "pool1", "-c", "10", "--spot-ratio", "0.3", "--enable"}
+	err := command.Flags().Parse(true, flags)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(called, check.Equals, true)
+	c.Assert(buf.String(), check.Equals, "Rule successfully defined.\n")
+}
+
+func (s *S) TestAutoScaleSetRuleCmdRunWithCPURatio(c *check.C) {
+	var called bool
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			err := req.ParseForm()
+			c.Assert(err, check.IsNil)
+			var rule autoScaleRule
+			err = form.DecodeValues(&rule, req.Form)
+			c.Assert(err, check.IsNil)
+			c.Assert(rule, check.DeepEquals, autoScaleRule{
+				MetadataFilter:    "pool1",
+				Enabled:           true,
+				MaxMemoryRatio:    0.9,
+				MaxCPURatio:       0.8,
+				ScaleDownRatio:    1.33,
+			})
+			return req.Method == "POST" && req.URL.Path == "/1.0/docker/autoscale/rules"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleSetRuleCmd
+	flags := []string{"-f", "pool1", "-m", "0.9", "--max-cpu-ratio", "0.8", "--enable"}
+	err := command.Flags().Parse(true, flags)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(called, check.Equals, true)
+	c.Assert(buf.String(), check.Equals, "Rule successfully defined.\n")
+}
+
 func (s *S) TestAutoScaleDeleteCmdRun(c *check.C) {
 	var called bool
 	transport := cmdtest.ConditionalTransport{
@@ -776,3 +870,53 @@ Log driver [pool p1]: x
 Log driver [pool p2]: bs
 `)
 }
+
+func (s *S) TestSchedulerUpdateRun(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{Args: []string{"binpack"}, Stdout: &stdout}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			return req.URL.Path == "/1.0/docker/scheduler" && req.Method == "POST" &&
+				req.Form.Get("strategy") == "binpack" && req.Form.Get("pool") == "p1"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := schedulerUpdate{}
+	cmd.Flags().Parse(true, []string{"--pool", "p1"})
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Scheduler config successfully updated.\n")
+}
+
+func (s *S) TestSchedulerInfoRun(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout}
+	conf := map[string]SchedulerConfig{
+		"":   {},
+		"p2": {Strategy: "random"},
+		"p1": {Strategy: "binpack"},
+	}
+	result, _ := json.Marshal(conf)
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/scheduler" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := schedulerInfo{}
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, `+-----------+----------+
+| Pool      | Strategy |
++-----------+----------+
+| <default> | spread   |
+| p1        | binpack  |
+| p2        | random   |
++-----------+----------+
+`)
+}
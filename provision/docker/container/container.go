@@ -5,6 +5,7 @@
 package container
 
 import (
+	"bytes"
 	"crypto"
 	"fmt"
 	"io"
@@ -25,6 +26,14 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+// cpuPeriod is the CFS period, in microseconds, used along with the quota to
+// enforce the cpu limit of the units.
+const cpuPeriod = 100000
+
+// defaultStopTimeout is the number of seconds docker waits for a container to
+// stop before killing it, when tsuru.yaml doesn't set a grace period.
+const defaultStopTimeout = 10
+
 func init() {
 	rand.Seed(time.Now().UTC().UnixNano())
 }
@@ -72,6 +81,20 @@ type Container struct {
 	LockedUntil             time.Time
 	Routable                bool `bson:"-"`
 	ExposedPort             string
+	Ports                   []ContainerPort             `bson:",omitempty"`
+	Shutdown                provision.TsuruYamlShutdown `bson:",omitempty"`
+}
+
+// ContainerPort is a port exposed by the container besides the HTTP one,
+// declared by its process in tsuru.yaml.
+type ContainerPort struct {
+	Port     int
+	Protocol string
+	HostPort string
+}
+
+func (p *ContainerPort) dockerPort() docker.Port {
+	return docker.Port(fmt.Sprintf("%d/%s", p.Port, p.Protocol))
 }
 
 func (c *Container) ShortID() string {
@@ -93,6 +116,15 @@ func (c *Container) Address() *url.URL {
 	}
 }
 
+// PortAddress returns the address of the given port in the host running the
+// container.
+func (c *Container) PortAddress(p ContainerPort) *url.URL {
+	return &url.URL{
+		Scheme: p.Protocol,
+		Host:   fmt.Sprintf("%s:%s", c.HostAddr, p.HostPort),
+	}
+}
+
 type CreateArgs struct {
 	ImageID          string
 	Commands         []string
@@ -102,6 +134,8 @@ type CreateArgs struct {
 	ProcessName      string
 	Deploy           bool
 	Building         bool
+	// Volumes are the binds mounting the persistent volumes of the app.
+	Volumes []string
 }
 
 func (c *Container) Create(args *CreateArgs) error {
@@ -119,6 +153,15 @@ func (c *Container) Create(args *CreateArgs) error {
 		exposedPorts = map[docker.Port]struct{}{
 			docker.Port(c.ExposedPort): {},
 		}
+		var ports []ContainerPort
+		for _, p := range c.Ports {
+			if p.dockerPort() == docker.Port(c.ExposedPort) {
+				continue
+			}
+			exposedPorts[p.dockerPort()] = struct{}{}
+			ports = append(ports, p)
+		}
+		c.Ports = ports
 	}
 	var user string
 	if args.Building {
@@ -136,6 +179,7 @@ func (c *Container) Create(args *CreateArgs) error {
 	if err != nil {
 		return err
 	}
+	hostConf.Binds = append(hostConf.Binds, args.Volumes...)
 	conf := docker.Config{
 		Image:        args.ImageID,
 		Cmd:          args.Commands,
@@ -149,6 +193,7 @@ func (c *Container) Create(args *CreateArgs) error {
 		CPUShares:    hostConf.CPUShares,
 		SecurityOpts: securityOpts,
 		User:         user,
+		StopSignal:   c.Shutdown.Signal,
 		Labels: map[string]string{
 			"tsuru.container":    strconv.FormatBool(true),
 			"tsuru.app.name":     args.App.GetName(),
@@ -158,7 +203,10 @@ func (c *Container) Create(args *CreateArgs) error {
 			"tsuru.router.type":  routerType,
 		},
 	}
-	c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	err = c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	if err != nil {
+		return err
+	}
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &conf, HostConfig: hostConf}
 	var nodeList []string
 	if len(args.DestinationHosts) > 0 {
@@ -201,9 +249,13 @@ func (c *Container) hostToNodeAddress(p DockerProvisioner, host string) (string,
 	return "", fmt.Errorf("Host `%s` not found", host)
 }
 
-func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) {
+func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) error {
 	if !args.Deploy {
-		for _, envData := range args.App.Envs() {
+		envs, err := args.App.Envs()
+		if err != nil {
+			return err
+		}
+		for _, envData := range envs {
 			cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", "TSURU_PROCESSNAME", c.ProcessName))
@@ -222,6 +274,7 @@ func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.C
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	return nil
 }
 
 func (c *Container) user() string {
@@ -235,6 +288,7 @@ func (c *Container) user() string {
 type NetworkInfo struct {
 	HTTPHostPort string
 	IP           string
+	Ports        []ContainerPort
 }
 
 func (c *Container) NetworkInfo(p DockerProvisioner) (NetworkInfo, error) {
@@ -252,6 +306,15 @@ func (c *Container) NetworkInfo(p DockerProvisioner) (NetworkInfo, error) {
 				break
 			}
 		}
+		for _, p := range c.Ports {
+			for _, port := range dockerContainer.NetworkSettings.Ports[p.dockerPort()] {
+				if port.HostPort != "" && port.HostIP != "" {
+					p.HostPort = port.HostPort
+					break
+				}
+			}
+			netInfo.Ports = append(netInfo.Ports, p)
+		}
 	}
 	return netInfo, err
 }
@@ -444,12 +507,7 @@ func (c *Container) Sleep(p DockerProvisioner) error {
 	if c.Status != provision.StatusStarted.String() && c.Status != provision.StatusStarting.String() {
 		return fmt.Errorf("container %s is not starting or started", c.ID)
 	}
-	done := p.ActionLimiter().Start(c.HostAddr)
-	err := p.Cluster().StopContainer(c.ID, 10)
-	done()
-	if err != nil {
-		log.Errorf("error on stop container %s: %s", c.ID, err)
-	}
+	c.stopContainer(p)
 	return c.SetStatus(p, provision.StatusAsleep, true)
 }
 
@@ -457,14 +515,53 @@ func (c *Container) Stop(p DockerProvisioner) error {
 	if c.Status == provision.StatusStopped.String() {
 		return nil
 	}
+	c.stopContainer(p)
+	c.SetStatus(p, provision.StatusStopped, true)
+	return nil
+}
+
+// stopContainer runs the pre stop command of the container and stops it,
+// waiting for the grace period of its shutdown before killing it.
+func (c *Container) stopContainer(p DockerProvisioner) {
+	timeout := time.Duration(c.Shutdown.GracePeriod) * time.Second
+	if timeout == 0 {
+		timeout = defaultStopTimeout * time.Second
+	}
+	timeout = c.runPreStop(p, timeout)
 	done := p.ActionLimiter().Start(c.HostAddr)
-	err := p.Cluster().StopContainer(c.ID, 10)
+	err := p.Cluster().StopContainer(c.ID, uint(timeout/time.Second))
 	done()
 	if err != nil {
 		log.Errorf("error on stop container %s: %s", c.ID, err)
 	}
-	c.SetStatus(p, provision.StatusStopped, true)
-	return nil
+}
+
+// runPreStop runs the pre stop command of the container, waiting for it up to
+// the given timeout. It returns how much of the timeout is left for the
+// container to stop after the signal.
+func (c *Container) runPreStop(p DockerProvisioner, timeout time.Duration) time.Duration {
+	if c.Shutdown.PreStop == "" {
+		return timeout
+	}
+	start := time.Now()
+	var buf bytes.Buffer
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Exec(p, &buf, &buf, c.Shutdown.PreStop)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.Errorf("error running pre stop command of container %s: %s - %s", c.ID, err, buf.String())
+		}
+	case <-time.After(timeout):
+		log.Errorf("pre stop command of container %s still running after %s", c.ID, timeout)
+	}
+	timeout -= time.Since(start)
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
 }
 
 type StartArgs struct {
@@ -478,17 +575,25 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 	sharedMount, _ := config.GetString("docker:sharedfs:mountpoint")
 	sharedIsolation, _ := config.GetBool("docker:sharedfs:app-isolation")
 	sharedSalt, _ := config.GetString("docker:sharedfs:salt")
+	resources := app.GetUnitResources(c.ProcessName)
 	hostConfig := docker.HostConfig{
-		CPUShares: int64(app.GetCpuShare()),
+		CPUShares: int64(resources.CpuShare),
 	}
 
 	if !isDeploy {
-		hostConfig.Memory = app.GetMemory()
-		hostConfig.MemorySwap = app.GetMemory() + app.GetSwap()
+		hostConfig.Memory = resources.Memory
+		hostConfig.MemorySwap = resources.Memory + resources.Swap
+		if resources.CpuLimit > 0 {
+			hostConfig.CPUPeriod = cpuPeriod
+			hostConfig.CPUQuota = int64(resources.CpuLimit * cpuPeriod)
+		}
 		hostConfig.RestartPolicy = docker.AlwaysRestart()
 		hostConfig.PortBindings = map[docker.Port][]docker.PortBinding{
 			docker.Port(c.ExposedPort): {{HostIP: "", HostPort: ""}},
 		}
+		for _, p := range c.Ports {
+			hostConfig.PortBindings[p.dockerPort()] = []docker.PortBinding{{HostIP: "", HostPort: ""}}
+		}
 		pool := app.GetPool()
 		driver, opts, logErr := LogOpts(pool)
 		if logErr != nil {
@@ -153,6 +153,166 @@ func (s *S) TestContainerCreate(c *check.C) {
 	c.Assert(cont.Status, check.Equals, "created")
 }
 
+func (s *S) TestContainerCreateCpuLimit(c *check.C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.CpuShare = 50
+	app.CpuLimit = 0.5
+	img := "tsuru/brainfuck:latest"
+	s.p.Cluster().PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "myprocess1",
+		ExposedPort: "8888/tcp",
+	}
+	err = cont.Create(&CreateArgs{
+		App:         app,
+		ImageID:     img,
+		Commands:    []string{"docker", "run"},
+		Provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.HostConfig.CPUShares, check.Equals, int64(50))
+	c.Assert(dockerContainer.HostConfig.CPUPeriod, check.Equals, int64(100000))
+	c.Assert(dockerContainer.HostConfig.CPUQuota, check.Equals, int64(50000))
+}
+
+func (s *S) TestContainerCreateProcessResources(c *check.C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.Memory = 15
+	app.CpuShare = 50
+	app.ProcessResources = map[string]provision.UnitResources{
+		"cron": {Memory: 10, Swap: 5, CpuShare: 20, CpuLimit: 0.25},
+	}
+	img := "tsuru/brainfuck:latest"
+	s.p.Cluster().PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "cron",
+		ExposedPort: "8888/tcp",
+	}
+	err = cont.Create(&CreateArgs{
+		App:         app,
+		ImageID:     img,
+		Commands:    []string{"docker", "run"},
+		Provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.HostConfig.Memory, check.Equals, int64(10))
+	c.Assert(dockerContainer.HostConfig.MemorySwap, check.Equals, int64(15))
+	c.Assert(dockerContainer.HostConfig.CPUShares, check.Equals, int64(20))
+	c.Assert(dockerContainer.HostConfig.CPUQuota, check.Equals, int64(25000))
+}
+
+func (s *S) TestContainerCreateWithPorts(c *check.C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	img := "tsuru/brainfuck:latest"
+	s.p.Cluster().PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "broker",
+		ExposedPort: "8888/tcp",
+		Ports: []ContainerPort{
+			{Port: 1883, Protocol: "tcp"},
+			{Port: 5683, Protocol: "udp"},
+		},
+	}
+	err = cont.Create(&CreateArgs{
+		App:         app,
+		ImageID:     img,
+		Commands:    []string{"docker", "run"},
+		Provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.ExposedPorts, check.DeepEquals, map[docker.Port]struct{}{
+		"8888/tcp": {},
+		"1883/tcp": {},
+		"5683/udp": {},
+	})
+	c.Assert(dockerContainer.HostConfig.PortBindings, check.DeepEquals, map[docker.Port][]docker.PortBinding{
+		"8888/tcp": {{HostIP: "", HostPort: ""}},
+		"1883/tcp": {{HostIP: "", HostPort: ""}},
+		"5683/udp": {{HostIP: "", HostPort: ""}},
+	})
+}
+
+func (s *S) TestContainerCreateWithVolumes(c *check.C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	img := "tsuru/brainfuck:latest"
+	s.p.Cluster().PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "web",
+	}
+	err = cont.Create(&CreateArgs{
+		App:         app,
+		ImageID:     img,
+		Commands:    []string{"docker", "run"},
+		Provisioner: s.p,
+		Volumes:     []string{"/mnt/volumes/cache:/var/cache", "data:/var/data:ro"},
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.HostConfig.Binds, check.DeepEquals, []string{"/mnt/volumes/cache:/var/cache", "data:/var/data:ro"})
+}
+
+func (s *S) TestContainerCreateWithStopSignal(c *check.C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	img := "tsuru/brainfuck:latest"
+	s.p.Cluster().PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "web",
+		Shutdown:    provision.TsuruYamlShutdown{Signal: "SIGQUIT"},
+	}
+	err = cont.Create(&CreateArgs{
+		App:         app,
+		ImageID:     img,
+		Commands:    []string{"docker", "run"},
+		Provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dockerContainer, err := client.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.Config.StopSignal, check.Equals, "SIGQUIT")
+}
+
 func (s *S) TestContainerCreateCustomLog(c *check.C) {
 	client, err := docker.NewClient(s.server.URL())
 	c.Assert(err, check.IsNil)
@@ -483,6 +643,52 @@ func (s *S) TestContainerNetworkInfo(c *check.C) {
 	c.Assert(info.HTTPHostPort, check.Equals, "")
 }
 
+func (s *S) TestContainerNetworkInfoWithPorts(c *check.C) {
+	inspectOut := `{
+	"NetworkSettings": {
+		"IpAddress": "10.10.10.10",
+		"IpPrefixLen": 8,
+		"Gateway": "10.65.41.1",
+		"Ports": {
+			"8888/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32001"}],
+			"1883/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32002"}],
+			"5683/udp": [{"HostIp": "0.0.0.0", "HostPort": "32003"}]
+		}
+	}
+}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/containers/") {
+			w.Write([]byte(inspectOut))
+		}
+	}))
+	defer server.Close()
+	var storage cluster.MapStorage
+	storage.StoreContainer("c-01", server.URL)
+	p, err := newFakeDockerProvisioner(server.URL)
+	c.Assert(err, check.IsNil)
+	p.cluster, err = cluster.New(nil, &storage, "",
+		cluster.Node{Address: server.URL},
+	)
+	c.Assert(err, check.IsNil)
+	container := Container{
+		ID:          "c-01",
+		ExposedPort: "8888/tcp",
+		Ports: []ContainerPort{
+			{Port: 1883, Protocol: "tcp"},
+			{Port: 5683, Protocol: "udp"},
+		},
+	}
+	info, err := container.NetworkInfo(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.IP, check.Equals, "10.10.10.10")
+	c.Assert(info.HTTPHostPort, check.Equals, "32001")
+	c.Assert(info.Ports, check.DeepEquals, []ContainerPort{
+		{Port: 1883, Protocol: "tcp", HostPort: "32002"},
+		{Port: 5683, Protocol: "udp", HostPort: "32003"},
+	})
+	c.Assert(container.Ports[0].HostPort, check.Equals, "")
+}
+
 func (s *S) TestContainerSetStatus(c *check.C) {
 	update := time.Date(1989, 2, 2, 14, 59, 32, 0, time.UTC).In(time.UTC)
 	container := Container{ID: "something-300", LastStatusUpdate: update}
@@ -773,6 +979,46 @@ func (s *S) TestContainerStop(c *check.C) {
 	c.Assert(cont.Status, check.Equals, provision.StatusStopped.String())
 }
 
+func (s *S) TestContainerStopRunsPreStop(c *check.C) {
+	cont, err := s.newContainer(newContainerOpts{}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	err = client.StartContainer(cont.ID, nil)
+	c.Assert(err, check.IsNil)
+	cont.Shutdown = provision.TsuruYamlShutdown{GracePeriod: 30, PreStop: "kill -USR1 1 && sleep 5"}
+	err = cont.Stop(s.p)
+	c.Assert(err, check.IsNil)
+	dockerContainer, err := s.p.Cluster().InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.State.Running, check.Equals, false)
+	c.Assert(dockerContainer.ExecIDs, check.HasLen, 1)
+	exec, err := client.InspectExec(dockerContainer.ExecIDs[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(exec.ProcessConfig.EntryPoint, check.Equals, "/bin/bash")
+	c.Assert(exec.ProcessConfig.Arguments, check.DeepEquals, []string{"-lc", "kill -USR1 1 && sleep 5"})
+}
+
+func (s *S) TestContainerStopPreStopTimeout(c *check.C) {
+	cont, err := s.newContainer(newContainerOpts{}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	err = client.StartContainer(cont.ID, nil)
+	c.Assert(err, check.IsNil)
+	s.server.PrepareExec("*", func() {
+		time.Sleep(3 * time.Second)
+	})
+	cont.Shutdown = provision.TsuruYamlShutdown{GracePeriod: 1, PreStop: "sleep 60"}
+	start := time.Now()
+	err = cont.Stop(s.p)
+	c.Assert(err, check.IsNil)
+	c.Assert(time.Since(start) < 3*time.Second, check.Equals, true)
+	c.Assert(cont.Status, check.Equals, provision.StatusStopped.String())
+}
+
 func (s *S) TestContainerSleep(c *check.C) {
 	cont, err := s.newContainer(newContainerOpts{}, nil)
 	c.Assert(err, check.IsNil)
@@ -791,6 +1037,26 @@ func (s *S) TestContainerSleep(c *check.C) {
 	c.Assert(cont.Status, check.Equals, provision.StatusAsleep.String())
 }
 
+func (s *S) TestContainerSleepRunsPreStop(c *check.C) {
+	cont, err := s.newContainer(newContainerOpts{}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	err = cont.Start(&StartArgs{
+		Provisioner: s.p,
+		App:         app,
+	})
+	c.Assert(err, check.IsNil)
+	cont.Shutdown = provision.TsuruYamlShutdown{PreStop: "sleep 5"}
+	err = cont.Sleep(s.p)
+	c.Assert(err, check.IsNil)
+	dockerContainer, err := s.p.Cluster().InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dockerContainer.State.Running, check.Equals, false)
+	c.Assert(dockerContainer.ExecIDs, check.HasLen, 1)
+	c.Assert(cont.Status, check.Equals, provision.StatusAsleep.String())
+}
+
 func (s *S) TestContainerSleepNotStarted(c *check.C) {
 	cont, err := s.newContainer(newContainerOpts{}, nil)
 	c.Assert(err, check.IsNil)
@@ -85,7 +85,7 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 	if w == nil {
 		w = ioutil.Discard
 	}
-	evt, _ := w.(*event.Event)
+	evt := event.FromWriter(w)
 	args := changeUnitsPipelineArgs{
 		app:         a,
 		toAdd:       toAdd,
@@ -125,7 +125,7 @@ func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App,
 	if w == nil {
 		w = ioutil.Discard
 	}
-	evt, _ := w.(*event.Event)
+	evt := event.FromWriter(w)
 	args := changeUnitsPipelineArgs{
 		app:         a,
 		toAdd:       toAdd,
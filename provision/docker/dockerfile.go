@@ -0,0 +1,182 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// archiveHasDockerfile reports whether the given gzipped tarball has a
+// Dockerfile in its root.
+func archiveHasDockerfile(r io.Reader) (bool, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return false, err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if header.Typeflag != tar.TypeDir && path.Clean(header.Name) == "Dockerfile" {
+			return true, nil
+		}
+	}
+}
+
+// detectDockerfile reports whether the uploaded archive has a Dockerfile in its
+// root, rewinding it afterwards. Archives that can't be rewound are never
+// inspected. The switch to a Dockerfile build is noticed in w, as it replaces
+// the platform of the app.
+func detectDockerfile(archive io.Reader, w io.Writer) (bool, error) {
+	seeker, ok := archive.(io.ReadSeeker)
+	if !ok {
+		return false, nil
+	}
+	hasDockerfile, err := archiveHasDockerfile(seeker)
+	if err != nil {
+		return false, err
+	}
+	_, err = seeker.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return false, err
+	}
+	if hasDockerfile {
+		fmt.Fprintln(w, "---- Dockerfile found in the root of the archive, building the image from it instead of using the platform ----")
+	}
+	return hasDockerfile, nil
+}
+
+// dockerfileBuildArgs returns the public environment variables of the app,
+// sorted by name, as build args. Private variables are left out, as build args
+// are visible in the history of the image.
+func dockerfileBuildArgs(app provision.App) ([]docker.BuildArg, error) {
+	envs, err := app.Envs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(envs))
+	for name, env := range envs {
+		if env.Public {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	args := make([]docker.BuildArg, len(names))
+	for i, name := range names {
+		args[i] = docker.BuildArg{Name: name, Value: envs[name].Value}
+	}
+	return args, nil
+}
+
+// dockerfileDeploy builds the image of the app from the Dockerfile in the
+// build context, which is either a gzipped tarball or the URL of one, and
+// deploys it.
+func (p *dockerProvisioner) dockerfileDeploy(app provision.App, context io.Reader, contextURL string, evt *event.Event) (string, error) {
+	imageId, err := p.dockerfileBuild(app, context, contextURL, evt)
+	if err != nil {
+		return "", err
+	}
+	return imageId, p.deployAndClean(app, imageId, evt)
+}
+
+func (p *dockerProvisioner) dockerfileBuild(app provision.App, context io.Reader, contextURL string, evt *event.Event) (string, error) {
+	nodes, err := p.Cluster().NodesForMetadata(map[string]string{"pool": app.GetPool()})
+	if err != nil {
+		return "", err
+	}
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no nodes available in pool %q", app.GetPool())
+	}
+	nodeAddr, _, err := p.scheduler.minMaxNodes(nodes, app.GetName(), "")
+	if err != nil {
+		return "", err
+	}
+	newImage, err := appNewImageName(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	buildArgs, err := dockerfileBuildArgs(app)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(evt, "---- Building image from Dockerfile ----")
+	buildOpts := docker.BuildImageOptions{
+		Name:              newImage,
+		Pull:              true,
+		RmTmpContainer:    true,
+		InputStream:       context,
+		Remote:            contextURL,
+		OutputStream:      evt,
+		BuildArgs:         buildArgs,
+		InactivityTimeout: net.StreamInactivityTimeout,
+	}
+	err = p.buildImageInNode(nodeAddr, buildOpts)
+	if err != nil {
+		return "", err
+	}
+	err = p.setupDockerfileImage(app, newImage, evt)
+	if err != nil {
+		p.cleanImage(app.GetName(), newImage)
+		return "", err
+	}
+	app.SetUpdatePlatform(true)
+	return newImage, nil
+}
+
+// buildImageInNode builds the image in the given node, registering it in the
+// cluster storage, so other nodes are able to find it.
+func (p *dockerProvisioner) buildImageInNode(nodeAddr string, opts docker.BuildImageOptions) error {
+	node, err := p.Cluster().GetNode(nodeAddr)
+	if err != nil {
+		return err
+	}
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	client.HTTPClient.Timeout = 0
+	err = client.BuildImage(opts)
+	if err != nil {
+		return err
+	}
+	img, err := client.InspectImage(opts.Name)
+	if err != nil {
+		return err
+	}
+	return p.storage.StoreImage(opts.Name, img.ID, nodeAddr)
+}
+
+// setupDockerfileImage pushes the image built from the Dockerfile of the app
+// and stores the processes found in it.
+func (p *dockerProvisioner) setupDockerfileImage(app provision.App, imageName string, evt *event.Event) error {
+	imageInfo := strings.Split(imageName, ":")
+	err := p.PushImage(strings.Join(imageInfo[:len(imageInfo)-1], ":"), imageInfo[len(imageInfo)-1])
+	if err != nil {
+		return err
+	}
+	procfile, imageInspect, err := p.imageProcesses(app, imageName, evt)
+	if err != nil {
+		return err
+	}
+	return saveImageProcesses(imageName, procfile, imageInspect)
+}
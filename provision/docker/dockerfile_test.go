@@ -0,0 +1,170 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+)
+
+func buildTestArchive(c *check.C, files ...string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range files {
+		content := []byte("FROM tsuru/base\n")
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		c.Assert(err, check.IsNil)
+		_, err = tarWriter.Write(content)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(tarWriter.Close(), check.IsNil)
+	c.Assert(gzipWriter.Close(), check.IsNil)
+	return &buf
+}
+
+func (s *S) TestArchiveHasDockerfile(c *check.C) {
+	var tests = []struct {
+		files    []string
+		expected bool
+	}{
+		{[]string{"app.py", "Dockerfile"}, true},
+		{[]string{"./Dockerfile"}, true},
+		{[]string{"app.py", "Procfile"}, false},
+		{[]string{"app/Dockerfile"}, false},
+		{nil, false},
+	}
+	for i, tt := range tests {
+		hasDockerfile, err := archiveHasDockerfile(buildTestArchive(c, tt.files...))
+		c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		c.Check(hasDockerfile, check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+	_, err := archiveHasDockerfile(bytes.NewBufferString("not an archive"))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestDetectDockerfile(c *check.C) {
+	var buf bytes.Buffer
+	archive := bytes.NewReader(buildTestArchive(c, "app.py", "Dockerfile").Bytes())
+	hasDockerfile, err := detectDockerfile(archive, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(hasDockerfile, check.Equals, true)
+	c.Assert(buf.String(), check.Matches, "---- Dockerfile found in the root of the archive.*\n")
+	hasDockerfile, err = archiveHasDockerfile(archive)
+	c.Assert(err, check.IsNil)
+	c.Assert(hasDockerfile, check.Equals, true)
+	buf.Reset()
+	hasDockerfile, err = detectDockerfile(bytes.NewReader(buildTestArchive(c, "app.py").Bytes()), &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(hasDockerfile, check.Equals, false)
+	c.Assert(buf.String(), check.Equals, "")
+	hasDockerfile, err = detectDockerfile(buildTestArchive(c, "Dockerfile"), &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(hasDockerfile, check.Equals, false)
+	c.Assert(buf.String(), check.Equals, "")
+}
+
+func (s *S) TestDockerfileBuildArgs(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	args, err := dockerfileBuildArgs(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(args, check.HasLen, 0)
+	a.SetEnv(bind.EnvVar{Name: "PORT", Value: "8888", Public: true})
+	a.SetEnv(bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "secret"})
+	a.SetEnv(bind.EnvVar{Name: "DEBUG", Value: "1", Public: true})
+	args, err = dockerfileBuildArgs(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(args, check.DeepEquals, []docker.BuildArg{
+		{Name: "DEBUG", Value: "1"},
+		{Name: "PORT", Value: "8888"},
+	})
+}
+
+func (s *S) TestDockerfileBuild(c *check.C) {
+	var buildArgs string
+	var hasDockerfile bool
+	s.server.CustomHandler("/build", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buildArgs = r.URL.Query().Get("buildargs")
+		hasDockerfile, _ = archiveHasDockerfile(r.Body)
+		w.Write([]byte(`{"stream":"Successfully built"}`))
+	}))
+	s.server.CustomHandler("/containers/.*/attach", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "cannot hijack connection", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		outStream := stdcopy.NewStdWriter(conn, stdcopy.Stdout)
+		fmt.Fprintf(outStream, "web: python app.py\n")
+		conn.Close()
+	}))
+	s.server.CustomHandler("/images/tsuru/app-myapp:v1/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := docker.Image{
+			ID: "dockerfile-image",
+			Config: &docker.Config{
+				ExposedPorts: map[docker.Port]struct{}{"8000/tcp": {}},
+			},
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	var buf safe.Buffer
+	err := s.p.Cluster().PullImage(docker.PullImageOptions{Repository: "tsuru/app-myapp:v1", OutputStream: &buf}, docker.AuthConfiguration{})
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.Pool = "test-default"
+	a.SetEnv(bind.EnvVar{Name: "DEBUG", Value: "1", Public: true})
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: a.GetName()},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	imageId, err := s.p.dockerfileBuild(a, buildTestArchive(c, "Dockerfile", "app.py"), "", evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(imageId, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(hasDockerfile, check.Equals, true)
+	c.Assert(buildArgs, check.Equals, `{"DEBUG":"1"}`)
+	c.Assert(evt.Log, check.Matches, `(?s)---- Building image from Dockerfile ----.*Process web found with command: python app.py.*`)
+	imageData, err := getImageCustomData(imageId)
+	c.Assert(err, check.IsNil)
+	c.Assert(imageData.Processes, check.DeepEquals, map[string]string{"web": "python app.py"})
+	c.Assert(imageData.ExposedPort, check.Equals, "8000/tcp")
+	c.Assert(a.UpdatePlatform, check.Equals, true)
+}
+
+func (s *S) TestDockerfileBuildNoNodesInPool(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.Pool = "empty-pool"
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: a.GetName()},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	_, err = s.p.dockerfileBuild(a, buildTestArchive(c, "Dockerfile"), "", evt)
+	c.Assert(err, check.ErrorMatches, `no nodes available in pool "empty-pool"`)
+}
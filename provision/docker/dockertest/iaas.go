@@ -18,6 +18,9 @@ type TestHealerIaaS struct {
 	Addrs  []string
 	Ports  []int
 	AddrId int
+	// SpotSupported makes the IaaS create spot machines when the spot
+	// param is set.
+	SpotSupported bool
 }
 
 func NewHealerIaaSConstructor(addr string, err error) func(string) iaas.IaaS {
@@ -66,6 +69,7 @@ func (t *TestHealerIaaS) CreateMachine(params map[string]string) (*iaas.Machine,
 		Status:  "running",
 		Address: addr,
 		Port:    port,
+		Spot:    t.SpotSupported && params["spot"] == "true",
 	}
 	return &m, nil
 }
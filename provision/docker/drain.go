@@ -0,0 +1,100 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+// nodeCreationStatusMaintenance marks a node under maintenance. As with
+// disabled nodes, the cluster ignores it when listing nodes, so the scheduler
+// never chooses it for new units, but it's kept registered and its containers
+// keep running until they're drained.
+const nodeCreationStatusMaintenance = "maintenance"
+
+var errDrainCanceled = errors.New("node drain canceled by user action")
+
+// drainNode puts the node in maintenance and moves its containers to other
+// nodes. Containers are moved app by app, in batches that keep at least
+// minAvailable units of each app running elsewhere, and the event is checked
+// for cancellation before each batch.
+func (p *dockerProvisioner) drainNode(evt *event.Event, address string, minAvailable int) error {
+	node, err := p.Cluster().GetNode(address)
+	if err != nil {
+		return err
+	}
+	if node.CreationStatus == "" || node.CreationStatus == cluster.NodeCreationStatusCreated {
+		node.CreationStatus = nodeCreationStatusMaintenance
+		_, err = p.Cluster().UpdateNode(node)
+		if err != nil {
+			return err
+		}
+	}
+	containers, err := p.listContainersByHost(net.URLToHost(address))
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		fmt.Fprintf(evt, "No units to move in %s\n", address)
+		return nil
+	}
+	byApp := map[string][]container.Container{}
+	var appNames []string
+	for _, c := range containers {
+		if _, ok := byApp[c.AppName]; !ok {
+			appNames = append(appNames, c.AppName)
+		}
+		byApp[c.AppName] = append(byApp[c.AppName], c)
+	}
+	sort.Strings(appNames)
+	fmt.Fprintf(evt, "Draining %d units from %d apps in %s...\n", len(containers), len(appNames), address)
+	for _, appName := range appNames {
+		appContainers, err := p.listContainersByApp(appName)
+		if err != nil {
+			return err
+		}
+		batchSize := len(appContainers) - minAvailable
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		toMove := byApp[appName]
+		for len(toMove) > 0 {
+			if err = checkDrainCanceled(evt); err != nil {
+				return err
+			}
+			batch := toMove
+			if len(batch) > batchSize {
+				batch = batch[:batchSize]
+			}
+			toMove = toMove[len(batch):]
+			fmt.Fprintf(evt, "Moving %d units of app %s...\n", len(batch), appName)
+			err = p.moveContainerList(batch, "", evt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkDrainCanceled(evt *event.Event) error {
+	canceled, err := evt.AckCancel()
+	if err != nil {
+		log.Errorf("unable to check if event should be canceled, ignoring: %s", err)
+		return nil
+	}
+	if canceled {
+		return errDrainCanceled
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) prepareDrain(c *check.C) (*dockerProvisioner, *event.Event) {
+	p, err := s.startMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	err = s.newFakeImage(p, "tsuru/app-myapp", nil)
+	c.Assert(err, check.IsNil)
+	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
+	p.Provision(appInstance)
+	imageId, err := appCurrentImageName(appInstance.GetName())
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toHost:      "127.0.0.1",
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 3}},
+		app:         appInstance,
+		imageId:     imageId,
+		provisioner: p,
+	})
+	c.Assert(err, check.IsNil)
+	err = s.storage.Apps().Insert(&app.App{Name: appInstance.GetName()})
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeNode, Value: s.server.URL()},
+		Kind:       permission.PermNodeUpdateDrain,
+		Owner:      s.token,
+		Cancelable: true,
+	})
+	c.Assert(err, check.IsNil)
+	return p, evt
+}
+
+func (s *S) TestDrainNode(c *check.C) {
+	p, evt := s.prepareDrain(c)
+	defer p.Collection().RemoveAll(bson.M{"appname": "myapp"})
+	err := p.drainNode(evt, s.server.URL(), 2)
+	c.Assert(err, check.IsNil)
+	evt.Done(err)
+	containers, err := p.listContainersByHost("127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+	containers, err = p.listContainersByHost("localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 3)
+	node, err := p.Cluster().GetNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	c.Assert(node.CreationStatus, check.Equals, nodeCreationStatusMaintenance)
+	c.Assert(evt.Log, check.Matches, `(?s)Draining 3 units from 1 apps.*Moving 1 units of app myapp.*Moving 1 units of app myapp.*Moving 1 units of app myapp.*`)
+}
+
+func (s *S) TestDrainNodeCanceled(c *check.C) {
+	p, evt := s.prepareDrain(c)
+	defer p.Collection().RemoveAll(bson.M{"appname": "myapp"})
+	err := evt.TryCancel("because yes", "admin@example.com")
+	c.Assert(err, check.IsNil)
+	err = p.drainNode(evt, s.server.URL(), 1)
+	c.Assert(err, check.Equals, errDrainCanceled)
+	evt.Done(err)
+	containers, err := p.listContainersByHost("127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 3)
+	node, err := p.Cluster().GetNode(s.server.URL())
+	c.Assert(err, check.IsNil)
+	c.Assert(node.CreationStatus, check.Equals, nodeCreationStatusMaintenance)
+}
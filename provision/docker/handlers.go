@@ -24,10 +24,13 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/iaas"
 	_ "github.com/tsuru/tsuru/iaas/cloudstack"
 	_ "github.com/tsuru/tsuru/iaas/digitalocean"
 	_ "github.com/tsuru/tsuru/iaas/ec2"
+	_ "github.com/tsuru/tsuru/iaas/exec"
+	_ "github.com/tsuru/tsuru/iaas/openstack"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
@@ -44,6 +47,7 @@ func init() {
 	api.RegisterHandler("/docker/node/{address:.*}/containers", "GET", api.AuthorizationRequiredHandler(listContainersByNode))
 	api.RegisterHandler("/docker/node", "POST", api.AuthorizationRequiredHandler(addNodeHandler))
 	api.RegisterHandler("/docker/node", "PUT", api.AuthorizationRequiredHandler(updateNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/drain", "POST", api.AuthorizationRequiredHandler(drainNodeHandler))
 	api.RegisterHandler("/docker/node/{address:.*}", "DELETE", api.AuthorizationRequiredHandler(removeNodeHandler))
 	api.RegisterHandler("/docker/container/{id}/move", "POST", api.AuthorizationRequiredHandler(moveContainerHandler))
 	api.RegisterHandler("/docker/containers/move", "POST", api.AuthorizationRequiredHandler(moveContainersHandler))
@@ -70,6 +74,8 @@ func init() {
 	api.RegisterHandler("/docker/nodecontainers/{name}/upgrade", "POST", api.AuthorizationRequiredHandler(nodeContainerUpgrade))
 	api.RegisterHandler("/docker/logs", "GET", api.AuthorizationRequiredHandler(logsConfigGetHandler))
 	api.RegisterHandler("/docker/logs", "POST", api.AuthorizationRequiredHandler(logsConfigSetHandler))
+	api.RegisterHandler("/docker/scheduler", "GET", api.AuthorizationRequiredHandler(schedulerConfigGetHandler))
+	api.RegisterHandler("/docker/scheduler", "POST", api.AuthorizationRequiredHandler(schedulerConfigSetHandler))
 }
 
 // title: get autoscale config
@@ -331,6 +337,66 @@ func removeNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) err
 	return nil
 }
 
+// title: drain node
+// path: /docker/node/{address}/drain
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func drainNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	address := r.URL.Query().Get(":address")
+	node, err := mainDockerProvisioner.Cluster().GetNode(address)
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("Node %s not found.", address),
+		}
+	}
+	allowed := permission.Check(t, permission.PermNodeUpdateDrain,
+		permission.Context(permission.CtxPool, node.Metadata["pool"]),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	minAvailable := 1
+	if value := r.FormValue("min-available"); value != "" {
+		minAvailable, err = strconv.Atoi(value)
+		if err != nil || minAvailable < 0 {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid min-available: %q", value),
+			}
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeNode, Value: node.Address},
+		Kind:       permission.PermNodeUpdateDrain,
+		Owner:      t,
+		CustomData: map[string]interface{}{"min-available": minAvailable},
+		Cancelable: true,
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	evt.SetLogWriter(writer)
+	err = mainDockerProvisioner.drainNode(evt, node.Address, minAvailable)
+	evt.Done(err)
+	if err != nil {
+		fmt.Fprintf(writer, "Error draining node: %s\n", err)
+	} else {
+		fmt.Fprintf(writer, "Node drained successfully!\n")
+	}
+	return nil
+}
+
 // title: list nodes
 // path: /docker/node
 // method: GET
@@ -392,10 +458,11 @@ func listNodesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 }
 
 type updateNodeOptions struct {
-	Address  string
-	Metadata map[string]string
-	Enable   bool
-	Disable  bool
+	Address     string
+	Metadata    map[string]string
+	Enable      bool
+	Disable     bool
+	Maintenance bool
 }
 
 // title: update nodes
@@ -452,9 +519,18 @@ func updateNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) err
 			Message: "You can't make a node enable and disable at the same time.",
 		}
 	}
+	if params.Maintenance && (params.Enable || params.Disable) {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "You can't put a node in maintenance and enable or disable it at the same time.",
+		}
+	}
 	if params.Disable {
 		node.CreationStatus = cluster.NodeCreationStatusDisabled
 	}
+	if params.Maintenance {
+		node.CreationStatus = nodeCreationStatusMaintenance
+	}
 	if params.Enable {
 		node.CreationStatus = cluster.NodeCreationStatusCreated
 	}
@@ -900,6 +976,61 @@ func logsConfigSetHandler(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return nil
 }
 
+// title: scheduler config
+// path: /docker/scheduler
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   401: Unauthorized
+func schedulerConfigGetHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pools, err := listContextValues(t, permission.PermPoolUpdateScheduler, true)
+	if err != nil {
+		return err
+	}
+	configEntries, err := schedulerConfigLoadAll()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(pools) == 0 {
+		return json.NewEncoder(w).Encode(configEntries)
+	}
+	newMap := map[string]SchedulerConfig{}
+	for _, p := range pools {
+		if entry, ok := configEntries[p]; ok {
+			newMap[p] = entry
+		}
+	}
+	return json.NewEncoder(w).Encode(newMap)
+}
+
+// title: scheduler config set
+// path: /docker/scheduler
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+func schedulerConfigSetHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pool := r.FormValue("pool")
+	if pool == "" && !permission.Check(t, permission.PermPoolUpdateScheduler) {
+		return permission.ErrUnauthorized
+	}
+	hasPermission := permission.Check(t, permission.PermPoolUpdateScheduler,
+		permission.Context(permission.CtxPool, pool))
+	if !hasPermission {
+		return permission.ErrUnauthorized
+	}
+	conf := SchedulerConfig{Strategy: r.FormValue("strategy")}
+	err := conf.validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return conf.save(pool)
+}
+
 func tryRestartAppsByFilter(filter *app.Filter, writer io.Writer) error {
 	apps, err := app.List(filter)
 	if err != nil {
@@ -32,6 +32,7 @@ import (
 	"github.com/tsuru/tsuru/db/dbtest"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	tsuruNet "github.com/tsuru/tsuru/net"
@@ -1446,6 +1447,115 @@ func (s *HandlersSuite) TestUpdateNodeEnableAndDisableCantBeDone(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 }
 
+func (s *HandlersSuite) TestUpdateNodeMaintenanceNodeHandler(c *check.C) {
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "localhost:1999", CreationStatus: cluster.NodeCreationStatusCreated},
+	)
+	params := updateNodeOptions{
+		Address:     "localhost:1999",
+		Maintenance: true,
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader(v.Encode())
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/docker/node", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	nodes, err := mainDockerProvisioner.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].CreationStatus, check.Equals, nodeCreationStatusMaintenance)
+	nodes, err = mainDockerProvisioner.Cluster().Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 0)
+}
+
+func (s *HandlersSuite) TestUpdateNodeMaintenanceAndEnableCantBeDone(c *check.C) {
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "localhost:1999", CreationStatus: cluster.NodeCreationStatusCreated},
+	)
+	params := updateNodeOptions{
+		Address:     "localhost:1999",
+		Maintenance: true,
+		Enable:      true,
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader(v.Encode())
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/docker/node", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *HandlersSuite) TestDrainNodeHandler(c *check.C) {
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "http://localhost:1999", CreationStatus: cluster.NodeCreationStatusCreated},
+	)
+	recorder := httptest.NewRecorder()
+	b := strings.NewReader("min-available=2")
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:1999/drain", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	validJson := fmt.Sprintf("[%s]", strings.Replace(strings.Trim(recorder.Body.String(), "\n "), "\n", ",", -1))
+	var result []tsuruIo.SimpleJsonMessage
+	err = json.Unmarshal([]byte(validJson), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []tsuruIo.SimpleJsonMessage{
+		{Message: "No units to move in http://localhost:1999\n"},
+		{Message: "Node drained successfully!\n"},
+	})
+	node, err := mainDockerProvisioner.Cluster().GetNode("http://localhost:1999")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.CreationStatus, check.Equals, nodeCreationStatusMaintenance)
+	c.Assert(eventtest.EventDesc{
+		Target:          event.Target{Type: event.TargetTypeNode, Value: "http://localhost:1999"},
+		Owner:           s.token.GetUserName(),
+		Kind:            "node.update.drain",
+		StartCustomData: map[string]interface{}{"min-available": 2},
+	}, eventtest.HasEvent)
+}
+
+func (s *HandlersSuite) TestDrainNodeHandlerNotFound(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:1999/drain", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestDrainNodeHandlerInvalidMinAvailable(c *check.C) {
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "http://localhost:1999", CreationStatus: cluster.NodeCreationStatusCreated},
+	)
+	recorder := httptest.NewRecorder()
+	b := strings.NewReader("min-available=-1")
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:1999/drain", b)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid min-available: \"-1\"\n")
+}
+
 func (s *HandlersSuite) TestUpdateNodeHandlerEnableCanMoveContainers(c *check.C) {
 	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
 		cluster.Node{Address: "localhost:2375", CreationStatus: cluster.NodeCreationStatusDisabled},
@@ -1912,6 +2022,72 @@ func (s *HandlersSuite) TestDockerLogsInfoHandler(c *check.C) {
 	})
 }
 
+func (s *HandlersSuite) TestSchedulerConfigSetHandler(c *check.C) {
+	values := url.Values{"pool": []string{"pool1"}, "strategy": []string{"binpack"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/scheduler", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	strategy, err := strategyForPool("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.FitsTypeOf, &binpackStrategy{})
+}
+
+func (s *HandlersSuite) TestSchedulerConfigSetHandlerInvalidStrategy(c *check.C) {
+	values := url.Values{"strategy": []string{"worst-fit"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/scheduler", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid scheduler strategy \"worst-fit\", valid strategies are: binpack, random, spread\n")
+}
+
+func (s *HandlersSuite) TestSchedulerConfigSetHandlerUnauthorized(c *check.C) {
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err := nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	token := createTokenForUser(limitedUser, "pool.update.scheduler", string(permission.CtxPool), "pool1", c)
+	values := url.Values{"pool": []string{"pool2"}, "strategy": []string{"binpack"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/scheduler", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
+func (s *HandlersSuite) TestSchedulerConfigGetHandler(c *check.C) {
+	conf := SchedulerConfig{Strategy: strategyRandom}
+	err := conf.save("p1")
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/scheduler", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result map[string]SchedulerConfig
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, map[string]SchedulerConfig{
+		"":   {},
+		"p1": {Strategy: strategyRandom},
+	})
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
@@ -340,7 +340,72 @@ func (h *NodeHealer) UpdateNodeData(nodeData provision.NodeStatusData) error {
 			}),
 		},
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	if nodeData.Reclaimed {
+		// The removal moves every container in the node, it must not hold
+		// the response to the node agent.
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			if err := h.removeReclaimedNode(node); err != nil {
+				log.Errorf("[node healer update] %s", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// removeReclaimedNode handles a reclaim notice for a node whose instance is
+// about to be terminated by the cloud provider. The node is removed as in a
+// planned removal: it's unregistered and its containers are moved to the
+// remaining nodes before the instance goes away. No node is created in its
+// place, replacing the lost capacity is left to the node auto scale.
+func (h *NodeHealer) removeReclaimedNode(node *cluster.Node) (err error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNode, Value: node.Address},
+		InternalKind: "healer",
+		CustomData: nodeHealerCustomData{
+			Node:   node,
+			Reason: "reclaim notice from the cloud provider",
+		},
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			// Removal in progress.
+			return nil
+		}
+		return fmt.Errorf("Error trying to insert node reclaim event, removal aborted: %s", err.Error())
+	}
+	defer func() {
+		if updateErr := evt.Done(err); updateErr != nil {
+			log.Errorf("error trying to update reclaim event: %s", updateErr.Error())
+		}
+	}()
+	host := net.URLToHost(node.Address)
+	log.Errorf("removing node %q due to reclaim notice from the cloud provider", node.Address)
+	err = h.provisioner.Cluster().Unregister(node.Address)
+	if err != nil {
+		return fmt.Errorf("unable to unregister reclaimed node %s: %s", host, err.Error())
+	}
+	var buf bytes.Buffer
+	err = h.provisioner.MoveContainers(host, "", &buf)
+	if err != nil {
+		return fmt.Errorf("unable to move containers from reclaimed node %s: %s: %s", host, err.Error(), buf.String())
+	}
+	if _, hasIaas := node.Metadata["iaas"]; !hasIaas {
+		return nil
+	}
+	machine, err := iaas.FindMachineByIdOrAddress(node.Metadata["iaas-id"], host)
+	if err != nil {
+		return fmt.Errorf("unable to find reclaimed machine %s in IaaS: %s", host, err.Error())
+	}
+	err = machine.Destroy()
+	if err != nil {
+		return fmt.Errorf("unable to destroy reclaimed machine %s from IaaS: %s", host, err.Error())
+	}
+	return nil
 }
 
 func (h *NodeHealer) RunClusterHook(evt cluster.HookEvent, node *cluster.Node) error {
@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/iaas"
 	tsurunet "github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/provision/docker/dockertest"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
 	"github.com/tsuru/tsuru/provision/provisiontest"
@@ -523,6 +524,58 @@ func (s *S) TestHealerUpdateNodeData(c *check.C) {
 	})
 }
 
+func (s *S) TestHealerUpdateNodeDataReclaimed(c *check.C) {
+	factory, _ := dockertest.NewHealerIaaSConstructorWithInst("127.0.0.1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	reclaimedAddr := nodes[0].Address
+	if tsurunet.URLToHost(reclaimedAddr) != "127.0.0.1" {
+		reclaimedAddr = nodes[1].Address
+	}
+	_, err = p.Cluster().UpdateNode(cluster.Node{Address: reclaimedAddr, Metadata: map[string]string{
+		"iaas": "my-healer-iaas",
+		"spot": "true",
+	}})
+	c.Assert(err, check.IsNil)
+	p.SetContainers("127.0.0.1", []container.Container{{ID: "c1", AppName: "myapp"}})
+	p.SetContainers("localhost", nil)
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner: p,
+	})
+	healer.Shutdown()
+	err = healer.UpdateNodeData(provision.NodeStatusData{
+		Addrs:     []string{"127.0.0.1"},
+		Reclaimed: true,
+	})
+	c.Assert(err, check.IsNil)
+	healer.wg.Wait()
+	nodes, err = p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(tsurunet.URLToHost(nodes[0].Address), check.Equals, "localhost")
+	c.Assert(p.Movings(), check.DeepEquals, []dockertest.ContainerMoving{
+		{ContainerID: "c1", HostFrom: "127.0.0.1", HostTo: "localhost"},
+	})
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "node", Value: reclaimedAddr},
+		Kind:   "healer",
+		StartCustomData: map[string]interface{}{
+			"reason":   "reclaim notice from the cloud provider",
+			"node._id": reclaimedAddr,
+		},
+	}, eventtest.HasEvent)
+}
+
 func (s *S) TestHealerUpdateNodeDataSavesLast10Checks(c *check.C) {
 	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
 	c.Assert(err, check.IsNil)
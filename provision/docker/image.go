@@ -213,6 +213,20 @@ func getImageTsuruYamlData(imageName string) (provision.TsuruYamlData, error) {
 	return customData.Customdata, err
 }
 
+// imageShutdown returns how the units using the image should be stopped,
+// according to the shutdown section of its tsuru.yaml.
+func imageShutdown(imageName string) (provision.TsuruYamlShutdown, error) {
+	yamlData, err := getImageTsuruYamlData(imageName)
+	if err != nil {
+		return provision.TsuruYamlShutdown{}, err
+	}
+	err = yamlData.Shutdown.Validate()
+	if err != nil {
+		return provision.TsuruYamlShutdown{}, err
+	}
+	return yamlData.Shutdown, nil
+}
+
 func appBasicImageName(appName string) string {
 	return fmt.Sprintf("%s/app-%s", basicImageName(), appName)
 }
@@ -0,0 +1,93 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/router"
+)
+
+// processPorts returns the ports declared in tsuru.yaml for the given process.
+func processPorts(imageID, processName string) ([]container.ContainerPort, error) {
+	yamlData, err := getImageTsuruYamlData(imageID)
+	if err != nil {
+		return nil, err
+	}
+	var ports []container.ContainerPort
+	for _, p := range yamlData.Ports[processName] {
+		err = p.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid port for process %q: %s", processName, err)
+		}
+		ports = append(ports, container.ContainerPort{Port: p.Port, Protocol: p.TransportProtocol()})
+	}
+	return ports, nil
+}
+
+// containersPortRoutes groups the addresses of the ports exposed by the given
+// containers by port.
+func containersPortRoutes(containers []container.Container) map[router.PortRoute][]*url.URL {
+	routes := make(map[router.PortRoute][]*url.URL)
+	for _, c := range containers {
+		if c.HostAddr == "" {
+			continue
+		}
+		for _, p := range c.Ports {
+			if p.HostPort == "" {
+				continue
+			}
+			port := router.PortRoute{Port: p.Port, Protocol: p.Protocol}
+			routes[port] = append(routes[port], c.PortAddress(p))
+		}
+	}
+	return routes
+}
+
+// addPortRoutes registers the ports exposed by the containers in the router,
+// doing nothing if the router is not able to route TCP traffic.
+func addPortRoutes(r router.Router, appName string, containers []container.Container) error {
+	tcpRouter, ok := r.(router.TCPRouter)
+	if !ok {
+		return nil
+	}
+	routes := containersPortRoutes(containers)
+	var added []router.PortRoute
+	for port, addresses := range routes {
+		err := tcpRouter.AddPortRoutes(appName, port, addresses)
+		if err != nil {
+			for _, p := range added {
+				tcpRouter.RemovePortRoutes(appName, p, routes[p])
+			}
+			return err
+		}
+		added = append(added, port)
+	}
+	return nil
+}
+
+// removePortRoutes removes the ports exposed by the containers from the
+// router, doing nothing if the router is not able to route TCP traffic.
+func removePortRoutes(r router.Router, appName string, containers []container.Container) error {
+	tcpRouter, ok := r.(router.TCPRouter)
+	if !ok {
+		return nil
+	}
+	routes := containersPortRoutes(containers)
+	var removed []router.PortRoute
+	for port, addresses := range routes {
+		err := tcpRouter.RemovePortRoutes(appName, port, addresses)
+		if err != nil {
+			for _, p := range removed {
+				tcpRouter.AddPortRoutes(appName, p, routes[p])
+			}
+			return err
+		}
+		removed = append(removed, port)
+	}
+	return nil
+}
@@ -48,6 +48,7 @@ var (
 
 	ErrEntrypointOrProcfileNotFound = stderr.New("You should provide a entrypoint in image or a Procfile in the following locations: /home/application/current or /app/user or /.")
 	ErrDeployCanceled               = stderr.New("deploy canceled by user action")
+	ErrRestartCanceled              = stderr.New("restart canceled by user action")
 )
 
 func init() {
@@ -95,9 +96,13 @@ func (p *dockerProvisioner) initDockerCluster() error {
 	var nodes []cluster.Node
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
 	maxUsedMemory, _ := config.GetFloat("docker:scheduler:max-used-memory")
+	TotalCPUMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
+	maxUsedCPU, _ := config.GetFloat("docker:scheduler:max-used-cpu")
 	p.scheduler = &segregatedScheduler{
 		maxMemoryRatio:      float32(maxUsedMemory),
 		TotalMemoryMetadata: TotalMemoryMetadata,
+		maxCPURatio:         float32(maxUsedCPU),
+		TotalCPUMetadata:    TotalCPUMetadata,
 		provisioner:         p,
 	}
 	caPath, _ := config.GetString("docker:tls:root-path")
@@ -141,6 +146,15 @@ func (p *dockerProvisioner) initDockerCluster() error {
 		shutdown.Register(contHealerInst)
 		go contHealerInst.RunContainerHealer()
 	}
+	autoRollbackSeconds, _ := config.GetInt("docker:auto-rollback:check-interval")
+	if autoRollbackSeconds > 0 {
+		watcher := &deployWatcher{
+			interval: time.Duration(autoRollbackSeconds) * time.Second,
+			done:     make(chan bool),
+		}
+		shutdown.Register(watcher)
+		go watcher.run()
+	}
 	activeMonitoring, _ := config.GetInt("docker:healing:active-monitoring-interval")
 	if activeMonitoring > 0 {
 		p.cluster.StartActiveMonitoring(time.Duration(activeMonitoring) * time.Second)
@@ -172,8 +186,10 @@ func (p *dockerProvisioner) initAutoScaleConfig() *autoScaleConfig {
 	waitSecondsNewMachine, _ := config.GetInt("docker:auto-scale:wait-new-time")
 	runInterval, _ := config.GetInt("docker:auto-scale:run-interval")
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
+	TotalCPUMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
 	return &autoScaleConfig{
 		TotalMemoryMetadata: TotalMemoryMetadata,
+		TotalCPUMetadata:    TotalCPUMetadata,
 		WaitTimeNewMachine:  time.Duration(waitSecondsNewMachine) * time.Second,
 		RunInterval:         time.Duration(runInterval) * time.Second,
 		Enabled:             enabled,
@@ -192,6 +208,8 @@ func (p *dockerProvisioner) cloneProvisioner(ignoredContainers []container.Conta
 	overridenProvisioner.scheduler = &segregatedScheduler{
 		maxMemoryRatio:      p.scheduler.maxMemoryRatio,
 		TotalMemoryMetadata: p.scheduler.TotalMemoryMetadata,
+		maxCPURatio:         p.scheduler.maxCPURatio,
+		TotalCPUMetadata:    p.scheduler.TotalCPUMetadata,
 		provisioner:         &overridenProvisioner,
 		ignoredContainers:   containerIds,
 	}
@@ -227,6 +245,8 @@ func (p *dockerProvisioner) dryMode(ignoredContainers []container.Container) (*d
 	overridenProvisioner.scheduler = &segregatedScheduler{
 		maxMemoryRatio:      p.scheduler.maxMemoryRatio,
 		TotalMemoryMetadata: p.scheduler.TotalMemoryMetadata,
+		maxCPURatio:         p.scheduler.maxCPURatio,
+		TotalCPUMetadata:    p.scheduler.TotalCPUMetadata,
 		provisioner:         overridenProvisioner,
 		ignoredContainers:   containerIds,
 	}
@@ -311,6 +331,7 @@ func (p *dockerProvisioner) Restart(a provision.App, process string, w io.Writer
 	if w == nil {
 		w = ioutil.Discard
 	}
+	evt := event.FromWriter(w)
 	writer := io.MultiWriter(w, &app.LogWriter{App: a})
 	toAdd := make(map[string]*containersToAdd, len(containers))
 	for _, c := range containers {
@@ -320,8 +341,11 @@ func (p *dockerProvisioner) Restart(a provision.App, process string, w io.Writer
 		toAdd[c.ProcessName].Quantity++
 		toAdd[c.ProcessName].Status = provision.StatusStarted
 	}
-	_, err = p.runReplaceUnitsPipeline(writer, a, toAdd, containers, imageId)
+	_, err = p.runReplaceUnits(writer, evt, a, toAdd, containers, imageId)
 	routesRebuildOrEnqueue(a.GetName())
+	if err == ErrDeployCanceled {
+		return ErrRestartCanceled
+	}
 	return err
 }
 
@@ -406,7 +430,12 @@ func (p *dockerProvisioner) Rollback(a provision.App, imageId string, evt *event
 	if !valid {
 		return "", fmt.Errorf("Image %q not found in app", imageId)
 	}
-	return imageId, p.deploy(a, imageId, evt)
+	err = p.deploy(a, imageId, evt)
+	if err != nil {
+		return "", err
+	}
+	watchDeploy(a, imageId, "", evt)
+	return imageId, nil
 }
 
 func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, evt *event.Event) (string, error) {
@@ -433,28 +462,10 @@ func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, evt *
 	if err != nil {
 		return "", err
 	}
-	fmt.Fprintln(w, "---- Getting process from image ----")
-	cmd := "cat /home/application/current/Procfile || cat /app/user/Procfile || cat /Procfile"
-	output, _ := p.runCommandInContainer(imageId, cmd, app)
-	procfile := getProcessesFromProcfile(output.String())
-	imageInspect, err := cluster.InspectImage(imageId)
+	procfile, imageInspect, err := p.imageProcesses(app, imageId, w)
 	if err != nil {
 		return "", err
 	}
-	if len(procfile) == 0 {
-		fmt.Fprintln(w, "  ---> Procfile not found, trying to get entrypoint")
-		if len(imageInspect.Config.Entrypoint) == 0 {
-			return "", ErrEntrypointOrProcfileNotFound
-		}
-		webProcess := imageInspect.Config.Entrypoint[0]
-		for _, c := range imageInspect.Config.Entrypoint[1:] {
-			webProcess += fmt.Sprintf(" %q", c)
-		}
-		procfile["web"] = webProcess
-	}
-	for k, v := range procfile {
-		fmt.Fprintf(w, "  ---> Process %s found with command: %v\n", k, v)
-	}
 	newImage, err := appNewImageName(app.GetName())
 	if err != nil {
 		return "", err
@@ -480,22 +491,66 @@ func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, evt *
 	if err != nil {
 		return "", err
 	}
-	imageData := createImageMetadata(newImage, procfile)
+	err = saveImageProcesses(newImage, procfile, imageInspect)
+	if err != nil {
+		return "", err
+	}
+	app.SetUpdatePlatform(true)
+	previousImage := rollbackImage(app.GetName())
+	err = p.deploy(app, newImage, evt)
+	if err != nil {
+		return "", err
+	}
+	watchDeploy(app, newImage, previousImage, evt)
+	return newImage, nil
+}
+
+// imageProcesses returns the processes of the app found in the Procfile of
+// the image, or its entrypoint as the web process when there's no Procfile,
+// along with the inspected image.
+func (p *dockerProvisioner) imageProcesses(app provision.App, imageId string, w io.Writer) (map[string]string, *docker.Image, error) {
+	fmt.Fprintln(w, "---- Getting process from image ----")
+	cmd := "cat /home/application/current/Procfile || cat /app/user/Procfile || cat /Procfile"
+	output, _ := p.runCommandInContainer(imageId, cmd, app)
+	procfile := getProcessesFromProcfile(output.String())
+	imageInspect, err := p.Cluster().InspectImage(imageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(procfile) == 0 {
+		fmt.Fprintln(w, "  ---> Procfile not found, trying to get entrypoint")
+		if len(imageInspect.Config.Entrypoint) == 0 {
+			return nil, nil, ErrEntrypointOrProcfileNotFound
+		}
+		webProcess := imageInspect.Config.Entrypoint[0]
+		for _, c := range imageInspect.Config.Entrypoint[1:] {
+			webProcess += fmt.Sprintf(" %q", c)
+		}
+		procfile["web"] = webProcess
+	}
+	for k, v := range procfile {
+		fmt.Fprintf(w, "  ---> Process %s found with command: %v\n", k, v)
+	}
+	return procfile, imageInspect, nil
+}
+
+// saveImageProcesses stores the processes and the exposed port of the image
+// built for an app, so it can be deployed.
+func saveImageProcesses(imageName string, procfile map[string]string, imageInspect *docker.Image) error {
+	imageData := createImageMetadata(imageName, procfile)
 	if len(imageInspect.Config.ExposedPorts) > 1 {
-		return "", stderr.New("Too many ports. You should especify which one you want to.")
+		return stderr.New("Too many ports. You should especify which one you want to.")
 	}
 	for k := range imageInspect.Config.ExposedPorts {
 		imageData.CustomData["exposedPort"] = string(k)
 	}
-	err = saveImageCustomData(newImage, imageData.CustomData)
-	if err != nil {
-		return "", err
-	}
-	app.SetUpdatePlatform(true)
-	return newImage, p.deploy(app, newImage, evt)
+	return saveImageCustomData(imageName, imageData.CustomData)
 }
 
-func (p *dockerProvisioner) ArchiveDeploy(app provision.App, archiveURL string, evt *event.Event) (string, error) {
+func (p *dockerProvisioner) ArchiveDeploy(app provision.App, archiveURL string, dockerfile bool, evt *event.Event) (string, error) {
+	if dockerfile {
+		return p.dockerfileDeploy(app, nil, archiveURL, evt)
+	}
 	imageId, err := p.archiveDeploy(app, p.getBuildImage(app), archiveURL, evt)
 	if err != nil {
 		return "", err
@@ -503,17 +558,27 @@ func (p *dockerProvisioner) ArchiveDeploy(app provision.App, archiveURL string,
 	return imageId, p.deployAndClean(app, imageId, evt)
 }
 
-func (p *dockerProvisioner) UploadDeploy(app provision.App, archiveFile io.ReadCloser, fileSize int64, build bool, evt *event.Event) (string, error) {
+func (p *dockerProvisioner) UploadDeploy(app provision.App, archiveFile io.ReadCloser, fileSize int64, build, dockerfile bool, evt *event.Event) (string, error) {
 	if build {
 		return "", stderr.New("running UploadDeploy with build=true is not yet supported")
 	}
+	defer archiveFile.Close()
+	if !dockerfile {
+		var err error
+		dockerfile, err = detectDockerfile(archiveFile, evt)
+		if err != nil {
+			return "", err
+		}
+	}
+	if dockerfile {
+		return p.dockerfileDeploy(app, archiveFile, "", evt)
+	}
 	dirPath := "/home/application/"
 	filePath := fmt.Sprintf("%sarchive.tar.gz", dirPath)
 	user, err := config.GetString("docker:user")
 	if err != nil {
 		user, _ = config.GetString("docker:ssh:user")
 	}
-	defer archiveFile.Close()
 	imageName := p.getBuildImage(app)
 	options := docker.CreateContainerOptions{
 		Config: &docker.Config{
@@ -608,11 +673,14 @@ func (p *dockerProvisioner) UploadDeploy(app provision.App, archiveFile io.ReadC
 }
 
 func (p *dockerProvisioner) deployAndClean(a provision.App, imageId string, evt *event.Event) error {
+	previousImage := rollbackImage(a.GetName())
 	err := p.deploy(a, imageId, evt)
 	if err != nil {
 		p.cleanImage(a.GetName(), imageId)
+		return err
 	}
-	return err
+	watchDeploy(a, imageId, previousImage, evt)
+	return nil
 }
 
 func (p *dockerProvisioner) deploy(a provision.App, imageId string, evt *event.Event) error {
@@ -646,7 +714,7 @@ func (p *dockerProvisioner) deploy(a provision.App, imageId string, evt *event.E
 		if err = setQuota(a, toAdd); err != nil {
 			return err
 		}
-		_, err = p.runReplaceUnitsPipeline(evt, a, toAdd, containers, imageId)
+		_, err = p.runReplaceUnits(evt, evt, a, toAdd, containers, imageId)
 	}
 	routesRebuildOrEnqueue(a.GetName())
 	return err
@@ -775,6 +843,29 @@ func (p *dockerProvisioner) runRestartAfterHooks(cont *container.Container, w io
 	return nil
 }
 
+// checkProcessUnitLimit returns an error if the process would have more units
+// than its limit once the units being replaced are removed.
+func checkProcessUnitLimit(args *changeUnitsPipelineArgs, processName string, toAdd int) error {
+	max := args.app.GetMaxUnits(processName)
+	if max == 0 {
+		return nil
+	}
+	containers, err := args.provisioner.listContainersByProcess(args.app.GetName(), processName)
+	if err != nil {
+		return err
+	}
+	total := len(containers) + toAdd
+	for _, c := range args.toRemove {
+		if c.ProcessName == processName {
+			total--
+		}
+	}
+	if total > max {
+		return &app.ProcessUnitLimitError{Process: processName, Max: max, Requested: total}
+	}
+	return nil
+}
+
 func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container.Container, error) {
 	a := args.app
 	w := args.writer
@@ -787,6 +878,10 @@ func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container.Container
 			_, processName, _ = processCmdForImage(processName, imageId)
 		}
 		processMsg = append(processMsg, fmt.Sprintf("[%s: %d]", processName, v.Quantity))
+		err := checkProcessUnitLimit(args, processName, v.Quantity)
+		if err != nil {
+			return nil, err
+		}
 	}
 	var destinationHost []string
 	if args.toHost != "" {
@@ -954,10 +1049,14 @@ func (p *dockerProvisioner) SetUnitStatus(unit provision.Unit, status provision.
 	if unit.AppName != "" && cont.AppName != unit.AppName {
 		return stderr.New("wrong app name")
 	}
+	previousStatus := cont.Status
 	err = cont.SetStatus(p, status, true)
 	if err != nil {
 		return err
 	}
+	if status == provision.StatusError && previousStatus != provision.StatusError.String() {
+		countDeployWatchError(cont)
+	}
 	return p.checkContainer(cont)
 }
 
@@ -1029,6 +1128,7 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&rebalanceContainersCmd{},
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
+		&drainNodeCmd{},
 		&listNodesInTheSchedulerCmd{},
 		&healer.ListHealingHistoryCmd{},
 		&healer.GetNodeHealingConfigCmd{},
@@ -1042,6 +1142,8 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&updateNodeToSchedulerCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&schedulerInfo{},
+		&schedulerUpdate{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
@@ -1185,6 +1287,14 @@ func (p *dockerProvisioner) RoutableUnits(app provision.App) ([]provision.Unit,
 	return units, nil
 }
 
+func (p *dockerProvisioner) RoutablePorts(app provision.App) (map[router.PortRoute][]*url.URL, error) {
+	containers, err := p.listContainersByApp(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return containersPortRoutes(containers), nil
+}
+
 func (p *dockerProvisioner) RegisterUnit(unit provision.Unit, customData map[string]interface{}) error {
 	cont, err := p.GetContainer(unit.ID)
 	if err != nil {
@@ -1379,6 +1489,10 @@ func (n *clusterNodeWrapper) Pool() string {
 	return n.node.Metadata["pool"]
 }
 
+func (n *clusterNodeWrapper) Metadata() map[string]string {
+	return n.node.Metadata
+}
+
 func (p *dockerProvisioner) ListNodes(addressFilter []string) ([]provision.Node, error) {
 	nodes, err := p.Cluster().Nodes()
 	if err != nil {
@@ -38,6 +38,7 @@ import (
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/routertest"
 	"github.com/tsuru/tsuru/safe"
 	"gopkg.in/check.v1"
@@ -1393,6 +1394,29 @@ func (s *S) TestProvisionerAddUnits(c *check.C) {
 	c.Assert(count, check.Equals, 4)
 }
 
+func (s *S) TestProvisionerAddUnitsProcessUnitLimit(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp", nil)
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	a.Deploys = 1
+	a.ProcessMaxUnits = map[string]int{"web": 3}
+	s.p.Provision(a)
+	defer s.p.Destroy(a)
+	coll := s.p.Collection()
+	defer coll.Close()
+	defer coll.RemoveAll(bson.M{"appname": a.GetName()})
+	_, err = s.newContainer(&newContainerOpts{AppName: a.GetName()}, nil)
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnits(a, 3, "web", nil)
+	c.Assert(err, check.DeepEquals, &app.ProcessUnitLimitError{Process: "web", Max: 3, Requested: 4})
+	units, err := s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	count, err := coll.Find(bson.M{"appname": a.GetName()}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 3)
+}
+
 func (s *S) TestProvisionerAddUnitsInvalidProcess(c *check.C) {
 	err := s.newFakeImage(s.p, "tsuru/app-myapp", nil)
 	c.Assert(err, check.IsNil)
@@ -2085,6 +2109,7 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&rebalanceContainersCmd{},
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
+		&drainNodeCmd{},
 		&listNodesInTheSchedulerCmd{},
 		&healer.ListHealingHistoryCmd{},
 		&healer.GetNodeHealingConfigCmd{},
@@ -2098,6 +2123,8 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&updateNodeToSchedulerCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&schedulerInfo{},
+		&schedulerUpdate{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
@@ -3211,6 +3238,35 @@ func (s *S) TestProvisionerRoutableUnits(c *check.C) {
 	})
 }
 
+func (s *S) TestProvisionerRoutablePorts(c *check.C) {
+	coll := s.p.Collection()
+	defer coll.Close()
+	err := coll.Insert(
+		container.Container{
+			ID: "c1", AppName: "myapp", ProcessName: "broker", HostAddr: "10.10.10.10", HostPort: "1234",
+			Ports: []container.ContainerPort{{Port: 1883, Protocol: "tcp", HostPort: "32001"}},
+		},
+		container.Container{
+			ID: "c2", AppName: "myapp", ProcessName: "broker", HostAddr: "10.10.10.11",
+			Ports: []container.ContainerPort{{Port: 1883, Protocol: "tcp", HostPort: "32002"}},
+		},
+		container.Container{ID: "c3", AppName: "myapp", ProcessName: "web", HostAddr: "10.10.10.10", HostPort: "1235"},
+		container.Container{
+			ID: "c4", AppName: "otherapp", ProcessName: "broker", HostAddr: "10.10.10.12",
+			Ports: []container.ContainerPort{{Port: 1883, Protocol: "tcp", HostPort: "32003"}},
+		},
+	)
+	c.Assert(err, check.IsNil)
+	routes, err := s.p.RoutablePorts(provisiontest.NewFakeApp("myapp", "python", 0))
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, map[router.PortRoute][]*url.URL{
+		{Port: 1883, Protocol: "tcp"}: {
+			{Scheme: "tcp", Host: "10.10.10.10:32001"},
+			{Scheme: "tcp", Host: "10.10.10.11:32002"},
+		},
+	})
+}
+
 func (s *S) TestProvisionerRoutableUnitsInvalidContainers(c *check.C) {
 	appName := "my-fake-app"
 	fakeApp := provisiontest.NewFakeApp(appName, "python", 0)
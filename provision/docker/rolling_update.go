@@ -0,0 +1,227 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+// rollingBatch is a step in the rolling update of a process. Units in
+// toRemoveFirst are removed before the new units are created, making room for
+// them when the surge is limited, while units in toReplace are only removed
+// after the new units are bound and healthy.
+type rollingBatch struct {
+	process       string
+	status        provision.Status
+	toAdd         int
+	toRemoveFirst []container.Container
+	toReplace     []container.Container
+}
+
+// planRollingBatches splits the replacement of the units of each process in
+// batches that keep the number of units of the process within the surge and
+// unavailability limits of the rolling update.
+func planRollingBatches(r provision.RollingUpdate, toAdd map[string]*containersToAdd, toRemove []container.Container) []rollingBatch {
+	oldByProcess := make(map[string][]container.Container)
+	var processes []string
+	for _, c := range toRemove {
+		if _, ok := oldByProcess[c.ProcessName]; !ok {
+			processes = append(processes, c.ProcessName)
+		}
+		oldByProcess[c.ProcessName] = append(oldByProcess[c.ProcessName], c)
+	}
+	for name := range toAdd {
+		if _, ok := oldByProcess[name]; !ok {
+			processes = append(processes, name)
+			oldByProcess[name] = nil
+		}
+	}
+	sort.Strings(processes)
+	size := r.MaxSurge + r.MaxUnavailable
+	if r.BatchSize > 0 && r.BatchSize < size {
+		size = r.BatchSize
+	}
+	var batches []rollingBatch
+	for _, process := range processes {
+		old := oldByProcess[process]
+		var quantity int
+		var status provision.Status
+		if ct, ok := toAdd[process]; ok {
+			quantity = ct.Quantity
+			status = ct.Status
+		}
+		for quantity > 0 || len(old) > 0 {
+			batch := rollingBatch{process: process, status: status}
+			if quantity == 0 {
+				n := minInt(len(old), size)
+				batch.toReplace, old = old[:n], old[n:]
+				batches = append(batches, batch)
+				continue
+			}
+			batch.toAdd = minInt(quantity, size)
+			quantity -= batch.toAdd
+			first := minInt(batch.toAdd-minInt(batch.toAdd, r.MaxSurge), len(old))
+			batch.toRemoveFirst, old = old[:first], old[first:]
+			replace := minInt(batch.toAdd-first, len(old))
+			batch.toReplace, old = old[:replace], old[replace:]
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// runReplaceUnits replaces the units of the app, in batches when the app has
+// a rolling update configured or all at once otherwise.
+func (p *dockerProvisioner) runReplaceUnits(w io.Writer, evt *event.Event, a provision.App, toAdd map[string]*containersToAdd, toRemove []container.Container, imageId string) ([]container.Container, error) {
+	if !p.isDryMode && a.GetRollingUpdate().Enabled() {
+		return p.runRollingReplaceUnits(w, evt, a, toAdd, toRemove, imageId)
+	}
+	return p.runReplaceUnitsPipeline(w, a, toAdd, toRemove, imageId)
+}
+
+// rollingUpdateSleep is used to pause between batches, replaced in tests.
+var rollingUpdateSleep = time.Sleep
+
+// runRollingReplaceUnits replaces the units of the app in batches, following
+// its rolling update settings. The image of the app is only changed after all
+// batches succeed. If a batch fails, or the event is canceled, units created
+// by the previous batches are replaced again by units using the current image
+// of the app.
+func (p *dockerProvisioner) runRollingReplaceUnits(w io.Writer, evt *event.Event, a provision.App, toAdd map[string]*containersToAdd, toRemove []container.Container, imageId string) ([]container.Container, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	r := a.GetRollingUpdate()
+	batches := planRollingBatches(r, toAdd, toRemove)
+	fmt.Fprintf(w, "\n---- Rolling update of %d %s in %d batches (max surge: %d, max unavailable: %d) ----\n",
+		len(toRemove), pluralize("unit", len(toRemove)), len(batches), r.MaxSurge, r.MaxUnavailable)
+	var added []container.Container
+	// missing counts the units removed without a replacement, per process.
+	missing := make(map[string]int)
+	for i, batch := range batches {
+		if i > 0 && r.Pause > 0 {
+			fmt.Fprintf(w, "\n---- Waiting %d seconds before the next batch ----\n", r.Pause)
+			rollingUpdateSleep(time.Duration(r.Pause) * time.Second)
+		}
+		err := checkCanceled(evt)
+		if err != nil {
+			return nil, p.rollbackRollingUpdate(w, a, added, missing, err)
+		}
+		fmt.Fprintf(w, "\n---- Batch %d/%d: starting %d new and removing %d old units of process %q ----\n",
+			i+1, len(batches), batch.toAdd, len(batch.toRemoveFirst)+len(batch.toReplace), batch.process)
+		if len(batch.toRemoveFirst) > 0 {
+			_, err = p.runRollingBatchPipeline(w, evt, a, nil, batch.toRemoveFirst, imageId)
+			if err != nil {
+				return nil, p.rollbackRollingUpdate(w, a, added, missing, err)
+			}
+			missing[batch.process] += len(batch.toRemoveFirst)
+		}
+		var batchToAdd map[string]*containersToAdd
+		if batch.toAdd > 0 {
+			batchToAdd = map[string]*containersToAdd{
+				batch.process: {Quantity: batch.toAdd, Status: batch.status},
+			}
+		}
+		newContainers, err := p.runRollingBatchPipeline(w, evt, a, batchToAdd, batch.toReplace, imageId)
+		if err != nil {
+			return nil, p.rollbackRollingUpdate(w, a, added, missing, err)
+		}
+		missing[batch.process] -= len(batch.toRemoveFirst)
+		added = append(added, newContainers...)
+	}
+	args := changeUnitsPipelineArgs{
+		app:         a,
+		writer:      w,
+		imageId:     imageId,
+		provisioner: p,
+	}
+	err := action.NewPipeline(&updateAppImage).Execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (p *dockerProvisioner) runRollingBatchPipeline(w io.Writer, evt *event.Event, a provision.App, toAdd map[string]*containersToAdd, toRemove []container.Container, imageId string) ([]container.Container, error) {
+	args := changeUnitsPipelineArgs{
+		app:         a,
+		toAdd:       toAdd,
+		toRemove:    toRemove,
+		writer:      w,
+		imageId:     imageId,
+		provisioner: p,
+		event:       evt,
+	}
+	pipeline := action.NewPipeline(
+		&provisionAddUnitsToHost,
+		&bindAndHealthcheck,
+		&addNewRoutes,
+		&setRouterHealthcheck,
+		&removeOldRoutes,
+		&provisionRemoveOldUnits,
+		&provisionUnbindOldUnits,
+	)
+	err := pipeline.Execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return pipeline.Result().([]container.Container), nil
+}
+
+// rollbackRollingUpdate replaces the units created by a failed rolling update
+// with units using the current image of the app, and starts units in place of
+// the ones removed without a replacement. It always returns the error that
+// caused the rollback.
+func (p *dockerProvisioner) rollbackRollingUpdate(w io.Writer, a provision.App, added []container.Container, missing map[string]int, cause error) error {
+	currentImage, err := appCurrentImageName(a.GetName())
+	if err != nil {
+		log.Errorf("[rolling update] unable to get the current image of %q for rollback: %s", a.GetName(), err)
+		return cause
+	}
+	toAdd := make(map[string]*containersToAdd)
+	var toRemove []container.Container
+	for process, n := range missing {
+		if n > 0 {
+			toAdd[process] = &containersToAdd{Quantity: n, Status: provision.StatusStarted}
+		}
+	}
+	for _, c := range added {
+		if c.Image == currentImage {
+			continue
+		}
+		toRemove = append(toRemove, c)
+		if _, ok := toAdd[c.ProcessName]; !ok {
+			toAdd[c.ProcessName] = &containersToAdd{Status: provision.StatusStarted}
+		}
+		toAdd[c.ProcessName].Quantity++
+	}
+	if len(toAdd) == 0 {
+		return cause
+	}
+	fmt.Fprintf(w, "\n---- Rolling update failed: %s. Restoring units with the current image ----\n", cause)
+	_, err = p.runRollingBatchPipeline(w, nil, a, toAdd, toRemove, currentImage)
+	if err != nil {
+		log.Errorf("[rolling update] unable to roll back units of %q: %s", a.GetName(), err)
+		fmt.Fprintf(w, "\n---- Unable to restore units: %s ----\n", err)
+	}
+	return cause
+}
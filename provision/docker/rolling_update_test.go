@@ -0,0 +1,159 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+)
+
+func batchSummary(batches []rollingBatch) [][4]interface{} {
+	result := make([][4]interface{}, len(batches))
+	for i, b := range batches {
+		result[i] = [4]interface{}{b.process, b.toAdd, len(b.toRemoveFirst), len(b.toReplace)}
+	}
+	return result
+}
+
+func (s *S) TestPlanRollingBatches(c *check.C) {
+	old := []container.Container{
+		{ID: "w1", ProcessName: "web"},
+		{ID: "w2", ProcessName: "web"},
+		{ID: "w3", ProcessName: "web"},
+		{ID: "k1", ProcessName: "worker"},
+		{ID: "o1", ProcessName: "old"},
+	}
+	toAdd := map[string]*containersToAdd{
+		"web":    {Quantity: 3, Status: provision.StatusStarted},
+		"worker": {Quantity: 1, Status: provision.StatusStarted},
+		"new":    {Quantity: 1, Status: provision.StatusStarted},
+	}
+	tests := []struct {
+		rolling  provision.RollingUpdate
+		expected [][4]interface{}
+	}{
+		{
+			rolling: provision.RollingUpdate{MaxSurge: 1},
+			expected: [][4]interface{}{
+				{"new", 1, 0, 0},
+				{"old", 0, 0, 1},
+				{"web", 1, 0, 1},
+				{"web", 1, 0, 1},
+				{"web", 1, 0, 1},
+				{"worker", 1, 0, 1},
+			},
+		},
+		{
+			rolling: provision.RollingUpdate{MaxSurge: 1, MaxUnavailable: 1},
+			expected: [][4]interface{}{
+				{"new", 1, 0, 0},
+				{"old", 0, 0, 1},
+				{"web", 2, 1, 1},
+				{"web", 1, 0, 1},
+				{"worker", 1, 0, 1},
+			},
+		},
+		{
+			rolling: provision.RollingUpdate{MaxUnavailable: 3, BatchSize: 2},
+			expected: [][4]interface{}{
+				{"new", 1, 0, 0},
+				{"old", 0, 0, 1},
+				{"web", 2, 2, 0},
+				{"web", 1, 1, 0},
+				{"worker", 1, 1, 0},
+			},
+		},
+	}
+	for i, tt := range tests {
+		batches := planRollingBatches(tt.rolling, toAdd, old)
+		c.Check(batchSummary(batches), check.DeepEquals, tt.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestProvisionerRestartRollingUpdate(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	a.RollingUpdate = provision.RollingUpdate{MaxSurge: 1, Pause: 5}
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python web.py",
+		},
+	}
+	oldIDs := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		cont, err := s.newContainer(&newContainerOpts{
+			AppName:         a.GetName(),
+			ProcessName:     "web",
+			ImageCustomData: customData,
+			Image:           "tsuru/app-" + a.GetName(),
+		}, nil)
+		c.Assert(err, check.IsNil)
+		defer s.removeTestContainer(cont)
+		oldIDs[cont.ID] = true
+	}
+	var pauses []time.Duration
+	rollingUpdateSleep = func(d time.Duration) {
+		pauses = append(pauses, d)
+	}
+	defer func() { rollingUpdateSleep = time.Sleep }()
+	var buf bytes.Buffer
+	err := s.p.Restart(a, "", &buf)
+	c.Assert(err, check.IsNil)
+	dbConts, err := s.p.listAllContainers()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbConts, check.HasLen, 3)
+	for _, cont := range dbConts {
+		c.Assert(oldIDs[cont.ID], check.Equals, false)
+		c.Assert(cont.Image, check.Equals, "tsuru/app-"+a.GetName())
+	}
+	c.Assert(pauses, check.DeepEquals, []time.Duration{5 * time.Second, 5 * time.Second})
+	c.Assert(buf.String(), check.Matches, `(?s).*Rolling update of 3 units in 3 batches.*Batch 3/3.*`)
+}
+
+// wrappedEventWriter wraps an event, like writers adding output to the
+// event log.
+type wrappedEventWriter struct {
+	event.Writer
+}
+
+func (s *S) TestProvisionerRestartRollingUpdateCanceled(c *check.C) {
+	a := provisiontest.NewFakeApp("almah", "static", 1)
+	a.RollingUpdate = provision.RollingUpdate{MaxSurge: 1}
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python web.py",
+		},
+	}
+	cont, err := s.newContainer(&newContainerOpts{
+		AppName:         a.GetName(),
+		ProcessName:     "web",
+		ImageCustomData: customData,
+		Image:           "tsuru/app-" + a.GetName(),
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:       permission.PermAppUpdateRestart,
+		Owner:      s.token,
+		Cancelable: true,
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.TryCancel("because yes", "admin@example.com")
+	c.Assert(err, check.IsNil)
+	err = s.p.Restart(a, "", &wrappedEventWriter{Writer: evt})
+	c.Assert(err, check.Equals, ErrRestartCanceled)
+	evt.Done(err)
+	dbConts, err := s.p.listAllContainers()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbConts, check.HasLen, 1)
+	c.Assert(dbConts[0].ID, check.Equals, cont.ID)
+}
@@ -7,7 +7,6 @@ package docker
 import (
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
 	"sync"
 
@@ -30,6 +29,8 @@ type segregatedScheduler struct {
 	hostMutex           sync.Mutex
 	maxMemoryRatio      float32
 	TotalMemoryMetadata string
+	maxCPURatio         float32
+	TotalCPUMetadata    string
 	provisioner         *dockerProvisioner
 	// ignored containers is only set in provisioner returned by
 	// cloneProvisioner which will set this field to exclude some container
@@ -49,11 +50,27 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
-	nodes, err = s.filterByMemoryUsage(a, nodes, s.maxMemoryRatio, s.TotalMemoryMetadata)
+	var constraints []app.PlacementConstraint
+	if a != nil {
+		constraints = a.ConstraintsForProcess(schedOpts.ProcessName)
+	}
+	nodes, err = filterByRequiredConstraints(nodes, constraints)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
+	nodes, err = filterByVolumes(schedOpts.AppName, nodes)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
+	nodes, err = s.filterByResourceUsage(a, schedOpts.ProcessName, nodes)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
-	node, err := s.chooseNodeToAdd(nodes, opts.Name, schedOpts.AppName, schedOpts.ProcessName)
+	node, err := s.chooseNodeToAdd(nodes, opts.Name, schedOpts.AppName, schedOpts.ProcessName, constraints...)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
+	err = prepareVolumes(c, schedOpts.AppName, node)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
@@ -63,10 +80,40 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	return cluster.Node{Address: node}, nil
 }
 
-func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.Node, maxMemoryRatio float32, TotalMemoryMetadata string) ([]cluster.Node, error) {
-	if maxMemoryRatio == 0 || TotalMemoryMetadata == "" {
+// hostReservation is the memory and cpu reserved by the plans of the units in
+// a host.
+type hostReservation struct {
+	memory int64
+	cpu    float64
+}
+
+// filterByResourceUsage removes the nodes that would go over their memory or
+// cpu limits with a new unit of the process.
+func (s *segregatedScheduler) filterByResourceUsage(a *app.App, process string, nodes []cluster.Node) ([]cluster.Node, error) {
+	checkMemory := s.maxMemoryRatio != 0 && s.TotalMemoryMetadata != ""
+	checkCPU := s.maxCPURatio != 0 && s.TotalCPUMetadata != ""
+	if !checkMemory && !checkCPU {
 		return nodes, nil
 	}
+	reserved, err := s.reservationsByHost(nodes)
+	if err != nil {
+		return nil, err
+	}
+	if checkMemory {
+		nodes, err = filterByMemoryUsage(a, process, nodes, reserved, s.maxMemoryRatio, s.TotalMemoryMetadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if checkCPU {
+		nodes, err = filterByCPUUsage(a, process, nodes, reserved, s.maxCPURatio, s.TotalCPUMetadata)
+	}
+	return nodes, err
+}
+
+// reservationsByHost returns the resources reserved in each of the given
+// nodes, loading each app with units in them only once.
+func (s *segregatedScheduler) reservationsByHost(nodes []cluster.Node) (map[string]hostReservation, error) {
 	hosts := make([]string, len(nodes))
 	for i := range nodes {
 		hosts[i] = net.URLToHost(nodes[i].Address)
@@ -75,14 +122,28 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 	if err != nil {
 		return nil, err
 	}
-	hostReserved := make(map[string]int64)
+	apps := make(map[string]*app.App)
+	reserved := make(map[string]hostReservation)
 	for _, cont := range containers {
-		contApp, err := app.GetByName(cont.AppName)
-		if err != nil {
-			return nil, err
+		contApp, ok := apps[cont.AppName]
+		if !ok {
+			contApp, err = app.GetByName(cont.AppName)
+			if err != nil {
+				return nil, err
+			}
+			apps[cont.AppName] = contApp
 		}
-		hostReserved[cont.HostAddr] += contApp.Plan.Memory
+		plan := contApp.PlanForProcess(cont.ProcessName)
+		r := reserved[cont.HostAddr]
+		r.memory += plan.Memory
+		r.cpu += plan.CpuLimit
+		reserved[cont.HostAddr] = r
 	}
+	return reserved, nil
+}
+
+func filterByMemoryUsage(a *app.App, process string, nodes []cluster.Node, reserved map[string]hostReservation, maxMemoryRatio float32, TotalMemoryMetadata string) ([]cluster.Node, error) {
+	plan := a.PlanForProcess(process)
 	megabyte := float64(1024 * 1024)
 	nodeList := make([]cluster.Node, 0, len(nodes))
 	for _, node := range nodes {
@@ -91,11 +152,11 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 		if totalMemory != 0 {
 			maxMemory := totalMemory * float64(maxMemoryRatio)
 			host := net.URLToHost(node.Address)
-			nodeReserved := hostReserved[host] + a.Plan.Memory
+			nodeReserved := reserved[host].memory + plan.Memory
 			if nodeReserved > int64(maxMemory) {
 				shouldAdd = false
-				tryingToReserveMB := float64(a.Plan.Memory) / megabyte
-				reservedMB := float64(hostReserved[host]) / megabyte
+				tryingToReserveMB := float64(plan.Memory) / megabyte
+				reservedMB := float64(reserved[host].memory) / megabyte
 				limitMB := maxMemory / megabyte
 				log.Errorf("Node %q has reached its memory limit. "+
 					"Limit %0.4fMB. Reserved: %0.4fMB. Needed additional %0.4fMB",
@@ -107,20 +168,51 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 		}
 	}
 	if len(nodeList) == 0 {
-		autoScaleEnabled, _ := config.GetBool("docker:auto-scale:enabled")
 		errMsg := fmt.Sprintf("no nodes found with enough memory for container of %q: %0.4fMB",
-			a.Name, float64(a.Plan.Memory)/megabyte)
-		if autoScaleEnabled {
-			// Allow going over quota temporarily because auto-scale will be
-			// able to detect this and automatically add a new nodes.
-			log.Errorf("WARNING: %s. Will ignore memory restrictions.", errMsg)
-			return nodes, nil
+			a.Name, float64(plan.Memory)/megabyte)
+		return nodesOverLimit(nodes, "memory", errMsg)
+	}
+	return nodeList, nil
+}
+
+func filterByCPUUsage(a *app.App, process string, nodes []cluster.Node, reserved map[string]hostReservation, maxCPURatio float32, TotalCPUMetadata string) ([]cluster.Node, error) {
+	plan := a.PlanForProcess(process)
+	nodeList := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		totalCPU, _ := strconv.ParseFloat(node.Metadata[TotalCPUMetadata], 64)
+		if totalCPU != 0 {
+			maxCPU := totalCPU * float64(maxCPURatio)
+			host := net.URLToHost(node.Address)
+			if reserved[host].cpu+plan.CpuLimit > maxCPU {
+				log.Errorf("Node %q has reached its cpu limit. "+
+					"Limit %0.4f CPUs. Reserved: %0.4f CPUs. Needed additional %0.4f CPUs",
+					host, maxCPU, reserved[host].cpu, plan.CpuLimit)
+				continue
+			}
 		}
-		return nil, errors.New(errMsg)
+		nodeList = append(nodeList, node)
+	}
+	if len(nodeList) == 0 {
+		errMsg := fmt.Sprintf("no nodes found with enough cpu for container of %q: %0.4f CPUs",
+			a.Name, plan.CpuLimit)
+		return nodesOverLimit(nodes, "cpu", errMsg)
 	}
 	return nodeList, nil
 }
 
+// nodesOverLimit handles the lack of nodes with enough of the resource,
+// failing with errMsg unless auto scale is enabled.
+func nodesOverLimit(nodes []cluster.Node, resource, errMsg string) ([]cluster.Node, error) {
+	autoScaleEnabled, _ := config.GetBool("docker:auto-scale:enabled")
+	if autoScaleEnabled {
+		// Allow going over quota temporarily because auto-scale will be
+		// able to detect this and automatically add new nodes.
+		log.Errorf("WARNING: %s. Will ignore %s restrictions.", errMsg, resource)
+		return nodes, nil
+	}
+	return nil, errors.New(errMsg)
+}
+
 type nodeAggregate struct {
 	HostAddr string `bson:"_id"`
 	Count    int
@@ -171,6 +263,11 @@ func (s *segregatedScheduler) GetRemovableContainer(appName string, process stri
 	if err != nil {
 		return "", err
 	}
+	if a != nil {
+		if constraints := a.ConstraintsForProcess(process); len(constraints) > 0 {
+			return s.chooseContainerToRemoveConstrained(nodes, appName, process, constraints)
+		}
+	}
 	return s.chooseContainerToRemove(nodes, appName, process)
 }
 
@@ -218,12 +315,16 @@ func (s *segregatedScheduler) nodesToHosts(nodes []cluster.Node) ([]string, map[
 	return hosts, hostsMap
 }
 
-// chooseNodeToAdd finds which is the node with the minimum number of containers
-// and returns it
-func (s *segregatedScheduler) chooseNodeToAdd(nodes []cluster.Node, contName string, appName, process string) (string, error) {
+// chooseNodeToAdd finds which is the node with the minimum number of containers,
+// among the ones best satisfying the placement constraints, and returns it
+func (s *segregatedScheduler) chooseNodeToAdd(nodes []cluster.Node, contName string, appName, process string, constraints ...app.PlacementConstraint) (string, error) {
 	log.Debugf("[scheduler] Possible nodes for container %s: %#v", contName, nodes)
 	s.hostMutex.Lock()
 	defer s.hostMutex.Unlock()
+	nodes, err := s.filterByPreferredConstraints(nodes, appName, process, constraints)
+	if err != nil {
+		return "", err
+	}
 	chosenNode, _, err := s.minMaxNodes(nodes, appName, process)
 	if err != nil {
 		return "", err
@@ -264,9 +365,11 @@ func appGroupCount(hostGroups map[string]int, appCountHost map[string]int) map[s
 	return result
 }
 
-// Find the host with the minimum (good to add a new container) and maximum
-// (good to remove a container) value for the pair [(number of containers for
-// app-process), (number of containers in host)]
+// Find the host best suited to receive a new container and the host best
+// suited to have a container removed, according to the scheduler strategy
+// configured for the pool of the nodes. The default strategy picks the
+// minimum and maximum values for the pair [(number of containers for
+// app-process), (number of containers in host)].
 func (s *segregatedScheduler) minMaxNodes(nodes []cluster.Node, appName, process string) (string, string, error) {
 	nodesPtr := make([]*cluster.Node, len(nodes))
 	for i := range nodes {
@@ -291,23 +394,24 @@ func (s *segregatedScheduler) minMaxNodes(nodes []cluster.Node, appName, process
 	if err != nil {
 		return "", "", err
 	}
-	priorityEntries := []map[string]int{appGroupCount(hostGroupMap, appCountMap), appCountMap, hostCountMap}
-	var minHost, maxHost string
-	var minScore uint64 = math.MaxUint64
-	var maxScore uint64 = 0
-	for _, host := range hosts {
-		var score uint64
-		for i, e := range priorityEntries {
-			score += uint64(e[host]) << uint((len(priorityEntries)-i-1)*(64/len(priorityEntries)))
-		}
-		if score < minScore {
-			minScore = score
-			minHost = host
-		}
-		if score > maxScore {
-			maxScore = score
-			maxHost = host
+	var pool string
+	if len(nodes) > 0 {
+		pool = nodes[0].Metadata[poolMetadataName]
+	}
+	strategy, err := strategyForPool(pool)
+	if err != nil {
+		return "", "", err
+	}
+	groupCountMap := appGroupCount(hostGroupMap, appCountMap)
+	stats := make([]hostContainerStats, len(hosts))
+	for i, host := range hosts {
+		stats[i] = hostContainerStats{
+			host:       host,
+			groupCount: groupCountMap[host],
+			appCount:   appCountMap[host],
+			totalCount: hostCountMap[host],
 		}
 	}
+	minHost, maxHost := strategy.chooseHosts(stats)
 	return hostsMap[minHost], hostsMap[maxHost], nil
 }
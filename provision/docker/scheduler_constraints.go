@@ -0,0 +1,151 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/net"
+)
+
+func constraintsOfKind(constraints []app.PlacementConstraint, kind string) []app.PlacementConstraint {
+	var result []app.PlacementConstraint
+	for _, c := range constraints {
+		if c.Kind == kind {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func matchesAllConstraints(node *cluster.Node, constraints []app.PlacementConstraint) bool {
+	for _, c := range constraints {
+		if !c.Matches(node.Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterByRequiredConstraints returns the nodes satisfying all require
+// constraints, failing if there are none.
+func filterByRequiredConstraints(nodes []cluster.Node, constraints []app.PlacementConstraint) ([]cluster.Node, error) {
+	required := constraintsOfKind(constraints, app.ConstraintRequire)
+	if len(required) == 0 {
+		return nodes, nil
+	}
+	result := make([]cluster.Node, 0, len(nodes))
+	for i := range nodes {
+		if matchesAllConstraints(&nodes[i], required) {
+			result = append(result, nodes[i])
+		}
+	}
+	if len(result) == 0 {
+		names := make([]string, len(required))
+		for i, c := range required {
+			names[i] = c.String()
+		}
+		return nil, fmt.Errorf("no nodes found matching the placement constraints: %s", strings.Join(names, ", "))
+	}
+	return result, nil
+}
+
+// filterByPreferredConstraints narrows the nodes to the ones satisfying most
+// prefer constraints and then, for each spread constraint, to the group of
+// nodes with the fewest containers of the app process.
+func (s *segregatedScheduler) filterByPreferredConstraints(nodes []cluster.Node, appName, process string, constraints []app.PlacementConstraint) ([]cluster.Node, error) {
+	preferred := constraintsOfKind(constraints, app.ConstraintPrefer)
+	if len(preferred) > 0 {
+		var best []cluster.Node
+		bestMatches := -1
+		for _, n := range nodes {
+			var matches int
+			for _, c := range preferred {
+				if c.Matches(n.Metadata) {
+					matches++
+				}
+			}
+			if matches > bestMatches {
+				best, bestMatches = nil, matches
+			}
+			if matches == bestMatches {
+				best = append(best, n)
+			}
+		}
+		nodes = best
+	}
+	for _, c := range constraintsOfKind(constraints, app.ConstraintSpread) {
+		var err error
+		nodes, err = s.spreadGroup(nodes, appName, process, c.Key, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// spreadGroup groups the nodes by the value of the metadata key and returns
+// the group with the fewest, or with the most, containers of the app process.
+// Groups are compared in order of the metadata value to break ties.
+func (s *segregatedScheduler) spreadGroup(nodes []cluster.Node, appName, process, key string, most bool) ([]cluster.Node, error) {
+	if len(nodes) == 0 {
+		return nodes, nil
+	}
+	hosts, _ := s.nodesToHosts(nodes)
+	appCountMap, err := s.aggregateContainersByHostAppProcess(hosts, appName, process)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]cluster.Node{}
+	groupCount := map[string]int{}
+	var values []string
+	for _, n := range nodes {
+		value := n.Metadata[key]
+		if _, ok := groups[value]; !ok {
+			values = append(values, value)
+		}
+		groups[value] = append(groups[value], n)
+		groupCount[value] += appCountMap[net.URLToHost(n.Address)]
+	}
+	sort.Strings(values)
+	chosen := values[0]
+	for _, value := range values[1:] {
+		if (most && groupCount[value] > groupCount[chosen]) || (!most && groupCount[value] < groupCount[chosen]) {
+			chosen = value
+		}
+	}
+	return groups[chosen], nil
+}
+
+// chooseContainerToRemoveConstrained removes containers from nodes violating
+// the require constraints first, and then from the spread group with the
+// most containers of the app process.
+func (s *segregatedScheduler) chooseContainerToRemoveConstrained(nodes []cluster.Node, appName, process string, constraints []app.PlacementConstraint) (string, error) {
+	required := constraintsOfKind(constraints, app.ConstraintRequire)
+	for i := range nodes {
+		if matchesAllConstraints(&nodes[i], required) {
+			continue
+		}
+		id, err := s.getContainerFromHost(nodes[i].Address, appName, process)
+		if err == nil {
+			return id, nil
+		}
+		if _, ok := err.(*errContainerNotFound); !ok {
+			return "", err
+		}
+	}
+	for _, c := range constraintsOfKind(constraints, app.ConstraintSpread) {
+		var err error
+		nodes, err = s.spreadGroup(nodes, appName, process, c.Key, true)
+		if err != nil {
+			return "", err
+		}
+	}
+	return s.chooseContainerToRemove(nodes, appName, process)
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestFilterByRequiredConstraints(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a", "ssd": "true"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"zone": "b", "ssd": "true"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"zone": "a"}},
+	}
+	constraints := []app.PlacementConstraint{
+		{Kind: app.ConstraintRequire, Key: "zone", Value: "a"},
+		{Kind: app.ConstraintPrefer, Key: "gpu", Value: "true"},
+	}
+	result, err := filterByRequiredConstraints(nodes, constraints)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []cluster.Node{nodes[0], nodes[2]})
+	constraints = append(constraints, app.PlacementConstraint{Kind: app.ConstraintRequire, Key: "ssd", Value: "true", Exclude: true})
+	result, err = filterByRequiredConstraints(nodes, constraints)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []cluster.Node{nodes[2]})
+	constraints = append(constraints, app.PlacementConstraint{Kind: app.ConstraintRequire, Key: "zone", Value: "c"})
+	_, err = filterByRequiredConstraints(nodes, constraints)
+	c.Assert(err, check.ErrorMatches, "no nodes found matching the placement constraints: require zone=a, require ssd!=true, require zone=c")
+	result, err = filterByRequiredConstraints(nodes, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+}
+
+func (s *S) TestChooseNodeWithPreferConstraint(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1", "ssd": "true"}},
+	}
+	constraints := []app.PlacementConstraint{{Kind: app.ConstraintPrefer, Key: "ssd", Value: "true"}}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": "skyrim"})
+	sched := segregatedScheduler{provisioner: s.p}
+	for i := 0; i < 3; i++ {
+		cont := container.Container{ID: fmt.Sprintf("cont%d", i), Name: fmt.Sprintf("unit%d", i), AppName: "skyrim", ProcessName: "web"}
+		err := contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.chooseNodeToAdd(nodes, cont.Name, "skyrim", "web", constraints...)
+		c.Assert(err, check.IsNil)
+		c.Assert(node, check.Equals, "http://server2:1234")
+	}
+}
+
+func (s *S) TestChooseNodeWithSpreadConstraint(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1", "zone": "a"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1", "zone": "a"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"pool": "pool1", "zone": "b"}},
+	}
+	constraints := []app.PlacementConstraint{{Kind: app.ConstraintSpread, Key: "zone"}}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": "skyrim"})
+	sched := segregatedScheduler{provisioner: s.p}
+	expected := []string{"http://server1:1234", "http://server3:1234", "http://server2:1234", "http://server3:1234"}
+	for i, addr := range expected {
+		cont := container.Container{ID: fmt.Sprintf("cont%d", i), Name: fmt.Sprintf("unit%d", i), AppName: "skyrim", ProcessName: "web"}
+		err := contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.chooseNodeToAdd(nodes, cont.Name, "skyrim", "web", constraints...)
+		c.Assert(err, check.IsNil)
+		c.Assert(node, check.Equals, addr)
+	}
+}
+
+func (s *S) TestChooseContainerToRemoveConstrained(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1", "zone": "a"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1", "zone": "b"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"pool": "pool1", "zone": "b"}},
+	}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": "skyrim"})
+	err := contColl.Insert(
+		container.Container{ID: "c1", Name: "unit1", AppName: "skyrim", HostAddr: "server1", ProcessName: "web"},
+		container.Container{ID: "c2", Name: "unit2", AppName: "skyrim", HostAddr: "server2", ProcessName: "web"},
+		container.Container{ID: "c3", Name: "unit3", AppName: "skyrim", HostAddr: "server3", ProcessName: "web"},
+	)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	constraints := []app.PlacementConstraint{{Kind: app.ConstraintRequire, Key: "zone", Value: "b"}}
+	contID, err := sched.chooseContainerToRemoveConstrained(nodes, "skyrim", "web", constraints)
+	c.Assert(err, check.IsNil)
+	c.Assert(contID, check.Equals, "c1")
+	constraints = []app.PlacementConstraint{{Kind: app.ConstraintSpread, Key: "zone"}}
+	contID, err = sched.chooseContainerToRemoveConstrained(nodes, "skyrim", "web", constraints)
+	c.Assert(err, check.IsNil)
+	c.Assert(contID, check.Not(check.Equals), "c1")
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/tsuru/scopedconfig"
+)
+
+const (
+	schedulerConfigCollection = "scheduler"
+
+	strategySpread  = "spread"
+	strategyBinpack = "binpack"
+	strategyRandom  = "random"
+
+	defaultSchedulerStrategy = strategySpread
+)
+
+var schedulerStrategies = map[string]schedulerStrategy{
+	strategySpread:  &spreadStrategy{},
+	strategyBinpack: &binpackStrategy{},
+	strategyRandom:  &randomStrategy{},
+}
+
+// hostContainerStats holds the number of containers in a host used by
+// scheduler strategies to choose where to add or remove a container of an
+// app process.
+type hostContainerStats struct {
+	host string
+	// groupCount is the number of containers of the app process in all hosts
+	// with the same metadata as this host.
+	groupCount int
+	// appCount is the number of containers of the app process in the host.
+	appCount int
+	// totalCount is the number of containers in the host.
+	totalCount int
+}
+
+// schedulerStrategy decides the placement of containers among the nodes of a
+// pool. It's used by the scheduler when adding and removing units, and by the
+// auto scaler to decide whether containers should be rebalanced.
+type schedulerStrategy interface {
+	// chooseHosts returns the host that should receive a new container of the
+	// app process and the host from which one of its containers should be
+	// removed.
+	chooseHosts(stats []hostContainerStats) (toAdd string, toRemove string)
+	// rebalanceReason compares the number of containers per node before and
+	// after a rebalance, returning why the rebalance is worth running or an
+	// empty string if it isn't.
+	rebalanceReason(before, after []int) string
+}
+
+// spreadStrategy distributes the containers of each app process evenly among
+// nodes, and among groups of nodes with different metadata, before
+// considering the total number of containers in each node.
+type spreadStrategy struct{}
+
+func (spreadStrategy) chooseHosts(stats []hostContainerStats) (string, string) {
+	var minHost, maxHost string
+	var minScore uint64 = math.MaxUint64
+	var maxScore uint64
+	for _, st := range stats {
+		priorityEntries := []int{st.groupCount, st.appCount, st.totalCount}
+		var score uint64
+		for i, e := range priorityEntries {
+			score += uint64(e) << uint((len(priorityEntries)-i-1)*(64/len(priorityEntries)))
+		}
+		if score < minScore {
+			minScore = score
+			minHost = st.host
+		}
+		if score > maxScore {
+			maxScore = score
+			maxHost = st.host
+		}
+	}
+	return minHost, maxHost
+}
+
+func (spreadStrategy) rebalanceReason(before, after []int) string {
+	gap, gapAfter := countGap(before), countGap(after)
+	diff := gap - gapAfter
+	if diff > 2 || diff < -2 {
+		return fmt.Sprintf("gap is %d, after rebalance gap will be %d", gap, gapAfter)
+	}
+	return ""
+}
+
+// binpackStrategy fills the nodes with most containers first, keeping the
+// remaining nodes as empty as possible so they can be removed by the auto
+// scaler. Node capacity is given by the memory limits in the scheduler.
+type binpackStrategy struct{}
+
+func (binpackStrategy) chooseHosts(stats []hostContainerStats) (string, string) {
+	var toAdd, toRemove *hostContainerStats
+	for i := range stats {
+		st := &stats[i]
+		if toAdd == nil || st.totalCount > toAdd.totalCount ||
+			(st.totalCount == toAdd.totalCount && st.appCount < toAdd.appCount) {
+			toAdd = st
+		}
+		if st.appCount == 0 {
+			continue
+		}
+		if toRemove == nil || st.totalCount < toRemove.totalCount ||
+			(st.totalCount == toRemove.totalCount && st.appCount > toRemove.appCount) {
+			toRemove = st
+		}
+	}
+	var addHost, removeHost string
+	if toAdd != nil {
+		addHost = toAdd.host
+	}
+	if toRemove != nil {
+		removeHost = toRemove.host
+	}
+	return addHost, removeHost
+}
+
+func (binpackStrategy) rebalanceReason(before, after []int) string {
+	used, usedAfter := countUsed(before), countUsed(after)
+	if usedAfter < used {
+		return fmt.Sprintf("%d nodes in use, after rebalance %d nodes will be in use", used, usedAfter)
+	}
+	return ""
+}
+
+// randomStrategy places containers in random nodes. As there's no ideal
+// placement, containers are never rebalanced by the auto scaler.
+type randomStrategy struct{}
+
+func (randomStrategy) chooseHosts(stats []hostContainerStats) (string, string) {
+	if len(stats) == 0 {
+		return "", ""
+	}
+	toAdd := stats[rand.Intn(len(stats))].host
+	var withApp []string
+	for _, st := range stats {
+		if st.appCount > 0 {
+			withApp = append(withApp, st.host)
+		}
+	}
+	if len(withApp) == 0 {
+		return toAdd, ""
+	}
+	return toAdd, withApp[rand.Intn(len(withApp))]
+}
+
+func (randomStrategy) rebalanceReason(before, after []int) string {
+	return ""
+}
+
+func countGap(counts []int) int {
+	if len(counts) == 0 {
+		return 0
+	}
+	min, max := counts[0], counts[0]
+	for _, c := range counts[1:] {
+		if c < min {
+			min = c
+		}
+		if c > max {
+			max = c
+		}
+	}
+	return max - min
+}
+
+func countUsed(counts []int) int {
+	var used int
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	return used
+}
+
+// SchedulerConfig holds the scheduler configuration for a pool, entries
+// without a pool apply to all pools without a configuration of their own.
+type SchedulerConfig struct {
+	Strategy string
+}
+
+func loadSchedulerConfig() *scopedconfig.ScopedConfig {
+	conf := scopedconfig.FindScopedConfig(schedulerConfigCollection)
+	conf.ShallowMerge = true
+	return conf
+}
+
+func schedulerStrategyNames() []string {
+	names := make([]string, 0, len(schedulerStrategies))
+	for name := range schedulerStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *SchedulerConfig) validate() error {
+	if _, ok := schedulerStrategies[c.Strategy]; !ok {
+		return fmt.Errorf("invalid scheduler strategy %q, valid strategies are: %s", c.Strategy, strings.Join(schedulerStrategyNames(), ", "))
+	}
+	return nil
+}
+
+func (c *SchedulerConfig) save(pool string) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+	return loadSchedulerConfig().Save(pool, *c)
+}
+
+func schedulerConfigLoadAll() (map[string]SchedulerConfig, error) {
+	var all map[string]SchedulerConfig
+	err := loadSchedulerConfig().LoadAll(&all)
+	return all, err
+}
+
+// strategyForPool returns the scheduler strategy configured for the pool,
+// falling back to the default strategy.
+func strategyForPool(pool string) (schedulerStrategy, error) {
+	var conf SchedulerConfig
+	err := loadSchedulerConfig().Load(pool, &conf)
+	if err != nil {
+		return nil, err
+	}
+	if strategy, ok := schedulerStrategies[conf.Strategy]; ok {
+		return strategy, nil
+	}
+	return schedulerStrategies[defaultSchedulerStrategy], nil
+}
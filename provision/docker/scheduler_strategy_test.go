@@ -0,0 +1,122 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSpreadStrategyChooseHosts(c *check.C) {
+	stats := []hostContainerStats{
+		{host: "server1", groupCount: 2, appCount: 2, totalCount: 2},
+		{host: "server2", groupCount: 1, appCount: 1, totalCount: 5},
+		{host: "server3", groupCount: 1, appCount: 1, totalCount: 3},
+	}
+	toAdd, toRemove := spreadStrategy{}.chooseHosts(stats)
+	c.Assert(toAdd, check.Equals, "server3")
+	c.Assert(toRemove, check.Equals, "server1")
+}
+
+func (s *S) TestBinpackStrategyChooseHosts(c *check.C) {
+	stats := []hostContainerStats{
+		{host: "server1", appCount: 2, totalCount: 2},
+		{host: "server2", appCount: 1, totalCount: 5},
+		{host: "server3", appCount: 0, totalCount: 5},
+		{host: "server4", appCount: 0, totalCount: 0},
+	}
+	toAdd, toRemove := binpackStrategy{}.chooseHosts(stats)
+	c.Assert(toAdd, check.Equals, "server3")
+	c.Assert(toRemove, check.Equals, "server1")
+	toAdd, toRemove = binpackStrategy{}.chooseHosts(nil)
+	c.Assert(toAdd, check.Equals, "")
+	c.Assert(toRemove, check.Equals, "")
+}
+
+func (s *S) TestRandomStrategyChooseHosts(c *check.C) {
+	stats := []hostContainerStats{
+		{host: "server1", appCount: 0, totalCount: 2},
+		{host: "server2", appCount: 1, totalCount: 5},
+	}
+	for i := 0; i < 10; i++ {
+		toAdd, toRemove := randomStrategy{}.chooseHosts(stats)
+		c.Assert(toAdd, check.Matches, "server[12]")
+		c.Assert(toRemove, check.Equals, "server2")
+	}
+}
+
+func (s *S) TestStrategiesRebalanceReason(c *check.C) {
+	c.Assert(spreadStrategy{}.rebalanceReason([]int{8, 2, 2}, []int{4, 4, 4}), check.Equals, "gap is 6, after rebalance gap will be 0")
+	c.Assert(spreadStrategy{}.rebalanceReason([]int{5, 3, 4}, []int{4, 4, 4}), check.Equals, "")
+	c.Assert(binpackStrategy{}.rebalanceReason([]int{4, 4, 4}, []int{8, 4, 0}), check.Equals, "3 nodes in use, after rebalance 2 nodes will be in use")
+	c.Assert(binpackStrategy{}.rebalanceReason([]int{8, 4, 0}, []int{6, 6, 0}), check.Equals, "")
+	c.Assert(randomStrategy{}.rebalanceReason([]int{8, 0, 0}, []int{4, 4, 0}), check.Equals, "")
+}
+
+func (s *S) TestSchedulerConfigSaveInvalidStrategy(c *check.C) {
+	conf := SchedulerConfig{Strategy: "first-fit"}
+	err := conf.save("pool1")
+	c.Assert(err, check.ErrorMatches, `invalid scheduler strategy "first-fit", valid strategies are: binpack, random, spread`)
+}
+
+func (s *S) TestStrategyForPool(c *check.C) {
+	strategy, err := strategyForPool("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.FitsTypeOf, &spreadStrategy{})
+	conf := SchedulerConfig{Strategy: strategyRandom}
+	err = conf.save("")
+	c.Assert(err, check.IsNil)
+	conf = SchedulerConfig{Strategy: strategyBinpack}
+	err = conf.save("pool1")
+	c.Assert(err, check.IsNil)
+	strategy, err = strategyForPool("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.FitsTypeOf, &binpackStrategy{})
+	strategy, err = strategyForPool("pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.FitsTypeOf, &randomStrategy{})
+	all, err := schedulerConfigLoadAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.DeepEquals, map[string]SchedulerConfig{
+		"":      {Strategy: strategyRandom},
+		"pool1": {Strategy: strategyBinpack},
+	})
+}
+
+func (s *S) TestChooseNodeBinpackStrategy(c *check.C) {
+	conf := SchedulerConfig{Strategy: strategyBinpack}
+	err := conf.save("pool1")
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1"}},
+	}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": bson.M{"$in": []string{"skyrim", "oblivion"}}})
+	err = contColl.Insert(container.Container{ID: "pre1", Name: "existingUnit1", AppName: "oblivion", HostAddr: "server2", ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	for i := 0; i < 3; i++ {
+		cont := container.Container{ID: fmt.Sprintf("cont%d", i), Name: fmt.Sprintf("unit%d", i), AppName: "skyrim", ProcessName: "web"}
+		err = contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.chooseNodeToAdd(nodes, cont.Name, "skyrim", "web")
+		c.Assert(err, check.IsNil)
+		c.Assert(node, check.Equals, "http://server2:1234")
+	}
+	n, err := contColl.Find(bson.M{"hostaddr": "server2"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 4)
+	err = contColl.Insert(container.Container{ID: "pre2", Name: "existingUnit2", AppName: "skyrim", HostAddr: "server1", ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	contID, err := sched.chooseContainerToRemove(nodes, "skyrim", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(contID, check.Equals, "pre2")
+}
@@ -376,6 +376,46 @@ func (s *S) TestSchedulerScheduleWithMemoryAwareness(c *check.C) {
 	c.Assert(node, check.DeepEquals, cluster.Node{})
 }
 
+func (s *S) TestSchedulerFilterByCPUUsage(c *check.C) {
+	app1 := app.App{Name: "skyrim", Plan: app.Plan{CpuLimit: 1.5}, Pool: "mypool"}
+	err := s.storage.Apps().Insert(app1)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": app1.Name})
+	app2 := app.App{Name: "oblivion", Plan: app.Plan{CpuLimit: 0.5}, Pool: "mypool"}
+	err = s.storage.Apps().Insert(app2)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": app2.Name})
+	segSched := segregatedScheduler{provisioner: s.p}
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"totalCPU": "2"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"totalCPU": "2"}},
+	}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": bson.M{"$in": []string{app1.Name, app2.Name}}})
+	err = contColl.Insert(
+		container.Container{ID: "pre1", Name: "existingUnit1", AppName: app1.Name, HostAddr: "server1"},
+		container.Container{ID: "pre2", Name: "existingUnit2", AppName: app2.Name, HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+	result, err := segSched.filterByResourceUsage(&app2, "web", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+	segSched.maxCPURatio = 0.9
+	segSched.TotalCPUMetadata = "totalCPU"
+	result, err = segSched.filterByResourceUsage(&app2, "web", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []cluster.Node{nodes[1]})
+	_, err = segSched.filterByResourceUsage(&app1, "web", nodes)
+	c.Assert(err, check.ErrorMatches, `no nodes found with enough cpu for container of "skyrim": 1.5000 CPUs`)
+	reserved, err := segSched.reservationsByHost(nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(reserved, check.DeepEquals, map[string]hostReservation{
+		"server1": {cpu: 1.5},
+		"server2": {cpu: 0.5},
+	})
+}
+
 func (s *S) TestSchedulerScheduleWithMemoryAwarenessWithAutoScale(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
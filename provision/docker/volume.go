@@ -0,0 +1,192 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/net"
+)
+
+type appVolume struct {
+	bind   app.VolumeBind
+	volume *app.Volume
+	plan   *app.VolumePlan
+}
+
+func appVolumes(appName string) ([]appVolume, error) {
+	binds, err := app.GetVolumeBindsByApp(appName)
+	if err != nil {
+		return nil, err
+	}
+	volumes := make([]appVolume, len(binds))
+	for i, b := range binds {
+		v, err := app.GetVolume(b.ID.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get volume %q: %s", b.ID.Volume, err)
+		}
+		plan, err := v.VolumePlan()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get plan of volume %q: %s", v.Name, err)
+		}
+		volumes[i] = appVolume{bind: b, volume: v, plan: plan}
+	}
+	return volumes, nil
+}
+
+// dockerBind returns the bind used to mount the volume in the container, host
+// volumes are directories named after the volume in the base path of the plan,
+// other volumes are docker volumes named after the volume.
+func (v *appVolume) dockerBind() string {
+	source := v.volume.Name
+	if v.plan.Type == app.VolumeTypeHost {
+		source = path.Join(v.plan.Opts["path"], v.volume.Name)
+	}
+	bind := fmt.Sprintf("%s:%s", source, v.bind.ID.MountPoint)
+	if v.bind.ReadOnly {
+		bind += ":ro"
+	}
+	return bind
+}
+
+func (v *appVolume) createOptions() docker.CreateVolumeOptions {
+	switch v.plan.Type {
+	case app.VolumeTypeNFS:
+		addr := "addr=" + v.plan.Opts["server"]
+		if v.plan.Opts["options"] != "" {
+			addr += "," + v.plan.Opts["options"]
+		}
+		return docker.CreateVolumeOptions{
+			Name:   v.volume.Name,
+			Driver: "local",
+			DriverOpts: map[string]string{
+				"type":   "nfs",
+				"o":      addr,
+				"device": ":" + path.Join(v.plan.Opts["path"], v.volume.Name),
+			},
+		}
+	case app.VolumeTypeDriver:
+		return docker.CreateVolumeOptions{
+			Name:       v.volume.Name,
+			Driver:     v.plan.Driver,
+			DriverOpts: v.plan.Opts,
+		}
+	}
+	return docker.CreateVolumeOptions{}
+}
+
+// appVolumeBinds returns the binds mounting the volumes of the app in its
+// units.
+func appVolumeBinds(appName string) ([]string, error) {
+	volumes, err := appVolumes(appName)
+	if err != nil {
+		return nil, err
+	}
+	var binds []string
+	for i := range volumes {
+		binds = append(binds, volumes[i].dockerBind())
+	}
+	return binds, nil
+}
+
+// filterByVolumes keeps only the node holding the local volumes of the app,
+// if they were already assigned to a node.
+func filterByVolumes(appName string, nodes []cluster.Node) ([]cluster.Node, error) {
+	volumes, err := appVolumes(appName)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, v := range volumes {
+		if v.plan.IsLocal() && v.volume.Node != "" {
+			hosts = append(hosts, v.volume.Node)
+		}
+	}
+	if len(hosts) == 0 {
+		return nodes, nil
+	}
+	var result []cluster.Node
+	for _, node := range nodes {
+		host := net.URLToHost(node.Address)
+		matches := true
+		for _, h := range hosts {
+			if h != host {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, node)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no nodes found holding the local volumes of %q: %s", appName, strings.Join(hosts, ", "))
+	}
+	return result, nil
+}
+
+// prepareVolumes assigns the local volumes of the app to the chosen node and
+// creates in it the docker volumes used by the app.
+func prepareVolumes(c *cluster.Cluster, appName, nodeAddr string) error {
+	volumes, err := appVolumes(appName)
+	if err != nil {
+		return err
+	}
+	host := net.URLToHost(nodeAddr)
+	var client *docker.Client
+	for _, v := range volumes {
+		if v.plan.IsLocal() {
+			ok, err := v.volume.SetNode(host)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("volume %q is held by another node", v.volume.Name)
+			}
+			continue
+		}
+		if client == nil {
+			node, err := c.GetNode(nodeAddr)
+			if err != nil {
+				return err
+			}
+			client, err = node.Client()
+			if err != nil {
+				return err
+			}
+		}
+		_, err = client.CreateVolume(v.createOptions())
+		if err != nil {
+			return fmt.Errorf("unable to create volume %q in node %s: %s", v.volume.Name, host, err)
+		}
+	}
+	return nil
+}
+
+// prepareVolumesInHost prepares the volumes of the app in the node with the
+// given host, used when the scheduler is bypassed and units are created in a
+// specific node.
+func prepareVolumesInHost(p *dockerProvisioner, appName, host string) error {
+	nodes, err := p.Cluster().Nodes()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if net.URLToHost(node.Address) != host {
+			continue
+		}
+		_, err = filterByVolumes(appName, []cluster.Node{node})
+		if err != nil {
+			return err
+		}
+		return prepareVolumes(p.Cluster(), appName, node.Address)
+	}
+	return fmt.Errorf("host %q not found", host)
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/net"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) addVolume(c *check.C, a *app.App, plan app.VolumePlan, name, mountPoint string, readOnly bool) *app.Volume {
+	err := app.AddVolumePlan(plan)
+	if err != app.ErrVolumePlanAlreadyExists {
+		c.Assert(err, check.IsNil)
+	}
+	v := app.Volume{Name: name, Pool: plan.Pool, Plan: plan.Name, TeamOwner: s.team.Name}
+	err = v.Create()
+	c.Assert(err, check.IsNil)
+	err = v.Bind(a, mountPoint, readOnly, false, nil)
+	c.Assert(err, check.IsNil)
+	return &v
+}
+
+func (s *S) TestAppVolumeBinds(c *check.C) {
+	a := &app.App{Name: "myapp", Pool: "test-default"}
+	hostPlan := app.VolumePlan{Name: "local", Pool: "test-default", Type: app.VolumeTypeHost, Opts: map[string]string{"path": "/mnt/volumes"}}
+	driverPlan := app.VolumePlan{Name: "ebs", Pool: "test-default", Type: app.VolumeTypeDriver, Driver: "rexray"}
+	s.addVolume(c, a, hostPlan, "cache", "/var/cache", false)
+	s.addVolume(c, a, driverPlan, "data", "/var/data", true)
+	binds, err := appVolumeBinds(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.DeepEquals, []string{
+		"/mnt/volumes/cache:/var/cache",
+		"data:/var/data:ro",
+	})
+	binds, err = appVolumeBinds("otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(binds, check.HasLen, 0)
+}
+
+func (s *S) TestAppVolumeCreateOptions(c *check.C) {
+	v := appVolume{
+		volume: &app.Volume{Name: "data"},
+		plan: &app.VolumePlan{Type: app.VolumeTypeNFS, Opts: map[string]string{
+			"server":  "10.0.0.1",
+			"path":    "/exports",
+			"options": "nfsvers=4",
+		}},
+	}
+	c.Assert(v.createOptions(), check.DeepEquals, docker.CreateVolumeOptions{
+		Name:   "data",
+		Driver: "local",
+		DriverOpts: map[string]string{
+			"type":   "nfs",
+			"o":      "addr=10.0.0.1,nfsvers=4",
+			"device": ":/exports/data",
+		},
+	})
+	v.plan = &app.VolumePlan{Type: app.VolumeTypeDriver, Driver: "rexray", Opts: map[string]string{"size": "10"}}
+	c.Assert(v.createOptions(), check.DeepEquals, docker.CreateVolumeOptions{
+		Name:       "data",
+		Driver:     "rexray",
+		DriverOpts: map[string]string{"size": "10"},
+	})
+}
+
+func (s *S) TestFilterByVolumes(c *check.C) {
+	a := &app.App{Name: "myapp", Pool: "test-default"}
+	plan := app.VolumePlan{Name: "local", Pool: "test-default", Type: app.VolumeTypeHost, Opts: map[string]string{"path": "/mnt/volumes"}}
+	v := s.addVolume(c, a, plan, "cache", "/var/cache", false)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234"},
+	}
+	result, err := filterByVolumes(a.Name, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+	ok, err := v.SetNode("server2")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	result, err = filterByVolumes(a.Name, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []cluster.Node{nodes[1]})
+	_, err = filterByVolumes(a.Name, nodes[:1])
+	c.Assert(err, check.ErrorMatches, `no nodes found holding the local volumes of "myapp": server2`)
+}
+
+func (s *S) TestPrepareVolumes(c *check.C) {
+	a := &app.App{Name: "myapp", Pool: "test-default"}
+	hostPlan := app.VolumePlan{Name: "local", Pool: "test-default", Type: app.VolumeTypeHost, Opts: map[string]string{"path": "/mnt/volumes"}}
+	driverPlan := app.VolumePlan{Name: "ebs", Pool: "test-default", Type: app.VolumeTypeDriver, Driver: "rexray"}
+	s.addVolume(c, a, hostPlan, "cache", "/var/cache", false)
+	s.addVolume(c, a, driverPlan, "data", "/var/data", false)
+	err := prepareVolumes(s.p.Cluster(), a.Name, s.server.URL())
+	c.Assert(err, check.IsNil)
+	v, err := app.GetVolume("cache")
+	c.Assert(err, check.IsNil)
+	c.Assert(v.Node, check.Equals, net.URLToHost(s.server.URL()))
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	volume, err := client.InspectVolume("data")
+	c.Assert(err, check.IsNil)
+	c.Assert(volume.Driver, check.Equals, "rexray")
+	err = prepareVolumes(s.p.Cluster(), a.Name, "http://otherhost:2375")
+	c.Assert(err, check.ErrorMatches, `volume "cache" is held by another node`)
+}
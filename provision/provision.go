@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"regexp"
 	"time"
 
 	"github.com/tsuru/tsuru/app/bind"
@@ -23,6 +24,9 @@ import (
 var (
 	ErrInvalidStatus = errors.New("invalid status")
 	ErrEmptyApp      = errors.New("no units for this app")
+
+	ErrInvalidRollingUpdate = errors.New("invalid rolling update: values must not be negative and either max surge or max unavailable must be set")
+	ErrInvalidAutoRollback  = errors.New("invalid auto rollback: values must not be negative and both the window and either max restarts or max errors must be set")
 )
 
 type UnitNotFoundError struct {
@@ -155,6 +159,84 @@ type Named interface {
 	GetName() string
 }
 
+// UnitResources are the resources reserved for each unit of an app process.
+type UnitResources struct {
+	Memory   int64
+	Swap     int64
+	CpuShare int
+	CpuLimit float64
+}
+
+// RollingUpdate configures how the units of an app are replaced in deploys and
+// restarts. The zero value replaces all units at once.
+type RollingUpdate struct {
+	// BatchSize is the maximum number of units of a process replaced in each
+	// batch, zero means it's only limited by MaxSurge and MaxUnavailable.
+	BatchSize int `bson:",omitempty" json:"batchSize"`
+	// MaxSurge is the number of units a process may have above its desired
+	// number of units during the update.
+	MaxSurge int `bson:",omitempty" json:"maxSurge"`
+	// MaxUnavailable is the number of units of a process that may be
+	// unavailable during the update.
+	MaxUnavailable int `bson:",omitempty" json:"maxUnavailable"`
+	// Pause is the number of seconds to wait between batches.
+	Pause int `bson:",omitempty" json:"pause"`
+}
+
+// Enabled returns whether units should be replaced in batches.
+func (r RollingUpdate) Enabled() bool {
+	return r != RollingUpdate{}
+}
+
+// Validate checks that the rolling update is able to make progress.
+func (r RollingUpdate) Validate() error {
+	if !r.Enabled() {
+		return nil
+	}
+	if r.BatchSize < 0 || r.MaxSurge < 0 || r.MaxUnavailable < 0 || r.Pause < 0 {
+		return ErrInvalidRollingUpdate
+	}
+	if r.MaxSurge+r.MaxUnavailable == 0 {
+		return ErrInvalidRollingUpdate
+	}
+	return nil
+}
+
+// AutoRollback configures the window after a deploy in which the units of an
+// app running the new image are watched, rolling the app back to its previous
+// image when they fail too much. The zero value disables automatic rollbacks.
+type AutoRollback struct {
+	// Window is the number of seconds the units are watched after a deploy.
+	Window int `bson:",omitempty" json:"window"`
+	// MaxRestarts is the number of units that may be restarted by the
+	// container healer during the window, the app is rolled back when it's
+	// exceeded. Zero means restarts are not taken into account.
+	MaxRestarts int `bson:",omitempty" json:"maxRestarts"`
+	// MaxErrors is the number of times units may report an error status
+	// during the window, the app is rolled back when it's exceeded. Zero
+	// means errors are not taken into account.
+	MaxErrors int `bson:",omitempty" json:"maxErrors"`
+}
+
+// Enabled returns whether deploys of the app should be watched.
+func (r AutoRollback) Enabled() bool {
+	return r != AutoRollback{}
+}
+
+// Validate checks that the auto rollback is able to trigger a rollback.
+func (r AutoRollback) Validate() error {
+	if !r.Enabled() {
+		return nil
+	}
+	if r.Window <= 0 || r.MaxRestarts < 0 || r.MaxErrors < 0 {
+		return ErrInvalidAutoRollback
+	}
+	if r.MaxRestarts+r.MaxErrors == 0 {
+		return ErrInvalidAutoRollback
+	}
+	return nil
+}
+
 // App represents a tsuru app.
 //
 // It contains only relevant information for provisioning.
@@ -181,11 +263,28 @@ type App interface {
 	// app.
 	Run(cmd string, w io.Writer, once bool) error
 
-	Envs() map[string]bind.EnvVar
+	Envs() (map[string]bind.EnvVar, error)
 
 	GetMemory() int64
 	GetSwap() int64
 	GetCpuShare() int
+	GetCpuLimit() float64
+
+	// GetUnitResources returns the resources reserved for each unit of
+	// the process, which may override the ones of the app.
+	GetUnitResources(process string) UnitResources
+
+	// GetMaxUnits returns the maximum number of units of the process, zero
+	// means no limit.
+	GetMaxUnits(process string) int
+
+	// GetRollingUpdate returns how the units of the app are replaced in
+	// deploys and restarts.
+	GetRollingUpdate() RollingUpdate
+
+	// GetAutoRollback returns how the units of the app are watched after
+	// deploys.
+	GetAutoRollback() AutoRollback
 
 	SetUpdatePlatform(bool) error
 	GetUpdatePlatform() bool
@@ -239,15 +338,18 @@ type ShellOptions struct {
 	Term   string
 }
 
-// ArchiveDeployer is a provisioner that can deploy archives.
+// ArchiveDeployer is a provisioner that can deploy archives. When dockerfile
+// is true, the image of the app is built from the Dockerfile in the root of
+// the archive.
 type ArchiveDeployer interface {
-	ArchiveDeploy(app App, archiveURL string, evt *event.Event) (string, error)
+	ArchiveDeploy(app App, archiveURL string, dockerfile bool, evt *event.Event) (string, error)
 }
 
 // UploadDeployer is a provisioner that can deploy the application from an
-// uploaded file.
+// uploaded file. The image of the app is built from the Dockerfile in the
+// root of the file when dockerfile is true or when the file contains one.
 type UploadDeployer interface {
-	UploadDeploy(app App, file io.ReadCloser, fileSize int64, build bool, evt *event.Event) (string, error)
+	UploadDeploy(app App, file io.ReadCloser, fileSize int64, build, dockerfile bool, evt *event.Event) (string, error)
 }
 
 // ImageDeployer is a provisioner that can deploy the application from a
@@ -256,6 +358,15 @@ type ImageDeployer interface {
 	ImageDeploy(app App, image string, evt *event.Event) (string, error)
 }
 
+// PortRoutableProvisioner is a provisioner whose units may expose ports
+// besides the HTTP one, to be routed by routers implementing
+// router.TCPRouter.
+type PortRoutableProvisioner interface {
+	// RoutablePorts returns the addresses of the ports exposed by the units
+	// of the app, grouped by port.
+	RoutablePorts(App) (map[router.PortRoute][]*url.URL, error)
+}
+
 // Provisioner is the basic interface of this package.
 //
 // Any tsuru provisioner must implement this interface in order to provision
@@ -373,12 +484,17 @@ type NodeProvisioner interface {
 type Node interface {
 	Pool() string
 	Address() string
+	Metadata() map[string]string
 }
 
 type NodeStatusData struct {
 	Addrs  []string
 	Units  []UnitStatusData
 	Checks []NodeCheckResult
+	// Reclaimed is set by node agents when the cloud provider notifies that
+	// the node's instance, usually a spot or preemptible one, is about to be
+	// terminated.
+	Reclaimed bool
 }
 
 type UnitStatusData struct {
@@ -485,7 +601,58 @@ func (hc TsuruYamlHealthcheck) ToRouterHC() router.HealthcheckData {
 	}
 }
 
+// TsuruYamlPort is a port exposed by the units of a process. Protocol may be
+// tcp, udp or http, defaulting to tcp.
+type TsuruYamlPort struct {
+	Port     int
+	Protocol string
+}
+
+// TransportProtocol returns the transport protocol used by the port, http
+// ports are exposed as tcp.
+func (p TsuruYamlPort) TransportProtocol() string {
+	if p.Protocol == "udp" {
+		return "udp"
+	}
+	return "tcp"
+}
+
+func (p TsuruYamlPort) Validate() error {
+	if p.Port <= 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid port number: %d", p.Port)
+	}
+	switch p.Protocol {
+	case "", "tcp", "udp", "http":
+		return nil
+	}
+	return fmt.Errorf("invalid protocol %q for port %d, must be one of tcp, udp or http", p.Protocol, p.Port)
+}
+
+var signalRegexp = regexp.MustCompile(`^((SIG)?[A-Z][A-Z0-9+-]*|[0-9]+)$`)
+
+// TsuruYamlShutdown configures how the units of the app are stopped. The
+// PreStop command is run inside the unit first, then Signal is sent to its
+// process, which is killed if still running after the grace period. The
+// grace period also limits the time the PreStop command may take.
+type TsuruYamlShutdown struct {
+	Signal      string
+	GracePeriod int    `json:"grace_period" bson:"grace_period"`
+	PreStop     string `json:"pre_stop" bson:"pre_stop"`
+}
+
+func (s TsuruYamlShutdown) Validate() error {
+	if s.Signal != "" && !signalRegexp.MatchString(s.Signal) {
+		return fmt.Errorf("invalid shutdown signal %q", s.Signal)
+	}
+	if s.GracePeriod < 0 {
+		return fmt.Errorf("invalid shutdown grace period: %d", s.GracePeriod)
+	}
+	return nil
+}
+
 type TsuruYamlData struct {
 	Hooks       TsuruYamlHooks
 	Healthcheck TsuruYamlHealthcheck
+	Ports       map[string][]TsuruYamlPort
+	Shutdown    TsuruYamlShutdown
 }
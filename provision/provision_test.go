@@ -123,3 +123,105 @@ func (ProvisionSuite) TestUnitNotFoundError(c *check.C) {
 	var err error = &UnitNotFoundError{ID: "some unit"}
 	c.Assert(err.Error(), check.Equals, `unit "some unit" not found`)
 }
+
+func (ProvisionSuite) TestTsuruYamlPortValidate(c *check.C) {
+	var tests = []struct {
+		port     TsuruYamlPort
+		expected string
+	}{
+		{TsuruYamlPort{Port: 8080}, ""},
+		{TsuruYamlPort{Port: 1883, Protocol: "tcp"}, ""},
+		{TsuruYamlPort{Port: 53, Protocol: "udp"}, ""},
+		{TsuruYamlPort{Port: 8000, Protocol: "http"}, ""},
+		{TsuruYamlPort{Port: 0}, "invalid port number: 0"},
+		{TsuruYamlPort{Port: 70000, Protocol: "tcp"}, "invalid port number: 70000"},
+		{TsuruYamlPort{Port: 5672, Protocol: "amqp"}, `invalid protocol "amqp" for port 5672, must be one of tcp, udp or http`},
+	}
+	for _, test := range tests {
+		err := test.port.Validate()
+		if test.expected == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, test.expected)
+		}
+	}
+}
+
+func (ProvisionSuite) TestTsuruYamlPortTransportProtocol(c *check.C) {
+	c.Assert(TsuruYamlPort{Port: 80}.TransportProtocol(), check.Equals, "tcp")
+	c.Assert(TsuruYamlPort{Port: 80, Protocol: "http"}.TransportProtocol(), check.Equals, "tcp")
+	c.Assert(TsuruYamlPort{Port: 53, Protocol: "udp"}.TransportProtocol(), check.Equals, "udp")
+}
+
+func (ProvisionSuite) TestTsuruYamlShutdownValidate(c *check.C) {
+	var tests = []struct {
+		shutdown TsuruYamlShutdown
+		expected string
+	}{
+		{TsuruYamlShutdown{}, ""},
+		{TsuruYamlShutdown{Signal: "SIGTERM", GracePeriod: 30, PreStop: "sleep 5"}, ""},
+		{TsuruYamlShutdown{Signal: "QUIT"}, ""},
+		{TsuruYamlShutdown{Signal: "15"}, ""},
+		{TsuruYamlShutdown{Signal: "sigterm"}, `invalid shutdown signal "sigterm"`},
+		{TsuruYamlShutdown{Signal: "SIGTERM; rm -rf /"}, `invalid shutdown signal "SIGTERM; rm -rf /"`},
+		{TsuruYamlShutdown{GracePeriod: -1}, "invalid shutdown grace period: -1"},
+	}
+	for _, test := range tests {
+		err := test.shutdown.Validate()
+		if test.expected == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, test.expected)
+		}
+	}
+}
+
+func (ProvisionSuite) TestRollingUpdateValidate(c *check.C) {
+	var tests = []struct {
+		rolling RollingUpdate
+		valid   bool
+	}{
+		{RollingUpdate{}, true},
+		{RollingUpdate{MaxSurge: 1}, true},
+		{RollingUpdate{MaxUnavailable: 1, BatchSize: 2, Pause: 10}, true},
+		{RollingUpdate{BatchSize: 2}, false},
+		{RollingUpdate{Pause: 10}, false},
+		{RollingUpdate{MaxSurge: -1, MaxUnavailable: 2}, false},
+		{RollingUpdate{MaxSurge: 1, Pause: -1}, false},
+	}
+	for i, tt := range tests {
+		err := tt.rolling.Validate()
+		if tt.valid {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.Equals, ErrInvalidRollingUpdate, check.Commentf("test %d", i))
+		}
+	}
+	c.Assert(RollingUpdate{}.Enabled(), check.Equals, false)
+	c.Assert(RollingUpdate{MaxSurge: 1}.Enabled(), check.Equals, true)
+}
+
+func (ProvisionSuite) TestAutoRollbackValidate(c *check.C) {
+	var tests = []struct {
+		autoRollback AutoRollback
+		valid        bool
+	}{
+		{AutoRollback{}, true},
+		{AutoRollback{Window: 300, MaxRestarts: 2}, true},
+		{AutoRollback{Window: 300, MaxErrors: 5}, true},
+		{AutoRollback{Window: 300}, false},
+		{AutoRollback{MaxRestarts: 2}, false},
+		{AutoRollback{Window: -1, MaxRestarts: 2}, false},
+		{AutoRollback{Window: 300, MaxRestarts: 2, MaxErrors: -1}, false},
+	}
+	for i, tt := range tests {
+		err := tt.autoRollback.Validate()
+		if tt.valid {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.Equals, ErrInvalidAutoRollback, check.Commentf("test %d", i))
+		}
+	}
+	c.Assert(AutoRollback{}.Enabled(), check.Equals, false)
+	c.Assert(AutoRollback{Window: 300, MaxErrors: 1}.Enabled(), check.Equals, true)
+}
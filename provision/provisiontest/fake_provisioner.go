@@ -45,6 +45,7 @@ type FakeApp struct {
 	Memory         int64
 	Swap           int64
 	CpuShare       int
+	CpuLimit       float64
 	commMut        sync.Mutex
 	Deploys        uint
 	env            map[string]bind.EnvVar
@@ -57,6 +58,12 @@ type FakeApp struct {
 	TeamOwner      string
 	Teams          []string
 	quota.Quota
+	// ProcessResources and ProcessMaxUnits override the resources and
+	// limit the units of single processes.
+	ProcessResources map[string]provision.UnitResources
+	ProcessMaxUnits  map[string]int
+	RollingUpdate    provision.RollingUpdate
+	AutoRollback     provision.AutoRollback
 }
 
 func NewFakeApp(name, platform string, units int) *FakeApp {
@@ -99,6 +106,34 @@ func (a *FakeApp) GetCpuShare() int {
 	return a.CpuShare
 }
 
+func (a *FakeApp) GetCpuLimit() float64 {
+	return a.CpuLimit
+}
+
+func (a *FakeApp) GetUnitResources(process string) provision.UnitResources {
+	if resources, ok := a.ProcessResources[process]; ok {
+		return resources
+	}
+	return provision.UnitResources{
+		Memory:   a.Memory,
+		Swap:     a.Swap,
+		CpuShare: a.CpuShare,
+		CpuLimit: a.CpuLimit,
+	}
+}
+
+func (a *FakeApp) GetMaxUnits(process string) int {
+	return a.ProcessMaxUnits[process]
+}
+
+func (a *FakeApp) GetRollingUpdate() provision.RollingUpdate {
+	return a.RollingUpdate
+}
+
+func (a *FakeApp) GetAutoRollback() provision.AutoRollback {
+	return a.AutoRollback
+}
+
 func (a *FakeApp) HasBind(unit *provision.Unit) bool {
 	a.bindLock.Lock()
 	defer a.bindLock.Unlock()
@@ -296,8 +331,8 @@ func (a *FakeApp) InstanceEnv(env string) map[string]bind.EnvVar {
 }
 
 // Env returns app.Env
-func (a *FakeApp) Envs() map[string]bind.EnvVar {
-	return a.env
+func (a *FakeApp) Envs() (map[string]bind.EnvVar, error) {
+	return a.env, nil
 }
 
 func (a *FakeApp) SerializeEnvVars() error {
@@ -389,9 +424,15 @@ func (p *FakeProvisioner) AddNode(name, pool string) {
 	p.nodes[name] = fakeNode{address: name, pool: pool}
 }
 
+// AddNodeWithMetadata adds a node with the given metadata
+func (p *FakeProvisioner) AddNodeWithMetadata(name, pool string, metadata map[string]string) {
+	p.nodes[name] = fakeNode{address: name, pool: pool, metadata: metadata}
+}
+
 type fakeNode struct {
-	address string
-	pool    string
+	address  string
+	pool     string
+	metadata map[string]string
 }
 
 func (n *fakeNode) Pool() string {
@@ -402,6 +443,10 @@ func (n *fakeNode) Address() string {
 	return n.address
 }
 
+func (n *fakeNode) Metadata() map[string]string {
+	return n.metadata
+}
+
 func (p *FakeProvisioner) ListNodes(addressFilter []string) ([]provision.Node, error) {
 	var result []provision.Node
 	if addressFilter != nil {
@@ -446,6 +491,14 @@ func (p *FakeProvisioner) Starts(app provision.App, process string) int {
 	return p.apps[app.GetName()].starts[process]
 }
 
+// LastDockerfile returns whether the last archive or upload deploy of the
+// given app was a Dockerfile deploy.
+func (p *FakeProvisioner) LastDockerfile(app provision.App) bool {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.apps[app.GetName()].lastDockerfile
+}
+
 // Stops returns the number of stops for a given app.
 func (p *FakeProvisioner) Stops(app provision.App, process string) int {
 	p.mut.RLock()
@@ -568,7 +621,7 @@ func (p *FakeProvisioner) Swap(app1, app2 provision.App, cnameOnly bool) error {
 	return routertest.FakeRouter.Swap(app1.GetName(), app2.GetName(), cnameOnly)
 }
 
-func (p *FakeProvisioner) ArchiveDeploy(app provision.App, archiveURL string, evt *event.Event) (string, error) {
+func (p *FakeProvisioner) ArchiveDeploy(app provision.App, archiveURL string, dockerfile bool, evt *event.Event) (string, error) {
 	if err := p.getError("ArchiveDeploy"); err != nil {
 		return "", err
 	}
@@ -580,11 +633,12 @@ func (p *FakeProvisioner) ArchiveDeploy(app provision.App, archiveURL string, ev
 	}
 	evt.Write([]byte("Archive deploy called"))
 	pApp.lastArchive = archiveURL
+	pApp.lastDockerfile = dockerfile
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
 }
 
-func (p *FakeProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, fileSize int64, build bool, evt *event.Event) (string, error) {
+func (p *FakeProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, fileSize int64, build, dockerfile bool, evt *event.Event) (string, error) {
 	if err := p.getError("UploadDeploy"); err != nil {
 		return "", err
 	}
@@ -596,6 +650,7 @@ func (p *FakeProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, fi
 	}
 	evt.Write([]byte("Upload deploy called"))
 	pApp.lastFile = file
+	pApp.lastDockerfile = dockerfile
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
 }
@@ -946,6 +1001,22 @@ func (p *FakeProvisioner) RoutableUnits(app provision.App) ([]provision.Unit, er
 	return p.apps[app.GetName()].units, nil
 }
 
+// SetPortRoutes sets the addresses of the ports exposed by the units of the
+// app, returned by RoutablePorts.
+func (p *FakeProvisioner) SetPortRoutes(app provision.App, routes map[router.PortRoute][]*url.URL) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	a := p.apps[app.GetName()]
+	a.portRoutes = routes
+	p.apps[app.GetName()] = a
+}
+
+func (p *FakeProvisioner) RoutablePorts(app provision.App) (map[router.PortRoute][]*url.URL, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.apps[app.GetName()].portRoutes, nil
+}
+
 func (p *FakeProvisioner) SetUnitStatus(unit provision.Unit, status provision.Status) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
@@ -1245,18 +1316,20 @@ func (p *ExtensibleFakeProvisioner) PlatformRemove(name string) error {
 }
 
 type provisionedApp struct {
-	units       []provision.Unit
-	app         provision.App
-	restarts    map[string]int
-	starts      map[string]int
-	stops       map[string]int
-	sleeps      map[string]int
-	lastArchive string
-	lastFile    io.ReadCloser
-	cnames      []string
-	unitLen     int
-	lastData    map[string]interface{}
-	image       string
+	units          []provision.Unit
+	app            provision.App
+	restarts       map[string]int
+	starts         map[string]int
+	stops          map[string]int
+	sleeps         map[string]int
+	lastArchive    string
+	lastFile       io.ReadCloser
+	lastDockerfile bool
+	portRoutes     map[router.PortRoute][]*url.URL
+	cnames         []string
+	unitLen        int
+	lastData       map[string]interface{}
+	image          string
 }
 
 type provisionedPlatform struct {
@@ -441,7 +441,7 @@ func (s *S) TestArchiveDeploy(c *check.C) {
 		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
 	})
 	c.Assert(err, check.IsNil)
-	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", evt)
+	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", false, evt)
 	c.Assert(err, check.IsNil)
 	err = evt.Done(nil)
 	c.Assert(err, check.IsNil)
@@ -449,6 +449,23 @@ func (s *S) TestArchiveDeploy(c *check.C) {
 	c.Assert(p.apps[app.GetName()].lastArchive, check.Equals, "https://s3.amazonaws.com/smt/archive.tar.gz")
 }
 
+func (s *S) TestArchiveDeployDockerfile(c *check.C) {
+	app := NewFakeApp("soul", "arch", 1)
+	p := NewFakeProvisioner()
+	err := p.Provision(app)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: app.name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(p.LastDockerfile(app), check.Equals, false)
+	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", true, evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.LastDockerfile(app), check.Equals, true)
+}
+
 func (s *S) TestArchiveDeployUnknownApp(c *check.C) {
 	app := NewFakeApp("soul", "arch", 1)
 	p := NewFakeProvisioner()
@@ -458,7 +475,7 @@ func (s *S) TestArchiveDeployUnknownApp(c *check.C) {
 		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
 	})
 	c.Assert(err, check.IsNil)
-	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", evt)
+	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", false, evt)
 	c.Assert(err, check.Equals, errNotProvisioned)
 }
 
@@ -474,7 +491,7 @@ func (s *S) TestArchiveDeployWithPreparedFailure(c *check.C) {
 	err = p.Provision(app)
 	c.Assert(err, check.IsNil)
 	p.PrepareFailure("ArchiveDeploy", errors.New("not really"))
-	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", evt)
+	_, err = p.ArchiveDeploy(app, "https://s3.amazonaws.com/smt/archive.tar.gz", false, evt)
 	c.Assert(err, check.ErrorMatches, "not really")
 }
 
@@ -491,7 +508,7 @@ func (s *S) TestUploadDeploy(c *check.C) {
 	p := NewFakeProvisioner()
 	err = p.Provision(app)
 	c.Assert(err, check.IsNil)
-	_, err = p.UploadDeploy(app, file, 0, false, evt)
+	_, err = p.UploadDeploy(app, file, 0, false, false, evt)
 	c.Assert(err, check.IsNil)
 	err = evt.Done(nil)
 	c.Assert(err, check.IsNil)
@@ -508,7 +525,7 @@ func (s *S) TestUploadDeployUnknownApp(c *check.C) {
 	})
 	c.Assert(err, check.IsNil)
 	p := NewFakeProvisioner()
-	_, err = p.UploadDeploy(app, nil, 0, false, evt)
+	_, err = p.UploadDeploy(app, nil, 0, false, false, evt)
 	c.Assert(err, check.Equals, errNotProvisioned)
 }
 
@@ -524,7 +541,7 @@ func (s *S) TestUploadDeployWithPreparedFailure(c *check.C) {
 	err = p.Provision(app)
 	c.Assert(err, check.IsNil)
 	p.PrepareFailure("UploadDeploy", errors.New("not really"))
-	_, err = p.UploadDeploy(app, nil, 0, false, evt)
+	_, err = p.UploadDeploy(app, nil, 0, false, false, evt)
 	c.Assert(err, check.ErrorMatches, "not really")
 }
 
@@ -113,7 +113,20 @@ func (r *fusisRouter) RemoveBackend(name string) error {
 	if err == fusisTypes.ErrServiceNotFound {
 		return router.ErrBackendNotFound
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	services, err := r.portServices(backendName)
+	if err != nil {
+		return err
+	}
+	for _, srv := range services {
+		err = r.client.DeleteService(srv.Name)
+		if err != nil && err != fusisTypes.ErrServiceNotFound {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *fusisRouter) routeName(name string, address *url.URL) string {
@@ -249,3 +262,101 @@ func (r *fusisRouter) Routes(name string) ([]*url.URL, error) {
 	}
 	return result, nil
 }
+
+func (r *fusisRouter) portServiceName(backendName string, port router.PortRoute) string {
+	return fmt.Sprintf("%s_%s_%d", backendName, port.Protocol, port.Port)
+}
+
+// portServices returns the services created for the ports of a backend, each
+// port of the backend is balanced by a service of its own.
+func (r *fusisRouter) portServices(backendName string) ([]*fusisTypes.Service, error) {
+	services, err := r.client.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	var result []*fusisTypes.Service
+	for _, srv := range services {
+		if srv.Name == r.portServiceName(backendName, router.PortRoute{Port: int(srv.Port), Protocol: srv.Protocol}) {
+			result = append(result, srv)
+		}
+	}
+	return result, nil
+}
+
+func (r *fusisRouter) AddPortRoutes(name string, port router.PortRoute, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	_, err = r.findService(name)
+	if err != nil {
+		return err
+	}
+	srvName := r.portServiceName(backendName, port)
+	srv := fusisTypes.Service{
+		Name:      srvName,
+		Port:      uint16(port.Port),
+		Protocol:  port.Protocol,
+		Scheduler: r.scheduler,
+	}
+	_, err = r.client.CreateService(srv)
+	if err != nil && err != fusisTypes.ErrServiceAlreadyExists {
+		return err
+	}
+	for _, addr := range addresses {
+		host, hostPort, err := net.SplitHostPort(addr.Host)
+		if err != nil {
+			return err
+		}
+		portInt, _ := strconv.ParseUint(hostPort, 10, 16)
+		dst := fusisTypes.Destination{
+			Name:      r.routeName(srvName, addr),
+			Host:      host,
+			Port:      uint16(portInt),
+			Mode:      r.mode,
+			ServiceId: srvName,
+		}
+		_, err = r.client.AddDestination(dst)
+		if err != nil && err != fusisTypes.ErrDestinationAlreadyExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fusisRouter) RemovePortRoutes(name string, port router.PortRoute, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	srvName := r.portServiceName(backendName, port)
+	for _, addr := range addresses {
+		err = r.client.DeleteDestination(srvName, r.routeName(srvName, addr))
+		if err != nil && err != fusisTypes.ErrDestinationNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fusisRouter) PortRoutes(name string) (map[router.PortRoute][]*url.URL, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	services, err := r.portServices(backendName)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[router.PortRoute][]*url.URL)
+	for _, srv := range services {
+		port := router.PortRoute{Port: int(srv.Port), Protocol: srv.Protocol}
+		for _, d := range srv.Destinations {
+			result[port] = append(result[port], &url.URL{
+				Scheme: srv.Protocol,
+				Host:   fmt.Sprintf("%s:%d", d.Host, d.Port),
+			})
+		}
+	}
+	return result, nil
+}
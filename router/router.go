@@ -115,6 +115,27 @@ type OptsRouter interface {
 	AddBackendOpts(name string, opts map[string]string) error
 }
 
+// PortRoute identifies a port exposed by the units of an app, besides the
+// HTTP one, using a transport protocol (tcp or udp).
+type PortRoute struct {
+	Port     int
+	Protocol string
+}
+
+func (p PortRoute) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// TCPRouter is implemented by layer 4 routers, able to forward raw TCP and UDP
+// traffic to the ports exposed by the units of an app.
+type TCPRouter interface {
+	AddPortRoutes(name string, port PortRoute, addresses []*url.URL) error
+	RemovePortRoutes(name string, port PortRoute, addresses []*url.URL) error
+
+	// PortRoutes returns the routes of each port of a backend.
+	PortRoutes(name string) (map[PortRoute][]*url.URL, error)
+}
+
 type HealthcheckData struct {
 	Path   string
 	Status int
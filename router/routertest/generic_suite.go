@@ -610,3 +610,65 @@ func (s *RouterSuite) TestSetHealthcheck(c *check.C) {
 	err = s.Router.RemoveBackend(testBackend1)
 	c.Assert(err, check.IsNil)
 }
+
+func (s *RouterSuite) TestAddRemovePortRoutes(c *check.C) {
+	tcpRouter, ok := s.Router.(router.TCPRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement TCPRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	mqtt := router.PortRoute{Port: 1883, Protocol: "tcp"}
+	dns := router.PortRoute{Port: 53, Protocol: "udp"}
+	addr1, err := url.Parse("tcp://10.10.10.10:30001")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("tcp://10.10.10.11:30002")
+	c.Assert(err, check.IsNil)
+	addr3, err := url.Parse("udp://10.10.10.10:30003")
+	c.Assert(err, check.IsNil)
+	err = tcpRouter.AddPortRoutes(testBackend1, mqtt, []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	err = tcpRouter.AddPortRoutes(testBackend1, mqtt, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = tcpRouter.AddPortRoutes(testBackend1, dns, []*url.URL{addr3})
+	c.Assert(err, check.IsNil)
+	routes, err := tcpRouter.PortRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	sort.Sort(URLList(routes[mqtt]))
+	c.Assert(routes[mqtt], HostEquals, []*url.URL{addr1, addr2})
+	c.Assert(routes[dns], HostEquals, []*url.URL{addr3})
+	httpRoutes, err := s.Router.Routes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(httpRoutes, check.HasLen, 0)
+	err = tcpRouter.RemovePortRoutes(testBackend1, mqtt, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	routes, err = tcpRouter.PortRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes[mqtt], HostEquals, []*url.URL{addr2})
+	c.Assert(routes[dns], HostEquals, []*url.URL{addr3})
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestRemoveBackendWithPortRoutes(c *check.C) {
+	tcpRouter, ok := s.Router.(router.TCPRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement TCPRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("tcp://10.10.10.10:30001")
+	c.Assert(err, check.IsNil)
+	err = tcpRouter.AddPortRoutes(testBackend1, router.PortRoute{Port: 1883, Protocol: "tcp"}, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	routes, err := tcpRouter.PortRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 0)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
@@ -33,7 +33,7 @@ func createHCRouter(name, prefix string) (router.Router, error) {
 }
 
 func newFakeRouter() fakeRouter {
-	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), mutex: &sync.Mutex{}}
+	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), ports: make(map[string]map[router.PortRoute][]string), mutex: &sync.Mutex{}}
 }
 
 type fakeRouter struct {
@@ -41,6 +41,7 @@ type fakeRouter struct {
 	cnames       map[string]string
 	failuresByIp map[string]bool
 	healthcheck  map[string]router.HealthcheckData
+	ports        map[string]map[router.PortRoute][]string
 	mutex        *sync.Mutex
 }
 
@@ -147,6 +148,7 @@ func (r *fakeRouter) RemoveBackend(name string) error {
 		}
 	}
 	delete(r.backends, backendName)
+	delete(r.ports, backendName)
 	return router.Remove(backendName)
 }
 
@@ -315,6 +317,7 @@ func (r *fakeRouter) Reset() {
 	r.failuresByIp = make(map[string]bool)
 	r.cnames = make(map[string]string)
 	r.healthcheck = make(map[string]router.HealthcheckData)
+	r.ports = make(map[string]map[router.PortRoute][]string)
 }
 
 func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
@@ -359,3 +362,98 @@ func (r *fakeRouter) SetHealthcheck(name string, data router.HealthcheckData) er
 	r.healthcheck[backendName] = data
 	return nil
 }
+
+func (r *fakeRouter) HasPortRoute(name string, port router.PortRoute, address string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	u, err := url.Parse(address)
+	if err == nil && u.Host != "" {
+		address = u.Host
+	}
+	for _, route := range r.ports[name][port] {
+		if route == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeRouter) AddPortRoutes(name string, port router.PortRoute, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, addr := range addresses {
+		if r.failuresByIp[addr.Host] {
+			return ErrForcedFailure
+		}
+	}
+	if r.ports[backendName] == nil {
+		r.ports[backendName] = make(map[router.PortRoute][]string)
+	}
+	routes := r.ports[backendName][port]
+addresses:
+	for _, addr := range addresses {
+		for i := range routes {
+			if routes[i] == addr.Host {
+				continue addresses
+			}
+		}
+		routes = append(routes, addr.Host)
+	}
+	r.ports[backendName][port] = routes
+	return nil
+}
+
+func (r *fakeRouter) RemovePortRoutes(name string, port router.PortRoute, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, addr := range addresses {
+		if r.failuresByIp[addr.Host] {
+			return ErrForcedFailure
+		}
+	}
+	routes := r.ports[backendName][port]
+	for _, addr := range addresses {
+		for i := range routes {
+			if routes[i] == addr.Host {
+				routes = append(routes[:i], routes[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(routes) == 0 {
+		delete(r.ports[backendName], port)
+	} else {
+		r.ports[backendName][port] = routes
+	}
+	return nil
+}
+
+func (r *fakeRouter) PortRoutes(name string) (map[router.PortRoute][]*url.URL, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make(map[router.PortRoute][]*url.URL)
+	for port, routes := range r.ports[backendName] {
+		for _, route := range routes {
+			result[port] = append(result[port], &url.URL{Scheme: port.Protocol, Host: route})
+		}
+	}
+	return result, nil
+}